@@ -0,0 +1,439 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ConditionRegistryConnected tells whether the operator can reach the
+	// service registry.
+	ConditionRegistryConnected string = "RegistryConnected"
+)
+
+// OperatorConfigSpec contains the settings of the operator.
+type OperatorConfigSpec struct {
+	// ClusterID uniquely identifies the cluster among all the ones whose
+	// operators share the same service registry. If empty or "auto", it is
+	// detected automatically.
+	// +optional
+	ClusterID string `json:"clusterID,omitempty"`
+	// WatchNamespacesByDefault specifies whether namespaces without the
+	// operator.cnwan.io/watch label must be watched.
+	// +optional
+	WatchNamespacesByDefault bool `json:"watchNamespacesByDefault,omitempty"`
+	// ServiceAnnotations is the list of annotations that are registered as
+	// metadata. Wildcards such as prefix/* or */name are supported.
+	// +optional
+	ServiceAnnotations []string `json:"serviceAnnotations,omitempty"`
+	// AnnotationRules select annotations and transform them into metadata,
+	// in addition to the ones in ServiceAnnotations.
+	// +optional
+	AnnotationRules []AnnotationRuleSpec `json:"annotationRules,omitempty"`
+	// NamespaceAnnotations is the list of annotations of namespaces that
+	// are inherited by the services inside them, unless they have their
+	// own.
+	// +optional
+	NamespaceAnnotations []string `json:"namespaceAnnotations,omitempty"`
+	// ServiceLabels is the list of labels that are registered as metadata.
+	// +optional
+	ServiceLabels []string `json:"serviceLabels,omitempty"`
+	// ServiceRegistry where services are registered.
+	ServiceRegistry ServiceRegistrySpec `json:"serviceRegistry"`
+	// +optional
+	DryRun *DryRunSpec `json:"dryRun,omitempty"`
+	// +optional
+	CloudMetadata *CloudMetadataSpec `json:"cloudMetadata,omitempty"`
+	// +optional
+	GarbageCollection *GarbageCollectionSpec `json:"garbageCollection,omitempty"`
+	// +optional
+	LeaderElection *LeaderElectionSpec `json:"leaderElection,omitempty"`
+	// +optional
+	Metrics *MetricsSpec `json:"metrics,omitempty"`
+	// +optional
+	NodePort *NodePortSpec `json:"nodePort,omitempty"`
+	// +optional
+	EndpointSlices *EndpointSlicesSpec `json:"endpointSlices,omitempty"`
+	// +optional
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+	// +optional
+	GatewayAPI *GatewayAPISpec `json:"gatewayAPI,omitempty"`
+	// EndpointNaming is how endpoints are named on the service registry:
+	// either after an hash of their address and port or after the name of
+	// their port and their address.
+	// +kubebuilder:validation:Enum=hashed;readable
+	// +kubebuilder:default=hashed
+	// +optional
+	EndpointNaming string `json:"endpointNaming,omitempty"`
+	// +optional
+	HostnameResolution *HostnameResolutionSpec `json:"hostnameResolution,omitempty"`
+	// IPFamilies are the IP families of the addresses that are registered.
+	// If empty, addresses of all families are registered.
+	// +optional
+	IPFamilies []IPFamily `json:"ipFamilies,omitempty"`
+	// MetadataPlacement is where metadata is registered on the service
+	// registry: either all on endpoints or on the namespaces, services and
+	// endpoints it refers to.
+	// +kubebuilder:validation:Enum=endpoints;hierarchical
+	// +kubebuilder:default=endpoints
+	// +optional
+	MetadataPlacement string `json:"metadataPlacement,omitempty"`
+}
+
+// IPFamily is the family of an IP address.
+// +kubebuilder:validation:Enum=IPv4;IPv6
+type IPFamily string
+
+// AnnotationRuleSpec selects annotations by key and transforms them into
+// metadata.
+type AnnotationRuleSpec struct {
+	// Key is the key of the annotation. Either this or KeyRegex must be
+	// set.
+	// +optional
+	Key string `json:"key,omitempty"`
+	// KeyRegex is a regular expression matching the keys of annotations.
+	// +optional
+	KeyRegex string `json:"keyRegex,omitempty"`
+	// Rename is the key of the metadata. With KeyRegex, it can reference
+	// the groups of the expression, e.g. cnwan.io/$1.
+	// +optional
+	Rename string `json:"rename,omitempty"`
+	// StripPrefix removes the prefix from the key of the metadata.
+	// +optional
+	StripPrefix bool `json:"stripPrefix,omitempty"`
+	// Default is the value of the metadata when the annotation is absent.
+	// It can only be set along with Key.
+	// +optional
+	Default string `json:"default,omitempty"`
+	// Values are the allowed values, matched regardless of case. If empty,
+	// all values are allowed.
+	// +optional
+	Values []string `json:"values,omitempty"`
+	// OnInvalidValue is what happens when the value is not one of Values:
+	// the annotation is either dropped or replaced with the default value.
+	// +kubebuilder:validation:Enum=drop;default
+	// +optional
+	OnInvalidValue string `json:"onInvalidValue,omitempty"`
+}
+
+// ServiceRegistrySpec contains the settings of the service registries. At
+// least one of its fields must be set, and objects are registered on all the
+// ones that are set.
+// +kubebuilder:validation:MinProperties=1
+type ServiceRegistrySpec struct {
+	// +optional
+	Etcd *EtcdSpec `json:"etcd,omitempty"`
+	// +optional
+	GCPServiceDirectory *ServiceDirectorySpec `json:"gcpServiceDirectory,omitempty"`
+	// +optional
+	AWSCloudMap *CloudMapSpec `json:"awsCloudMap,omitempty"`
+	// +optional
+	Consul *ConsulSpec `json:"consul,omitempty"`
+	// +optional
+	Kubernetes *KubernetesRegistrySpec `json:"kubernetes,omitempty"`
+	// +optional
+	DNS *DNSSpec `json:"dns,omitempty"`
+}
+
+// EtcdSpec contains the settings to connect to etcd.
+type EtcdSpec struct {
+	// Authentication method. Credentials and certificates are read from
+	// secrets in the namespace of the operator.
+	// +kubebuilder:validation:Enum="";WithUsernameAndPassword;WithTLS;WithTLSAndUsernameAndPassword
+	// +optional
+	Authentication string `json:"authentication,omitempty"`
+	// Prefix of all the keys read and written by the operator. No prefix is
+	// used if empty or /.
+	// +kubebuilder:validation:Pattern=`^/[^\s*]*$`
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// +kubebuilder:validation:MinItems=1
+	Endpoints []EtcdEndpointSpec `json:"endpoints"`
+}
+
+// EtcdEndpointSpec is the address of an etcd server.
+type EtcdEndpointSpec struct {
+	// +kubebuilder:validation:MinLength=1
+	Host string `json:"host"`
+	// +kubebuilder:default=2379
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+}
+
+// ServiceDirectorySpec contains the settings of Google Cloud Service
+// Directory. Empty values are detected automatically when running on GKE.
+type ServiceDirectorySpec struct {
+	// +optional
+	DefaultRegion string `json:"defaultRegion,omitempty"`
+	// +optional
+	ProjectID string `json:"projectID,omitempty"`
+}
+
+// CloudMapSpec contains the settings of AWS Cloud Map. Empty values are
+// detected automatically when running on EKS.
+type CloudMapSpec struct {
+	// +optional
+	DefaultRegion string `json:"defaultRegion,omitempty"`
+}
+
+// ConsulSpec contains the settings to connect to HashiCorp Consul.
+type ConsulSpec struct {
+	// Address of the Consul HTTP API, i.e. host and port.
+	// +kubebuilder:validation:MinLength=1
+	Address string `json:"address"`
+	// Datacenter where objects are registered. The one of the Consul agent
+	// that receives the requests is used if empty.
+	// +optional
+	Datacenter string `json:"datacenter,omitempty"`
+	// Authentication method. The ACL token is read from a secret in the
+	// namespace of the operator.
+	// +kubebuilder:validation:Enum="";WithACLToken
+	// +optional
+	Authentication string `json:"authentication,omitempty"`
+	// TLS specifies whether HTTPS must be used. Certificates are read from a
+	// secret in the namespace of the operator, if it exists.
+	// +optional
+	TLS bool `json:"tls,omitempty"`
+	// Node is the name of the external node where endpoints are registered.
+	// +kubebuilder:default="cnwan-operator"
+	// +optional
+	Node string `json:"node,omitempty"`
+	// Prefix of the keys where namespaces and services are stored in the
+	// Consul KV store.
+	// +kubebuilder:default="cnwan"
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// KubernetesRegistrySpec contains the settings to register objects as
+// custom resources on Kubernetes.
+type KubernetesRegistrySpec struct {
+	// Namespace where the custom resources are created.
+	// +kubebuilder:default="cnwan-registry"
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// KubeconfigSecret is the name of a secret in the namespace of the
+	// operator, with the kubeconfig of the cluster where the custom
+	// resources are created in its kubeconfig key. The cluster where the
+	// operator runs is used if empty.
+	// +optional
+	KubeconfigSecret string `json:"kubeconfigSecret,omitempty"`
+}
+
+// DNSSpec contains the settings to publish objects on an authoritative DNS
+// server with dynamic updates.
+type DNSSpec struct {
+	// Server is the address of the DNS server, i.e. host and port.
+	// +kubebuilder:validation:MinLength=1
+	Server string `json:"server"`
+	// Zone where records are published.
+	// +kubebuilder:validation:MinLength=1
+	Zone string `json:"zone"`
+	// TTL of the records, in seconds.
+	// +kubebuilder:default=60
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TTL int32 `json:"ttl,omitempty"`
+	// Authentication method. The TSIG key is read from a secret in the
+	// namespace of the operator.
+	// +kubebuilder:validation:Enum="";WithTSIG
+	// +optional
+	Authentication string `json:"authentication,omitempty"`
+	// TSIGAlgorithm is the algorithm used to sign updates.
+	// +kubebuilder:validation:Enum=hmac-sha1;hmac-sha224;hmac-sha256;hmac-sha384;hmac-sha512
+	// +kubebuilder:default="hmac-sha256"
+	// +optional
+	TSIGAlgorithm string `json:"tsigAlgorithm,omitempty"`
+}
+
+// CloudMetadataSpec contains the cloud metadata that must be registered on
+// all objects. Values can be set to "auto" to detect them automatically.
+type CloudMetadataSpec struct {
+	// +optional
+	Network *string `json:"network,omitempty"`
+	// +optional
+	SubNetwork *string `json:"subNetwork,omitempty"`
+}
+
+// DryRunSpec contains the service registries where the operations are only
+// reported, without being performed.
+type DryRunSpec struct {
+	// Registries are the names of the service registries in dry run, e.g.
+	// gcpServiceDirectory.
+	// +optional
+	Registries []string `json:"registries,omitempty"`
+	// Output is where operations are written as JSON lines, in addition to
+	// the logs: either stdout or the absolute path of a file.
+	// +optional
+	Output string `json:"output,omitempty"`
+}
+
+// GarbageCollectionSpec contains the settings about the removal of orphan
+// objects from the service registry.
+type GarbageCollectionSpec struct {
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// LeaderElectionSpec contains the settings about the election of a leader
+// among the replicas of the operator.
+type LeaderElectionSpec struct {
+	// +kubebuilder:default=true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// +optional
+	Name string `json:"name,omitempty"`
+	// +optional
+	LeaseDuration *metav1.Duration `json:"leaseDuration,omitempty"`
+	// +optional
+	RenewDeadline *metav1.Duration `json:"renewDeadline,omitempty"`
+	// +optional
+	RetryPeriod *metav1.Duration `json:"retryPeriod,omitempty"`
+}
+
+// MetricsSpec contains the settings about metrics.
+type MetricsSpec struct {
+	// BindAddress where metrics are served, or 0 to disable them.
+	// +optional
+	BindAddress string `json:"bindAddress,omitempty"`
+}
+
+// NodePortSpec contains the settings about the registration of NodePort
+// services.
+type NodePortSpec struct {
+	// Enabled specifies whether NodePort services must be registered, with
+	// the addresses of the ready nodes.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// AddressType is the type of node address to register.
+	// +kubebuilder:validation:Enum=InternalIP;ExternalIP
+	// +kubebuilder:default=InternalIP
+	// +optional
+	AddressType string `json:"addressType,omitempty"`
+}
+
+// EndpointSlicesSpec contains the settings about the registration of
+// ClusterIP services with the addresses of their pods.
+type EndpointSlicesSpec struct {
+	// Enabled specifies whether ClusterIP services, including headless
+	// ones, must be registered with the addresses of their ready pods.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// IngressSpec contains the settings about the registration of ingresses.
+type IngressSpec struct {
+	// Enabled specifies whether ingresses must be registered, each one as
+	// a service with the addresses of its load balancer.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// GatewayAPISpec contains the settings about the registration of Gateway API
+// gateways and routes.
+type GatewayAPISpec struct {
+	// Enabled specifies whether gateways must be registered, each one as a
+	// service with its addresses and the ports of its listeners.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// HTTPRoutes specifies whether HTTP routes attached to the gateways
+	// must be registered as well.
+	// +optional
+	HTTPRoutes bool `json:"httpRoutes,omitempty"`
+}
+
+// HostnameResolutionSpec contains the settings about the resolution of the
+// hostnames of load balancers.
+type HostnameResolutionSpec struct {
+	// Nameserver is the IP -- with an optional port -- of the DNS server
+	// used to resolve hostnames. If empty, the nameservers in
+	// /etc/resolv.conf are used.
+	// +optional
+	Nameserver string `json:"nameserver,omitempty"`
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// RegisterHostnames specifies whether hostnames must be registered as
+	// they are, rather than with their IPs. Only etcd and DNS support this.
+	// +optional
+	RegisterHostnames bool `json:"registerHostnames,omitempty"`
+}
+
+// OperatorConfigStatus contains the settings as resolved by the operator and
+// the state of its connection to the service registry.
+type OperatorConfigStatus struct {
+	// ObservedGeneration is the generation of the spec that the operator
+	// is currently using.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ClusterID in use, including when detected automatically.
+	// +optional
+	ClusterID string `json:"clusterID,omitempty"`
+	// ServiceRegistry in use, i.e. etcd, gcpServiceDirectory, awsCloudMap,
+	// consul, kubernetes or dns. Multiple service registries are separated
+	// by commas.
+	// +optional
+	ServiceRegistry string `json:"serviceRegistry,omitempty"`
+	// +optional
+	ProjectID string `json:"projectID,omitempty"`
+	// +optional
+	Region string `json:"region,omitempty"`
+	// +optional
+	Network string `json:"network,omitempty"`
+	// +optional
+	SubNetwork string `json:"subNetwork,omitempty"`
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// OperatorConfig contains the settings of the operator. The operator reads
+// the one named cnwan-operator in its own namespace.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=opcfg
+// +kubebuilder:printcolumn:name="Registry",type=string,JSONPath=`.status.serviceRegistry`
+// +kubebuilder:printcolumn:name="Connected",type=string,JSONPath=`.status.conditions[?(@.type=="RegistryConnected")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type OperatorConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   OperatorConfigSpec   `json:"spec,omitempty"`
+	Status OperatorConfigStatus `json:"status,omitempty"`
+}
+
+// OperatorConfigList contains a list of OperatorConfig.
+// +kubebuilder:object:root=true
+type OperatorConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OperatorConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OperatorConfig{}, &OperatorConfigList{})
+}
@@ -0,0 +1,148 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// RegisteredNamespaceLabel is the label with the name of the namespace
+	// that a RegisteredService or RegisteredEndpoint belongs to.
+	RegisteredNamespaceLabel string = "operator.cnwan.io/namespace"
+	// RegisteredServiceLabel is the label with the name of the service that
+	// a RegisteredEndpoint belongs to.
+	RegisteredServiceLabel string = "operator.cnwan.io/service"
+)
+
+// RegisteredNamespaceSpec is a namespace on the service registry.
+type RegisteredNamespaceSpec struct {
+	// Name of the namespace.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// +optional
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// RegisteredServiceSpec is a service on the service registry.
+type RegisteredServiceSpec struct {
+	// Namespace of the service.
+	// +kubebuilder:validation:MinLength=1
+	Namespace string `json:"namespace"`
+	// Name of the service.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// +optional
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// RegisteredEndpointSpec is an endpoint on the service registry.
+type RegisteredEndpointSpec struct {
+	// Namespace of the endpoint.
+	// +kubebuilder:validation:MinLength=1
+	Namespace string `json:"namespace"`
+	// Service of the endpoint.
+	// +kubebuilder:validation:MinLength=1
+	Service string `json:"service"`
+	// Name of the endpoint.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// +optional
+	Address string `json:"address,omitempty"`
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// +optional
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// RegisteredNamespace is a namespace registered by the operator when using
+// Kubernetes as the service registry. It is named after the namespace.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=regns
+// +kubebuilder:printcolumn:name="Namespace",type=string,JSONPath=`.spec.name`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type RegisteredNamespace struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec RegisteredNamespaceSpec `json:"spec,omitempty"`
+}
+
+// RegisteredNamespaceList contains a list of RegisteredNamespace.
+// +kubebuilder:object:root=true
+type RegisteredNamespaceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RegisteredNamespace `json:"items"`
+}
+
+// RegisteredService is a service registered by the operator when using
+// Kubernetes as the service registry. It is named <namespace>.<service>.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=regsvc
+// +kubebuilder:printcolumn:name="Namespace",type=string,JSONPath=`.spec.namespace`
+// +kubebuilder:printcolumn:name="Service",type=string,JSONPath=`.spec.name`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type RegisteredService struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec RegisteredServiceSpec `json:"spec,omitempty"`
+}
+
+// RegisteredServiceList contains a list of RegisteredService.
+// +kubebuilder:object:root=true
+type RegisteredServiceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RegisteredService `json:"items"`
+}
+
+// RegisteredEndpoint is an endpoint registered by the operator when using
+// Kubernetes as the service registry. It is named
+// <namespace>.<service>.<endpoint>.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=regep
+// +kubebuilder:printcolumn:name="Namespace",type=string,JSONPath=`.spec.namespace`
+// +kubebuilder:printcolumn:name="Service",type=string,JSONPath=`.spec.service`
+// +kubebuilder:printcolumn:name="Address",type=string,JSONPath=`.spec.address`
+// +kubebuilder:printcolumn:name="Port",type=integer,JSONPath=`.spec.port`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type RegisteredEndpoint struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec RegisteredEndpointSpec `json:"spec,omitempty"`
+}
+
+// RegisteredEndpointList contains a list of RegisteredEndpoint.
+// +kubebuilder:object:root=true
+type RegisteredEndpointList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RegisteredEndpoint `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(
+		&RegisteredNamespace{}, &RegisteredNamespaceList{},
+		&RegisteredService{}, &RegisteredServiceList{},
+		&RegisteredEndpoint{}, &RegisteredEndpointList{},
+	)
+}
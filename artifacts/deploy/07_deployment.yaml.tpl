@@ -11,7 +11,7 @@ metadata:
     control-plane: controller-manager
     cnwan.io/application: operator
 spec:
-  replicas: 1
+  replicas: 2
   selector:
     matchLabels:
       control-plane: controller-manager
@@ -21,6 +21,9 @@ spec:
       labels:
         control-plane: controller-manager
         cnwan.io/application: operator
+      annotations:
+        prometheus.io/scrape: "true"
+        prometheus.io/port: "8080"
     spec:
       containers:
         - name: manager
@@ -33,6 +36,25 @@ spec:
               cpu: 100m
               memory: 20Mi
           imagePullPolicy: Always
+          ports:
+          - name: metrics
+            containerPort: 8080
+            protocol: TCP
+          - name: probes
+            containerPort: 8081
+            protocol: TCP
+          livenessProbe:
+            httpGet:
+              path: /healthz
+              port: probes
+            initialDelaySeconds: 15
+            periodSeconds: 20
+          readinessProbe:
+            httpGet:
+              path: /readyz
+              port: probes
+            initialDelaySeconds: 5
+            periodSeconds: 10
           env:
           - name: CNWAN_OPERATOR_NAMESPACE
             valueFrom:
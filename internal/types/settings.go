@@ -18,25 +18,95 @@
 
 package types
 
+import "time"
+
 // Settings of the application
 type Settings struct {
+	// ClusterID uniquely identifies the cluster among all the ones whose
+	// operators share the same service registry. If empty or "auto", it is
+	// detected automatically.
+	ClusterID                string          `yaml:"clusterID"`
 	WatchNamespacesByDefault bool            `yaml:"watchNamespacesByDefault"`
 	Service                  ServiceSettings `yaml:",inline"`
 	*ServiceRegistrySettings `yaml:"serviceRegistry"`
-	CloudMetadata            *CloudMetadata `yaml:"cloudMetadata"`
+	DryRun                   *DryRunSettings            `yaml:"dryRun"`
+	CloudMetadata            *CloudMetadata             `yaml:"cloudMetadata"`
+	GarbageCollection        *GarbageCollectionSettings `yaml:"garbageCollection"`
+	LeaderElection           *LeaderElectionSettings    `yaml:"leaderElection"`
+	Metrics                  *MetricsSettings           `yaml:"metrics"`
+	NodePort                 *NodePortSettings          `yaml:"nodePort"`
+	EndpointSlices           *EndpointSlicesSettings    `yaml:"endpointSlices"`
+	Ingress                  *IngressSettings           `yaml:"ingress"`
+	GatewayAPI               *GatewayAPISettings        `yaml:"gatewayAPI"`
+	// EndpointNaming is how endpoints are named on the service registry.
+	// Defaults to EndpointNamingHashed.
+	EndpointNaming     EndpointNaming              `yaml:"endpointNaming"`
+	HostnameResolution *HostnameResolutionSettings `yaml:"hostnameResolution"`
+	// IPFamilies are the IP families of the addresses that are registered.
+	// If empty, addresses of all families are registered.
+	IPFamilies []IPFamily `yaml:"ipFamilies"`
+	// MetadataPlacement is where metadata is registered on the service
+	// registry. Defaults to MetadataPlacementEndpoints.
+	MetadataPlacement MetadataPlacement `yaml:"metadataPlacement"`
 }
 
 // ServiceSettings includes settings about services
 type ServiceSettings struct {
 	Annotations []string `yaml:"serviceAnnotations"`
+	// AnnotationRules select annotations and transform them into metadata,
+	// in addition to the ones in Annotations.
+	AnnotationRules []AnnotationRule `yaml:"annotationRules"`
+	// NamespaceAnnotations are the annotations of namespaces that are
+	// inherited by the services inside them, unless they have their own.
+	NamespaceAnnotations []string `yaml:"namespaceAnnotations"`
+	// Labels are the labels of services that are registered as metadata.
+	Labels []string `yaml:"serviceLabels"`
+}
+
+// AnnotationRule selects annotations by key and transforms them into
+// metadata.
+type AnnotationRule struct {
+	// Key is the key of the annotation. Either this or KeyRegex must be
+	// set.
+	Key string `yaml:"key"`
+	// KeyRegex is a regular expression matching the keys of annotations.
+	KeyRegex string `yaml:"keyRegex"`
+	// Rename is the key of the metadata. With KeyRegex, it can reference
+	// the groups of the expression, e.g. cnwan.io/$1.
+	Rename string `yaml:"rename"`
+	// StripPrefix removes the prefix from the key of the metadata, e.g.
+	// example.com/profile becomes profile.
+	StripPrefix bool `yaml:"stripPrefix"`
+	// Default is the value of the metadata when the annotation is absent.
+	// It can only be set along with Key.
+	Default string `yaml:"default"`
+	// Values are the allowed values, matched regardless of case and
+	// surrounding spaces. If empty, all values are allowed.
+	Values []string `yaml:"values"`
+	// OnInvalidValue is what happens when the value is not one of Values.
+	// Defaults to InvalidValueDrop.
+	OnInvalidValue InvalidValueAction `yaml:"onInvalidValue"`
 }
 
+// InvalidValueAction is what happens to annotations with invalid values.
+type InvalidValueAction string
+
+const (
+	// InvalidValueDrop drops the annotation.
+	InvalidValueDrop InvalidValueAction = "drop"
+	// InvalidValueDefault replaces the value with the default one.
+	InvalidValueDefault InvalidValueAction = "default"
+)
+
 // ServiceRegistrySettings contains information about the service registry
 // that must be used, i.e. etcd or service directory.
 type ServiceRegistrySettings struct {
 	*ServiceDirectorySettings `yaml:"gcpServiceDirectory"`
 	*EtcdSettings             `yaml:"etcd"`
 	*CloudMapSettings         `yaml:"awsCloudMap"`
+	*ConsulSettings           `yaml:"consul"`
+	*KubernetesSettings       `yaml:"kubernetes"`
+	*DNSSettings              `yaml:"dns"`
 }
 
 // ServiceDirectorySettings holds settings about gcloud service directory
@@ -62,6 +132,9 @@ const (
 	EtcdAuthWithUsernamePassw EtcdAuthenticationType = "WithUsernameAndPassword"
 	// EtcdAuthWithTLS specifies that authentication must be done with TLS.
 	EtcdAuthWithTLS EtcdAuthenticationType = "WithTLS"
+	// EtcdAuthWithTLSAndUsernamePassw specifies that authentication must be
+	// done with TLS and with username and password.
+	EtcdAuthWithTLSAndUsernamePassw EtcdAuthenticationType = "WithTLSAndUsernameAndPassword"
 )
 
 // EtcdSettings holds settings about etcd
@@ -79,6 +152,73 @@ type EtcdEndpoint struct {
 	Port *int   `yaml:"port"`
 }
 
+// ConsulAuthenticationType specifies how the cnwan operator must authenticate
+// to Consul.
+type ConsulAuthenticationType string
+
+const (
+	// ConsulAuthWithNothing specifies that no authentication must be
+	// performed.
+	ConsulAuthWithNothing ConsulAuthenticationType = ""
+	// ConsulAuthWithACLToken specifies that requests must be authenticated
+	// with an ACL token.
+	ConsulAuthWithACLToken ConsulAuthenticationType = "WithACLToken"
+)
+
+// ConsulSettings holds settings about HashiCorp Consul.
+type ConsulSettings struct {
+	// Address of the Consul HTTP API, i.e. host and port.
+	Address string `yaml:"address"`
+	// Datacenter where objects are registered. The one of the Consul agent
+	// that receives the requests is used if empty.
+	Datacenter     string                   `yaml:"datacenter,omitempty"`
+	Authentication ConsulAuthenticationType `yaml:"authentication,omitempty"`
+	// TLS specifies whether HTTPS must be used to connect to Consul.
+	TLS bool `yaml:"tls,omitempty"`
+	// Node is the name of the external node where endpoints are registered.
+	Node string `yaml:"node,omitempty"`
+	// Prefix of the keys where namespaces and services are stored in the
+	// Consul KV store.
+	Prefix string `yaml:"prefix,omitempty"`
+}
+
+// KubernetesSettings holds settings about registering objects as custom
+// resources on Kubernetes.
+type KubernetesSettings struct {
+	// Namespace where the custom resources are created.
+	Namespace string `yaml:"namespace,omitempty"`
+	// KubeconfigSecret is the name of the secret with the kubeconfig of the
+	// cluster where the custom resources are created. The cluster where the
+	// operator runs is used if empty.
+	KubeconfigSecret string `yaml:"kubeconfigSecret,omitempty"`
+}
+
+// DNSAuthenticationType specifies how the cnwan operator must authenticate
+// the updates sent to the DNS server.
+type DNSAuthenticationType string
+
+const (
+	// DNSAuthWithNothing specifies that updates must not be signed.
+	DNSAuthWithNothing DNSAuthenticationType = ""
+	// DNSAuthWithTSIG specifies that updates must be signed with TSIG.
+	DNSAuthWithTSIG DNSAuthenticationType = "WithTSIG"
+)
+
+// DNSSettings holds settings about publishing objects on an authoritative
+// DNS server with dynamic updates.
+type DNSSettings struct {
+	// Server is the address of the DNS server, i.e. host and port.
+	Server string `yaml:"server"`
+	// Zone where records are published.
+	Zone string `yaml:"zone"`
+	// TTL of the records, in seconds.
+	TTL            uint32                `yaml:"ttl,omitempty"`
+	Authentication DNSAuthenticationType `yaml:"authentication,omitempty"`
+	// TSIGAlgorithm is the algorithm used to sign updates, e.g.
+	// hmac-sha256.
+	TSIGAlgorithm string `yaml:"tsigAlgorithm,omitempty"`
+}
+
 // CloudMetadata contains data and configuration about the cloud provider
 // that is hosting the cluster, if any.
 type CloudMetadata struct {
@@ -94,3 +234,156 @@ type CloudMapSettings struct {
 	DefaultRegion string `yaml:"defaultRegion"`
 	// TODO: support a different profile?
 }
+
+// DryRunOutputStdout is the DryRunSettings output that writes operations to
+// the standard output.
+const DryRunOutputStdout string = "stdout"
+
+// DryRunSettings contains the service registries where objects are not
+// registered or deregistered: the operations that would be performed are
+// only reported instead.
+type DryRunSettings struct {
+	// Registries are the names of the service registries in dry run, i.e.
+	// the ones used under serviceRegistry, e.g. gcpServiceDirectory.
+	Registries []string `yaml:"registries"`
+	// Output is where operations are written as JSON lines, in addition to
+	// the logs: either DryRunOutputStdout or the absolute path of a file.
+	// If empty, operations are only logged.
+	Output string `yaml:"output"`
+}
+
+// GarbageCollectionSettings contains settings about the removal of objects
+// that the operator registered on the service registry but that do not exist
+// in the cluster anymore.
+type GarbageCollectionSettings struct {
+	// Interval between two consecutive sweeps, e.g. 30m. A sweep is always
+	// performed at startup as well.
+	Interval time.Duration `yaml:"interval"`
+	// DryRun only reports the objects that would be removed, without
+	// actually removing them.
+	DryRun bool `yaml:"dryRun"`
+}
+
+// LeaderElectionSettings contains settings about the election of a leader
+// among the replicas of the operator: only the leader performs operations on
+// the service registry.
+type LeaderElectionSettings struct {
+	// Enabled specifies whether leader election must be performed. Defaults
+	// to true.
+	Enabled *bool `yaml:"enabled"`
+	// Namespace where the lease is created. Defaults to the namespace where
+	// the operator is running.
+	Namespace string `yaml:"namespace"`
+	// Name of the lease.
+	Name string `yaml:"name"`
+	// LeaseDuration is the time that non-leader replicas wait before trying
+	// to acquire the lease after it was last renewed.
+	LeaseDuration time.Duration `yaml:"leaseDuration"`
+	// RenewDeadline is the time that the leader keeps trying to renew the
+	// lease before giving up leadership.
+	RenewDeadline time.Duration `yaml:"renewDeadline"`
+	// RetryPeriod is the time that replicas wait between two attempts.
+	RetryPeriod time.Duration `yaml:"retryPeriod"`
+}
+
+// MetricsSettings contains settings about the Prometheus metrics exposed by
+// the operator.
+type MetricsSettings struct {
+	// BindAddress is the address where metrics are served, e.g. :8080. Set
+	// it to 0 to disable metrics.
+	BindAddress string `yaml:"bindAddress"`
+}
+
+type NodeAddressType string
+
+const (
+	// NodeInternalIP specifies that the internal IPs of the nodes must be
+	// used.
+	NodeInternalIP NodeAddressType = "InternalIP"
+	// NodeExternalIP specifies that the external IPs of the nodes must be
+	// used.
+	NodeExternalIP NodeAddressType = "ExternalIP"
+)
+
+type NodePortSettings struct {
+	// Enabled specifies whether NodePort services must be registered, with
+	// the addresses of the ready nodes. Defaults to false.
+	Enabled bool `yaml:"enabled"`
+	// AddressType is the type of node address to register. Defaults to
+	// InternalIP.
+	AddressType NodeAddressType `yaml:"addressType"`
+}
+
+type EndpointSlicesSettings struct {
+	// Enabled specifies whether ClusterIP services, including headless
+	// ones, must be registered with the addresses of their ready pods, as
+	// found in their endpoint slices. Defaults to false.
+	Enabled bool `yaml:"enabled"`
+}
+
+type IngressSettings struct {
+	// Enabled specifies whether ingresses must be registered, each one as a
+	// service with the addresses of its load balancer. Defaults to false.
+	Enabled bool `yaml:"enabled"`
+}
+
+type GatewayAPISettings struct {
+	// Enabled specifies whether Gateway API gateways must be registered,
+	// each one as a service with its addresses and the ports of its
+	// listeners. Defaults to false.
+	Enabled bool `yaml:"enabled"`
+	// HTTPRoutes specifies whether HTTP routes must be registered as well,
+	// each one with the addresses and ports of the gateways it is attached
+	// to. It is only taken into account if Enabled is true. Defaults to
+	// false.
+	HTTPRoutes bool `yaml:"httpRoutes"`
+}
+
+// EndpointNaming specifies how endpoints are named on the service registry.
+type EndpointNaming string
+
+const (
+	// EndpointNamingHashed names endpoints after their service and an hash
+	// of their address and port.
+	EndpointNamingHashed EndpointNaming = "hashed"
+	// EndpointNamingReadable names endpoints after their service, the name
+	// of their port and their address.
+	EndpointNamingReadable EndpointNaming = "readable"
+)
+
+// MetadataPlacement specifies where metadata is registered on the service
+// registry.
+type MetadataPlacement string
+
+const (
+	// MetadataPlacementEndpoints registers all metadata on endpoints.
+	MetadataPlacementEndpoints MetadataPlacement = "endpoints"
+	// MetadataPlacementHierarchical registers the metadata of objects on
+	// their services, the one inherited from namespaces on the namespaces
+	// and only the one specific to endpoints on the endpoints.
+	MetadataPlacementHierarchical MetadataPlacement = "hierarchical"
+)
+
+type HostnameResolutionSettings struct {
+	// Nameserver is the IP -- with an optional port -- of the DNS server
+	// used to resolve hostnames. If empty, the nameservers in
+	// /etc/resolv.conf are used.
+	Nameserver string `yaml:"nameserver"`
+	// Interval is the maximum time after which hostnames are resolved
+	// again, if the TTL of their records does not expire before. Defaults
+	// to one minute.
+	Interval time.Duration `yaml:"interval"`
+	// Timeout is the timeout of each resolution. Defaults to five seconds.
+	Timeout time.Duration `yaml:"timeout"`
+	// RegisterHostnames specifies whether hostnames must be registered as
+	// they are, rather than with their IPs. Only etcd and DNS support this.
+	RegisterHostnames bool `yaml:"registerHostnames"`
+}
+
+// IPFamily is the family of an IP address.
+type IPFamily string
+
+const (
+	IPv4Family IPFamily = "IPv4"
+	IPv6Family IPFamily = "IPv6"
+)
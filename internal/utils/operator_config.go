@@ -0,0 +1,209 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package utils
+
+import (
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/api/v1alpha1"
+	"github.com/CloudNativeSDWAN/cnwan-operator/internal/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SettingsFromOperatorConfig converts the spec of an OperatorConfig to the
+// settings format used by the operator, so that they can be parsed and
+// validated with ParseAndValidateSettings like the ones from the config map.
+func SettingsFromOperatorConfig(spec *v1alpha1.OperatorConfigSpec) *types.Settings {
+	if spec == nil {
+		return nil
+	}
+
+	settings := &types.Settings{
+		ClusterID:                spec.ClusterID,
+		WatchNamespacesByDefault: spec.WatchNamespacesByDefault,
+		Service: types.ServiceSettings{
+			Annotations:          append([]string{}, spec.ServiceAnnotations...),
+			NamespaceAnnotations: append([]string{}, spec.NamespaceAnnotations...),
+			Labels:               append([]string{}, spec.ServiceLabels...),
+		},
+		ServiceRegistrySettings: &types.ServiceRegistrySettings{},
+	}
+
+	for _, rule := range spec.AnnotationRules {
+		settings.Service.AnnotationRules = append(settings.Service.AnnotationRules, types.AnnotationRule{
+			Key:            rule.Key,
+			KeyRegex:       rule.KeyRegex,
+			Rename:         rule.Rename,
+			StripPrefix:    rule.StripPrefix,
+			Default:        rule.Default,
+			Values:         append([]string{}, rule.Values...),
+			OnInvalidValue: types.InvalidValueAction(rule.OnInvalidValue),
+		})
+	}
+
+	if etcd := spec.ServiceRegistry.Etcd; etcd != nil {
+		etcdSettings := &types.EtcdSettings{
+			Authentication: types.EtcdAuthenticationType(etcd.Authentication),
+			Endpoints:      []*types.EtcdEndpoint{},
+		}
+		if etcd.Prefix != "" {
+			prefix := etcd.Prefix
+			etcdSettings.Prefix = &prefix
+		}
+		for _, endp := range etcd.Endpoints {
+			etcdEndp := &types.EtcdEndpoint{Host: endp.Host}
+			if endp.Port > 0 {
+				port := int(endp.Port)
+				etcdEndp.Port = &port
+			}
+			etcdSettings.Endpoints = append(etcdSettings.Endpoints, etcdEndp)
+		}
+		settings.EtcdSettings = etcdSettings
+	}
+
+	if sd := spec.ServiceRegistry.GCPServiceDirectory; sd != nil {
+		settings.ServiceDirectorySettings = &types.ServiceDirectorySettings{
+			DefaultRegion: sd.DefaultRegion,
+			ProjectID:     sd.ProjectID,
+		}
+	}
+
+	if cm := spec.ServiceRegistry.AWSCloudMap; cm != nil {
+		settings.CloudMapSettings = &types.CloudMapSettings{
+			DefaultRegion: cm.DefaultRegion,
+		}
+	}
+
+	if consul := spec.ServiceRegistry.Consul; consul != nil {
+		settings.ConsulSettings = &types.ConsulSettings{
+			Address:        consul.Address,
+			Datacenter:     consul.Datacenter,
+			Authentication: types.ConsulAuthenticationType(consul.Authentication),
+			TLS:            consul.TLS,
+			Node:           consul.Node,
+			Prefix:         consul.Prefix,
+		}
+	}
+
+	if k8s := spec.ServiceRegistry.Kubernetes; k8s != nil {
+		settings.KubernetesSettings = &types.KubernetesSettings{
+			Namespace:        k8s.Namespace,
+			KubeconfigSecret: k8s.KubeconfigSecret,
+		}
+	}
+
+	if dnsSpec := spec.ServiceRegistry.DNS; dnsSpec != nil {
+		settings.DNSSettings = &types.DNSSettings{
+			Server:         dnsSpec.Server,
+			Zone:           dnsSpec.Zone,
+			TTL:            uint32(dnsSpec.TTL),
+			Authentication: types.DNSAuthenticationType(dnsSpec.Authentication),
+			TSIGAlgorithm:  dnsSpec.TSIGAlgorithm,
+		}
+	}
+
+	if dryRun := spec.DryRun; dryRun != nil {
+		settings.DryRun = &types.DryRunSettings{
+			Registries: dryRun.Registries,
+			Output:     dryRun.Output,
+		}
+	}
+
+	if cloudMeta := spec.CloudMetadata; cloudMeta != nil {
+		settings.CloudMetadata = &types.CloudMetadata{
+			Network:    cloudMeta.Network,
+			SubNetwork: cloudMeta.SubNetwork,
+		}
+	}
+
+	if gc := spec.GarbageCollection; gc != nil {
+		settings.GarbageCollection = &types.GarbageCollectionSettings{
+			Interval: durationOrZero(gc.Interval),
+			DryRun:   gc.DryRun,
+		}
+	}
+
+	if le := spec.LeaderElection; le != nil {
+		settings.LeaderElection = &types.LeaderElectionSettings{
+			Enabled:       le.Enabled,
+			Namespace:     le.Namespace,
+			Name:          le.Name,
+			LeaseDuration: durationOrZero(le.LeaseDuration),
+			RenewDeadline: durationOrZero(le.RenewDeadline),
+			RetryPeriod:   durationOrZero(le.RetryPeriod),
+		}
+	}
+
+	if metrics := spec.Metrics; metrics != nil {
+		settings.Metrics = &types.MetricsSettings{
+			BindAddress: metrics.BindAddress,
+		}
+	}
+
+	if np := spec.NodePort; np != nil {
+		settings.NodePort = &types.NodePortSettings{
+			Enabled:     np.Enabled,
+			AddressType: types.NodeAddressType(np.AddressType),
+		}
+	}
+
+	if es := spec.EndpointSlices; es != nil {
+		settings.EndpointSlices = &types.EndpointSlicesSettings{
+			Enabled: es.Enabled,
+		}
+	}
+
+	if ing := spec.Ingress; ing != nil {
+		settings.Ingress = &types.IngressSettings{
+			Enabled: ing.Enabled,
+		}
+	}
+
+	settings.EndpointNaming = types.EndpointNaming(spec.EndpointNaming)
+	settings.MetadataPlacement = types.MetadataPlacement(spec.MetadataPlacement)
+	for _, family := range spec.IPFamilies {
+		settings.IPFamilies = append(settings.IPFamilies, types.IPFamily(family))
+	}
+
+	if hr := spec.HostnameResolution; hr != nil {
+		settings.HostnameResolution = &types.HostnameResolutionSettings{
+			Nameserver:        hr.Nameserver,
+			Interval:          durationOrZero(hr.Interval),
+			Timeout:           durationOrZero(hr.Timeout),
+			RegisterHostnames: hr.RegisterHostnames,
+		}
+	}
+
+	if gw := spec.GatewayAPI; gw != nil {
+		settings.GatewayAPI = &types.GatewayAPISettings{
+			Enabled:    gw.Enabled,
+			HTTPRoutes: gw.HTTPRoutes,
+		}
+	}
+
+	return settings
+}
+
+func durationOrZero(d *metav1.Duration) time.Duration {
+	if d == nil {
+		return 0
+	}
+
+	return d.Duration
+}
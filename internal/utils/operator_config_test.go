@@ -0,0 +1,285 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package utils
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/api/v1alpha1"
+	"github.com/CloudNativeSDWAN/cnwan-operator/internal/types"
+	. "github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSettingsFromOperatorConfig(t *testing.T) {
+	a := New(t)
+	prefix := "/prefix"
+	port := 2380
+	auto := "auto"
+	yes := true
+	cases := []struct {
+		id     string
+		arg    *v1alpha1.OperatorConfigSpec
+		expRes *types.Settings
+	}{
+		{
+			id: "nil",
+		},
+		{
+			id: "etcd",
+			arg: &v1alpha1.OperatorConfigSpec{
+				ClusterID:                "cluster-1",
+				WatchNamespacesByDefault: true,
+				ServiceAnnotations:       []string{"cnwan.io/*"},
+				NamespaceAnnotations:     []string{"cnwan.io/team"},
+				ServiceLabels:            []string{"app.kubernetes.io/name"},
+				ServiceRegistry: v1alpha1.ServiceRegistrySpec{
+					Etcd: &v1alpha1.EtcdSpec{
+						Authentication: "WithTLS",
+						Prefix:         prefix,
+						Endpoints: []v1alpha1.EtcdEndpointSpec{
+							{Host: "10.10.10.10", Port: 2380},
+							{Host: "10.10.10.11"},
+						},
+					},
+				},
+			},
+			expRes: &types.Settings{
+				ClusterID:                "cluster-1",
+				WatchNamespacesByDefault: true,
+				Service: types.ServiceSettings{
+					Annotations:          []string{"cnwan.io/*"},
+					NamespaceAnnotations: []string{"cnwan.io/team"},
+					Labels:               []string{"app.kubernetes.io/name"},
+				},
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					EtcdSettings: &types.EtcdSettings{
+						Authentication: types.EtcdAuthWithTLS,
+						Prefix:         &prefix,
+						Endpoints: []*types.EtcdEndpoint{
+							{Host: "10.10.10.10", Port: &port},
+							{Host: "10.10.10.11"},
+						},
+					},
+				},
+			},
+		},
+		{
+			id: "service-directory-with-everything",
+			arg: &v1alpha1.OperatorConfigSpec{
+				AnnotationRules: []v1alpha1.AnnotationRuleSpec{
+					{Key: "profile", Rename: "cnwan.io/profile", Values: []string{"video"}, OnInvalidValue: "drop"},
+				},
+				ServiceRegistry: v1alpha1.ServiceRegistrySpec{
+					GCPServiceDirectory: &v1alpha1.ServiceDirectorySpec{
+						DefaultRegion: "us-west1",
+						ProjectID:     "project",
+					},
+				},
+				CloudMetadata: &v1alpha1.CloudMetadataSpec{
+					Network:    &auto,
+					SubNetwork: &auto,
+				},
+				DryRun: &v1alpha1.DryRunSpec{
+					Registries: []string{"gcpServiceDirectory"},
+					Output:     "stdout",
+				},
+				GarbageCollection: &v1alpha1.GarbageCollectionSpec{
+					Interval: &metav1.Duration{Duration: time.Hour},
+					DryRun:   true,
+				},
+				LeaderElection: &v1alpha1.LeaderElectionSpec{
+					Enabled:       &yes,
+					Name:          "lease",
+					LeaseDuration: &metav1.Duration{Duration: 15 * time.Second},
+				},
+				Metrics:        &v1alpha1.MetricsSpec{BindAddress: ":9090"},
+				NodePort:       &v1alpha1.NodePortSpec{Enabled: true, AddressType: "ExternalIP"},
+				EndpointSlices: &v1alpha1.EndpointSlicesSpec{Enabled: true},
+				Ingress:        &v1alpha1.IngressSpec{Enabled: true},
+				GatewayAPI:     &v1alpha1.GatewayAPISpec{Enabled: true, HTTPRoutes: true},
+				EndpointNaming: "readable",
+				IPFamilies:     []v1alpha1.IPFamily{"IPv6"},
+				HostnameResolution: &v1alpha1.HostnameResolutionSpec{
+					Nameserver: "10.0.0.10",
+					Interval:   &metav1.Duration{Duration: 30 * time.Second},
+				},
+				MetadataPlacement: "hierarchical",
+			},
+			expRes: &types.Settings{
+				Service: types.ServiceSettings{
+					Annotations:          []string{},
+					NamespaceAnnotations: []string{},
+					Labels:               []string{},
+					AnnotationRules: []types.AnnotationRule{
+						{Key: "profile", Rename: "cnwan.io/profile", Values: []string{"video"}, OnInvalidValue: types.InvalidValueDrop},
+					},
+				},
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{
+						DefaultRegion: "us-west1",
+						ProjectID:     "project",
+					},
+				},
+				CloudMetadata: &types.CloudMetadata{
+					Network:    &auto,
+					SubNetwork: &auto,
+				},
+				DryRun: &types.DryRunSettings{
+					Registries: []string{"gcpServiceDirectory"},
+					Output:     types.DryRunOutputStdout,
+				},
+				GarbageCollection: &types.GarbageCollectionSettings{
+					Interval: time.Hour,
+					DryRun:   true,
+				},
+				LeaderElection: &types.LeaderElectionSettings{
+					Enabled:       &yes,
+					Name:          "lease",
+					LeaseDuration: 15 * time.Second,
+				},
+				Metrics:        &types.MetricsSettings{BindAddress: ":9090"},
+				NodePort:       &types.NodePortSettings{Enabled: true, AddressType: types.NodeExternalIP},
+				EndpointSlices: &types.EndpointSlicesSettings{Enabled: true},
+				Ingress:        &types.IngressSettings{Enabled: true},
+				GatewayAPI:     &types.GatewayAPISettings{Enabled: true, HTTPRoutes: true},
+				EndpointNaming: types.EndpointNamingReadable,
+				IPFamilies:     []types.IPFamily{types.IPv6Family},
+				HostnameResolution: &types.HostnameResolutionSettings{
+					Nameserver: "10.0.0.10",
+					Interval:   30 * time.Second,
+				},
+				MetadataPlacement: types.MetadataPlacementHierarchical,
+			},
+		},
+		{
+			id: "cloud-map",
+			arg: &v1alpha1.OperatorConfigSpec{
+				ServiceRegistry: v1alpha1.ServiceRegistrySpec{
+					AWSCloudMap: &v1alpha1.CloudMapSpec{DefaultRegion: "us-east-1"},
+				},
+			},
+			expRes: &types.Settings{
+				Service: types.ServiceSettings{
+					Annotations:          []string{},
+					NamespaceAnnotations: []string{},
+					Labels:               []string{},
+				},
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					CloudMapSettings: &types.CloudMapSettings{DefaultRegion: "us-east-1"},
+				},
+			},
+		},
+		{
+			id: "consul",
+			arg: &v1alpha1.OperatorConfigSpec{
+				ServiceRegistry: v1alpha1.ServiceRegistrySpec{
+					Consul: &v1alpha1.ConsulSpec{
+						Address:        "consul:8501",
+						Datacenter:     "dc1",
+						Authentication: "WithACLToken",
+						TLS:            true,
+						Node:           "cnwan-operator",
+						Prefix:         "cnwan",
+					},
+				},
+			},
+			expRes: &types.Settings{
+				Service: types.ServiceSettings{
+					Annotations:          []string{},
+					NamespaceAnnotations: []string{},
+					Labels:               []string{},
+				},
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ConsulSettings: &types.ConsulSettings{
+						Address:        "consul:8501",
+						Datacenter:     "dc1",
+						Authentication: types.ConsulAuthWithACLToken,
+						TLS:            true,
+						Node:           "cnwan-operator",
+						Prefix:         "cnwan",
+					},
+				},
+			},
+		},
+		{
+			id: "kubernetes",
+			arg: &v1alpha1.OperatorConfigSpec{
+				ServiceRegistry: v1alpha1.ServiceRegistrySpec{
+					Kubernetes: &v1alpha1.KubernetesRegistrySpec{
+						Namespace:        "cnwan-registry",
+						KubeconfigSecret: "hub-kubeconfig",
+					},
+				},
+			},
+			expRes: &types.Settings{
+				Service: types.ServiceSettings{
+					Annotations:          []string{},
+					NamespaceAnnotations: []string{},
+					Labels:               []string{},
+				},
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					KubernetesSettings: &types.KubernetesSettings{
+						Namespace:        "cnwan-registry",
+						KubeconfigSecret: "hub-kubeconfig",
+					},
+				},
+			},
+		},
+		{
+			id: "dns",
+			arg: &v1alpha1.OperatorConfigSpec{
+				ServiceRegistry: v1alpha1.ServiceRegistrySpec{
+					DNS: &v1alpha1.DNSSpec{
+						Server:         "10.0.0.53:53",
+						Zone:           "sdwan.example.com",
+						TTL:            60,
+						Authentication: "WithTSIG",
+						TSIGAlgorithm:  "hmac-sha256",
+					},
+				},
+			},
+			expRes: &types.Settings{
+				Service: types.ServiceSettings{
+					Annotations:          []string{},
+					NamespaceAnnotations: []string{},
+					Labels:               []string{},
+				},
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					DNSSettings: &types.DNSSettings{
+						Server:         "10.0.0.53:53",
+						Zone:           "sdwan.example.com",
+						TTL:            60,
+						Authentication: types.DNSAuthWithTSIG,
+						TSIGAlgorithm:  "hmac-sha256",
+					},
+				},
+			},
+		},
+	}
+
+	for _, currCase := range cases {
+		res := SettingsFromOperatorConfig(currCase.arg)
+		if !a.Equal(currCase.expRes, res) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
@@ -20,9 +20,14 @@ package utils
 
 import (
 	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/CloudNativeSDWAN/cnwan-operator/internal/types"
 	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
@@ -41,6 +46,11 @@ func ParseAndValidateSettings(settings *types.Settings) (*types.Settings, error)
 	}
 
 	finalSettings := &types.Settings{WatchNamespacesByDefault: settings.WatchNamespacesByDefault}
+
+	finalSettings.ClusterID = strings.TrimSpace(settings.ClusterID)
+	if strings.ContainsAny(finalSettings.ClusterID, ", \t\n") {
+		return nil, fmt.Errorf("cluster ID cannot contain commas or spaces")
+	}
 	if settings.CloudMetadata != nil {
 		clCfg := settings.CloudMetadata
 		finalCfg := &types.CloudMetadata{}
@@ -57,20 +67,160 @@ func ParseAndValidateSettings(settings *types.Settings) (*types.Settings, error)
 		}
 	}
 
-	if len(settings.Service.Annotations) == 0 {
+	if len(settings.Service.Annotations) == 0 && len(settings.Service.AnnotationRules) == 0 &&
+		len(settings.Service.Labels) == 0 {
 		log.V(int(zapcore.WarnLevel)).Info("no allowed annotations provided: no service will be registered")
 	}
 	finalSettings.Service = settings.Service
 
+	if len(settings.Service.AnnotationRules) > 0 {
+		rules, err := parseAnnotationRules(settings.Service.AnnotationRules)
+		if err != nil {
+			return nil, err
+		}
+
+		finalSettings.Service.AnnotationRules = rules
+	}
+
+	if settings.GarbageCollection != nil {
+		if settings.GarbageCollection.Interval < 0 {
+			return nil, fmt.Errorf("invalid garbage collection interval provided")
+		}
+
+		finalSettings.GarbageCollection = &types.GarbageCollectionSettings{
+			Interval: settings.GarbageCollection.Interval,
+			DryRun:   settings.GarbageCollection.DryRun,
+		}
+	}
+
+	enabled := true
+	finalSettings.LeaderElection = &types.LeaderElectionSettings{Enabled: &enabled}
+	if le := settings.LeaderElection; le != nil {
+		if le.LeaseDuration < 0 || le.RenewDeadline < 0 || le.RetryPeriod < 0 {
+			return nil, fmt.Errorf("invalid leader election durations provided")
+		}
+
+		if le.LeaseDuration > 0 && le.RenewDeadline > 0 && le.RenewDeadline >= le.LeaseDuration {
+			return nil, fmt.Errorf("leader election renew deadline must be lower than lease duration")
+		}
+
+		if le.RenewDeadline > 0 && le.RetryPeriod > 0 && le.RetryPeriod >= le.RenewDeadline {
+			return nil, fmt.Errorf("leader election retry period must be lower than renew deadline")
+		}
+
+		if le.Enabled != nil {
+			enabled = *le.Enabled
+		}
+
+		finalSettings.LeaderElection.Namespace = strings.TrimSpace(le.Namespace)
+		finalSettings.LeaderElection.Name = strings.TrimSpace(le.Name)
+		finalSettings.LeaderElection.LeaseDuration = le.LeaseDuration
+		finalSettings.LeaderElection.RenewDeadline = le.RenewDeadline
+		finalSettings.LeaderElection.RetryPeriod = le.RetryPeriod
+	}
+
+	if settings.Metrics != nil {
+		finalSettings.Metrics = &types.MetricsSettings{
+			BindAddress: strings.TrimSpace(settings.Metrics.BindAddress),
+		}
+	}
+
+	if np := settings.NodePort; np != nil && np.Enabled {
+		addrType := types.NodeAddressType(strings.TrimSpace(string(np.AddressType)))
+		switch addrType {
+		case "":
+			addrType = types.NodeInternalIP
+		case types.NodeInternalIP, types.NodeExternalIP:
+		default:
+			return nil, fmt.Errorf("invalid node address type provided: %s", np.AddressType)
+		}
+
+		finalSettings.NodePort = &types.NodePortSettings{
+			Enabled:     true,
+			AddressType: addrType,
+		}
+	}
+
+	if es := settings.EndpointSlices; es != nil && es.Enabled {
+		finalSettings.EndpointSlices = &types.EndpointSlicesSettings{Enabled: true}
+	}
+
+	if ing := settings.Ingress; ing != nil && ing.Enabled {
+		finalSettings.Ingress = &types.IngressSettings{Enabled: true}
+	}
+
+	if gw := settings.GatewayAPI; gw != nil && gw.Enabled {
+		finalSettings.GatewayAPI = &types.GatewayAPISettings{
+			Enabled:    true,
+			HTTPRoutes: gw.HTTPRoutes,
+		}
+	}
+
+	if hr := settings.HostnameResolution; hr != nil {
+		if hr.Interval < 0 || hr.Timeout < 0 {
+			return nil, fmt.Errorf("invalid hostname resolution durations provided")
+		}
+
+		nameserver := strings.TrimSpace(hr.Nameserver)
+		if nameserver != "" {
+			host := nameserver
+			if h, _, err := net.SplitHostPort(nameserver); err == nil {
+				host = h
+			}
+
+			if net.ParseIP(host) == nil {
+				return nil, fmt.Errorf("invalid nameserver provided: %s", hr.Nameserver)
+			}
+		}
+
+		finalSettings.HostnameResolution = &types.HostnameResolutionSettings{
+			Nameserver:        nameserver,
+			Interval:          hr.Interval,
+			Timeout:           hr.Timeout,
+			RegisterHostnames: hr.RegisterHostnames,
+		}
+	}
+
+	for _, family := range settings.IPFamilies {
+		family = types.IPFamily(strings.TrimSpace(string(family)))
+		if family != types.IPv4Family && family != types.IPv6Family {
+			return nil, fmt.Errorf("invalid IP family provided: %s", family)
+		}
+
+		duplicate := false
+		for _, f := range finalSettings.IPFamilies {
+			duplicate = duplicate || f == family
+		}
+		if !duplicate {
+			finalSettings.IPFamilies = append(finalSettings.IPFamilies, family)
+		}
+	}
+
+	switch naming := types.EndpointNaming(strings.TrimSpace(string(settings.EndpointNaming))); naming {
+	case "":
+		finalSettings.EndpointNaming = types.EndpointNamingHashed
+	case types.EndpointNamingHashed, types.EndpointNamingReadable:
+		finalSettings.EndpointNaming = naming
+	default:
+		return nil, fmt.Errorf("invalid endpoint naming provided: %s", settings.EndpointNaming)
+	}
+
+	switch placement := types.MetadataPlacement(strings.TrimSpace(string(settings.MetadataPlacement))); placement {
+	case "":
+		finalSettings.MetadataPlacement = types.MetadataPlacementEndpoints
+	case types.MetadataPlacementEndpoints, types.MetadataPlacementHierarchical:
+		finalSettings.MetadataPlacement = placement
+	default:
+		return nil, fmt.Errorf("invalid metadata placement provided: %s", settings.MetadataPlacement)
+	}
+
 	if settings.ServiceRegistrySettings == nil {
 		return nil, fmt.Errorf("no service registry provided")
 	}
 
 	finalSettings.ServiceRegistrySettings = &types.ServiceRegistrySettings{}
 
-	// Make sure only one service registry is provided.
-	// TODO: this won't be necessary in future anymore as the CLI will take
-	// care of it.
+	// Objects are registered on all the provided service registries.
 	srs := func() int {
 		n := 0
 
@@ -86,6 +236,18 @@ func ParseAndValidateSettings(settings *types.Settings) (*types.Settings, error)
 			n++
 		}
 
+		if settings.ConsulSettings != nil {
+			n++
+		}
+
+		if settings.KubernetesSettings != nil {
+			n++
+		}
+
+		if settings.DNSSettings != nil {
+			n++
+		}
+
 		return n
 	}()
 
@@ -93,8 +255,10 @@ func ParseAndValidateSettings(settings *types.Settings) (*types.Settings, error)
 		return nil, fmt.Errorf("no service registry provided")
 	}
 
-	if srs > 1 {
-		return nil, fmt.Errorf("UNSUPPORTED: multiple service registries have been provided")
+	if hr := finalSettings.HostnameResolution; hr != nil && hr.RegisterHostnames &&
+		(settings.ServiceDirectorySettings != nil || settings.CloudMapSettings != nil ||
+			settings.ConsulSettings != nil || settings.KubernetesSettings != nil) {
+		return nil, fmt.Errorf("hostnames can only be registered on etcd and dns")
 	}
 
 	if settings.EtcdSettings != nil {
@@ -104,9 +268,6 @@ func ParseAndValidateSettings(settings *types.Settings) (*types.Settings, error)
 		}
 
 		finalSettings.EtcdSettings = parsedSettings
-		// Nothing else to check
-
-		return finalSettings, nil
 	}
 
 	if settings.ServiceDirectorySettings != nil {
@@ -119,6 +280,181 @@ func ParseAndValidateSettings(settings *types.Settings) (*types.Settings, error)
 		finalSettings.CloudMapSettings = settings.CloudMapSettings
 	}
 
+	if settings.ConsulSettings != nil {
+		parsedSettings, err := parseConsulSettings(settings.ConsulSettings)
+		if err != nil {
+			return nil, err
+		}
+
+		finalSettings.ConsulSettings = parsedSettings
+	}
+
+	if settings.KubernetesSettings != nil {
+		parsedSettings, err := parseKubernetesSettings(settings.KubernetesSettings)
+		if err != nil {
+			return nil, err
+		}
+
+		finalSettings.KubernetesSettings = parsedSettings
+	}
+
+	if settings.DNSSettings != nil {
+		parsedSettings, err := parseDNSSettings(settings.DNSSettings)
+		if err != nil {
+			return nil, err
+		}
+
+		finalSettings.DNSSettings = parsedSettings
+	}
+
+	if settings.DryRun != nil {
+		parsedSettings, err := parseDryRunSettings(settings.DryRun, settings.ServiceRegistrySettings)
+		if err != nil {
+			return nil, err
+		}
+
+		finalSettings.DryRun = parsedSettings
+	}
+
+	return finalSettings, nil
+}
+
+func parseDryRunSettings(settings *types.DryRunSettings, registries *types.ServiceRegistrySettings) (*types.DryRunSettings, error) {
+	configured := map[string]bool{
+		"etcd":                registries.EtcdSettings != nil,
+		"gcpServiceDirectory": registries.ServiceDirectorySettings != nil,
+		"awsCloudMap":         registries.CloudMapSettings != nil,
+		"consul":              registries.ConsulSettings != nil,
+		"kubernetes":          registries.KubernetesSettings != nil,
+		"dns":                 registries.DNSSettings != nil,
+	}
+
+	finalRegistries := []string{}
+	for _, name := range settings.Registries {
+		name = strings.TrimSpace(name)
+		isSet, exists := configured[name]
+		if !exists {
+			return nil, fmt.Errorf("unrecognized service registry for dry run: %s", name)
+		}
+
+		if !isSet {
+			return nil, fmt.Errorf("service registry for dry run is not set: %s", name)
+		}
+
+		duplicate := false
+		for _, r := range finalRegistries {
+			duplicate = duplicate || r == name
+		}
+		if !duplicate {
+			finalRegistries = append(finalRegistries, name)
+		}
+	}
+
+	if len(finalRegistries) == 0 {
+		return nil, nil
+	}
+
+	output := strings.TrimSpace(settings.Output)
+	if output != "" && output != types.DryRunOutputStdout && !filepath.IsAbs(output) {
+		return nil, fmt.Errorf("invalid dry run output provided: %s", settings.Output)
+	}
+
+	return &types.DryRunSettings{
+		Registries: finalRegistries,
+		Output:     output,
+	}, nil
+}
+
+func parseDNSSettings(settings *types.DNSSettings) (*types.DNSSettings, error) {
+	server := strings.TrimSpace(settings.Server)
+	if server == "" {
+		return nil, fmt.Errorf("no dns server provided")
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	zone := strings.TrimSuffix(strings.TrimSpace(settings.Zone), ".")
+	if zone == "" {
+		return nil, fmt.Errorf("no dns zone provided")
+	}
+
+	if errs := validation.IsDNS1123Subdomain(strings.ToLower(zone)); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid dns zone provided: %s", settings.Zone)
+	}
+
+	if settings.Authentication != types.DNSAuthWithNothing &&
+		settings.Authentication != types.DNSAuthWithTSIG {
+		return nil, fmt.Errorf("unrecognized authentication method for dns")
+	}
+
+	algorithm := strings.ToLower(strings.TrimSpace(settings.TSIGAlgorithm))
+	switch algorithm {
+	case "", "hmac-sha1", "hmac-sha224", "hmac-sha256", "hmac-sha384", "hmac-sha512":
+	default:
+		return nil, fmt.Errorf("unrecognized tsig algorithm provided: %s", settings.TSIGAlgorithm)
+	}
+
+	return &types.DNSSettings{
+		Server:         server,
+		Zone:           zone,
+		TTL:            settings.TTL,
+		Authentication: settings.Authentication,
+		TSIGAlgorithm:  algorithm,
+	}, nil
+}
+
+func parseKubernetesSettings(settings *types.KubernetesSettings) (*types.KubernetesSettings, error) {
+	finalSettings := &types.KubernetesSettings{
+		Namespace:        strings.TrimSpace(settings.Namespace),
+		KubeconfigSecret: strings.TrimSpace(settings.KubeconfigSecret),
+	}
+
+	if finalSettings.Namespace != "" {
+		if errs := validation.IsDNS1123Label(finalSettings.Namespace); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid kubernetes namespace provided: %s", settings.Namespace)
+		}
+	}
+
+	if finalSettings.KubeconfigSecret != "" {
+		if errs := validation.IsDNS1123Subdomain(finalSettings.KubeconfigSecret); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid kubeconfig secret provided: %s", settings.KubeconfigSecret)
+		}
+	}
+
+	return finalSettings, nil
+}
+
+func parseConsulSettings(settings *types.ConsulSettings) (*types.ConsulSettings, error) {
+	address := strings.TrimSpace(settings.Address)
+	if address == "" {
+		return nil, fmt.Errorf("no consul address provided")
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		// https://developer.hashicorp.com/consul/docs/install/ports
+		address = net.JoinHostPort(address, "8500")
+	}
+
+	if settings.Authentication != types.ConsulAuthWithNothing &&
+		settings.Authentication != types.ConsulAuthWithACLToken {
+		return nil, fmt.Errorf("unrecognized authentication method for consul")
+	}
+
+	finalSettings := &types.ConsulSettings{
+		Address:        address,
+		Datacenter:     strings.TrimSpace(settings.Datacenter),
+		Authentication: settings.Authentication,
+		TLS:            settings.TLS,
+		Node:           strings.TrimSpace(settings.Node),
+		Prefix:         strings.Trim(strings.TrimSpace(settings.Prefix), "/"),
+	}
+
+	if strings.ContainsAny(finalSettings.Prefix, " \t\n*") {
+		return nil, fmt.Errorf("invalid consul prefix provided: %s", settings.Prefix)
+	}
+
 	return finalSettings, nil
 }
 
@@ -129,20 +465,25 @@ func parseEtcdSettings(settings *types.EtcdSettings) (*types.EtcdSettings, error
 
 	if settings.Authentication != types.EtcdAuthWithNothing &&
 		settings.Authentication != types.EtcdAuthWithUsernamePassw &&
-		settings.Authentication != types.EtcdAuthWithTLS {
+		settings.Authentication != types.EtcdAuthWithTLS &&
+		settings.Authentication != types.EtcdAuthWithTLSAndUsernamePassw {
 		return nil, fmt.Errorf("unrecognized authentication method for etcd")
 	}
 
-	if settings.Authentication == types.EtcdAuthWithTLS {
-		return nil, fmt.Errorf("etcd authentication with TLS is not supported yet")
-	}
-
 	finalSettings := &types.EtcdSettings{
 		Authentication: settings.Authentication,
-		Prefix:         settings.Prefix,
 		Endpoints:      []*types.EtcdEndpoint{},
 	}
 
+	if settings.Prefix != nil && strings.TrimSpace(*settings.Prefix) != "" {
+		prefix, err := parseEtcdPrefix(*settings.Prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		finalSettings.Prefix = &prefix
+	}
+
 	dups := map[string]int{}
 	for i, endp := range settings.Endpoints {
 		if len(endp.Host) == 0 {
@@ -170,3 +511,92 @@ func parseEtcdSettings(settings *types.EtcdSettings) (*types.EtcdSettings, error
 
 	return finalSettings, nil
 }
+
+// parseAnnotationRules validates the provided annotation rules and returns
+// them without leading and trailing spaces and with default values.
+func parseAnnotationRules(rules []types.AnnotationRule) ([]types.AnnotationRule, error) {
+	finalRules := []types.AnnotationRule{}
+	for i, rule := range rules {
+		finalRule := types.AnnotationRule{
+			Key:            strings.TrimSpace(rule.Key),
+			KeyRegex:       strings.TrimSpace(rule.KeyRegex),
+			Rename:         strings.TrimSpace(rule.Rename),
+			StripPrefix:    rule.StripPrefix,
+			Default:        strings.TrimSpace(rule.Default),
+			OnInvalidValue: types.InvalidValueAction(strings.TrimSpace(string(rule.OnInvalidValue))),
+		}
+		for _, val := range rule.Values {
+			finalRule.Values = append(finalRule.Values, strings.TrimSpace(val))
+		}
+
+		if (finalRule.Key == "") == (finalRule.KeyRegex == "") {
+			return nil, fmt.Errorf("annotation rule %d must have either key or keyRegex", i)
+		}
+
+		if finalRule.KeyRegex != "" {
+			if _, err := regexp.Compile(finalRule.KeyRegex); err != nil {
+				return nil, fmt.Errorf("invalid keyRegex in annotation rule %d: %w", i, err)
+			}
+
+			if finalRule.Default != "" {
+				return nil, fmt.Errorf("annotation rule %d can only have a default value with key", i)
+			}
+		}
+
+		if finalRule.Rename != "" && finalRule.StripPrefix {
+			return nil, fmt.Errorf("annotation rule %d cannot have both rename and stripPrefix", i)
+		}
+
+		if finalRule.Default != "" && len(finalRule.Values) > 0 && !containsFold(finalRule.Values, finalRule.Default) {
+			return nil, fmt.Errorf("default value of annotation rule %d is not one of its values", i)
+		}
+
+		switch finalRule.OnInvalidValue {
+		case "":
+			finalRule.OnInvalidValue = types.InvalidValueDrop
+		case types.InvalidValueDrop:
+		case types.InvalidValueDefault:
+			if finalRule.Default == "" {
+				return nil, fmt.Errorf("annotation rule %d must have a default value to replace invalid values", i)
+			}
+		default:
+			return nil, fmt.Errorf("invalid onInvalidValue in annotation rule %d: %s", i, rule.OnInvalidValue)
+		}
+
+		finalRules = append(finalRules, finalRule)
+	}
+
+	return finalRules, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, val := range values {
+		if strings.EqualFold(val, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseEtcdPrefix validates the provided etcd prefix and returns it without
+// leading and trailing spaces and without the trailing slash, unless the
+// prefix is just a slash.
+func parseEtcdPrefix(prefix string) (string, error) {
+	prefix = strings.TrimSpace(prefix)
+
+	switch {
+	case !strings.HasPrefix(prefix, "/"):
+		return "", fmt.Errorf("etcd prefix must start with /")
+	case strings.Contains(prefix, "//"):
+		return "", fmt.Errorf("etcd prefix cannot contain empty path segments")
+	case strings.ContainsAny(prefix, " \t\n*"):
+		return "", fmt.Errorf("etcd prefix cannot contain spaces or wildcards")
+	}
+
+	if prefix != "/" {
+		prefix = strings.TrimSuffix(prefix, "/")
+	}
+
+	return prefix, nil
+}
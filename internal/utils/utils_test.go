@@ -21,6 +21,7 @@ package utils
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/CloudNativeSDWAN/cnwan-operator/internal/types"
 	. "github.com/stretchr/testify/assert"
@@ -32,6 +33,7 @@ func TestParseAndValidateSettings(t *testing.T) {
 	port2800 := 2800
 	portDef := 2379
 	port2810 := 2810
+	no := false
 	cases := []struct {
 		id     string
 		arg    *types.Settings
@@ -60,23 +62,35 @@ func TestParseAndValidateSettings(t *testing.T) {
 			arg: &types.Settings{
 				WatchNamespacesByDefault: true,
 				ServiceRegistrySettings: &types.ServiceRegistrySettings{
-					EtcdSettings:             &types.EtcdSettings{},
-					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+					EtcdSettings: &types.EtcdSettings{
+						Endpoints: []*types.EtcdEndpoint{{Host: "10.10.10.10"}},
+					},
+					CloudMapSettings: &types.CloudMapSettings{DefaultRegion: "us-west-2"},
+				},
+			},
+			expRes: &types.Settings{
+				WatchNamespacesByDefault: true,
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					EtcdSettings: &types.EtcdSettings{
+						Endpoints: []*types.EtcdEndpoint{{Host: "10.10.10.10", Port: &portDef}},
+					},
+					CloudMapSettings: &types.CloudMapSettings{DefaultRegion: "us-west-2"},
 				},
 			},
-			expErr: fmt.Errorf("UNSUPPORTED: multiple service registries have been provided"),
 		},
 		{
-			id: "3-service-registries",
+			id: "3-service-registries-one-invalid",
 			arg: &types.Settings{
 				WatchNamespacesByDefault: true,
 				ServiceRegistrySettings: &types.ServiceRegistrySettings{
-					EtcdSettings:             &types.EtcdSettings{},
+					EtcdSettings: &types.EtcdSettings{
+						Endpoints: []*types.EtcdEndpoint{{Host: "10.10.10.10"}},
+					},
 					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
-					CloudMapSettings:         &types.CloudMapSettings{},
+					ConsulSettings:           &types.ConsulSettings{},
 				},
 			},
-			expErr: fmt.Errorf("UNSUPPORTED: multiple service registries have been provided"),
+			expErr: fmt.Errorf("no consul address provided"),
 		},
 		{
 			id: "etcd-unknown-auth",
@@ -129,7 +143,39 @@ func TestParseAndValidateSettings(t *testing.T) {
 					},
 				},
 			},
-			expErr: fmt.Errorf("etcd authentication with TLS is not supported yet"),
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					EtcdSettings: &types.EtcdSettings{
+						Authentication: types.EtcdAuthWithTLS,
+						Endpoints: []*types.EtcdEndpoint{
+							{Host: "10.10.10.10", Port: &portDef},
+						},
+					},
+				},
+			},
+		},
+		{
+			id: "etcd-tls-and-username-password-auth",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					EtcdSettings: &types.EtcdSettings{
+						Authentication: types.EtcdAuthWithTLSAndUsernamePassw,
+						Endpoints: []*types.EtcdEndpoint{
+							{Host: "10.10.10.10"},
+						},
+					},
+				},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					EtcdSettings: &types.EtcdSettings{
+						Authentication: types.EtcdAuthWithTLSAndUsernamePassw,
+						Endpoints: []*types.EtcdEndpoint{
+							{Host: "10.10.10.10", Port: &portDef},
+						},
+					},
+				},
+			},
 		},
 		{
 			id: "only-etcd-not-empty",
@@ -240,42 +286,861 @@ func TestParseAndValidateSettings(t *testing.T) {
 				CloudMetadata: nil,
 			},
 		},
-	}
-
-	for _, currCase := range cases {
-		res, err := ParseAndValidateSettings(currCase.arg)
-
-		if currCase.expRes != nil {
-			if !a.NotNil(res) {
-				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
-			}
-
-			if currCase.expRes.ServiceRegistrySettings != nil {
-				if !a.NotNil(res.ServiceRegistrySettings) {
-					a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
-				}
-
-				if currCase.expRes.EtcdSettings != nil {
-					if !a.Equal(*currCase.expRes.EtcdSettings, *res.EtcdSettings) {
-						a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
-					}
-				}
-
-				if currCase.expRes.ServiceDirectorySettings != nil {
-					if !a.Equal(*currCase.expRes.ServiceDirectorySettings, *res.ServiceDirectorySettings) {
-						a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
-					}
-				}
-			}
-		}
-
-		if !a.Equal(currCase.expErr, err) {
-			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
-		} else {
-			continue
-		}
-
-		if !a.Equal(currCase.expRes, currCase.arg) {
+		{
+			id: "invalid-cluster-id",
+			arg: &types.Settings{
+				ClusterID: "one,two",
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+			},
+			expErr: fmt.Errorf("cluster ID cannot contain commas or spaces"),
+		},
+		{
+			id: "invalid-cluster-id-spaces",
+			arg: &types.Settings{
+				ClusterID: "one two",
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+			},
+			expErr: fmt.Errorf("cluster ID cannot contain commas or spaces"),
+		},
+		{
+			id: "invalid-garbage-collection-interval",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				GarbageCollection: &types.GarbageCollectionSettings{
+					Interval: -time.Minute,
+				},
+			},
+			expErr: fmt.Errorf("invalid garbage collection interval provided"),
+		},
+		{
+			id: "successful-with-garbage-collection",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				GarbageCollection: &types.GarbageCollectionSettings{
+					Interval: 30 * time.Minute,
+					DryRun:   true,
+				},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				GarbageCollection: &types.GarbageCollectionSettings{
+					Interval: 30 * time.Minute,
+					DryRun:   true,
+				},
+			},
+		},
+		{
+			id: "invalid-leader-election-durations",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				LeaderElection: &types.LeaderElectionSettings{
+					RetryPeriod: -time.Second,
+				},
+			},
+			expErr: fmt.Errorf("invalid leader election durations provided"),
+		},
+		{
+			id: "invalid-leader-election-renew-deadline",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				LeaderElection: &types.LeaderElectionSettings{
+					LeaseDuration: 10 * time.Second,
+					RenewDeadline: 15 * time.Second,
+				},
+			},
+			expErr: fmt.Errorf("leader election renew deadline must be lower than lease duration"),
+		},
+		{
+			id: "invalid-leader-election-retry-period",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				LeaderElection: &types.LeaderElectionSettings{
+					RenewDeadline: 10 * time.Second,
+					RetryPeriod:   10 * time.Second,
+				},
+			},
+			expErr: fmt.Errorf("leader election retry period must be lower than renew deadline"),
+		},
+		{
+			id: "successful-with-default-leader-election",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				LeaderElection: &types.LeaderElectionSettings{
+					Enabled: func() *bool { b := true; return &b }(),
+				},
+			},
+		},
+		{
+			id: "successful-with-leader-election",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				LeaderElection: &types.LeaderElectionSettings{
+					Enabled:       &no,
+					Name:          " my-lease ",
+					LeaseDuration: 30 * time.Second,
+					RenewDeadline: 20 * time.Second,
+					RetryPeriod:   5 * time.Second,
+				},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				LeaderElection: &types.LeaderElectionSettings{
+					Enabled:       &no,
+					Name:          "my-lease",
+					LeaseDuration: 30 * time.Second,
+					RenewDeadline: 20 * time.Second,
+					RetryPeriod:   5 * time.Second,
+				},
+			},
+		},
+		{
+			id: "invalid-nameserver",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				HostnameResolution: &types.HostnameResolutionSettings{Nameserver: "dns.example.com:53"},
+			},
+			expErr: fmt.Errorf("invalid nameserver provided: dns.example.com:53"),
+		},
+		{
+			id: "invalid-hostname-resolution-durations",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				HostnameResolution: &types.HostnameResolutionSettings{Interval: -time.Second},
+			},
+			expErr: fmt.Errorf("invalid hostname resolution durations provided"),
+		},
+		{
+			id: "register-hostnames-without-etcd",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				HostnameResolution: &types.HostnameResolutionSettings{RegisterHostnames: true},
+			},
+			expErr: fmt.Errorf("hostnames can only be registered on etcd and dns"),
+		},
+		{
+			id: "register-hostnames-on-multiple",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					EtcdSettings: &types.EtcdSettings{
+						Endpoints: []*types.EtcdEndpoint{{Host: "10.10.10.10"}},
+					},
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				HostnameResolution: &types.HostnameResolutionSettings{RegisterHostnames: true},
+			},
+			expErr: fmt.Errorf("hostnames can only be registered on etcd and dns"),
+		},
+		{
+			id: "successful-with-hostname-resolution",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					EtcdSettings: &types.EtcdSettings{
+						Endpoints: []*types.EtcdEndpoint{{Host: "etcd"}},
+					},
+				},
+				HostnameResolution: &types.HostnameResolutionSettings{
+					Nameserver:        " 10.0.0.10 ",
+					Interval:          30 * time.Second,
+					RegisterHostnames: true,
+				},
+			},
+			expRes: &types.Settings{
+				HostnameResolution: &types.HostnameResolutionSettings{
+					Nameserver:        "10.0.0.10",
+					Interval:          30 * time.Second,
+					RegisterHostnames: true,
+				},
+			},
+		},
+		{
+			id: "successful-register-hostnames-on-etcd-and-dns",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					EtcdSettings: &types.EtcdSettings{
+						Endpoints: []*types.EtcdEndpoint{{Host: "etcd"}},
+					},
+					DNSSettings: &types.DNSSettings{Server: "10.0.0.53", Zone: "example.com"},
+				},
+				HostnameResolution: &types.HostnameResolutionSettings{RegisterHostnames: true},
+			},
+			expRes: &types.Settings{
+				HostnameResolution: &types.HostnameResolutionSettings{RegisterHostnames: true},
+			},
+		},
+		{
+			id: "invalid-ip-family",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				IPFamilies: []types.IPFamily{"IPv4", "IPv5"},
+			},
+			expErr: fmt.Errorf("invalid IP family provided: IPv5"),
+		},
+		{
+			id: "successful-with-ip-families",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				IPFamilies: []types.IPFamily{" IPv6", "IPv6"},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				IPFamilies: []types.IPFamily{types.IPv6Family},
+			},
+		},
+		{
+			id: "annotation-rule-without-key",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				Service: types.ServiceSettings{
+					AnnotationRules: []types.AnnotationRule{{Key: "version"}, {Rename: "cnwan.io/version"}},
+				},
+			},
+			expErr: fmt.Errorf("annotation rule 1 must have either key or keyRegex"),
+		},
+		{
+			id: "annotation-rule-with-key-and-regex",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				Service: types.ServiceSettings{
+					AnnotationRules: []types.AnnotationRule{{Key: "version", KeyRegex: "^version$"}},
+				},
+			},
+			expErr: fmt.Errorf("annotation rule 0 must have either key or keyRegex"),
+		},
+		{
+			id: "annotation-rule-with-default-and-regex",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				Service: types.ServiceSettings{
+					AnnotationRules: []types.AnnotationRule{{KeyRegex: "^version$", Default: "v1"}},
+				},
+			},
+			expErr: fmt.Errorf("annotation rule 0 can only have a default value with key"),
+		},
+		{
+			id: "annotation-rule-with-rename-and-strip-prefix",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				Service: types.ServiceSettings{
+					AnnotationRules: []types.AnnotationRule{{Key: "example.com/version", Rename: "version", StripPrefix: true}},
+				},
+			},
+			expErr: fmt.Errorf("annotation rule 0 cannot have both rename and stripPrefix"),
+		},
+		{
+			id: "annotation-rule-with-invalid-default",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				Service: types.ServiceSettings{
+					AnnotationRules: []types.AnnotationRule{{Key: "profile", Default: "gold", Values: []string{"standard", "video"}}},
+				},
+			},
+			expErr: fmt.Errorf("default value of annotation rule 0 is not one of its values"),
+		},
+		{
+			id: "annotation-rule-replacing-without-default",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				Service: types.ServiceSettings{
+					AnnotationRules: []types.AnnotationRule{{Key: "profile", Values: []string{"video"}, OnInvalidValue: types.InvalidValueDefault}},
+				},
+			},
+			expErr: fmt.Errorf("annotation rule 0 must have a default value to replace invalid values"),
+		},
+		{
+			id: "annotation-rule-with-invalid-action",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				Service: types.ServiceSettings{
+					AnnotationRules: []types.AnnotationRule{{Key: "profile", OnInvalidValue: "ignore"}},
+				},
+			},
+			expErr: fmt.Errorf("invalid onInvalidValue in annotation rule 0: ignore"),
+		},
+		{
+			id: "successful-with-annotation-rules",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				Service: types.ServiceSettings{
+					AnnotationRules: []types.AnnotationRule{
+						{Key: " traffic-profile", Rename: "cnwan.io/traffic-profile ", Default: "standard", Values: []string{"standard", " video"}, OnInvalidValue: types.InvalidValueDefault},
+						{KeyRegex: `^example\.com/(.+)$`, Rename: "cnwan.io/$1"},
+					},
+				},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				Service: types.ServiceSettings{
+					AnnotationRules: []types.AnnotationRule{
+						{Key: "traffic-profile", Rename: "cnwan.io/traffic-profile", Default: "standard", Values: []string{"standard", "video"}, OnInvalidValue: types.InvalidValueDefault},
+						{KeyRegex: `^example\.com/(.+)$`, Rename: "cnwan.io/$1", OnInvalidValue: types.InvalidValueDrop},
+					},
+				},
+			},
+		},
+		{
+			id: "invalid-metadata-placement",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				MetadataPlacement: "services",
+			},
+			expErr: fmt.Errorf("invalid metadata placement provided: services"),
+		},
+		{
+			id: "successful-with-default-metadata-placement",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				MetadataPlacement: types.MetadataPlacementEndpoints,
+			},
+		},
+		{
+			id: "successful-with-hierarchical-metadata-placement",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				MetadataPlacement: " hierarchical",
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				MetadataPlacement: types.MetadataPlacementHierarchical,
+			},
+		},
+		{
+			id: "invalid-endpoint-naming",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				EndpointNaming: "random",
+			},
+			expErr: fmt.Errorf("invalid endpoint naming provided: random"),
+		},
+		{
+			id: "successful-with-default-endpoint-naming",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				EndpointNaming: types.EndpointNamingHashed,
+			},
+		},
+		{
+			id: "successful-with-readable-endpoint-naming",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				EndpointNaming: " readable ",
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				EndpointNaming: types.EndpointNamingReadable,
+			},
+		},
+		{
+			id: "invalid-node-address-type",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				NodePort: &types.NodePortSettings{Enabled: true, AddressType: "Hostname"},
+			},
+			expErr: fmt.Errorf("invalid node address type provided: Hostname"),
+		},
+		{
+			id: "successful-with-default-node-address-type",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				NodePort: &types.NodePortSettings{Enabled: true},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				NodePort: &types.NodePortSettings{Enabled: true, AddressType: types.NodeInternalIP},
+			},
+		},
+		{
+			id: "successful-with-endpoint-slices",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				EndpointSlices: &types.EndpointSlicesSettings{Enabled: true},
+				Ingress:        &types.IngressSettings{Enabled: true},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				EndpointSlices: &types.EndpointSlicesSettings{Enabled: true},
+				Ingress:        &types.IngressSettings{Enabled: true},
+			},
+		},
+		{
+			id: "successful-with-gateway-api",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				GatewayAPI: &types.GatewayAPISettings{Enabled: true, HTTPRoutes: true},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				GatewayAPI: &types.GatewayAPISettings{Enabled: true, HTTPRoutes: true},
+			},
+		},
+		{
+			id: "successful-with-gateway-api-disabled",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				GatewayAPI: &types.GatewayAPISettings{HTTPRoutes: true},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+			},
+		},
+		{
+			id: "successful-with-node-port-disabled",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				NodePort: &types.NodePortSettings{AddressType: types.NodeExternalIP},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+			},
+		},
+		{
+			id: "consul-without-address",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ConsulSettings: &types.ConsulSettings{Address: " "},
+				},
+			},
+			expErr: fmt.Errorf("no consul address provided"),
+		},
+		{
+			id: "consul-unknown-auth",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ConsulSettings: &types.ConsulSettings{
+						Address:        "consul:8500",
+						Authentication: types.ConsulAuthenticationType("WithTLS"),
+					},
+				},
+			},
+			expErr: fmt.Errorf("unrecognized authentication method for consul"),
+		},
+		{
+			id: "consul-invalid-prefix",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ConsulSettings: &types.ConsulSettings{
+						Address: "consul:8500",
+						Prefix:  "cnwan/*",
+					},
+				},
+			},
+			expErr: fmt.Errorf("invalid consul prefix provided: cnwan/*"),
+		},
+		{
+			id: "successful-with-consul",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ConsulSettings: &types.ConsulSettings{
+						Address:        "consul.consul.svc",
+						Datacenter:     " dc1 ",
+						Authentication: types.ConsulAuthWithACLToken,
+						TLS:            true,
+						Prefix:         "/prod/cnwan/",
+					},
+				},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ConsulSettings: &types.ConsulSettings{
+						Address:        "consul.consul.svc:8500",
+						Datacenter:     "dc1",
+						Authentication: types.ConsulAuthWithACLToken,
+						TLS:            true,
+						Prefix:         "prod/cnwan",
+					},
+				},
+			},
+		},
+		{
+			id: "kubernetes-invalid-namespace",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					KubernetesSettings: &types.KubernetesSettings{Namespace: "CNWAN_Registry"},
+				},
+			},
+			expErr: fmt.Errorf("invalid kubernetes namespace provided: CNWAN_Registry"),
+		},
+		{
+			id: "kubernetes-invalid-secret",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					KubernetesSettings: &types.KubernetesSettings{KubeconfigSecret: "hub/kubeconfig"},
+				},
+			},
+			expErr: fmt.Errorf("invalid kubeconfig secret provided: hub/kubeconfig"),
+		},
+		{
+			id: "multiple-with-kubernetes",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ConsulSettings:     &types.ConsulSettings{Address: "consul:8500"},
+					KubernetesSettings: &types.KubernetesSettings{Namespace: "CNWAN_Registry"},
+				},
+			},
+			expErr: fmt.Errorf("invalid kubernetes namespace provided: CNWAN_Registry"),
+		},
+
+		{
+			id: "successful-with-kubernetes",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					KubernetesSettings: &types.KubernetesSettings{
+						Namespace:        " cnwan-registry ",
+						KubeconfigSecret: "hub-kubeconfig",
+					},
+				},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					KubernetesSettings: &types.KubernetesSettings{
+						Namespace:        "cnwan-registry",
+						KubeconfigSecret: "hub-kubeconfig",
+					},
+				},
+			},
+		},
+		{
+			id: "dry-run-unknown-registry",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				DryRun: &types.DryRunSettings{Registries: []string{"serviceDirectory"}},
+			},
+			expErr: fmt.Errorf("unrecognized service registry for dry run: serviceDirectory"),
+		},
+		{
+			id: "dry-run-registry-not-set",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				DryRun: &types.DryRunSettings{Registries: []string{"awsCloudMap"}},
+			},
+			expErr: fmt.Errorf("service registry for dry run is not set: awsCloudMap"),
+		},
+		{
+			id: "dry-run-invalid-output",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				DryRun: &types.DryRunSettings{
+					Registries: []string{"gcpServiceDirectory"},
+					Output:     "dry-run.jsonl",
+				},
+			},
+			expErr: fmt.Errorf("invalid dry run output provided: dry-run.jsonl"),
+		},
+		{
+			id: "dry-run-without-registries",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				DryRun: &types.DryRunSettings{Output: types.DryRunOutputStdout},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+			},
+		},
+		{
+			id: "successful-with-dry-run",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					EtcdSettings: &types.EtcdSettings{
+						Endpoints: []*types.EtcdEndpoint{{Host: "10.10.10.10"}},
+					},
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				DryRun: &types.DryRunSettings{
+					Registries: []string{" gcpServiceDirectory ", "gcpServiceDirectory"},
+					Output:     " /var/log/cnwan/dry-run.jsonl ",
+				},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					EtcdSettings: &types.EtcdSettings{
+						Endpoints: []*types.EtcdEndpoint{{Host: "10.10.10.10", Port: &portDef}},
+					},
+					ServiceDirectorySettings: &types.ServiceDirectorySettings{},
+				},
+				DryRun: &types.DryRunSettings{
+					Registries: []string{"gcpServiceDirectory"},
+					Output:     "/var/log/cnwan/dry-run.jsonl",
+				},
+			},
+		},
+		{
+			id: "dns-without-zone",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					DNSSettings: &types.DNSSettings{Server: "10.0.0.53"},
+				},
+			},
+			expErr: fmt.Errorf("no dns zone provided"),
+		},
+		{
+			id: "dns-invalid-zone",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					DNSSettings: &types.DNSSettings{Server: "10.0.0.53", Zone: "cnwan_example.com"},
+				},
+			},
+			expErr: fmt.Errorf("invalid dns zone provided: cnwan_example.com"),
+		},
+		{
+			id: "dns-unknown-algorithm",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					DNSSettings: &types.DNSSettings{
+						Server:         "10.0.0.53",
+						Zone:           "example.com",
+						Authentication: types.DNSAuthWithTSIG,
+						TSIGAlgorithm:  "hmac-md5",
+					},
+				},
+			},
+			expErr: fmt.Errorf("unrecognized tsig algorithm provided: hmac-md5"),
+		},
+		{
+			id: "successful-with-dns",
+			arg: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					DNSSettings: &types.DNSSettings{
+						Server:         "10.0.0.53",
+						Zone:           "sdwan.example.com.",
+						TTL:            30,
+						Authentication: types.DNSAuthWithTSIG,
+						TSIGAlgorithm:  "HMAC-SHA512",
+					},
+				},
+			},
+			expRes: &types.Settings{
+				ServiceRegistrySettings: &types.ServiceRegistrySettings{
+					DNSSettings: &types.DNSSettings{
+						Server:         "10.0.0.53:53",
+						Zone:           "sdwan.example.com",
+						TTL:            30,
+						Authentication: types.DNSAuthWithTSIG,
+						TSIGAlgorithm:  "hmac-sha512",
+					},
+				},
+			},
+		},
+	}
+
+	for _, currCase := range cases {
+		res, err := ParseAndValidateSettings(currCase.arg)
+
+		if currCase.expRes != nil {
+			if !a.NotNil(res) {
+				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+			}
+
+			if currCase.expRes.ServiceRegistrySettings != nil {
+				if !a.NotNil(res.ServiceRegistrySettings) {
+					a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+				}
+
+				if currCase.expRes.EtcdSettings != nil {
+					if !a.Equal(*currCase.expRes.EtcdSettings, *res.EtcdSettings) {
+						a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+					}
+				}
+
+				if currCase.expRes.ServiceDirectorySettings != nil {
+					if !a.Equal(*currCase.expRes.ServiceDirectorySettings, *res.ServiceDirectorySettings) {
+						a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+					}
+				}
+
+				if !a.Equal(currCase.expRes.ConsulSettings, res.ConsulSettings) {
+					a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+				}
+
+				if !a.Equal(currCase.expRes.KubernetesSettings, res.KubernetesSettings) {
+					a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+				}
+
+				if !a.Equal(currCase.expRes.DNSSettings, res.DNSSettings) {
+					a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+				}
+			}
+
+			if currCase.expRes.GarbageCollection != nil {
+				if !a.Equal(*currCase.expRes.GarbageCollection, *res.GarbageCollection) {
+					a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+				}
+			}
+
+			if currCase.expRes.LeaderElection != nil {
+				if !a.Equal(*currCase.expRes.LeaderElection, *res.LeaderElection) {
+					a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+				}
+			}
+
+			if currCase.expRes.EndpointNaming != "" {
+				if !a.Equal(currCase.expRes.EndpointNaming, res.EndpointNaming) {
+					a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+				}
+			}
+
+			if currCase.expRes.MetadataPlacement != "" {
+				if !a.Equal(currCase.expRes.MetadataPlacement, res.MetadataPlacement) {
+					a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+				}
+			}
+
+			if !a.Equal(currCase.expRes.NodePort, res.NodePort) ||
+				!a.Equal(currCase.expRes.EndpointSlices, res.EndpointSlices) ||
+				!a.Equal(currCase.expRes.Ingress, res.Ingress) ||
+				!a.Equal(currCase.expRes.GatewayAPI, res.GatewayAPI) ||
+				!a.Equal(currCase.expRes.HostnameResolution, res.HostnameResolution) ||
+				!a.Equal(currCase.expRes.DryRun, res.DryRun) ||
+				!a.Equal(currCase.expRes.IPFamilies, res.IPFamilies) ||
+				!a.Equal(currCase.expRes.Service.AnnotationRules, res.Service.AnnotationRules) {
+				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+			}
+		}
+
+		if !a.Equal(currCase.expErr, err) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		} else {
+			continue
+		}
+
+		if !a.Equal(currCase.expRes, currCase.arg) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
+
+func TestParseEtcdPrefix(t *testing.T) {
+	a := New(t)
+	cases := []struct {
+		id     string
+		arg    string
+		expRes string
+		expErr error
+	}{
+		{id: "root", arg: "/", expRes: "/"},
+		{id: "trailing-slash", arg: " /prod/service-registry/ ", expRes: "/prod/service-registry"},
+		{id: "no-leading-slash", arg: "prod", expErr: fmt.Errorf("etcd prefix must start with /")},
+		{id: "empty-segment", arg: "/prod//registry", expErr: fmt.Errorf("etcd prefix cannot contain empty path segments")},
+		{id: "spaces", arg: "/prod registry", expErr: fmt.Errorf("etcd prefix cannot contain spaces or wildcards")},
+		{id: "wildcard", arg: "/prod/*", expErr: fmt.Errorf("etcd prefix cannot contain spaces or wildcards")},
+	}
+
+	for _, currCase := range cases {
+		res, err := parseEtcdPrefix(currCase.arg)
+		if !a.Equal(currCase.expErr, err) || !a.Equal(currCase.expRes, res) {
 			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
 		}
 	}
@@ -23,8 +23,12 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-operator/api/v1alpha1"
 	"github.com/CloudNativeSDWAN/cnwan-operator/internal/types"
 	"github.com/CloudNativeSDWAN/cnwan-operator/internal/utils"
 	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/cluster"
@@ -34,7 +38,13 @@ import (
 	"github.com/CloudNativeSDWAN/serego/api/options/wrapper"
 	"github.com/rs/zerolog"
 	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	ktypes "k8s.io/apimachinery/pkg/types"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	ctrlmanager "sigs.k8s.io/controller-runtime/pkg/manager"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -46,6 +56,13 @@ const (
 	defaultTimeout       int    = 30
 	defaultNsName        string = "cnwan-operator-system"
 
+	settingsConfigMapName string = "cnwan-operator-settings"
+
+	defaultMetricsBindAddress     string = ":8080"
+	defaultHealthProbeBindAddress string = ":8081"
+
+	etcdTLSReloadInterval = time.Minute
+
 	// Exit codes
 	Success int = iota
 	CannotGetConfigmap
@@ -61,6 +78,20 @@ const (
 	CannotCreateServiceController
 	CannotCreateNamespaceController
 	CannotRunControllerManager
+	CannotCreateGarbageCollector
+	CannotGetClusterID
+	CannotRunEventHandler
+	CannotAddHealthChecks
+	CannotCreateSettingsController
+	CannotGetOperatorConfig
+	CannotCreateNodeController
+	CannotCreateIngressController
+	CannotCreateGatewayController
+	CannotCreateHostnameResolver
+	CannotGetConsulClient
+	CannotGetKubernetesClient
+	CannotGetDNSClient
+	CannotOpenDryRunOutput
 )
 
 // var (
@@ -78,7 +109,7 @@ const (
 var log zerolog.Logger
 
 func main() {
-	log = zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout}).With().Timestamp().Logger()
+	log = newLogger(os.Stdout)
 
 	if code, err := run(); err != nil {
 		log.Err(err).Msg("error occurred")
@@ -107,8 +138,23 @@ func run() (int, error) {
 	// Load and parse settings
 	//--------------------------------------
 
+	// Settings are read from the OperatorConfig if the custom resource
+	// definition is installed and the object exists, and from the config map
+	// otherwise.
 	var settings *types.Settings
-	{
+	opCfg, err := cluster.GetOperatorConfig(ctx)
+	switch {
+	case err == nil:
+		log.Info().Msg("settings loaded successfully from operator config")
+
+		settings, err = utils.ParseAndValidateSettings(utils.SettingsFromOperatorConfig(&opCfg.Spec))
+		if err != nil {
+			return SettingsValidationError, fmt.Errorf("invalid settings provided: %w", err)
+		}
+	case meta.IsNoMatchError(err) || k8serrors.IsNotFound(err):
+		opCfg = nil
+		log.Info().Msg("no operator config found: loading settings from configmap")
+
 		settingsByte, err := cluster.GetOperatorSettingsConfigMap(ctx)
 		if err != nil {
 			return CannotGetConfigmap, fmt.Errorf("unable to retrieve settings from configmap: %w", err)
@@ -124,9 +170,20 @@ func run() (int, error) {
 		if err != nil {
 			return SettingsValidationError, fmt.Errorf("invalid settings provided: %w", err)
 		}
+	default:
+		return CannotGetOperatorConfig, fmt.Errorf("unable to retrieve operator config: %w", err)
 	}
 	log.Info().Msg("settings parsed successfully")
 
+	clusterID, err := getClusterID(ctx, settings.ClusterID)
+	if err != nil {
+		return CannotGetClusterID, fmt.Errorf("cannot get cluster ID: %w", err)
+	}
+	log.Info().Str("cluster-id", clusterID).Msg("got cluster ID")
+
+	// resolvedSettings is reported on the status of the operator config.
+	resolvedSettings := v1alpha1.OperatorConfigStatus{ClusterID: clusterID}
+
 	persistentMeta := map[string]string{
 		"owner": "cnwan-operator",
 	}
@@ -141,6 +198,8 @@ func run() (int, error) {
 				Str("cnwan.io/network", netCfg.NetworkName).
 				Str("cnwan.io/sub-network", netCfg.SubNetworkName).
 				Msg("got network configuration")
+			resolvedSettings.Network = netCfg.NetworkName
+			resolvedSettings.SubNetwork = netCfg.SubNetworkName
 			if runningIn := cluster.WhereAmIRunning(); runningIn != cluster.UnknownCluster {
 				persistentMeta["cnwan.io/platform"] = string(runningIn)
 			}
@@ -157,26 +216,29 @@ func run() (int, error) {
 	// Get the service registry
 	//--------------------------------------
 
-	var seregoClient *serego.ServiceRegistry
-
-	switch {
+	registries := map[string]serviceregistry.Registry{}
 
 	// Etcd
-	case settings.ServiceRegistrySettings.EtcdSettings != nil:
+	if settings.ServiceRegistrySettings.EtcdSettings != nil {
 		log.Info().Msg("using etcd")
-		cli, err := getEtcdClient(settings.EtcdSettings)
+		if settings.EtcdSettings.Prefix != nil {
+			log.Info().Str("prefix", *settings.EtcdSettings.Prefix).Msg("using custom etcd prefix")
+		}
+		cli, err := getEtcdClient(ctx, settings.EtcdSettings)
 		if err != nil {
 			return CannotEstablishConnectionToEtcd, fmt.Errorf("cannot establish connection to etcd: %w", err)
 		}
 		defer cli.Close()
 
-		seregoClient, err = serego.NewServiceRegistryFromEtcd(cli)
+		seregoClient, err := serego.NewServiceRegistryFromEtcd(cli)
 		if err != nil {
 			return CannotEstablishConnectionToEtcd, fmt.Errorf("cannot establish connection to etcd: %w", err)
 		}
+		registries["etcd"] = serviceregistry.NewSeregoRegistry(seregoClient)
+	}
 
-		// Service directory
-	case settings.ServiceRegistrySettings.ServiceDirectorySettings != nil:
+	// Service directory
+	if settings.ServiceRegistrySettings.ServiceDirectorySettings != nil {
 		log.Info().Msg("using Service Directory")
 		cli, err := getGSDClient(ctx)
 		if err != nil {
@@ -188,66 +250,251 @@ func run() (int, error) {
 		if err != nil {
 			return InvalidServiceDirectorySettings, fmt.Errorf("invalid service directory: %w", err)
 		}
+		resolvedSettings.ProjectID = sdSettings.ProjectID
+		resolvedSettings.Region = sdSettings.DefaultRegion
 
-		seregoClient, err = serego.NewServiceRegistryFromServiceDirectory(cli,
+		seregoClient, err := serego.NewServiceRegistryFromServiceDirectory(cli,
 			wrapper.WithProjectID(sdSettings.ProjectID),
 			wrapper.WithRegion(sdSettings.DefaultRegion))
 		if err != nil {
 			return CannotGetServiceDirectoryClient, fmt.Errorf("cannot get service directory client: %w", err)
 		}
+		registries["gcpServiceDirectory"] = serviceregistry.NewSeregoRegistry(seregoClient)
+	}
 
-		// Cloud Map
-	case settings.ServiceRegistrySettings.CloudMapSettings != nil:
+	// Cloud Map
+	if settings.ServiceRegistrySettings.CloudMapSettings != nil {
 		log.Info().Msg("using Cloud Map")
 		cmSettings, err := parseAndResetAWSCloudMapSettings(settings.CloudMapSettings)
 		if err != nil {
 			return InvalidCloudMapSettings, fmt.Errorf("invalid cloud map settings: %w", err)
 		}
+		resolvedSettings.Region = cmSettings.DefaultRegion
 
 		cli, err := getAWSClient(ctx, &cmSettings.DefaultRegion)
 		if err != nil {
 			return CannotGetCloudMapClient, fmt.Errorf("cannot get cloud map client: %w", err)
 		}
 
-		seregoClient, _ = serego.NewServiceRegistryFromCloudMap(cli)
+		seregoClient, _ := serego.NewServiceRegistryFromCloudMap(cli)
+		registries["awsCloudMap"] = serviceregistry.NewSeregoRegistry(seregoClient)
+	}
+
+	// Consul
+	if settings.ServiceRegistrySettings.ConsulSettings != nil {
+		log.Info().Str("address", settings.ConsulSettings.Address).Msg("using Consul")
+		registries["consul"], err = getConsulRegistry(ctx, settings.ConsulSettings)
+		if err != nil {
+			return CannotGetConsulClient, fmt.Errorf("cannot get consul client: %w", err)
+		}
+	}
+
+	// Kubernetes
+	if settings.ServiceRegistrySettings.KubernetesSettings != nil {
+		log.Info().Msg("using Kubernetes")
+		registries["kubernetes"], err = getKubernetesRegistry(ctx, settings.KubernetesSettings)
+		if err != nil {
+			return CannotGetKubernetesClient, fmt.Errorf("cannot get kubernetes client: %w", err)
+		}
+	}
+
+	// DNS
+	if settings.ServiceRegistrySettings.DNSSettings != nil {
+		log.Info().Str("server", settings.DNSSettings.Server).Str("zone", settings.DNSSettings.Zone).Msg("using DNS")
+		registries["dns"], err = getDNSRegistry(ctx, settings.DNSSettings)
+		if err != nil {
+			return CannotGetDNSClient, fmt.Errorf("cannot get dns client: %w", err)
+		}
+	}
+
+	if dr := settings.DryRun; dr != nil {
+		out, closeOut, err := openDryRunOutput(dr.Output)
+		if err != nil {
+			return CannotOpenDryRunOutput, fmt.Errorf("cannot open dry run output: %w", err)
+		}
+		defer closeOut()
+
+		for _, name := range dr.Registries {
+			log.Warn().Str("registry", name).Str("output", dr.Output).
+				Msg("dry run: objects will not be registered or deregistered on this service registry")
+			registries[name] = serviceregistry.NewDryRunRegistry(registries[name], name, out, log)
+		}
+	}
+
+	registryNames := []string{}
+	for name := range registries {
+		registryNames = append(registryNames, name)
+	}
+	sort.Strings(registryNames)
+	resolvedSettings.ServiceRegistry = strings.Join(registryNames, ",")
+	if len(registryNames) > 1 {
+		log.Info().Strs("registries", registryNames).Msg("registering objects on multiple service registries")
+	}
+
+	mgrOpts := &controllers.ManagerOptions{
+		MetricsBindAddress:     defaultMetricsBindAddress,
+		HealthProbeBindAddress: defaultHealthProbeBindAddress,
+	}
+	if settings.Metrics != nil && settings.Metrics.BindAddress != "" {
+		mgrOpts.MetricsBindAddress = settings.Metrics.BindAddress
+	}
+
+	if le := settings.LeaderElection; le != nil && le.Enabled != nil && *le.Enabled {
+		leOpts := &controllers.LeaderElectionOptions{
+			Namespace:     le.Namespace,
+			Name:          le.Name,
+			LeaseDuration: le.LeaseDuration,
+			RenewDeadline: le.RenewDeadline,
+			RetryPeriod:   le.RetryPeriod,
+		}
+		if leOpts.Namespace == "" {
+			leOpts.Namespace = nsName
+		}
+		mgrOpts.LeaderElection = leOpts
+		log.Info().Str("namespace", leOpts.Namespace).Msg("leader election enabled")
 	}
 
-	manager, err := controllers.NewManager("")
+	manager, err := controllers.NewManager("", mgrOpts)
 	if err != nil {
-		log.Err(err).Msg("cannot create manager")
-		return 1, err
-	}
-
-	stopChan := make(chan os.Signal, 1)
-	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
-	watchCtx, watchCanc := context.WithCancel(ctx)
-	exitChan := make(chan struct{})
-	go func() {
-		defer close(exitChan)
-		eventsChan := make(chan *serviceregistry.Event, 100)
-		eventHandler := serviceregistry.NewEventHandler(seregoClient, persistentMeta, log)
-
-		go func() {
-			eventHandler.WatchForEvents(watchCtx, eventsChan)
-			close(exitChan)
-		}()
-
-		controllers.NewNamespaceController(manager, &controllers.ControllerOptions{
-			EventsChan:         eventsChan,
-			ServiceAnnotations: settings.Service.Annotations,
-		}, log)
-		controllers.NewServiceController(manager, &controllers.ControllerOptions{
-			EventsChan:         eventsChan,
-			ServiceAnnotations: settings.Service.Annotations,
-		}, log)
-
-		manager.Start(ctx)
-		log.Info().Msg("closing")
-	}()
-
-	<-stopChan
-	watchCanc()
-	<-exitChan
+		return CannotGetControllerManager, fmt.Errorf("cannot create manager: %w", err)
+	}
+
+	eventsChan := make(chan *serviceregistry.Event, 100)
+	eventHandler := serviceregistry.NewEventHandler(registries, clusterID, persistentMeta, log)
+	if err := ctrlmetrics.Registry.Register(eventHandler); err != nil {
+		log.Err(err).Msg("cannot register event handler metrics, skipping...")
+	}
+
+	if err := manager.AddReadyzCheck("service-registry", eventHandler.CheckRegistry); err != nil {
+		return CannotAddHealthChecks, fmt.Errorf("cannot add readiness check: %w", err)
+	}
+
+	if err := manager.AddHealthzCheck("events-dispatcher", eventHandler.CheckDispatcher); err != nil {
+		return CannotAddHealthChecks, fmt.Errorf("cannot add health check: %w", err)
+	}
+	resolverOpts := controllers.HostnameResolverOptions{}
+	if hr := settings.HostnameResolution; hr != nil {
+		resolverOpts = controllers.HostnameResolverOptions{
+			Nameserver:        hr.Nameserver,
+			Interval:          hr.Interval,
+			Timeout:           hr.Timeout,
+			RegisterHostnames: hr.RegisterHostnames,
+		}
+	}
+	resolver := controllers.NewHostnameResolver(resolverOpts, log)
+	if err := manager.Add(resolver); err != nil {
+		return CannotCreateHostnameResolver, fmt.Errorf("cannot add hostname resolver: %w", err)
+	}
+
+	ctrlOpts := &controllers.ControllerOptions{
+		EventsChan: eventsChan,
+		Resolver:   resolver,
+	}
+	if _, err := ctrlOpts.UpdateWatchSettings(settings.WatchNamespacesByDefault, settings.Service); err != nil {
+		return SettingsValidationError, fmt.Errorf("invalid settings provided: %w", err)
+	}
+
+	if np := settings.NodePort; np != nil && np.Enabled {
+		ctrlOpts.NodePortAddressType = corev1.NodeAddressType(np.AddressType)
+		if _, err := controllers.NewNodeController(manager, ctrlOpts, log); err != nil {
+			return CannotCreateNodeController, fmt.Errorf("cannot create node controller: %w", err)
+		}
+		log.Info().Str("address-type", string(np.AddressType)).Msg("registering NodePort services")
+	}
+
+	if es := settings.EndpointSlices; es != nil && es.Enabled {
+		ctrlOpts.EndpointSlices = true
+		log.Info().Msg("registering ClusterIP services with the addresses of their pods")
+	}
+
+	if ing := settings.Ingress; ing != nil && ing.Enabled {
+		ctrlOpts.Ingresses = true
+		if _, err := controllers.NewIngressController(manager, ctrlOpts, log); err != nil {
+			return CannotCreateIngressController, fmt.Errorf("cannot create ingress controller: %w", err)
+		}
+		log.Info().Msg("registering ingresses")
+	}
+
+	for _, family := range settings.IPFamilies {
+		ctrlOpts.IPFamilies = append(ctrlOpts.IPFamilies, corev1.IPFamily(family))
+	}
+
+	if settings.EndpointNaming == types.EndpointNamingReadable {
+		ctrlOpts.ReadableEndpointNames = true
+		log.Info().Msg("naming endpoints after their ports and addresses")
+	}
+
+	if settings.MetadataPlacement == types.MetadataPlacementHierarchical {
+		ctrlOpts.HierarchicalMetadata = true
+		log.Info().Msg("registering metadata on namespaces and services")
+	}
+
+	if gw := settings.GatewayAPI; gw != nil && gw.Enabled {
+		ctrlOpts.Gateways = true
+		if _, err := controllers.NewGatewayController(manager, ctrlOpts, log); err != nil {
+			return CannotCreateGatewayController, fmt.Errorf("cannot create gateway controller: %w", err)
+		}
+
+		if gw.HTTPRoutes {
+			ctrlOpts.HTTPRoutes = true
+			if _, err := controllers.NewHTTPRouteController(manager, ctrlOpts, log); err != nil {
+				return CannotCreateGatewayController, fmt.Errorf("cannot create http route controller: %w", err)
+			}
+		}
+		log.Info().Bool("http-routes", gw.HTTPRoutes).Msg("registering Gateway API gateways")
+	}
+
+	if _, err := controllers.NewNamespaceController(manager, ctrlOpts, log); err != nil {
+		return CannotCreateNamespaceController, fmt.Errorf("cannot create namespace controller: %w", err)
+	}
+
+	if _, err := controllers.NewServiceController(manager, ctrlOpts, log); err != nil {
+		return CannotCreateServiceController, fmt.Errorf("cannot create service controller: %w", err)
+	}
+
+	if opCfg != nil {
+		opCfgOpts := &controllers.OperatorConfigOptions{
+			Name:          ktypes.NamespacedName{Namespace: opCfg.Namespace, Name: opCfg.Name},
+			Settings:      settings,
+			Status:        resolvedSettings,
+			CheckRegistry: eventHandler.CheckRegistryConnection,
+		}
+		if _, err := controllers.NewOperatorConfigController(manager, ctrlOpts, opCfgOpts, log); err != nil {
+			return CannotCreateSettingsController, fmt.Errorf("cannot create operator config controller: %w", err)
+		}
+	} else {
+		settingsConfigMap := ktypes.NamespacedName{Namespace: nsName, Name: settingsConfigMapName}
+		if _, err := controllers.NewSettingsController(manager, ctrlOpts, settings, settingsConfigMap, log); err != nil {
+			return CannotCreateSettingsController, fmt.Errorf("cannot create settings controller: %w", err)
+		}
+	}
+
+	gcOpts := &controllers.GarbageCollectorOptions{Lister: eventHandler}
+	if settings.GarbageCollection != nil {
+		gcOpts.Interval = settings.GarbageCollection.Interval
+		gcOpts.DryRun = settings.GarbageCollection.DryRun
+	}
+	if err := controllers.NewGarbageCollector(manager, ctrlOpts, gcOpts, log); err != nil {
+		return CannotCreateGarbageCollector, fmt.Errorf("cannot create garbage collector: %w", err)
+	}
+
+	// The event handler is run by the manager, so that -- like the
+	// controllers -- it only runs when this replica is the leader and it is
+	// stopped, with all its namespace workers, before the lease is released.
+	if err := manager.Add(ctrlmanager.RunnableFunc(func(ctx context.Context) error {
+		return eventHandler.WatchForEvents(ctx, eventsChan)
+	})); err != nil {
+		return CannotRunEventHandler, fmt.Errorf("cannot add event handler to manager: %w", err)
+	}
+
+	sigCtx, sigCanc := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer sigCanc()
+
+	// This blocks until a signal is received or, in case leader election is
+	// enabled, the lease is lost.
+	if err := manager.Start(sigCtx); err != nil {
+		return CannotRunControllerManager, fmt.Errorf("error while running controller manager: %w", err)
+	}
 
 	log.Info().Msg("goodbye!")
 	return Success, nil
@@ -0,0 +1,49 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package cluster
+
+import (
+	"context"
+	"crypto/tls"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// NewConsulTLSConfig returns a TLS configuration to connect to Consul, with
+// the certificates loaded from the Consul TLS secret.
+//
+// If the secret does not exist, the system's CAs are used to verify the
+// Consul servers and no client certificate is sent.
+func NewConsulTLSConfig(ctx context.Context) (*tls.Config, error) {
+	secret, err := GetConsulTLSSecret(ctx)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return &tls.Config{MinVersion: tls.VersionTLS12}, nil
+		}
+
+		return nil, err
+	}
+
+	c := &EtcdTLSConfig{}
+	if err := c.load(secret); err != nil {
+		return nil, err
+	}
+
+	return c.TLSConfig(), nil
+}
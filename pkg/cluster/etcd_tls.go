@@ -0,0 +1,131 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package cluster
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync"
+)
+
+// EtcdTLSConfig provides a TLS configuration to connect to etcd, whose
+// certificates can be reloaded without creating a new client.
+//
+// Reloaded certificates are used for all connections established after the
+// reload, e.g. when the client reconnects to an etcd server.
+type EtcdTLSConfig struct {
+	lock        sync.RWMutex
+	rootCAs     *x509.CertPool
+	certificate *tls.Certificate
+}
+
+// NewEtcdTLSConfig returns a new EtcdTLSConfig with the certificates loaded
+// from the etcd TLS secret.
+func NewEtcdTLSConfig(ctx context.Context) (*EtcdTLSConfig, error) {
+	c := &EtcdTLSConfig{}
+	if err := c.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reload loads the certificates from the etcd TLS secret again. The current
+// certificates are kept in case of errors.
+func (c *EtcdTLSConfig) Reload(ctx context.Context) error {
+	secret, err := GetEtcdTLSSecret(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.load(secret)
+}
+
+func (c *EtcdTLSConfig) load(secret *EtcdTLSSecret) error {
+	var rootCAs *x509.CertPool
+	if len(secret.CA) > 0 {
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(secret.CA) {
+			return fmt.Errorf("cannot parse CA certificate")
+		}
+	}
+
+	var certificate *tls.Certificate
+	if len(secret.Certificate) > 0 {
+		cert, err := tls.X509KeyPair(secret.Certificate, secret.Key)
+		if err != nil {
+			return fmt.Errorf("cannot parse client certificate: %w", err)
+		}
+		certificate = &cert
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.rootCAs, c.certificate = rootCAs, certificate
+	return nil
+}
+
+// TLSConfig returns a TLS configuration that always uses the certificates
+// that were loaded last.
+func (c *EtcdTLSConfig) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			c.lock.RLock()
+			defer c.lock.RUnlock()
+
+			if c.certificate == nil {
+				// No certificate is sent to the server.
+				return &tls.Certificate{}, nil
+			}
+
+			return c.certificate, nil
+		},
+
+		// The default verification is disabled only because it would use
+		// the CAs provided at creation, and is replaced by the one below,
+		// which uses the ones that were loaded last.
+		InsecureSkipVerify: true,
+		VerifyConnection:   c.verifyConnection,
+	}
+}
+
+func (c *EtcdTLSConfig) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("server did not provide any certificate")
+	}
+
+	c.lock.RLock()
+	rootCAs := c.rootCAs
+	c.lock.RUnlock()
+
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         rootCAs,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
@@ -0,0 +1,165 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package cluster
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCertificate struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCertificate(t *testing.T, name string, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	parentCert, parentKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	return &testCertificate{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func handshake(t *testing.T, serverCfg, clientCfg *tls.Config) error {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+
+		srv := tls.Server(conn, serverCfg)
+		if err := srv.Handshake(); err != nil {
+			serverErr <- err
+			return
+		}
+
+		// Make sure the client's certificate was verified as well.
+		_, err = srv.Write([]byte("ok"))
+		serverErr <- err
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), clientCfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 2)); err != nil {
+		return err
+	}
+
+	return <-serverErr
+}
+
+func TestEtcdTLSConfig(t *testing.T) {
+	a := assert.New(t)
+
+	ca := newTestCertificate(t, "ca", nil)
+	server := newTestCertificate(t, "etcd", ca)
+	client := newTestCertificate(t, "cnwan-operator", ca)
+	otherCA := newTestCertificate(t, "other-ca", nil)
+
+	serverCert, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	a.NoError(err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	serverCfg := &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+
+	c := &EtcdTLSConfig{}
+	a.Error(c.load(&EtcdTLSSecret{CA: []byte("invalid")}))
+	a.Error(c.load(&EtcdTLSSecret{CA: ca.certPEM, Certificate: client.certPEM, Key: otherCA.keyPEM}))
+
+	// Wrong CA
+	a.NoError(c.load(&EtcdTLSSecret{CA: otherCA.certPEM, Certificate: client.certPEM, Key: client.keyPEM}))
+	clientCfg := c.TLSConfig()
+	clientCfg.ServerName = "etcd"
+	a.Error(handshake(t, serverCfg, clientCfg))
+
+	// The CA is reloaded without creating a new configuration.
+	a.NoError(c.load(&EtcdTLSSecret{CA: ca.certPEM, Certificate: client.certPEM, Key: client.keyPEM}))
+	a.NoError(handshake(t, serverCfg, clientCfg))
+
+	// Wrong server name
+	wrongNameCfg := c.TLSConfig()
+	wrongNameCfg.ServerName = "not-etcd"
+	a.Error(handshake(t, serverCfg, wrongNameCfg))
+
+	// No client certificate
+	a.NoError(c.load(&EtcdTLSSecret{CA: ca.certPEM}))
+	a.Error(handshake(t, serverCfg, clientCfg))
+	serverCfg.ClientAuth = tls.NoClientCert
+	a.NoError(handshake(t, serverCfg, clientCfg))
+}
@@ -0,0 +1,111 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	gcpmetadata "cloud.google.com/go/compute/metadata"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	awssess "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	gkeClusterLocationAttr string = "cluster-location"
+	eksClusterNameTag      string = "eks:cluster-name"
+	kubeSystemNamespace    string = "kube-system"
+)
+
+// GetClusterIDFromGKE returns an identifier of the GKE cluster where the
+// operator is running, in the same format used by gcloud for kubeconfig
+// contexts, i.e. gke_<project>_<location>_<name>.
+func GetClusterIDFromGKE(ctx context.Context) (string, error) {
+	if iAmIn != GKECluster {
+		return "", fmt.Errorf("not running in GKE or no permissions to get metadata from GKE")
+	}
+
+	projectID, err := gcpmetadata.ProjectID()
+	if err != nil {
+		return "", err
+	}
+
+	location, err := gcpmetadata.InstanceAttributeValue(gkeClusterLocationAttr)
+	if err != nil {
+		return "", err
+	}
+
+	clusterName, err := gcpmetadata.InstanceAttributeValue(gkeClusterNameAttr)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("gke_%s_%s_%s", projectID, location, clusterName), nil
+}
+
+// GetClusterIDFromEKS returns an identifier of the EKS cluster where the
+// operator is running, in the format eks_<account>_<region>_<name>.
+func GetClusterIDFromEKS(ctx context.Context) (string, error) {
+	if iAmIn != EKSCluster {
+		return "", fmt.Errorf("not running in EKS or no permissions to get metadata from EKS")
+	}
+
+	sess := awssess.Must(awssess.NewSession())
+	doc, err := ec2metadata.New(sess).GetInstanceIdentityDocumentWithContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	ec2cli := ec2.New(sess, aws.NewConfig().WithRegion(doc.Region))
+	out, err := ec2cli.DescribeTagsWithContext(ctx, &ec2.DescribeTagsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("resource-id"), Values: aws.StringSlice([]string{doc.InstanceID})},
+			{Name: aws.String("key"), Values: aws.StringSlice([]string{eksClusterNameTag})},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(out.Tags) == 0 {
+		return "", fmt.Errorf("could not find tag %s on currently running instance", eksClusterNameTag)
+	}
+
+	return fmt.Sprintf("eks_%s_%s_%s", doc.AccountID, doc.Region, aws.StringValue(out.Tags[0].Value)), nil
+}
+
+// GetClusterUID returns the UID of the kube-system namespace, which is
+// commonly used to uniquely identify a cluster as it never changes for
+// the whole life of the cluster.
+func GetClusterUID(ctx context.Context) (string, error) {
+	cli, err := getK8sClientSet()
+	if err != nil {
+		return "", err
+	}
+
+	ns, err := cli.CoreV1().Namespaces().Get(ctx, kubeSystemNamespace, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	return string(ns.UID), nil
+}
@@ -0,0 +1,71 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetClusterUID(t *testing.T) {
+	anyErr := fmt.Errorf("any")
+	cases := []struct {
+		kcli   kubernetes.Interface
+		expRes string
+		expErr error
+	}{
+		{
+			kcli:   fake.NewSimpleClientset(),
+			expErr: anyErr,
+		},
+		{
+			kcli: fake.NewSimpleClientset(&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: kubeSystemNamespace,
+					UID:  "5ba3a5e1-36b4-4a4c-a1b7-6a4d3e5c4e1f",
+				},
+			}),
+			expRes: "5ba3a5e1-36b4-4a4c-a1b7-6a4d3e5c4e1f",
+		},
+	}
+
+	for i, currCase := range cases {
+		a := assert.New(t)
+		kcli = currCase.kcli
+		res, err := GetClusterUID(context.Background())
+		if currCase.expErr == anyErr {
+			if err == nil {
+				a.FailNow("case failed: was expecting error but no error occurred", "i", i)
+			}
+			continue
+		}
+
+		if !a.Equal(currCase.expRes, res) || !a.Equal(currCase.expErr, err) {
+			a.FailNow("case failed", "i", i)
+		}
+		kcli = nil
+	}
+}
@@ -22,10 +22,14 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/CloudNativeSDWAN/cnwan-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
@@ -33,11 +37,18 @@ const (
 	defaultGoogleServiceAccountSecretName string = "google-service-account"
 	defaultAwsCredentialsSecret           string = "aws-credentials"
 	defaultEtcdCredentialsSecretName      string = "etcd-credentials"
+	defaultEtcdTLSSecretName              string = "etcd-tls"
+	defaultConsulACLTokenSecretName       string = "consul-acl-token"
+	defaultConsulTLSSecretName            string = "consul-tls"
+	defaultDNSTSIGSecretName              string = "dns-tsig"
 	defaultOpSettingsConfigmapName        string = "cnwan-operator-settings"
+	defaultOperatorConfigName             string = "cnwan-operator"
 )
 
 var (
 	kcli kubernetes.Interface
+	// crcli is used for custom resources, which are not supported by kcli.
+	crcli client.Client
 )
 
 func getK8sClientSet() (kubernetes.Interface, error) {
@@ -58,6 +69,29 @@ func getK8sClientSet() (kubernetes.Interface, error) {
 	return kcli, nil
 }
 
+func getK8sClient() (client.Client, error) {
+	if crcli != nil {
+		return crcli, nil
+	}
+
+	k8sconf, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := k8sruntime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	crcli, err = client.New(k8sconf, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+
+	return crcli, nil
+}
+
 func getSecret(ctx context.Context, name string) (*corev1.Secret, error) {
 	cli, err := getK8sClientSet()
 	if err != nil {
@@ -133,6 +167,108 @@ func GetEtcdCredentialsSecret(ctx context.Context) (string, string, error) {
 	return string(secret.Data["username"]), string(secret.Data["password"]), nil
 }
 
+// EtcdTLSSecret contains the PEM-encoded certificates used to connect to etcd
+// with TLS.
+type EtcdTLSSecret struct {
+	// CA is the certificate of the authority that signed the certificates
+	// of the etcd servers. If empty, the system's ones are used.
+	CA []byte
+	// Certificate and Key are the client's certificate and key, used for
+	// mutual TLS. They can be empty if etcd does not require clients to
+	// authenticate with certificates.
+	Certificate []byte
+	Key         []byte
+}
+
+// GetEtcdTLSSecret tries to retrieve the secret with the certificates needed
+// to connect to etcd with TLS.
+//
+// The secret is expected to have the same format as the kubernetes.io/tls
+// ones, i.e. with ca.crt, tls.crt and tls.key keys.
+func GetEtcdTLSSecret(ctx context.Context) (*EtcdTLSSecret, error) {
+	return getTLSSecret(ctx, defaultEtcdTLSSecretName)
+}
+
+// GetConsulTLSSecret tries to retrieve the secret with the certificates
+// needed to connect to Consul with TLS. It has the same format as the one
+// for etcd.
+func GetConsulTLSSecret(ctx context.Context) (*EtcdTLSSecret, error) {
+	return getTLSSecret(ctx, defaultConsulTLSSecretName)
+}
+
+func getTLSSecret(ctx context.Context, name string) (*EtcdTLSSecret, error) {
+	secret, err := getSecret(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &EtcdTLSSecret{
+		CA:          secret.Data["ca.crt"],
+		Certificate: secret.Data["tls.crt"],
+		Key:         secret.Data["tls.key"],
+	}
+
+	if len(data.CA) == 0 && len(data.Certificate) == 0 && len(data.Key) == 0 {
+		return nil, fmt.Errorf(`secret %s/%s has no data`, defaultK8sNamespace, name)
+	}
+
+	if (len(data.Certificate) == 0) != (len(data.Key) == 0) {
+		return nil, fmt.Errorf(`secret %s/%s must have both tls.crt and tls.key or none of them`, defaultK8sNamespace, name)
+	}
+
+	return data, nil
+}
+
+// GetConsulACLTokenSecret tries to retrieve the ACL token used to
+// authenticate to Consul, which is expected in the token key of its secret.
+func GetConsulACLTokenSecret(ctx context.Context) (string, error) {
+	secret, err := getSecret(ctx, defaultConsulACLTokenSecretName)
+	if err != nil {
+		return "", err
+	}
+
+	token := string(secret.Data["token"])
+	if token == "" {
+		return "", fmt.Errorf(`secret %s/%s has no token`, defaultK8sNamespace, defaultConsulACLTokenSecretName)
+	}
+
+	return token, nil
+}
+
+// GetDNSTSIGSecret tries to retrieve the name and the base64 encoded secret
+// of the TSIG key used to sign the updates sent to the DNS server, which are
+// expected in the name and secret keys of its secret.
+func GetDNSTSIGSecret(ctx context.Context) (string, string, error) {
+	secret, err := getSecret(ctx, defaultDNSTSIGSecretName)
+	if err != nil {
+		return "", "", err
+	}
+
+	name, key := string(secret.Data["name"]), string(secret.Data["secret"])
+	if name == "" || key == "" {
+		return "", "", fmt.Errorf(`secret %s/%s must have both name and secret`, defaultK8sNamespace, defaultDNSTSIGSecretName)
+	}
+
+	return name, key, nil
+}
+
+// GetKubeconfigSecret tries to retrieve the kubeconfig of a remote cluster,
+// which is expected in the kubeconfig key of the secret with the provided
+// name.
+func GetKubeconfigSecret(ctx context.Context, name string) ([]byte, error) {
+	secret, err := getSecret(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	kubeconfig := secret.Data["kubeconfig"]
+	if len(kubeconfig) == 0 {
+		return nil, fmt.Errorf(`secret %s/%s has no kubeconfig`, defaultK8sNamespace, name)
+	}
+
+	return kubeconfig, nil
+}
+
 func GetOperatorSettingsConfigMap(ctx context.Context) ([]byte, error) {
 	cli, err := getK8sClientSet()
 	if err != nil {
@@ -160,3 +296,24 @@ func GetOperatorSettingsConfigMap(ctx context.Context) ([]byte, error) {
 
 	return data, err
 }
+
+// GetOperatorConfig tries to retrieve the OperatorConfig with the settings of
+// the operator.
+//
+// The returned error can be checked with meta.IsNoMatchError to know if the
+// OperatorConfig custom resource definition is not installed in the cluster,
+// in which case the settings should be read from the config map.
+func GetOperatorConfig(ctx context.Context) (*v1alpha1.OperatorConfig, error) {
+	cli, err := getK8sClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO: May change this on future to use a different namespace.
+	var opCfg v1alpha1.OperatorConfig
+	if err := cli.Get(ctx, ktypes.NamespacedName{Namespace: defaultK8sNamespace, Name: defaultOperatorConfigName}, &opCfg); err != nil {
+		return nil, err
+	}
+
+	return &opCfg, nil
+}
@@ -23,11 +23,16 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/CloudNativeSDWAN/cnwan-operator/api/v1alpha1"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestGetGoogleServiceAccountSecret(t *testing.T) {
@@ -174,6 +179,233 @@ func TestGetEtcdCredentialsSecret(t *testing.T) {
 	}
 }
 
+func TestGetEtcdTLSSecret(t *testing.T) {
+
+	anyErr := fmt.Errorf("any")
+	newSecret := func(data map[string][]byte) kubernetes.Interface {
+		return fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaultEtcdTLSSecretName,
+				Namespace: defaultK8sNamespace,
+			},
+			Data: data,
+		})
+	}
+	cases := []struct {
+		kcli   kubernetes.Interface
+		expRes *EtcdTLSSecret
+		expErr error
+	}{
+		{
+			kcli:   fake.NewSimpleClientset(),
+			expErr: anyErr,
+		},
+		{
+			kcli:   newSecret(nil),
+			expErr: fmt.Errorf(`secret %s/%s has no data`, defaultK8sNamespace, defaultEtcdTLSSecretName),
+		},
+		{
+			kcli: newSecret(map[string][]byte{
+				"ca.crt":  []byte("ca"),
+				"tls.crt": []byte("crt"),
+			}),
+			expErr: fmt.Errorf(`secret %s/%s must have both tls.crt and tls.key or none of them`, defaultK8sNamespace, defaultEtcdTLSSecretName),
+		},
+		{
+			kcli: newSecret(map[string][]byte{
+				"ca.crt": []byte("ca"),
+			}),
+			expRes: &EtcdTLSSecret{CA: []byte("ca")},
+		},
+		{
+			kcli: newSecret(map[string][]byte{
+				"ca.crt":  []byte("ca"),
+				"tls.crt": []byte("crt"),
+				"tls.key": []byte("key"),
+			}),
+			expRes: &EtcdTLSSecret{CA: []byte("ca"), Certificate: []byte("crt"), Key: []byte("key")},
+		},
+	}
+
+	for i, currCase := range cases {
+		a := assert.New(t)
+		kcli = currCase.kcli
+		res, err := GetEtcdTLSSecret(context.Background())
+
+		if currCase.expErr == anyErr {
+			if err == nil {
+				a.FailNow("case failed: was expecting error but no error occurred", "i", i)
+			}
+
+			continue
+		}
+
+		if !a.Equal(currCase.expRes, res) || !a.Equal(currCase.expErr, err) {
+			a.FailNow("case failed", "i", i)
+		}
+
+		kcli = nil
+	}
+}
+
+func TestGetConsulACLTokenSecret(t *testing.T) {
+
+	anyErr := fmt.Errorf("any")
+	newSecret := func(data map[string][]byte) kubernetes.Interface {
+		return fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaultConsulACLTokenSecretName,
+				Namespace: defaultK8sNamespace,
+			},
+			Data: data,
+		})
+	}
+	cases := []struct {
+		kcli   kubernetes.Interface
+		expRes string
+		expErr error
+	}{
+		{
+			kcli:   fake.NewSimpleClientset(),
+			expErr: anyErr,
+		},
+		{
+			kcli:   newSecret(map[string][]byte{"other": []byte("token")}),
+			expErr: fmt.Errorf(`secret %s/%s has no token`, defaultK8sNamespace, defaultConsulACLTokenSecretName),
+		},
+		{
+			kcli:   newSecret(map[string][]byte{"token": []byte("secret")}),
+			expRes: "secret",
+		},
+	}
+
+	for i, currCase := range cases {
+		a := assert.New(t)
+		kcli = currCase.kcli
+		res, err := GetConsulACLTokenSecret(context.Background())
+
+		if currCase.expErr == anyErr {
+			if err == nil {
+				a.FailNow("case failed: was expecting error but no error occurred", "i", i)
+			}
+
+			continue
+		}
+
+		if !a.Equal(currCase.expRes, res) || !a.Equal(currCase.expErr, err) {
+			a.FailNow("case failed", "i", i)
+		}
+
+		kcli = nil
+	}
+}
+
+func TestGetDNSTSIGSecret(t *testing.T) {
+
+	anyErr := fmt.Errorf("any")
+	newSecret := func(data map[string][]byte) kubernetes.Interface {
+		return fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaultDNSTSIGSecretName,
+				Namespace: defaultK8sNamespace,
+			},
+			Data: data,
+		})
+	}
+	cases := []struct {
+		kcli    kubernetes.Interface
+		expName string
+		expKey  string
+		expErr  error
+	}{
+		{
+			kcli:   fake.NewSimpleClientset(),
+			expErr: anyErr,
+		},
+		{
+			kcli:   newSecret(map[string][]byte{"name": []byte("cnwan")}),
+			expErr: fmt.Errorf(`secret %s/%s must have both name and secret`, defaultK8sNamespace, defaultDNSTSIGSecretName),
+		},
+		{
+			kcli:    newSecret(map[string][]byte{"name": []byte("cnwan"), "secret": []byte("c2VjcmV0")}),
+			expName: "cnwan",
+			expKey:  "c2VjcmV0",
+		},
+	}
+
+	for i, currCase := range cases {
+		a := assert.New(t)
+		kcli = currCase.kcli
+		name, key, err := GetDNSTSIGSecret(context.Background())
+
+		if currCase.expErr == anyErr {
+			if err == nil {
+				a.FailNow("case failed: was expecting error but no error occurred", "i", i)
+			}
+
+			continue
+		}
+
+		if !a.Equal(currCase.expName, name) || !a.Equal(currCase.expKey, key) || !a.Equal(currCase.expErr, err) {
+			a.FailNow("case failed", "i", i)
+		}
+
+		kcli = nil
+	}
+}
+
+func TestGetKubeconfigSecret(t *testing.T) {
+
+	anyErr := fmt.Errorf("any")
+	newSecret := func(data map[string][]byte) kubernetes.Interface {
+		return fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hub-kubeconfig",
+				Namespace: defaultK8sNamespace,
+			},
+			Data: data,
+		})
+	}
+	cases := []struct {
+		kcli   kubernetes.Interface
+		expRes []byte
+		expErr error
+	}{
+		{
+			kcli:   fake.NewSimpleClientset(),
+			expErr: anyErr,
+		},
+		{
+			kcli:   newSecret(map[string][]byte{"config": []byte("apiVersion: v1")}),
+			expErr: fmt.Errorf(`secret %s/%s has no kubeconfig`, defaultK8sNamespace, "hub-kubeconfig"),
+		},
+		{
+			kcli:   newSecret(map[string][]byte{"kubeconfig": []byte("apiVersion: v1")}),
+			expRes: []byte("apiVersion: v1"),
+		},
+	}
+
+	for i, currCase := range cases {
+		a := assert.New(t)
+		kcli = currCase.kcli
+		res, err := GetKubeconfigSecret(context.Background(), "hub-kubeconfig")
+
+		if currCase.expErr == anyErr {
+			if err == nil {
+				a.FailNow("case failed: was expecting error but no error occurred", "i", i)
+			}
+
+			continue
+		}
+
+		if !a.Equal(currCase.expRes, res) || !a.Equal(currCase.expErr, err) {
+			a.FailNow("case failed", "i", i)
+		}
+
+		kcli = nil
+	}
+}
+
 func TestGetOperatorSettingsConfigMap(t *testing.T) {
 
 	anyErr := fmt.Errorf("any")
@@ -251,3 +483,55 @@ func TestGetOperatorSettingsConfigMap(t *testing.T) {
 		kcli = nil
 	}
 }
+
+func TestGetOperatorConfig(t *testing.T) {
+	scheme := k8sruntime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	opCfg := &v1alpha1.OperatorConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaultOperatorConfigName,
+			Namespace: defaultK8sNamespace,
+		},
+		Spec: v1alpha1.OperatorConfigSpec{
+			ClusterID: "cluster-1",
+		},
+	}
+
+	cases := []struct {
+		crcli  client.Client
+		expRes *v1alpha1.OperatorConfigSpec
+		expErr bool
+	}{
+		{
+			crcli:  ctrlfake.NewClientBuilder().WithScheme(scheme).Build(),
+			expErr: true,
+		},
+		{
+			crcli:  ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(opCfg).Build(),
+			expRes: &opCfg.Spec,
+		},
+	}
+
+	for i, currCase := range cases {
+		a := assert.New(t)
+		crcli = currCase.crcli
+		res, err := GetOperatorConfig(context.Background())
+
+		if currCase.expErr {
+			if !a.True(k8serrors.IsNotFound(err)) {
+				a.FailNow("case failed: was expecting not found error", "i", i)
+			}
+
+			continue
+		}
+
+		if !a.NoError(err) || !a.Equal(currCase.expRes, &res.Spec) {
+			a.FailNow("case failed", "i", i)
+		}
+
+		crcli = nil
+	}
+}
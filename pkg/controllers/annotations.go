@@ -0,0 +1,215 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/internal/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// annotationRule is an annotation rule with its regular expression compiled.
+type annotationRule struct {
+	types.AnnotationRule
+	keyRegex *regexp.Regexp
+}
+
+func newAnnotationRules(rules []types.AnnotationRule) ([]*annotationRule, error) {
+	compiled := make([]*annotationRule, 0, len(rules))
+	for i, rule := range rules {
+		r := &annotationRule{AnnotationRule: rule}
+		if rule.KeyRegex != "" {
+			keyRegex, err := regexp.Compile(rule.KeyRegex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid keyRegex in annotation rule %d: %w", i, err)
+			}
+
+			r.keyRegex = keyRegex
+		}
+
+		compiled = append(compiled, r)
+	}
+
+	return compiled, nil
+}
+
+// metadataKey returns the key of the metadata for the provided annotation
+// key and false if the rule does not select it.
+func (r *annotationRule) metadataKey(key string) (string, bool) {
+	target := key
+	switch {
+	case r.keyRegex != nil:
+		match := r.keyRegex.FindStringSubmatchIndex(key)
+		if match == nil {
+			return "", false
+		}
+
+		if r.Rename != "" {
+			target = string(r.keyRegex.ExpandString(nil, r.Rename, key, match))
+		}
+	case r.Key != key:
+		return "", false
+	case r.Rename != "":
+		target = r.Rename
+	}
+
+	if r.StripPrefix {
+		if _, name, found := strings.Cut(target, "/"); found {
+			target = name
+		}
+	}
+
+	return target, target != ""
+}
+
+// value returns the value of the metadata for the provided annotation value
+// and false if it must be dropped.
+func (r *annotationRule) value(val string) (string, bool) {
+	if len(r.Values) == 0 {
+		return val, true
+	}
+
+	trimmed := strings.TrimSpace(val)
+	for _, allowed := range r.Values {
+		if strings.EqualFold(allowed, trimmed) {
+			return allowed, true
+		}
+	}
+
+	if r.OnInvalidValue == types.InvalidValueDefault {
+		return r.Default, true
+	}
+
+	return "", false
+}
+
+// annotationFilter selects the annotations and labels that are registered as
+// metadata.
+type annotationFilter struct {
+	allowed []string
+	rules   []*annotationRule
+	// labels are the allowed labels, while namespaceAnnotations are the
+	// allowed annotations of namespaces, whose values are set with
+	// forNamespace.
+	labels               []string
+	namespaceAnnotations []string
+	inherited            map[string]string
+}
+
+// forNamespace returns a copy of the filter that also adds the allowed
+// annotations of the provided namespace.
+func (f annotationFilter) forNamespace(namespace *corev1.Namespace) annotationFilter {
+	f.inherited = filterAnnotations(namespace.Annotations, f.namespaceAnnotations)
+	return f
+}
+
+// apply returns the metadata for the annotations and labels of the provided
+// object.
+//
+// Annotations selected by a rule -- the first one that matches their key --
+// are transformed by it, while the others are kept as they are if they are
+// allowed. Allowed labels are added unless an annotation has the same key.
+//
+// Annotations of the namespace and default values, in this order, are only
+// added when at least another annotation or label was selected, so that they
+// don't make objects eligible for registration on their own.
+func (f annotationFilter) apply(obj metav1.Object) map[string]string {
+	metadata, inherited := f.split(obj)
+	for key, val := range inherited {
+		metadata[key] = val
+	}
+
+	return metadata
+}
+
+// split returns the same metadata as apply, separated into the one of the
+// object -- including default values -- and the one it inherits from its
+// namespace and that it does not override.
+func (f annotationFilter) split(obj metav1.Object) (map[string]string, map[string]string) {
+	annotations := obj.GetAnnotations()
+
+	// Copy the result, as it is the same map if all annotations are allowed.
+	metadata := map[string]string{}
+	for key, val := range filterAnnotations(annotations, f.allowed) {
+		metadata[key] = val
+	}
+
+	// Sort the keys, so that the result does not change when two annotations
+	// end up with the same key.
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	selected := map[string]bool{}
+	for _, key := range keys {
+		for _, rule := range f.rules {
+			target, matches := rule.metadataKey(key)
+			if !matches {
+				continue
+			}
+
+			if !selected[key] {
+				delete(metadata, key)
+			}
+			if val, valid := rule.value(annotations[key]); valid && !selected[target] {
+				metadata[target] = val
+				selected[target] = true
+			}
+
+			break
+		}
+	}
+
+	for key, val := range filterAnnotations(obj.GetLabels(), f.labels) {
+		if _, exists := metadata[key]; !exists {
+			metadata[key] = val
+		}
+	}
+
+	inherited := map[string]string{}
+	if len(metadata) == 0 {
+		return metadata, inherited
+	}
+
+	for key, val := range f.inherited {
+		if _, exists := metadata[key]; !exists {
+			inherited[key] = val
+		}
+	}
+
+	for _, rule := range f.rules {
+		if rule.Key == "" || rule.Default == "" {
+			continue
+		}
+
+		target, _ := rule.metadataKey(rule.Key)
+		_, exists := metadata[target]
+		if _, isInherited := inherited[target]; !exists && !isInherited {
+			metadata[target] = rule.Default
+		}
+	}
+
+	return metadata, inherited
+}
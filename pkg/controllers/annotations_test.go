@@ -0,0 +1,143 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/internal/types"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAnnotationFilter(t *testing.T) {
+	a := assert.New(t)
+	rules := []types.AnnotationRule{
+		{
+			Key:            "traffic-profile",
+			Rename:         "cnwan.io/traffic-profile",
+			Default:        "standard",
+			Values:         []string{"standard", "video"},
+			OnInvalidValue: types.InvalidValueDefault,
+		},
+		{Key: "tier", Values: []string{"gold", "silver"}, OnInvalidValue: types.InvalidValueDrop},
+		{KeyRegex: `^example\.com/(.+)$`, Rename: "cnwan.io/$1"},
+		{KeyRegex: `^other\.com/`, StripPrefix: true},
+	}
+
+	cases := []struct {
+		id                   string
+		allowed              []string
+		annotations          map[string]string
+		labels               map[string]string
+		namespaceAnnotations map[string]string
+		expRes               map[string]string
+	}{
+		{
+			id:          "no-annotations",
+			annotations: map[string]string{},
+			expRes:      map[string]string{},
+		},
+		{
+			id:          "default-only-if-eligible",
+			annotations: map[string]string{"version": "v1"},
+			expRes:      map[string]string{},
+		},
+		{
+			id:          "allowed-and-default",
+			allowed:     []string{"version"},
+			annotations: map[string]string{"version": "v1", "owner": "me"},
+			expRes:      map[string]string{"version": "v1", "cnwan.io/traffic-profile": "standard"},
+		},
+		{
+			id:          "coerce-value",
+			annotations: map[string]string{"traffic-profile": " Video "},
+			expRes:      map[string]string{"cnwan.io/traffic-profile": "video"},
+		},
+		{
+			id:          "replace-invalid-value",
+			annotations: map[string]string{"traffic-profile": "voice"},
+			expRes:      map[string]string{"cnwan.io/traffic-profile": "standard"},
+		},
+		{
+			id:          "drop-invalid-value",
+			annotations: map[string]string{"tier": "bronze", "example.com/app": "shop"},
+			expRes:      map[string]string{"cnwan.io/app": "shop", "cnwan.io/traffic-profile": "standard"},
+		},
+		{
+			id:          "drop-invalid-allowed-value",
+			allowed:     []string{"tier"},
+			annotations: map[string]string{"tier": "bronze"},
+			expRes:      map[string]string{},
+		},
+		{
+			id:          "regex-and-strip-prefix",
+			annotations: map[string]string{"example.com/app": "shop", "other.com/owner": "payments", "another.com/owner": "me"},
+			expRes:      map[string]string{"cnwan.io/app": "shop", "owner": "payments", "cnwan.io/traffic-profile": "standard"},
+		},
+		{
+			id:          "renamed-over-allowed",
+			allowed:     []string{"*/*"},
+			annotations: map[string]string{"example.com/traffic-profile": "gold", "cnwan.io/traffic-profile": "video"},
+			expRes:      map[string]string{"cnwan.io/traffic-profile": "gold"},
+		},
+		{
+			id:                   "namespace-only-if-eligible",
+			annotations:          map[string]string{"version": "v1"},
+			namespaceAnnotations: map[string]string{"cnwan.io/team": "payments"},
+			expRes:               map[string]string{},
+		},
+		{
+			id:                   "inherit-from-namespace",
+			allowed:              []string{"cnwan.io/*"},
+			annotations:          map[string]string{"cnwan.io/team": "shop"},
+			namespaceAnnotations: map[string]string{"cnwan.io/team": "payments", "cnwan.io/traffic-profile": "video", "owner": "me"},
+			expRes:               map[string]string{"cnwan.io/team": "shop", "cnwan.io/traffic-profile": "video"},
+		},
+		{
+			id:                   "labels",
+			allowed:              []string{"app.kubernetes.io/version"},
+			annotations:          map[string]string{"app.kubernetes.io/version": "v2"},
+			labels:               map[string]string{"app.kubernetes.io/name": "shop", "app.kubernetes.io/version": "v1", "pod-template-hash": "abc"},
+			namespaceAnnotations: map[string]string{"app.kubernetes.io/name": "other"},
+			expRes:               map[string]string{"app.kubernetes.io/name": "shop", "app.kubernetes.io/version": "v2", "cnwan.io/traffic-profile": "standard"},
+		},
+	}
+
+	compiled, err := newAnnotationRules(rules)
+	if !a.NoError(err) {
+		return
+	}
+
+	for _, currCase := range cases {
+		filter := annotationFilter{
+			allowed:              currCase.allowed,
+			rules:                compiled,
+			labels:               []string{"app.kubernetes.io/*"},
+			namespaceAnnotations: []string{"cnwan.io/*", "app.kubernetes.io/*"},
+		}
+		filter = filter.forNamespace(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Annotations: currCase.namespaceAnnotations}})
+		res := filter.apply(&metav1.ObjectMeta{Annotations: currCase.annotations, Labels: currCase.labels})
+
+		if !a.Equal(currCase.expRes, res) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
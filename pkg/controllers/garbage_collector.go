@@ -0,0 +1,227 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"path"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	serego "github.com/CloudNativeSDWAN/serego/api/core/types"
+	"github.com/rs/zerolog"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	defaultGarbageCollectionInterval time.Duration = time.Hour
+)
+
+// OwnedNamespacesLister lists the objects that the operator registered on the
+// service registry.
+type OwnedNamespacesLister interface {
+	ListOwnedNamespaces(ctx context.Context) ([]*serviceregistry.OwnedNamespace, error)
+}
+
+type GarbageCollectorOptions struct {
+	// Interval between two consecutive sweeps. A sweep is always performed
+	// at startup as well.
+	Interval time.Duration
+	// DryRun only reports orphans without removing them.
+	DryRun bool
+	Lister OwnedNamespacesLister
+}
+
+type garbageCollector struct {
+	client client.Client
+	log    zerolog.Logger
+	*ControllerOptions
+	*GarbageCollectorOptions
+}
+
+// garbageCollectionReport contains the paths of all the objects that have
+// been removed from the service registry -- or that would have been removed
+// in case of a dry run.
+type garbageCollectionReport struct {
+	namespaces []string
+	services   []string
+	endpoints  []string
+}
+
+// NewGarbageCollector adds a component to the manager that periodically
+// removes from the service registry all the objects owned by the operator
+// that do not have a counterpart in the cluster anymore, e.g. because they
+// were deleted while the operator was not running.
+func NewGarbageCollector(mgr manager.Manager, opts *ControllerOptions, gcOpts *GarbageCollectorOptions, log zerolog.Logger) error {
+	if mgr == nil {
+		return ErrorInvalidManager
+	}
+	if opts == nil || gcOpts == nil || gcOpts.Lister == nil {
+		return ErrorInvalidControllerOptions
+	}
+
+	gc := &garbageCollector{
+		client:                  mgr.GetClient(),
+		log:                     log.With().Str("from", "garbage-collector").Logger(),
+		ControllerOptions:       opts,
+		GarbageCollectorOptions: gcOpts,
+	}
+	if gc.Interval <= 0 {
+		gc.Interval = defaultGarbageCollectionInterval
+	}
+
+	return mgr.Add(manager.RunnableFunc(gc.run))
+}
+
+func (g *garbageCollector) run(ctx context.Context) error {
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+
+	for {
+		g.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *garbageCollector) sweep(ctx context.Context) {
+	l := g.log.With().Bool("dry-run", g.DryRun).Logger()
+	l.Info().Msg("looking for orphans on the service registry...")
+
+	namespaces, err := g.Lister.ListOwnedNamespaces(ctx)
+	if err != nil {
+		l.Err(err).Msg("cannot list objects owned by the operator, will retry later")
+		return
+	}
+
+	report, err := g.collect(ctx, namespaces)
+	if err != nil {
+		l.Err(err).Msg("some orphans could not be removed, will retry later")
+	}
+
+	msg := "orphans removed"
+	if g.DryRun {
+		msg = "orphans found"
+	}
+
+	l.Info().
+		Strs("namespaces", report.namespaces).
+		Strs("services", report.services).
+		Strs("endpoints", report.endpoints).
+		Msg(msg)
+}
+
+func (g *garbageCollector) collect(ctx context.Context, namespaces []*serviceregistry.OwnedNamespace) (*garbageCollectionReport, error) {
+	report := &garbageCollectionReport{
+		namespaces: []string{},
+		services:   []string{},
+		endpoints:  []string{},
+	}
+	errs := []error{}
+
+	for _, ns := range namespaces {
+		if len(ns.Services) == 0 {
+			if !g.DryRun {
+				if err := g.removeNamespace(ctx, ns.Name); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+			}
+
+			report.namespaces = append(report.namespaces, ns.Name)
+			continue
+		}
+
+		for _, registered := range ns.Services {
+			desired, err := getRegisteredState(ctx, g.client, types.NamespacedName{
+				Namespace: registered.Namespace,
+				Name:      registered.Name,
+			}, registered.Kind, g.ControllerOptions)
+			if errors.Is(err, errResolutionPending) {
+				// Nothing is removed until the desired state is known.
+				continue
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			orphans := getOrphanEndpoints(registered.Endpoints, desired.Endpoints)
+			if len(orphans) == 0 && len(desired.Endpoints) > 0 {
+				continue
+			}
+
+			if !g.DryRun {
+				// The desired state is sent rather than a list of
+				// orphans to delete, so that the namespace worker only
+				// removes what is not needed anymore at the time it
+				// processes the event.
+				if err := syncServiceState(ctx, g.EventsChan, desired); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+			}
+
+			for _, orphan := range orphans {
+				report.endpoints = append(report.endpoints,
+					path.Join(orphan.Namespace, orphan.Service, orphan.Name))
+			}
+
+			if len(desired.Endpoints) == 0 {
+				report.services = append(report.services,
+					path.Join(registered.Namespace, registered.Name))
+			}
+		}
+	}
+
+	return report, errors.Join(errs...)
+}
+
+func (g *garbageCollector) removeNamespace(ctx context.Context, name string) error {
+	// The namespace worker will only remove it if it is still empty at the
+	// time it processes the event.
+	return sendEvent(ctx, g.EventsChan, &serviceregistry.Event{
+		EventType: serviceregistry.EventDelete,
+		Object:    &serego.Namespace{Name: name},
+	})
+}
+
+// getOrphanEndpoints returns the registered endpoints that are not desired
+// anymore.
+func getOrphanEndpoints(registered, desired []*serego.Endpoint) []*serego.Endpoint {
+	desiredNames := map[string]bool{}
+	for _, ep := range desired {
+		desiredNames[ep.Name] = true
+	}
+
+	orphans := []*serego.Endpoint{}
+	for _, ep := range registered {
+		if !desiredNames[ep.Name] {
+			orphans = append(orphans, ep)
+		}
+	}
+
+	return orphans
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	serego "github.com/CloudNativeSDWAN/serego/api/core/types"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGarbageCollectorDryRun(t *testing.T) {
+	a := assert.New(t)
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "ns",
+		Labels: map[string]string{watchLabel: watchEnabledLabel},
+	}}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "serv",
+			Namespace:   "ns",
+			Annotations: map[string]string{"version": "v1"},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Port: 80}},
+		},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "10.10.10.10"}},
+			},
+		},
+	}
+
+	opts := &ControllerOptions{ServiceAnnotations: []string{"version"}}
+	checked := checkService(service, annotationFilter{allowed: opts.ServiceAnnotations}, nil, nil)
+	if !a.True(checked.passed) || !a.Len(checked.endpoints, 1) {
+		return
+	}
+
+	gc := &garbageCollector{
+		client:                  fake.NewClientBuilder().WithObjects(namespace, service).Build(),
+		log:                     zerolog.Nop(),
+		ControllerOptions:       opts,
+		GarbageCollectorOptions: &GarbageCollectorOptions{DryRun: true},
+	}
+
+	report, err := gc.collect(context.Background(), []*serviceregistry.OwnedNamespace{
+		{
+			Name: "ns",
+			Services: []*serviceregistry.ServiceState{
+				{
+					Namespace: "ns",
+					Name:      "serv",
+					Endpoints: []*serego.Endpoint{
+						checked.endpoints[0],
+						{Namespace: "ns", Service: "serv", Name: "serv-stale"},
+					},
+				},
+				{
+					Namespace: "ns",
+					Name:      "deleted",
+					Endpoints: []*serego.Endpoint{
+						{Namespace: "ns", Service: "deleted", Name: "deleted-1"},
+					},
+				},
+			},
+		},
+		{Name: "empty"},
+	})
+
+	a.NoError(err)
+	a.Equal([]string{"empty"}, report.namespaces)
+	a.Equal([]string{"ns/deleted"}, report.services)
+	a.Equal([]string{"ns/serv/serv-stale", "ns/deleted/deleted-1"}, report.endpoints)
+}
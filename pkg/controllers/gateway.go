@@ -0,0 +1,689 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	serego "github.com/CloudNativeSDWAN/serego/api/core/types"
+	"github.com/rs/zerolog"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	gwCtrlName    string = "gateway-event-handler"
+	routeCtrlName string = "httproute-event-handler"
+
+	// gatewayServicePrefix and httpRouteServicePrefix are prepended to the
+	// names of gateways and routes to get the names of their services on
+	// the service registry, so that they do not collide with services with
+	// the same name. As with ingresses, the kind of the object is registered
+	// as well, so that the service registry never syncs one over a service
+	// registered for another kind of object.
+	gatewayServicePrefix   string = "gateway-"
+	httpRouteServicePrefix string = "httproute-"
+
+	gatewayHostnamesMetadataKey string = "cnwan.io/gateway-hostnames"
+	routeHostnamesMetadataKey   string = "cnwan.io/route-hostnames"
+
+	gatewayAPIGroup string = "gateway.networking.k8s.io"
+)
+
+var (
+	// The Gateway API objects are read as unstructured objects, so that the
+	// operator does not depend on a specific release of the Gateway API and
+	// does not fail to start in clusters where it is not installed, as long
+	// as its support is not enabled.
+	gatewayGVK   = schema.GroupVersionKind{Group: gatewayAPIGroup, Version: "v1beta1", Kind: "Gateway"}
+	httpRouteGVK = schema.GroupVersionKind{Group: gatewayAPIGroup, Version: "v1beta1", Kind: "HTTPRoute"}
+)
+
+// gateway contains the fields of a Gateway that are used by the operator.
+type gateway struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Listeners []gatewayListener `json:"listeners,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Addresses []struct {
+			Type  *string `json:"type,omitempty"`
+			Value string  `json:"value"`
+		} `json:"addresses,omitempty"`
+	} `json:"status,omitempty"`
+}
+
+type gatewayListener struct {
+	Name     string  `json:"name"`
+	Hostname *string `json:"hostname,omitempty"`
+	Port     int32   `json:"port"`
+	Protocol string  `json:"protocol"`
+}
+
+// httpRoute contains the fields of an HTTPRoute that are used by the
+// operator.
+type httpRoute struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		ParentRefs []parentReference `json:"parentRefs,omitempty"`
+		Hostnames  []string          `json:"hostnames,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Parents []struct {
+			ParentRef  parentReference    `json:"parentRef"`
+			Conditions []metav1.Condition `json:"conditions,omitempty"`
+		} `json:"parents,omitempty"`
+	} `json:"status,omitempty"`
+}
+
+type parentReference struct {
+	Group       *string `json:"group,omitempty"`
+	Kind        *string `json:"kind,omitempty"`
+	Namespace   *string `json:"namespace,omitempty"`
+	Name        string  `json:"name"`
+	SectionName *string `json:"sectionName,omitempty"`
+	Port        *int32  `json:"port,omitempty"`
+}
+
+// gatewayName returns the name of the gateway the reference points to, or
+// false if it does not point to a gateway.
+func (p *parentReference) gatewayName(routeNamespace string) (types.NamespacedName, bool) {
+	if (p.Group != nil && *p.Group != gatewayAPIGroup) || (p.Kind != nil && *p.Kind != gatewayGVK.Kind) {
+		return types.NamespacedName{}, false
+	}
+
+	name := types.NamespacedName{Namespace: routeNamespace, Name: p.Name}
+	if p.Namespace != nil && *p.Namespace != "" {
+		name.Namespace = *p.Namespace
+	}
+
+	return name, true
+}
+
+// matches returns true if the listener is selected by the reference.
+func (p *parentReference) matches(listener *gatewayListener) bool {
+	if p.SectionName != nil && *p.SectionName != listener.Name {
+		return false
+	}
+
+	return p.Port == nil || *p.Port == listener.Port
+}
+
+func newUnstructured(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	return obj
+}
+
+func newUnstructuredList(gvk schema.GroupVersionKind) *unstructured.UnstructuredList {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	return list
+}
+
+// getGatewayAPIObject gets the object with the provided kind and name and
+// decodes it in out. It returns false if the object does not exist.
+func getGatewayAPIObject(ctx context.Context, cli client.Client, gvk schema.GroupVersionKind, name types.NamespacedName, out interface{}) (bool, error) {
+	obj := newUnstructured(gvk)
+	if err := cli.Get(ctx, name, obj); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, k8sruntime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, out)
+}
+
+type gatewayReconciler struct {
+	client client.Client
+	log    zerolog.Logger
+	*ControllerOptions
+}
+
+// NewGatewayController returns a controller that registers Gateway API
+// gateways on the service registry, each one as a service with the addresses
+// of the gateway and the ports of its listeners.
+//
+// It must only be created if ControllerOptions.Gateways is true.
+func NewGatewayController(mgr manager.Manager, opts *ControllerOptions, log zerolog.Logger) (controller.Controller, error) {
+	if mgr == nil {
+		return nil, ErrorInvalidManager
+	}
+	if opts == nil || !opts.Gateways {
+		return nil, ErrorInvalidControllerOptions
+	}
+
+	gwReconciler := &gatewayReconciler{
+		client:            mgr.GetClient(),
+		log:               log,
+		ControllerOptions: opts,
+	}
+	c, err := controller.New(gwCtrlName, mgr, controller.Options{
+		Reconciler:  gwReconciler,
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(requeueBaseDelay, requeueMaxDelay),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Watch(&source.Kind{Type: newUnstructured(gatewayGVK)}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Resolver != nil {
+		// Objects are reconciled again when the IPs of their hostnames
+		// change.
+		err = c.Watch(&source.Channel{Source: opts.Resolver.subscribe(gatewayOwnerKind)}, &handler.EnqueueRequestForObject{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Reconcile brings the service of the gateway on the service registry to the
+// state described by the gateway with the same namespace and name.
+func (g *gatewayReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	l := g.log.With().Str("gateway", req.NamespacedName.String()).Logger()
+
+	state, err := getGatewayState(ctx, g.client, req.NamespacedName, g.ControllerOptions)
+	if errors.Is(err, errResolutionPending) {
+		// The resolver triggers a new reconciliation once it is done.
+		l.Debug().Msg("waiting for hostnames to be resolved")
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		l.Err(err).Msg("cannot get desired state of gateway: requeueing...")
+		return reconcile.Result{}, err
+	}
+
+	if err := syncServiceState(ctx, g.EventsChan, state); err != nil {
+		l.Err(err).Msg("cannot sync gateway with the service registry: requeueing...")
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
+
+type httpRouteReconciler struct {
+	client client.Client
+	log    zerolog.Logger
+	*ControllerOptions
+}
+
+// NewHTTPRouteController returns a controller that registers Gateway API
+// HTTP routes on the service registry, each one as a service with the
+// addresses and ports of the gateway listeners it is attached to.
+//
+// It must only be created if ControllerOptions.HTTPRoutes is true.
+func NewHTTPRouteController(mgr manager.Manager, opts *ControllerOptions, log zerolog.Logger) (controller.Controller, error) {
+	if mgr == nil {
+		return nil, ErrorInvalidManager
+	}
+	if opts == nil || !opts.HTTPRoutes {
+		return nil, ErrorInvalidControllerOptions
+	}
+
+	routeReconciler := &httpRouteReconciler{
+		client:            mgr.GetClient(),
+		log:               log,
+		ControllerOptions: opts,
+	}
+	c, err := controller.New(routeCtrlName, mgr, controller.Options{
+		Reconciler:  routeReconciler,
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(requeueBaseDelay, requeueMaxDelay),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Watch(&source.Kind{Type: newUnstructured(httpRouteGVK)}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Resolver != nil {
+		// Objects are reconciled again when the IPs of their hostnames
+		// change.
+		err = c.Watch(&source.Channel{Source: opts.Resolver.subscribe(httpRouteOwnerKind)}, &handler.EnqueueRequestForObject{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Changes to the addresses or listeners of a gateway are reconciled as
+	// changes to all the routes attached to it.
+	cli := mgr.GetClient()
+	err = c.Watch(&source.Kind{Type: newUnstructured(gatewayGVK)},
+		handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+			routes, err := listAttachedRoutes(context.Background(), cli, types.NamespacedName{
+				Namespace: obj.GetNamespace(),
+				Name:      obj.GetName(),
+			})
+			if err != nil {
+				log.Err(err).Msg("cannot retrieve list of http routes")
+				return nil
+			}
+
+			requests := []reconcile.Request{}
+			for _, route := range routes {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Namespace: route.Namespace,
+					Name:      route.Name,
+				}})
+			}
+			return requests
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reconcile brings the service of the route on the service registry to the
+// state described by the route with the same namespace and name.
+func (h *httpRouteReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	l := h.log.With().Str("httproute", req.NamespacedName.String()).Logger()
+
+	state, err := getHTTPRouteState(ctx, h.client, req.NamespacedName, h.ControllerOptions)
+	if errors.Is(err, errResolutionPending) {
+		// The resolver triggers a new reconciliation once it is done.
+		l.Debug().Msg("waiting for hostnames to be resolved")
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		l.Err(err).Msg("cannot get desired state of http route: requeueing...")
+		return reconcile.Result{}, err
+	}
+
+	if err := syncServiceState(ctx, h.EventsChan, state); err != nil {
+		l.Err(err).Msg("cannot sync http route with the service registry: requeueing...")
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// listAttachedRoutes returns all the routes that reference the gateway with
+// the provided name.
+func listAttachedRoutes(ctx context.Context, cli client.Client, gwName types.NamespacedName) ([]*httpRoute, error) {
+	list := newUnstructuredList(httpRouteGVK)
+	if err := cli.List(ctx, list); err != nil {
+		return nil, err
+	}
+
+	routes := []*httpRoute{}
+	for _, item := range list.Items {
+		var route httpRoute
+		if err := k8sruntime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &route); err != nil {
+			return nil, err
+		}
+
+		for _, ref := range route.Spec.ParentRefs {
+			if name, ok := ref.gatewayName(route.Namespace); ok && name == gwName {
+				routes = append(routes, &route)
+				break
+			}
+		}
+	}
+
+	return routes, nil
+}
+
+// getWatchedNamespace returns the namespace if it exists, it is not being
+// deleted and it is watched according to its labels, and nil otherwise.
+func getWatchedNamespace(ctx context.Context, cli client.Client, name string, opts *ControllerOptions) (*corev1.Namespace, error) {
+	var namespace corev1.Namespace
+	if err := cli.Get(ctx, types.NamespacedName{Name: name}, &namespace); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	watchByDefault, _ := opts.getWatchSettings()
+	if namespace.DeletionTimestamp != nil ||
+		!checkNsLabels(namespace.Labels, watchByDefault) {
+		return nil, nil
+	}
+
+	return &namespace, nil
+}
+
+// getGatewayState returns the state that the service of the gateway with the
+// provided name should have on the service registry.
+//
+// As with services, a state with no endpoints is returned if the gateway
+// does not exist, if its namespace is not watched or if it is not eligible
+// for registration.
+func getGatewayState(ctx context.Context, cli client.Client, name types.NamespacedName, opts *ControllerOptions) (*serviceregistry.ServiceState, error) {
+	state := &serviceregistry.ServiceState{
+		Namespace: name.Namespace,
+		Name:      gatewayServicePrefix + name.Name,
+		Kind:      gatewayOwnerKind,
+	}
+
+	opts.Resolver.release(gatewayOwnerKind, name)
+
+	var gw gateway
+	if found, err := getGatewayAPIObject(ctx, cli, gatewayGVK, name, &gw); !found || err != nil {
+		return state, err
+	}
+
+	if gw.DeletionTimestamp != nil {
+		return state, nil
+	}
+
+	namespace, err := getWatchedNamespace(ctx, cli, name.Namespace, opts)
+	if namespace == nil || err != nil {
+		return state, err
+	}
+
+	_, annotationsToKeep := opts.getWatchSettings()
+	annotationsToKeep = annotationsToKeep.forNamespace(namespace)
+	annotations := annotationsToKeep.apply(&gw)
+	if len(annotations) == 0 {
+		return state, nil
+	}
+
+	ips, resolved := getGatewayIPs(&gw, opts.Resolver.lookupFunc(gatewayOwnerKind, name))
+	if !resolved {
+		return state, errResolutionPending
+	}
+	if len(ips) == 0 {
+		return state, nil
+	}
+
+	metadata := map[string]string{}
+	for key, val := range annotations {
+		metadata[key] = val
+	}
+	hostnames := map[string]bool{}
+	for _, listener := range gw.Spec.Listeners {
+		if listener.Hostname != nil && *listener.Hostname != "" {
+			hostnames[*listener.Hostname] = true
+		}
+	}
+	if len(hostnames) > 0 {
+		metadata[gatewayHostnamesMetadataKey] = joinSorted(hostnames)
+	}
+
+	ports := map[int32]bool{}
+	for _, listener := range gw.Spec.Listeners {
+		ports[listener.Port] = true
+	}
+
+	state.Endpoints = opts.prepareEndpoints(newEndpoints(state.Namespace, state.Name, ips, ports, metadata), nil)
+	opts.placeMetadata(state, annotationsToKeep, &gw)
+
+	return state, nil
+}
+
+// getHTTPRouteState returns the state that the service of the route with the
+// provided name should have on the service registry, with the addresses of
+// the gateways that accepted it and the ports of the listeners it is
+// attached to.
+func getHTTPRouteState(ctx context.Context, cli client.Client, name types.NamespacedName, opts *ControllerOptions) (*serviceregistry.ServiceState, error) {
+	state := &serviceregistry.ServiceState{
+		Namespace: name.Namespace,
+		Name:      httpRouteServicePrefix + name.Name,
+		Kind:      httpRouteOwnerKind,
+	}
+
+	opts.Resolver.release(httpRouteOwnerKind, name)
+
+	var route httpRoute
+	if found, err := getGatewayAPIObject(ctx, cli, httpRouteGVK, name, &route); !found || err != nil {
+		return state, err
+	}
+
+	if route.DeletionTimestamp != nil {
+		return state, nil
+	}
+
+	namespace, err := getWatchedNamespace(ctx, cli, name.Namespace, opts)
+	if namespace == nil || err != nil {
+		return state, err
+	}
+
+	_, annotationsToKeep := opts.getWatchSettings()
+	annotationsToKeep = annotationsToKeep.forNamespace(namespace)
+	annotations := annotationsToKeep.apply(&route)
+	if len(annotations) == 0 {
+		return state, nil
+	}
+
+	metadata := map[string]string{}
+	for key, val := range annotations {
+		metadata[key] = val
+	}
+	if len(route.Spec.Hostnames) > 0 {
+		hostnames := map[string]bool{}
+		for _, hostname := range route.Spec.Hostnames {
+			hostnames[hostname] = true
+		}
+		metadata[routeHostnamesMetadataKey] = joinSorted(hostnames)
+	}
+
+	endpoints := map[string]*serego.Endpoint{}
+	for _, ref := range route.Spec.ParentRefs {
+		gwName, ok := ref.gatewayName(route.Namespace)
+		if !ok || !isRouteAccepted(&route, &ref) {
+			continue
+		}
+
+		var gw gateway
+		found, err := getGatewayAPIObject(ctx, cli, gatewayGVK, gwName, &gw)
+		if err != nil {
+			return nil, err
+		}
+		if !found || gw.DeletionTimestamp != nil {
+			continue
+		}
+
+		ips, resolved := getGatewayIPs(&gw, opts.Resolver.lookupFunc(httpRouteOwnerKind, name))
+		if !resolved {
+			return state, errResolutionPending
+		}
+
+		ports := map[int32]bool{}
+		for i := range gw.Spec.Listeners {
+			listener := &gw.Spec.Listeners[i]
+			if ref.matches(listener) && (listener.Protocol == "HTTP" || listener.Protocol == "HTTPS") {
+				ports[listener.Port] = true
+			}
+		}
+
+		for _, endp := range newEndpoints(state.Namespace, state.Name, ips, ports, metadata) {
+			endpoints[endp.Name] = endp
+		}
+	}
+
+	for _, endp := range endpoints {
+		state.Endpoints = append(state.Endpoints, endp)
+	}
+	sort.Slice(state.Endpoints, func(i, j int) bool {
+		return state.Endpoints[i].Name < state.Endpoints[j].Name
+	})
+	state.Endpoints = opts.prepareEndpoints(state.Endpoints, nil)
+	opts.placeMetadata(state, annotationsToKeep, &route)
+
+	return state, nil
+}
+
+// isRouteAccepted returns true if the parent referenced by the route reports
+// it as accepted on the status of the route.
+func isRouteAccepted(route *httpRoute, ref *parentReference) bool {
+	refName, _ := ref.gatewayName(route.Namespace)
+	for _, parent := range route.Status.Parents {
+		parentName, ok := parent.ParentRef.gatewayName(route.Namespace)
+		if !ok || parentName != refName ||
+			!equalPtr(parent.ParentRef.SectionName, ref.SectionName) ||
+			!equalPtr(parent.ParentRef.Port, ref.Port) {
+			continue
+		}
+
+		return meta.IsStatusConditionTrue(parent.Conditions, "Accepted")
+	}
+
+	return false
+}
+
+func equalPtr[T comparable](first, second *T) bool {
+	if first == nil || second == nil {
+		return first == second
+	}
+
+	return *first == *second
+}
+
+// getGatewayIPs returns the addresses of the gateway, looking up the ones
+// that are hostnames with the provided function. False is returned if some
+// of them have not been resolved yet.
+func getGatewayIPs(gw *gateway, lookup func(string) ([]string, bool)) ([]string, bool) {
+	ipsMap := map[string]bool{}
+	for _, addr := range gw.Status.Addresses {
+		if addr.Value == "" {
+			continue
+		}
+
+		if addr.Type != nil && *addr.Type == "Hostname" {
+			resolvedIPs, resolved := lookup(addr.Value)
+			if !resolved {
+				return nil, false
+			}
+
+			for _, resolvedIP := range resolvedIPs {
+				ipsMap[resolvedIP] = true
+			}
+			continue
+		}
+
+		// Other types, e.g. NamedAddress, are implementation specific and
+		// are therefore only registered if they are IPs.
+		if addr.Type == nil || *addr.Type == "IPAddress" {
+			ipsMap[addr.Value] = true
+		}
+	}
+
+	ips := []string{}
+	for ip := range ipsMap {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips, true
+}
+
+// newEndpoints returns an endpoint for each combination of address and port.
+func newEndpoints(namespace, service string, ips []string, ports map[int32]bool, metadata map[string]string) []*serego.Endpoint {
+	sortedPorts := []int32{}
+	for port := range ports {
+		sortedPorts = append(sortedPorts, port)
+	}
+	sort.Slice(sortedPorts, func(i, j int) bool { return sortedPorts[i] < sortedPorts[j] })
+
+	endpoints := []*serego.Endpoint{}
+	for _, port := range sortedPorts {
+		for _, ip := range ips {
+			endpoints = append(endpoints, newEndpoint(namespace, service, ip, port, metadata))
+		}
+	}
+
+	return endpoints
+}
+
+func joinSorted(values map[string]bool) string {
+	sorted := []string{}
+	for val := range values {
+		sorted = append(sorted, val)
+	}
+	sort.Strings(sorted)
+	return joinCapped(sorted, maxListMetadataLength)
+}
+
+// syncGatewayAPIObjects syncs all gateways and, if enabled, all routes that
+// match the provided list options with the service registry.
+func syncGatewayAPIObjects(ctx context.Context, cli client.Client, opts *ControllerOptions, log zerolog.Logger, listOpts ...client.ListOption) error {
+	type objectSource struct {
+		gvk      schema.GroupVersionKind
+		enabled  bool
+		getState func(context.Context, client.Client, types.NamespacedName, *ControllerOptions) (*serviceregistry.ServiceState, error)
+	}
+
+	errs := []error{}
+	for _, src := range []objectSource{
+		{gvk: gatewayGVK, enabled: opts.Gateways, getState: getGatewayState},
+		{gvk: httpRouteGVK, enabled: opts.HTTPRoutes, getState: getHTTPRouteState},
+	} {
+		if !src.enabled {
+			continue
+		}
+
+		list := newUnstructuredList(src.gvk)
+		if err := cli.List(ctx, list, listOpts...); err != nil {
+			log.Err(err).Str("kind", src.gvk.Kind).Msg("cannot retrieve list of objects")
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, item := range list.Items {
+			state, err := src.getState(ctx, cli, types.NamespacedName{
+				Namespace: item.GetNamespace(),
+				Name:      item.GetName(),
+			}, opts)
+			if errors.Is(err, errResolutionPending) {
+				// The object is synced as soon as its hostnames are resolved.
+				continue
+			}
+			if err == nil {
+				err = syncServiceState(ctx, opts.EventsChan, state)
+			}
+
+			if err != nil {
+				log.Err(err).Str(strings.ToLower(src.gvk.Kind), item.GetNamespace()+"/"+item.GetName()).
+					Msg("cannot sync object with the service registry")
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
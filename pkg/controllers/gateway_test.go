@@ -0,0 +1,284 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestGateway(namespace, name string, annotations map[string]string, ips ...string) *unstructured.Unstructured {
+	addresses := []interface{}{}
+	for _, ip := range ips {
+		addresses = append(addresses, map[string]interface{}{"type": "IPAddress", "value": ip})
+	}
+
+	gw := newUnstructured(gatewayGVK)
+	gw.SetNamespace(namespace)
+	gw.SetName(name)
+	gw.SetAnnotations(annotations)
+	gw.Object["spec"] = map[string]interface{}{
+		"gatewayClassName": "example",
+		"listeners": []interface{}{
+			map[string]interface{}{"name": "http", "port": int64(80), "protocol": "HTTP", "hostname": "shop.example.com"},
+			map[string]interface{}{"name": "https", "port": int64(443), "protocol": "HTTPS", "hostname": "shop.example.com"},
+			map[string]interface{}{"name": "tcp", "port": int64(9000), "protocol": "TCP"},
+		},
+	}
+	gw.Object["status"] = map[string]interface{}{"addresses": addresses}
+	return gw
+}
+
+func newTestHTTPRoute(namespace, name string, annotations map[string]string, accepted bool, parentRefs ...map[string]interface{}) *unstructured.Unstructured {
+	refs, parents := []interface{}{}, []interface{}{}
+	status := metav1.ConditionFalse
+	if accepted {
+		status = metav1.ConditionTrue
+	}
+	for _, ref := range parentRefs {
+		refs = append(refs, ref)
+		parents = append(parents, map[string]interface{}{
+			"parentRef":      ref,
+			"controllerName": "example.com/gateway-controller",
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Accepted", "status": string(status)},
+			},
+		})
+	}
+
+	route := newUnstructured(httpRouteGVK)
+	route.SetNamespace(namespace)
+	route.SetName(name)
+	route.SetAnnotations(annotations)
+	route.Object["spec"] = map[string]interface{}{
+		"parentRefs": refs,
+		"hostnames":  []interface{}{"shop.example.com"},
+	}
+	route.Object["status"] = map[string]interface{}{"parents": parents}
+	return route
+}
+
+func TestGetGatewayState(t *testing.T) {
+	name := types.NamespacedName{Namespace: "ns", Name: "gw"}
+	opts := &ControllerOptions{ServiceAnnotations: []string{"version"}, Gateways: true}
+	namespace := func(watch string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   name.Namespace,
+			Labels: map[string]string{watchLabel: watch},
+		}}
+	}
+
+	cases := []struct {
+		id           string
+		objects      []client.Object
+		expEndpoints int
+	}{
+		{
+			id:      "gateway-not-found",
+			objects: []client.Object{namespace(watchEnabledLabel)},
+		},
+		{
+			id: "namespace-not-watched",
+			objects: []client.Object{
+				namespace(watchDisabledLabel),
+				newTestGateway(name.Namespace, name.Name, map[string]string{"version": "v1"}, "10.10.10.10"),
+			},
+		},
+		{
+			id: "no-valid-annotations",
+			objects: []client.Object{
+				namespace(watchEnabledLabel),
+				newTestGateway(name.Namespace, name.Name, map[string]string{"other": "v1"}, "10.10.10.10"),
+			},
+		},
+		{
+			id: "no-addresses",
+			objects: []client.Object{
+				namespace(watchEnabledLabel),
+				newTestGateway(name.Namespace, name.Name, map[string]string{"version": "v1"}),
+			},
+		},
+		{
+			id: "success",
+			objects: []client.Object{
+				namespace(watchEnabledLabel),
+				newTestGateway(name.Namespace, name.Name, map[string]string{"version": "v1"}, "10.10.10.10", "10.10.10.11"),
+			},
+			expEndpoints: 6,
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		cli := fake.NewClientBuilder().WithObjects(currCase.objects...).Build()
+		res, err := getGatewayState(context.Background(), cli, name, opts)
+		if !a.NoError(err) ||
+			!a.Equal(name.Namespace, res.Namespace) ||
+			!a.Equal(gatewayServicePrefix+name.Name, res.Name) ||
+			!a.Len(res.Endpoints, currCase.expEndpoints) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+
+		for _, endp := range res.Endpoints {
+			if !a.Equal(map[string]string{
+				"version":                   "v1",
+				ipFamilyMetadataKey:         "IPv4",
+				gatewayHostnamesMetadataKey: "shop.example.com",
+			}, endp.Metadata) {
+				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+			}
+		}
+
+		registered, err := getRegisteredState(context.Background(), cli, types.NamespacedName{
+			Namespace: res.Namespace,
+			Name:      res.Name,
+		}, gatewayOwnerKind, opts)
+		if !a.NoError(err) || !a.Equal(res, registered) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
+
+func TestGetHTTPRouteState(t *testing.T) {
+	name := types.NamespacedName{Namespace: "ns", Name: "shop"}
+	opts := &ControllerOptions{ServiceAnnotations: []string{"version"}, Gateways: true, HTTPRoutes: true}
+	namespaces := []client.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   name.Namespace,
+			Labels: map[string]string{watchLabel: watchEnabledLabel},
+		}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "infra"}},
+	}
+	gw := newTestGateway("infra", "gw", nil, "10.10.10.10")
+	annotations := map[string]string{"version": "v1"}
+	gwRef := map[string]interface{}{"name": "gw", "namespace": "infra"}
+	httpsRef := map[string]interface{}{"name": "gw", "namespace": "infra", "sectionName": "https"}
+	tcpRef := map[string]interface{}{"name": "gw", "namespace": "infra", "sectionName": "tcp"}
+	serviceRef := map[string]interface{}{"name": "gw", "kind": "Service", "group": ""}
+
+	cases := []struct {
+		id       string
+		objects  []client.Object
+		expPorts []int32
+	}{
+		{
+			id:      "route-not-found",
+			objects: []client.Object{gw},
+		},
+		{
+			id:      "no-valid-annotations",
+			objects: []client.Object{gw, newTestHTTPRoute(name.Namespace, name.Name, nil, true, gwRef)},
+		},
+		{
+			id:      "not-accepted",
+			objects: []client.Object{gw, newTestHTTPRoute(name.Namespace, name.Name, annotations, false, gwRef)},
+		},
+		{
+			id:      "gateway-not-found",
+			objects: []client.Object{newTestHTTPRoute(name.Namespace, name.Name, annotations, true, gwRef)},
+		},
+		{
+			id:      "not-a-gateway",
+			objects: []client.Object{gw, newTestHTTPRoute(name.Namespace, name.Name, annotations, true, serviceRef)},
+		},
+		{
+			id:      "non-http-listener",
+			objects: []client.Object{gw, newTestHTTPRoute(name.Namespace, name.Name, annotations, true, tcpRef)},
+		},
+		{
+			id:       "all-listeners",
+			objects:  []client.Object{gw, newTestHTTPRoute(name.Namespace, name.Name, annotations, true, gwRef)},
+			expPorts: []int32{443, 80},
+		},
+		{
+			id:       "section-name",
+			objects:  []client.Object{gw, newTestHTTPRoute(name.Namespace, name.Name, annotations, true, httpsRef, gwRef)},
+			expPorts: []int32{443, 80},
+		},
+		{
+			id:       "only-https",
+			objects:  []client.Object{gw, newTestHTTPRoute(name.Namespace, name.Name, annotations, true, httpsRef)},
+			expPorts: []int32{443},
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		cli := fake.NewClientBuilder().WithObjects(append(currCase.objects, namespaces...)...).Build()
+		res, err := getHTTPRouteState(context.Background(), cli, name, opts)
+		if !a.NoError(err) ||
+			!a.Equal(httpRouteServicePrefix+name.Name, res.Name) ||
+			!a.Len(res.Endpoints, len(currCase.expPorts)) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+
+		ports := []int32{}
+		for _, endp := range res.Endpoints {
+			ports = append(ports, endp.Port)
+			if !a.Equal("10.10.10.10", endp.Address) ||
+				!a.Equal(map[string]string{
+					"version":                 "v1",
+					ipFamilyMetadataKey:       "IPv4",
+					routeHostnamesMetadataKey: "shop.example.com",
+				}, endp.Metadata) {
+				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+			}
+		}
+
+		if !a.ElementsMatch(currCase.expPorts, ports) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+
+		// The garbage collector must find the route from the name and kind
+		// of its service on the service registry.
+		registered, err := getRegisteredState(context.Background(), cli, types.NamespacedName{
+			Namespace: res.Namespace,
+			Name:      res.Name,
+		}, httpRouteOwnerKind, opts)
+		if !a.NoError(err) || !a.Equal(res, registered) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
+
+func TestListAttachedRoutes(t *testing.T) {
+	a := assert.New(t)
+	cli := fake.NewClientBuilder().WithObjects(
+		newTestHTTPRoute("infra", "same-namespace", nil, true, map[string]interface{}{"name": "gw"}),
+		newTestHTTPRoute("ns", "other-namespace", nil, true, map[string]interface{}{"name": "gw", "namespace": "infra"}),
+		newTestHTTPRoute("ns", "other-gateway", nil, true, map[string]interface{}{"name": "gw"}),
+	).Build()
+
+	routes, err := listAttachedRoutes(context.Background(), cli, types.NamespacedName{Namespace: "infra", Name: "gw"})
+	names := []string{}
+	for _, route := range routes {
+		names = append(names, route.Name)
+	}
+
+	a.NoError(err)
+	a.ElementsMatch([]string{"same-namespace", "other-namespace"}, names)
+}
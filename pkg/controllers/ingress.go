@@ -0,0 +1,294 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	serego "github.com/CloudNativeSDWAN/serego/api/core/types"
+	"github.com/rs/zerolog"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	ingCtrlName string = "ingress-event-handler"
+
+	// ingressServicePrefix is prepended to the name of an ingress to get the
+	// name of its service on the service registry, so that it does not
+	// collide with a service with the same name. As a service may still be
+	// called like that, the kind of the object is registered as well and
+	// the service registry never syncs an ingress over a service.
+	ingressServicePrefix string = "ingress-"
+
+	ingressHostsMetadataKey string = "cnwan.io/ingress-hosts"
+	ingressRulesMetadataKey string = "cnwan.io/ingress-rules"
+)
+
+type ingressReconciler struct {
+	client client.Client
+	log    zerolog.Logger
+	*ControllerOptions
+}
+
+// NewIngressController returns a controller that registers ingresses on the
+// service registry, each one as a service with the addresses of its load
+// balancer.
+//
+// It must only be created if ControllerOptions.Ingresses is true.
+func NewIngressController(mgr manager.Manager, opts *ControllerOptions, log zerolog.Logger) (controller.Controller, error) {
+	if mgr == nil {
+		return nil, ErrorInvalidManager
+	}
+	if opts == nil || !opts.Ingresses {
+		return nil, ErrorInvalidControllerOptions
+	}
+
+	ingReconciler := &ingressReconciler{
+		client:            mgr.GetClient(),
+		log:               log,
+		ControllerOptions: opts,
+	}
+	c, err := controller.New(ingCtrlName, mgr, controller.Options{
+		Reconciler:  ingReconciler,
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(requeueBaseDelay, requeueMaxDelay),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Watch(&source.Kind{Type: &networkingv1.Ingress{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Resolver != nil {
+		// Objects are reconciled again when the IPs of their hostnames
+		// change.
+		err = c.Watch(&source.Channel{Source: opts.Resolver.subscribe(ingressOwnerKind)}, &handler.EnqueueRequestForObject{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Reconcile brings the service of the ingress on the service registry to the
+// state described by the ingress with the same namespace and name.
+func (i *ingressReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	l := i.log.With().Str("ingress", req.NamespacedName.String()).Logger()
+
+	state, err := getIngressState(ctx, i.client, req.NamespacedName, i.ControllerOptions)
+	if errors.Is(err, errResolutionPending) {
+		// The resolver triggers a new reconciliation once it is done.
+		l.Debug().Msg("waiting for hostnames to be resolved")
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		l.Err(err).Msg("cannot get desired state of ingress: requeueing...")
+		return reconcile.Result{}, err
+	}
+
+	if err := syncServiceState(ctx, i.EventsChan, state); err != nil {
+		l.Err(err).Msg("cannot sync ingress with the service registry: requeueing...")
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// getIngressState returns the state that the service of the ingress with the
+// provided name should have on the service registry.
+//
+// As with services, a state with no endpoints is returned if the ingress
+// does not exist, if its namespace is not watched or if it is not eligible
+// for registration.
+func getIngressState(ctx context.Context, cli client.Client, name types.NamespacedName, opts *ControllerOptions) (*serviceregistry.ServiceState, error) {
+	state := &serviceregistry.ServiceState{
+		Namespace: name.Namespace,
+		Name:      ingressServicePrefix + name.Name,
+		Kind:      ingressOwnerKind,
+	}
+
+	opts.Resolver.release(ingressOwnerKind, name)
+
+	var ingress networkingv1.Ingress
+	if err := cli.Get(ctx, name, &ingress); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return state, nil
+		}
+
+		return nil, err
+	}
+
+	if ingress.DeletionTimestamp != nil {
+		return state, nil
+	}
+
+	var namespace corev1.Namespace
+	if err := cli.Get(ctx, types.NamespacedName{Name: name.Namespace}, &namespace); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return state, nil
+		}
+
+		return nil, err
+	}
+
+	watchByDefault, annotations := opts.getWatchSettings()
+	if namespace.DeletionTimestamp != nil ||
+		!checkNsLabels(namespace.Labels, watchByDefault) {
+		return state, nil
+	}
+	annotations = annotations.forNamespace(&namespace)
+
+	checkedIngress := checkIngress(&ingress, annotations, opts.Resolver.lookupFunc(ingressOwnerKind, name))
+	if !checkedIngress.passed {
+		return state, checkedIngress.err
+	}
+
+	state.Endpoints = opts.prepareEndpoints(checkedIngress.endpoints, nil)
+	opts.placeMetadata(state, annotations, &ingress)
+
+	return state, nil
+}
+
+// checkIngress checks whether the ingress can be registered and returns its
+// endpoints: one for each address of its load balancer and port where it
+// serves traffic, i.e. 80 and, if it has TLS settings, 443.
+func checkIngress(ingress *networkingv1.Ingress, annotationsToKeep annotationFilter, lookup func(string) ([]string, bool)) (result checkServiceResult) {
+	annotations := annotationsToKeep.apply(ingress)
+	if len(annotations) == 0 {
+		result.reason = "no valid annotations"
+		return
+	}
+
+	ipsMap := map[string]bool{}
+	for _, ing := range ingress.Status.LoadBalancer.Ingress {
+		if ing.IP != "" {
+			ipsMap[ing.IP] = true
+		}
+
+		if ing.Hostname != "" {
+			resolvedIPs, resolved := lookup(ing.Hostname)
+			if !resolved {
+				result.reason = "hostnames not resolved yet"
+				result.err = errResolutionPending
+				return
+			}
+
+			for _, resolvedIP := range resolvedIPs {
+				ipsMap[resolvedIP] = true
+			}
+		}
+	}
+
+	if len(ipsMap) == 0 {
+		result.reason = "no valid hostnames/ips found"
+		return
+	}
+
+	// Endpoints share the same metadata, so the rules of the ingress are
+	// added to a copy of the filtered annotations.
+	metadata := map[string]string{}
+	for key, val := range annotations {
+		metadata[key] = val
+	}
+	if hosts, rules := getIngressRules(ingress); len(rules) > 0 {
+		metadata[ingressHostsMetadataKey] = joinCapped(hosts, maxListMetadataLength)
+		metadata[ingressRulesMetadataKey] = joinCapped(rules, maxListMetadataLength)
+	}
+
+	ports := []int32{80}
+	if len(ingress.Spec.TLS) > 0 {
+		ports = append(ports, 443)
+	}
+
+	result = checkServiceResult{
+		passed:      true,
+		annotations: metadata,
+		ips:         []string{},
+		endpoints:   []*serego.Endpoint{},
+	}
+	for ip := range ipsMap {
+		result.ips = append(result.ips, ip)
+	}
+	sort.Strings(result.ips)
+
+	for _, port := range ports {
+		for _, ip := range result.ips {
+			result.endpoints = append(result.endpoints, newEndpoint(ingress.Namespace,
+				ingressServicePrefix+ingress.Name, ip, port, metadata))
+		}
+	}
+
+	return
+}
+
+// getIngressRules returns the sorted hosts and host/path rules of the
+// ingress. Rules without a host are returned with * as host.
+func getIngressRules(ingress *networkingv1.Ingress) (hosts []string, rules []string) {
+	hostsMap, rulesMap := map[string]bool{}, map[string]bool{}
+	for _, rule := range ingress.Spec.Rules {
+		host := rule.Host
+		if host == "" {
+			host = "*"
+		}
+		hostsMap[host] = true
+
+		if rule.HTTP == nil || len(rule.HTTP.Paths) == 0 {
+			rulesMap[host+"/"] = true
+			continue
+		}
+
+		for _, path := range rule.HTTP.Paths {
+			p := path.Path
+			if !strings.HasPrefix(p, "/") {
+				p = "/" + p
+			}
+			rulesMap[host+p] = true
+		}
+	}
+
+	if len(rulesMap) == 0 && ingress.Spec.DefaultBackend != nil {
+		hostsMap["*"], rulesMap["*/"] = true, true
+	}
+
+	for host := range hostsMap {
+		hosts = append(hosts, host)
+	}
+	for rule := range rulesMap {
+		rules = append(rules, rule)
+	}
+	sort.Strings(hosts)
+	sort.Strings(rules)
+	return
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetIngressState(t *testing.T) {
+	name := types.NamespacedName{Namespace: "ns", Name: "web"}
+	opts := &ControllerOptions{ServiceAnnotations: []string{"version"}, Ingresses: true}
+	namespace := func(watch string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   name.Namespace,
+			Labels: map[string]string{watchLabel: watch},
+		}}
+	}
+	ingress := func(annotations map[string]string, ips ...string) *networkingv1.Ingress {
+		ing := &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name.Name,
+				Namespace:   name.Namespace,
+				Annotations: annotations,
+			},
+			Spec: networkingv1.IngressSpec{
+				TLS: []networkingv1.IngressTLS{{Hosts: []string{"shop.example.com"}}},
+				Rules: []networkingv1.IngressRule{
+					{
+						Host: "shop.example.com",
+						IngressRuleValue: networkingv1.IngressRuleValue{
+							HTTP: &networkingv1.HTTPIngressRuleValue{
+								Paths: []networkingv1.HTTPIngressPath{{Path: "/api"}, {Path: "/"}},
+							},
+						},
+					},
+					{Host: "blog.example.com"},
+				},
+			},
+		}
+		for _, ip := range ips {
+			ing.Status.LoadBalancer.Ingress = append(ing.Status.LoadBalancer.Ingress,
+				networkingv1.IngressLoadBalancerIngress{IP: ip})
+		}
+		return ing
+	}
+
+	cases := []struct {
+		id           string
+		objects      []client.Object
+		expEndpoints int
+	}{
+		{
+			id:      "ingress-not-found",
+			objects: []client.Object{namespace(watchEnabledLabel)},
+		},
+		{
+			id: "namespace-not-watched",
+			objects: []client.Object{
+				namespace(watchDisabledLabel),
+				ingress(map[string]string{"version": "v1"}, "10.10.10.10"),
+			},
+		},
+		{
+			id: "no-valid-annotations",
+			objects: []client.Object{
+				namespace(watchEnabledLabel),
+				ingress(map[string]string{"other": "v1"}, "10.10.10.10"),
+			},
+		},
+		{
+			id: "no-addresses",
+			objects: []client.Object{
+				namespace(watchEnabledLabel),
+				ingress(map[string]string{"version": "v1"}),
+			},
+		},
+		{
+			id: "success",
+			objects: []client.Object{
+				namespace(watchEnabledLabel),
+				ingress(map[string]string{"version": "v1"}, "10.10.10.10", "10.10.10.11"),
+			},
+			expEndpoints: 4,
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		cli := fake.NewClientBuilder().WithObjects(currCase.objects...).Build()
+		res, err := getIngressState(context.Background(), cli, name, opts)
+		if !a.NoError(err) ||
+			!a.Equal(name.Namespace, res.Namespace) ||
+			!a.Equal(ingressServicePrefix+name.Name, res.Name) ||
+			!a.Len(res.Endpoints, currCase.expEndpoints) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+
+		for _, endp := range res.Endpoints {
+			if !a.Equal(map[string]string{
+				"version":               "v1",
+				ipFamilyMetadataKey:     "IPv4",
+				ingressHostsMetadataKey: "blog.example.com,shop.example.com",
+				ingressRulesMetadataKey: "blog.example.com/,shop.example.com/,shop.example.com/api",
+			}, endp.Metadata) {
+				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+			}
+		}
+
+		// The garbage collector must find the ingress from the name of its
+		// service on the service registry.
+		registered, err := getRegisteredState(context.Background(), cli, types.NamespacedName{
+			Namespace: res.Namespace,
+			Name:      res.Name,
+		}, ingressOwnerKind, opts)
+		if !a.NoError(err) || !a.Equal(res, registered) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
+
+func TestGetIngressRules(t *testing.T) {
+	cases := []struct {
+		id       string
+		spec     networkingv1.IngressSpec
+		expHosts []string
+		expRules []string
+	}{
+		{
+			id: "empty",
+		},
+		{
+			id: "default-backend",
+			spec: networkingv1.IngressSpec{
+				DefaultBackend: &networkingv1.IngressBackend{},
+			},
+			expHosts: []string{"*"},
+			expRules: []string{"*/"},
+		},
+		{
+			id: "rules-without-host",
+			spec: networkingv1.IngressSpec{
+				Rules: []networkingv1.IngressRule{
+					{
+						IngressRuleValue: networkingv1.IngressRuleValue{
+							HTTP: &networkingv1.HTTPIngressRuleValue{
+								Paths: []networkingv1.HTTPIngressPath{{Path: "api"}},
+							},
+						},
+					},
+				},
+			},
+			expHosts: []string{"*"},
+			expRules: []string{"*/api"},
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		hosts, rules := getIngressRules(&networkingv1.Ingress{Spec: currCase.spec})
+		if !a.Equal(currCase.expHosts, hosts) || !a.Equal(currCase.expRules, rules) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
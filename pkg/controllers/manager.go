@@ -18,22 +18,71 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-operator/api/v1alpha1"
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
-func NewManager(kubeconfigPath string) (manager.Manager, error) {
+const (
+	defaultLeaderElectionName string = "cnwan-operator-leader-election"
+	cacheSyncCheckTimeout            = time.Second
+)
+
+// ManagerOptions contains options for the manager of the controllers.
+type ManagerOptions struct {
+	// MetricsBindAddress is the address where metrics are served, e.g.
+	// :8080. Metrics are not served if empty.
+	MetricsBindAddress string
+	// HealthProbeBindAddress is the address where the /healthz and /readyz
+	// endpoints are served, e.g. :8081. Probes are not served if empty.
+	HealthProbeBindAddress string
+	// LeaderElection, if not nil, enables leader election: the controllers,
+	// along with any other runnable added to the manager, only run on the
+	// replica that is currently the leader.
+	LeaderElection *LeaderElectionOptions
+}
+
+// LeaderElectionOptions contains options about the election of a leader
+// among all replicas of the operator, so that only one of them at a time
+// performs operations on the service registry.
+type LeaderElectionOptions struct {
+	// Namespace where the lease is created.
+	Namespace string
+	// Name of the lease. Defaults to cnwan-operator-leader-election if empty.
+	Name string
+	// LeaseDuration, RenewDeadline and RetryPeriod control the timing of the
+	// election, as described in the controller-runtime documentation. The
+	// controller-runtime defaults are used for empty values.
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// NewManager returns a new manager for the controllers.
+func NewManager(kubeconfigPath string, mgrOpts *ManagerOptions) (manager.Manager, error) {
+	if mgrOpts == nil {
+		mgrOpts = &ManagerOptions{}
+	}
+
 	scheme := k8sruntime.NewScheme()
 	if err := clientgoscheme.AddToScheme(scheme); err != nil {
 		return nil, fmt.Errorf("could not add to scheme: %w", err)
 	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("could not add to scheme: %w", err)
+	}
 
 	cfg, err := func() (*rest.Config, error) {
 		if kubeconfigPath == "" {
@@ -46,9 +95,69 @@ func NewManager(kubeconfigPath string) (manager.Manager, error) {
 		return nil, fmt.Errorf("could not get config: %w", err)
 	}
 
-	return manager.New(cfg, manager.Options{
+	opts := manager.Options{
 		Scheme:             scheme,
 		LeaderElection:     false,
 		MetricsBindAddress: "0",
-	})
+	}
+
+	if mgrOpts.MetricsBindAddress != "" {
+		opts.MetricsBindAddress = mgrOpts.MetricsBindAddress
+	}
+	opts.HealthProbeBindAddress = mgrOpts.HealthProbeBindAddress
+
+	if leOpts := mgrOpts.LeaderElection; leOpts != nil {
+		opts.LeaderElection = true
+		opts.LeaderElectionResourceLock = "leases"
+		opts.LeaderElectionNamespace = leOpts.Namespace
+		opts.LeaderElectionID = leOpts.Name
+		if opts.LeaderElectionID == "" {
+			opts.LeaderElectionID = defaultLeaderElectionName
+		}
+
+		// Release the lease as soon as the manager is stopped -- i.e. after
+		// all runnables exited -- so that another replica can take over
+		// without waiting for the lease to expire.
+		opts.LeaderElectionReleaseOnCancel = true
+
+		if leOpts.LeaseDuration > 0 {
+			opts.LeaseDuration = &leOpts.LeaseDuration
+		}
+		if leOpts.RenewDeadline > 0 {
+			opts.RenewDeadline = &leOpts.RenewDeadline
+		}
+		if leOpts.RetryPeriod > 0 {
+			opts.RetryPeriod = &leOpts.RetryPeriod
+		}
+	}
+
+	mgr, err := manager.New(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		return nil, fmt.Errorf("could not add health check: %w", err)
+	}
+
+	if err := mgr.AddReadyzCheck("informers", newCacheSyncedChecker(mgr.GetCache())); err != nil {
+		return nil, fmt.Errorf("could not add readiness check: %w", err)
+	}
+
+	return mgr, nil
+}
+
+// newCacheSyncedChecker returns a checker that fails until the informers of
+// the provided cache have synced.
+func newCacheSyncedChecker(c cache.Cache) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, canc := context.WithTimeout(req.Context(), cacheSyncCheckTimeout)
+		defer canc()
+
+		if !c.WaitForCacheSync(ctx) {
+			return fmt.Errorf("informers have not synced yet")
+		}
+
+		return nil
+	}
 }
@@ -0,0 +1,35 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	dnsResolutionFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "cnwan_operator",
+		Name:      "dns_resolution_failures_total",
+		Help:      "Total number of failed attempts to resolve the hostname of a LoadBalancer service.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(dnsResolutionFailuresTotal)
+}
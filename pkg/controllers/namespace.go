@@ -19,10 +19,12 @@ package controllers
 
 import (
 	"context"
+	"reflect"
+	"sync"
 	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-operator/internal/types"
 	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
-	serego "github.com/CloudNativeSDWAN/serego/api/core/types"
 	"github.com/rs/zerolog"
 	corev1 "k8s.io/api/core/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
@@ -30,7 +32,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
@@ -40,15 +44,95 @@ const (
 	watchLabel         string = "operator.cnwan.io/watch"
 	watchEnabledLabel  string = "enabled"
 	watchDisabledLabel string = "disabled"
+
+	requeueBaseDelay time.Duration = time.Second
+	requeueMaxDelay  time.Duration = 5 * time.Minute
+	syncTimeout      time.Duration = 5 * time.Minute
 )
 
 type ControllerOptions struct {
 	WatchNamespacesByDefault bool
 	ServiceAnnotations       []string
 	EventsChan               chan *serviceregistry.Event
+	// AnnotationRules transform annotations into metadata. They are set with
+	// UpdateWatchSettings, which compiles them.
+	AnnotationRules []types.AnnotationRule
+	// NamespaceAnnotations are the annotations of namespaces inherited by
+	// the objects inside them, while ServiceLabels are the labels that are
+	// registered as metadata.
+	NamespaceAnnotations []string
+	ServiceLabels        []string
+	// NodePortAddressType, if not empty, enables the registration of
+	// NodePort services, with the addresses of this type of all ready nodes.
+	NodePortAddressType corev1.NodeAddressType
+	// EndpointSlices enables the registration of ClusterIP services --
+	// including headless ones -- with the addresses of their ready pods.
+	EndpointSlices bool
+	// Ingresses enables the registration of ingresses, each one as a
+	// service with the addresses of its load balancer.
+	Ingresses bool
+	// Gateways enables the registration of Gateway API gateways and
+	// HTTPRoutes the registration of the routes attached to them.
+	Gateways   bool
+	HTTPRoutes bool
+	// ReadableEndpointNames makes endpoints be named after their service,
+	// port and address rather than after an hash of their address and port.
+	ReadableEndpointNames bool
+	// HierarchicalMetadata makes the metadata of objects be registered on
+	// their services and the one inherited from namespaces on the
+	// namespaces, rather than on all endpoints.
+	HierarchicalMetadata bool
+	// IPFamilies are the IP families of the addresses that are registered.
+	// If empty, addresses of all families are registered.
+	IPFamilies []corev1.IPFamily
+	// Resolver resolves the hostnames of load balancers.
+	Resolver *HostnameResolver
+
+	// lock protects the fields set by UpdateWatchSettings, which can be
+	// updated while the controllers are running.
+	lock            sync.RWMutex
+	annotationRules []*annotationRule
+}
+
+func (o *ControllerOptions) getWatchSettings() (bool, annotationFilter) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	return o.WatchNamespacesByDefault, annotationFilter{
+		allowed:              o.ServiceAnnotations,
+		rules:                o.annotationRules,
+		labels:               o.ServiceLabels,
+		namespaceAnnotations: o.NamespaceAnnotations,
+	}
 }
 
-type namespaceEventHandler struct {
+// UpdateWatchSettings replaces the current settings about namespaces and
+// annotations to watch, and returns true if they changed.
+func (o *ControllerOptions) UpdateWatchSettings(watchNamespacesByDefault bool, service types.ServiceSettings) (bool, error) {
+	rules, err := newAnnotationRules(service.AnnotationRules)
+	if err != nil {
+		return false, err
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	changed := o.WatchNamespacesByDefault != watchNamespacesByDefault ||
+		!sameElements(o.ServiceAnnotations, service.Annotations) ||
+		!reflect.DeepEqual(o.AnnotationRules, service.AnnotationRules) ||
+		!sameElements(o.NamespaceAnnotations, service.NamespaceAnnotations) ||
+		!sameElements(o.ServiceLabels, service.Labels)
+
+	o.WatchNamespacesByDefault = watchNamespacesByDefault
+	o.ServiceAnnotations = service.Annotations
+	o.AnnotationRules = service.AnnotationRules
+	o.NamespaceAnnotations = service.NamespaceAnnotations
+	o.ServiceLabels = service.Labels
+	o.annotationRules = rules
+	return changed, nil
+}
+
+type namespaceReconciler struct {
 	client client.Client
 	log    zerolog.Logger
 	*ControllerOptions
@@ -62,22 +146,51 @@ func NewNamespaceController(mgr manager.Manager, opts *ControllerOptions, log ze
 		return nil, ErrorInvalidControllerOptions
 	}
 
-	nsHandler := &namespaceEventHandler{
+	nsReconciler := &namespaceReconciler{
 		client:            mgr.GetClient(),
 		log:               log,
 		ControllerOptions: opts,
 	}
 	c, err := controller.New(nsCtrlName, mgr, controller.Options{
-		Reconciler: reconcile.Func(func(c context.Context, r reconcile.Request) (reconcile.Result, error) {
-			return reconcile.Result{}, nil
-		}),
+		Reconciler:  nsReconciler,
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(requeueBaseDelay, requeueMaxDelay),
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = c.Watch(&source.Kind{Type: &corev1.Namespace{}}, nsHandler)
+	err = c.Watch(&source.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestForObject{}, predicate.Funcs{
+		// The namespace is registered once an appropriate service appears
+		// and its services are removed by the service controller when it is
+		// deleted, so we only care about namespaces that started or stopped
+		// being watched or whose inherited annotations changed.
+		CreateFunc: func(event.CreateEvent) bool {
+			return false
+		},
+		UpdateFunc: func(ue event.UpdateEvent) bool {
+			if ue.ObjectOld == nil || ue.ObjectNew == nil {
+				return false
+			}
+
+			watchByDefault, annotations := opts.getWatchSettings()
+			wasWatched := checkNsLabels(ue.ObjectOld.GetLabels(), watchByDefault)
+			isWatched := checkNsLabels(ue.ObjectNew.GetLabels(), watchByDefault)
+			if wasWatched != isWatched {
+				return true
+			}
+
+			return isWatched && !reflect.DeepEqual(
+				filterAnnotations(ue.ObjectOld.GetAnnotations(), annotations.namespaceAnnotations),
+				filterAnnotations(ue.ObjectNew.GetAnnotations(), annotations.namespaceAnnotations))
+		},
+		DeleteFunc: func(event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(event.GenericEvent) bool {
+			return false
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -85,122 +198,12 @@ func NewNamespaceController(mgr manager.Manager, opts *ControllerOptions, log ze
 	return c, nil
 }
 
-// Create handles create events.
-func (n *namespaceEventHandler) Create(ce event.CreateEvent, wq workqueue.RateLimitingInterface) {
-	// The namespace is created once an appropriate service appears.
-	wq.Done(ce.Object)
-}
-
-// Update handles update events.
-func (n *namespaceEventHandler) Update(ue event.UpdateEvent, wq workqueue.RateLimitingInterface) {
-	defer wq.Done(ue.ObjectNew)
-
-	curr, currok := ue.ObjectNew.(*corev1.Namespace)
-	old, oldok := ue.ObjectOld.(*corev1.Namespace)
-	if !currok || !oldok {
-		return
-	}
-
-	watchNow := checkNsLabels(curr.Labels, n.WatchNamespacesByDefault)
-	watchedBefore := checkNsLabels(old.Labels, n.WatchNamespacesByDefault)
-
-	switch {
-	case watchedBefore && watchNow:
-		return
-	case watchedBefore && !watchNow:
-		n.handleUpdateEvent(curr, serviceregistry.EventDelete)
-	case !watchedBefore && watchNow:
-		n.handleUpdateEvent(curr, serviceregistry.EventCreate)
-	}
-}
-
-// Delete handles delete events.
-func (n *namespaceEventHandler) Delete(de event.DeleteEvent, wq workqueue.RateLimitingInterface) {
-	defer wq.Done(de.Object)
-
-	namespace, ok := de.Object.(*corev1.Namespace)
-	if !ok {
-		return
-	}
-
-	if !checkNsLabels(namespace.Labels, n.WatchNamespacesByDefault) {
-		return
-	}
-
-	n.handleUpdateEvent(namespace, serviceregistry.EventDelete)
-}
-
-func (n *namespaceEventHandler) handleUpdateEvent(namespace *corev1.Namespace, eventType serviceregistry.EventType) {
-	ctx, canc := context.WithTimeout(context.Background(), 10*time.Second)
-	defer canc()
-
-	services := corev1.ServiceList{}
-	if err := n.client.List(ctx, &services, &client.ListOptions{
-		Namespace: namespace.Name,
-	}); err != nil {
-		n.log.Err(err).Str("namespace", namespace.Name).
-			Msg("cannot retrieve list of services inside namespace")
-		return
-	}
-
-	// Inline function definitions for sending the namespace and service
-	sendNsEvent := func() {
-		n.EventsChan <- &serviceregistry.Event{
-			EventType: eventType,
-			Object: &serego.Namespace{
-				Name: namespace.Name,
-			},
-		}
-	}
-	switch eventType {
-	case serviceregistry.EventCreate:
-		sendNsEvent()
-	case serviceregistry.EventDelete:
-		defer sendNsEvent()
-	}
-
-	sendServiceEvent := func(name string) {
-		n.EventsChan <- &serviceregistry.Event{
-			EventType: eventType,
-			Object: &serego.Service{
-				Namespace: namespace.Name,
-				Name:      name,
-			},
-		}
-	}
-
-	for _, service := range services.Items {
-		checkedService := checkService(&service, n.ServiceAnnotations)
-		if !checkedService.passed {
-			if checkedService.err != nil {
-				n.log.Err(checkedService.err).Msg("cannot check service")
-			}
-			continue
-		}
-
-		func() {
-			// using an anonymous function, so we can defer events
-			// if needed.
-			switch eventType {
-			case serviceregistry.EventCreate:
-				sendServiceEvent(service.Name)
-			case serviceregistry.EventDelete:
-				defer sendServiceEvent(service.Name)
-			}
-
-			for _, endpoint := range checkedService.endpoints {
-				n.EventsChan <- &serviceregistry.Event{
-					EventType: serviceregistry.EventDelete,
-					Object:    endpoint,
-				}
-			}
-		}()
-	}
-}
+// Reconcile syncs all services inside the namespace with the service
+// registry, so that they are registered if the namespace is now watched,
+// removed if it is not anymore or updated with its new annotations.
+func (n *namespaceReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	l := n.log.With().Str("namespace", req.Name).Logger()
 
-// Generic handles generic events.
-func (n *namespaceEventHandler) Generic(ge event.GenericEvent, wq workqueue.RateLimitingInterface) {
-	// We don't really know what to do with generic events.
-	// We will just ignore this.
-	wq.Done(ge.Object)
+	return reconcile.Result{}, syncServices(ctx, n.client, n.ControllerOptions, l,
+		&client.ListOptions{Namespace: req.Name})
 }
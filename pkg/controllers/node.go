@@ -0,0 +1,125 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/rs/zerolog"
+	corev1 "k8s.io/api/core/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	nodeCtrlName string = "node-event-handler"
+)
+
+type nodeReconciler struct {
+	client client.Client
+	log    zerolog.Logger
+	*ControllerOptions
+}
+
+// NewNodeController returns a controller that watches nodes and syncs all
+// NodePort services with the service registry when a node joins, leaves, or
+// changes its readiness or addresses.
+//
+// It must only be created if ControllerOptions.NodePortAddressType is set.
+func NewNodeController(mgr manager.Manager, opts *ControllerOptions, log zerolog.Logger) (controller.Controller, error) {
+	if mgr == nil {
+		return nil, ErrorInvalidManager
+	}
+	if opts == nil || opts.NodePortAddressType == "" {
+		return nil, ErrorInvalidControllerOptions
+	}
+
+	nodeReconciler := &nodeReconciler{
+		client:            mgr.GetClient(),
+		log:               log,
+		ControllerOptions: opts,
+	}
+	c, err := controller.New(nodeCtrlName, mgr, controller.Options{
+		Reconciler:  nodeReconciler,
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(requeueBaseDelay, requeueMaxDelay),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// All changes are mapped to the same request, so that changes to many
+	// nodes at once -- e.g. while scaling the cluster -- are coalesced into
+	// a few syncs of the services.
+	enqueueSync := handler.EnqueueRequestsFromMapFunc(func(client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: ktypes.NamespacedName{Name: nodeCtrlName}}}
+	})
+
+	err = c.Watch(&source.Kind{Type: &corev1.Node{}}, enqueueSync, predicate.Funcs{
+		UpdateFunc: func(ue event.UpdateEvent) bool {
+			oldNode, ok := ue.ObjectOld.(*corev1.Node)
+			if !ok {
+				return false
+			}
+			newNode, ok := ue.ObjectNew.(*corev1.Node)
+			if !ok {
+				return false
+			}
+
+			return !reflect.DeepEqual(getNodeIPs([]corev1.Node{*oldNode}, opts.NodePortAddressType),
+				getNodeIPs([]corev1.Node{*newNode}, opts.NodePortAddressType))
+		},
+		GenericFunc: func(event.GenericEvent) bool {
+			return false
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reconcile syncs all NodePort services with the service registry, so that
+// their endpoints reflect the current ready nodes.
+func (n *nodeReconciler) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	services := corev1.ServiceList{}
+	if err := n.client.List(ctx, &services); err != nil {
+		n.log.Err(err).Msg("cannot retrieve list of services")
+		return reconcile.Result{}, err
+	}
+
+	nodePortServices := []corev1.Service{}
+	for _, service := range services.Items {
+		if service.Spec.Type == corev1.ServiceTypeNodePort {
+			nodePortServices = append(nodePortServices, service)
+		}
+	}
+
+	n.log.Debug().Int("services", len(nodePortServices)).
+		Msg("nodes changed: syncing NodePort services...")
+	return reconcile.Result{}, syncServiceList(ctx, n.client, n.ControllerOptions, n.log, nodePortServices)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestNodeReconcile(t *testing.T) {
+	a := assert.New(t)
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "ns",
+		Labels: map[string]string{watchLabel: watchEnabledLabel},
+	}}
+	service := func(name string, servType corev1.ServiceType) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "ns",
+				Annotations: map[string]string{"version": "v1"},
+			},
+			Spec: corev1.ServiceSpec{
+				Type:  servType,
+				Ports: []corev1.ServicePort{{Port: 80, NodePort: 30080}},
+			},
+		}
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			Addresses:  []corev1.NodeAddress{{Type: corev1.NodeExternalIP, Address: "1.1.1.1"}},
+		},
+	}
+
+	eventsChan := make(chan *serviceregistry.Event, 10)
+	cli := fake.NewClientBuilder().WithObjects(namespace, node,
+		service("node-port", corev1.ServiceTypeNodePort),
+		service("cluster-ip", corev1.ServiceTypeClusterIP)).Build()
+	r := &nodeReconciler{
+		client: cli,
+		log:    zerolog.Nop(),
+		ControllerOptions: &ControllerOptions{
+			ServiceAnnotations:  []string{"version"},
+			EventsChan:          eventsChan,
+			NodePortAddressType: corev1.NodeExternalIP,
+		},
+	}
+
+	states := []*serviceregistry.ServiceState{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ev := range eventsChan {
+			states = append(states, ev.Object.(*serviceregistry.ServiceState))
+			ev.Result <- nil
+		}
+	}()
+
+	_, err := r.Reconcile(context.Background(), reconcile.Request{})
+	close(eventsChan)
+	<-done
+
+	if !a.NoError(err) || !a.Len(states, 1) {
+		return
+	}
+	a.Equal("node-port", states[0].Name)
+	if a.Len(states[0].Endpoints, 1) {
+		a.Equal("1.1.1.1", states[0].Endpoints[0].Address)
+		a.Equal(int32(30080), states[0].Endpoints[0].Port)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/api/v1alpha1"
+	"github.com/CloudNativeSDWAN/cnwan-operator/internal/types"
+	"github.com/CloudNativeSDWAN/cnwan-operator/internal/utils"
+	"github.com/rs/zerolog"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	opCfgCtrlName string = "operator-config-event-handler"
+
+	// operatorConfigStatusInterval is how frequently the connection to the
+	// service registry is checked and reported on the status.
+	operatorConfigStatusInterval time.Duration = time.Minute
+
+	reasonRegistryReachable   string = "RegistryReachable"
+	reasonRegistryUnreachable string = "RegistryUnreachable"
+)
+
+// OperatorConfigOptions contains options for the controller of the
+// OperatorConfig with the settings of the operator.
+type OperatorConfigOptions struct {
+	// Name of the OperatorConfig.
+	Name ktypes.NamespacedName
+	// Settings are the ones the operator was started with.
+	Settings *types.Settings
+	// Status contains the values resolved by the operator at startup, e.g.
+	// the cluster ID or the region, and is reported on the OperatorConfig.
+	// Its ObservedGeneration and Conditions are ignored.
+	Status v1alpha1.OperatorConfigStatus
+	// CheckRegistry returns an error if the service registry cannot be
+	// reached. The RegistryConnected condition is not reported if nil.
+	CheckRegistry func(context.Context) error
+}
+
+type operatorConfigReconciler struct {
+	*settingsReconciler
+	status        v1alpha1.OperatorConfigStatus
+	checkRegistry func(context.Context) error
+	// rejectedGeneration is the last generation with invalid settings, so
+	// that they are not reported again on each periodic reconcile.
+	rejectedGeneration int64
+}
+
+// NewOperatorConfigController returns a controller that watches the
+// OperatorConfig with the settings of the operator, applies the changes that
+// can be applied without a restart -- exactly like the controller returned
+// by NewSettingsController does for the config map -- and keeps its status
+// up to date.
+func NewOperatorConfigController(mgr manager.Manager, opts *ControllerOptions, cfgOpts *OperatorConfigOptions, log zerolog.Logger) (controller.Controller, error) {
+	if mgr == nil {
+		return nil, ErrorInvalidManager
+	}
+	if opts == nil || cfgOpts == nil {
+		return nil, ErrorInvalidControllerOptions
+	}
+
+	// As with the config map, only the namespace of the operator is watched.
+	opCfgCache, err := cache.New(mgr.GetConfig(), cache.Options{
+		Scheme:    mgr.GetScheme(),
+		Mapper:    mgr.GetRESTMapper(),
+		Namespace: cfgOpts.Name.Namespace,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create cache for operator configs: %w", err)
+	}
+
+	if err := mgr.Add(opCfgCache); err != nil {
+		return nil, fmt.Errorf("cannot add cache for operator configs: %w", err)
+	}
+
+	opCfgReconciler := &operatorConfigReconciler{
+		settingsReconciler: &settingsReconciler{
+			reader:            opCfgCache,
+			client:            mgr.GetClient(),
+			recorder:          mgr.GetEventRecorderFor("cnwan-operator"),
+			log:               log,
+			settings:          cfgOpts.Settings,
+			ControllerOptions: opts,
+		},
+		status:        cfgOpts.Status,
+		checkRegistry: cfgOpts.CheckRegistry,
+	}
+	c, err := controller.New(opCfgCtrlName, mgr, controller.Options{
+		Reconciler:  opCfgReconciler,
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(requeueBaseDelay, requeueMaxDelay),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Updates to the status do not change the generation, so they are not
+	// reconciled again.
+	err = c.Watch(source.NewKindWithCache(&v1alpha1.OperatorConfig{}, opCfgCache),
+		&handler.EnqueueRequestForObject{},
+		predicate.GenerationChangedPredicate{},
+		predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetNamespace() == cfgOpts.Name.Namespace &&
+				obj.GetName() == cfgOpts.Name.Name
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reconcile applies the settings contained in the OperatorConfig and updates
+// its status. It is also periodically repeated, in order to report the
+// current state of the connection to the service registry.
+func (o *operatorConfigReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	l := o.log.With().Str("operator-config", req.NamespacedName.String()).Logger()
+
+	var opCfg v1alpha1.OperatorConfig
+	if err := o.reader.Get(ctx, req.NamespacedName, &opCfg); err != nil {
+		if k8serrors.IsNotFound(err) {
+			l.Warn().Msg("operator config not found: keeping current settings")
+			return reconcile.Result{}, nil
+		}
+
+		return reconcile.Result{}, err
+	}
+
+	status := *o.status.DeepCopy()
+	status.ObservedGeneration = opCfg.Status.ObservedGeneration
+	status.Conditions = append([]metav1.Condition{}, opCfg.Status.Conditions...)
+
+	var applyErr error
+	if opCfg.Status.ObservedGeneration != opCfg.Generation {
+		settings, err := utils.ParseAndValidateSettings(utils.SettingsFromOperatorConfig(&opCfg.Spec))
+		switch {
+		case err != nil && o.rejectedGeneration != opCfg.Generation:
+			l.Err(err).Msg("invalid settings provided: keeping current settings")
+			o.recorder.Event(&opCfg, corev1.EventTypeWarning, reasonInvalidSettings,
+				fmt.Sprintf("settings were rejected and will not be applied: %s", err))
+			o.rejectedGeneration = opCfg.Generation
+		case err == nil:
+			applyErr = o.apply(ctx, &opCfg, settings, l)
+			if applyErr == nil {
+				status.ObservedGeneration = opCfg.Generation
+			}
+		}
+	}
+
+	if o.checkRegistry != nil {
+		cond := metav1.Condition{
+			Type:               v1alpha1.ConditionRegistryConnected,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: opCfg.Generation,
+			Reason:             reasonRegistryReachable,
+			Message:            "the service registry can be reached",
+		}
+		if err := o.checkRegistry(ctx); err != nil {
+			cond.Status = metav1.ConditionFalse
+			cond.Reason = reasonRegistryUnreachable
+			cond.Message = err.Error()
+		}
+		meta.SetStatusCondition(&status.Conditions, cond)
+	}
+
+	if !reflect.DeepEqual(status, opCfg.Status) {
+		opCfg.Status = status
+		if err := o.client.Status().Update(ctx, &opCfg); err != nil {
+			l.Err(err).Msg("cannot update status of operator config")
+			return reconcile.Result{}, err
+		}
+	}
+
+	return reconcile.Result{RequeueAfter: operatorConfigStatusInterval}, applyErr
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/api/v1alpha1"
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestOperatorConfigReconcile(t *testing.T) {
+	a := assert.New(t)
+	scheme := k8sruntime.NewScheme()
+	a.NoError(clientgoscheme.AddToScheme(scheme))
+	a.NoError(v1alpha1.AddToScheme(scheme))
+
+	name := ktypes.NamespacedName{Namespace: "cnwan-operator-system", Name: "cnwan-operator"}
+	newOperatorConfig := func(spec v1alpha1.OperatorConfigSpec) *v1alpha1.OperatorConfig {
+		return &v1alpha1.OperatorConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: name.Namespace, Name: name.Name, Generation: 2},
+			Spec:       spec,
+		}
+	}
+	etcd := v1alpha1.ServiceRegistrySpec{
+		Etcd: &v1alpha1.EtcdSpec{Endpoints: []v1alpha1.EtcdEndpointSpec{{Host: "etcd"}}},
+	}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "ns",
+		Labels: map[string]string{watchLabel: watchEnabledLabel},
+	}}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "serv",
+			Namespace:   "ns",
+			Annotations: map[string]string{"version": "v1"},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Port: 80}},
+		},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "10.10.10.10"}},
+			},
+		},
+	}
+
+	cases := []struct {
+		id                    string
+		spec                  v1alpha1.OperatorConfigSpec
+		registryErr           error
+		expAnnotations        []string
+		expEvents             []string
+		expSynced             int
+		expObservedGeneration int64
+		expConnected          metav1.ConditionStatus
+	}{
+		{
+			id:             "invalid",
+			spec:           v1alpha1.OperatorConfigSpec{ServiceAnnotations: []string{"version"}},
+			expAnnotations: []string{},
+			expEvents:      []string{"Warning " + reasonInvalidSettings},
+			expConnected:   metav1.ConditionTrue,
+		},
+		{
+			id:                    "changed",
+			spec:                  v1alpha1.OperatorConfigSpec{ServiceAnnotations: []string{"version"}, ServiceRegistry: etcd},
+			expAnnotations:        []string{"version"},
+			expEvents:             []string{"Normal " + reasonSettingsApplied},
+			expSynced:             1,
+			expObservedGeneration: 2,
+			expConnected:          metav1.ConditionTrue,
+		},
+		{
+			id:                    "registry-unreachable",
+			spec:                  v1alpha1.OperatorConfigSpec{ServiceRegistry: etcd},
+			registryErr:           fmt.Errorf("connection refused"),
+			expAnnotations:        []string{},
+			expObservedGeneration: 2,
+			expConnected:          metav1.ConditionFalse,
+		},
+	}
+
+	for _, currCase := range cases {
+		eventsChan := make(chan *serviceregistry.Event, 10)
+		recorder := record.NewFakeRecorder(10)
+		cli := fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(newOperatorConfig(currCase.spec), namespace, service).Build()
+		r := &operatorConfigReconciler{
+			settingsReconciler: &settingsReconciler{
+				reader:   cli,
+				client:   cli,
+				recorder: recorder,
+				log:      zerolog.Nop(),
+				ControllerOptions: &ControllerOptions{
+					ServiceAnnotations: []string{},
+					EventsChan:         eventsChan,
+				},
+			},
+			status: v1alpha1.OperatorConfigStatus{ClusterID: "cluster-1", ServiceRegistry: "etcd"},
+			checkRegistry: func(context.Context) error {
+				return currCase.registryErr
+			},
+		}
+
+		synced := 0
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for ev := range eventsChan {
+				synced++
+				ev.Result <- nil
+			}
+		}()
+
+		_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: name})
+		close(eventsChan)
+		<-done
+		close(recorder.Events)
+
+		events := []string{}
+		for ev := range recorder.Events {
+			// Only keep the type and reason of the event.
+			events = append(events, strings.Join(strings.Fields(ev)[:2], " "))
+		}
+
+		var opCfg v1alpha1.OperatorConfig
+		if !a.NoError(err) || !a.NoError(cli.Get(context.Background(), name, &opCfg)) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+
+		cond := meta.FindStatusCondition(opCfg.Status.Conditions, v1alpha1.ConditionRegistryConnected)
+		if !a.Equal(currCase.expAnnotations, r.ServiceAnnotations) ||
+			!a.Equal(currCase.expSynced, synced) ||
+			!a.ElementsMatch(currCase.expEvents, events) ||
+			!a.Equal(currCase.expObservedGeneration, opCfg.Status.ObservedGeneration) ||
+			!a.Equal("cluster-1", opCfg.Status.ClusterID) ||
+			!a.NotNil(cond) ||
+			!a.Equal(currCase.expConnected, cond.Status) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
+
+func TestOperatorConfigReconcileFailedSync(t *testing.T) {
+	a := assert.New(t)
+	scheme := k8sruntime.NewScheme()
+	a.NoError(clientgoscheme.AddToScheme(scheme))
+	a.NoError(v1alpha1.AddToScheme(scheme))
+
+	name := ktypes.NamespacedName{Namespace: "cnwan-operator-system", Name: "cnwan-operator"}
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1alpha1.OperatorConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: name.Namespace, Name: name.Name, Generation: 2},
+			Spec: v1alpha1.OperatorConfigSpec{
+				ServiceAnnotations: []string{"version"},
+				ServiceRegistry: v1alpha1.ServiceRegistrySpec{
+					Etcd: &v1alpha1.EtcdSpec{Endpoints: []v1alpha1.EtcdEndpointSpec{{Host: "etcd"}}},
+				},
+			},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "ns",
+			Labels: map[string]string{watchLabel: watchEnabledLabel},
+		}},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "serv",
+				Namespace:   "ns",
+				Annotations: map[string]string{"version": "v1"},
+			},
+			Spec: corev1.ServiceSpec{
+				Type:  corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{{Port: 80}},
+			},
+			Status: corev1.ServiceStatus{
+				LoadBalancer: corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{{IP: "10.10.10.10"}},
+				},
+			},
+		},
+	).Build()
+	r := &operatorConfigReconciler{
+		settingsReconciler: &settingsReconciler{
+			reader:   cli,
+			client:   cli,
+			recorder: record.NewFakeRecorder(10),
+			log:      zerolog.Nop(),
+			ControllerOptions: &ControllerOptions{
+				ServiceAnnotations: []string{},
+			},
+		},
+		status: v1alpha1.OperatorConfigStatus{ClusterID: "cluster-1", ServiceRegistry: "etcd"},
+	}
+
+	// The generation must only be observed once services were synced.
+	cases := []struct {
+		id                    string
+		syncErr               error
+		expSynced             int
+		expObservedGeneration int64
+	}{
+		{
+			id:        "sync-fails",
+			syncErr:   fmt.Errorf("registry unavailable"),
+			expSynced: 1,
+		},
+		{
+			id:                    "sync-retried",
+			expSynced:             1,
+			expObservedGeneration: 2,
+		},
+		{
+			id:                    "already-observed",
+			expObservedGeneration: 2,
+		},
+	}
+
+	for _, currCase := range cases {
+		eventsChan := make(chan *serviceregistry.Event, 10)
+		r.EventsChan = eventsChan
+
+		synced := 0
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for ev := range eventsChan {
+				synced++
+				ev.Result <- currCase.syncErr
+			}
+		}()
+
+		_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: name})
+		close(eventsChan)
+		<-done
+
+		var opCfg v1alpha1.OperatorConfig
+		if !a.Equal(currCase.syncErr != nil, err != nil) ||
+			!a.NoError(cli.Get(context.Background(), name, &opCfg)) ||
+			!a.Equal(currCase.expSynced, synced) ||
+			!a.Equal(currCase.expObservedGeneration, opCfg.Status.ObservedGeneration) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
@@ -0,0 +1,442 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	defaultResolutionInterval time.Duration = time.Minute
+	defaultResolutionTimeout  time.Duration = 5 * time.Second
+	resolutionRetryBaseDelay  time.Duration = 2 * time.Second
+	// minResolutionInterval prevents hostnames whose records have a TTL of
+	// zero from being resolved continuously.
+	minResolutionInterval time.Duration = time.Second
+
+	serviceOwnerKind   string = "Service"
+	ingressOwnerKind   string = "Ingress"
+	gatewayOwnerKind   string = "Gateway"
+	httpRouteOwnerKind string = "HTTPRoute"
+)
+
+// errResolutionPending is returned when the state of an object cannot be
+// computed yet because some of its hostnames have not been resolved: the
+// object is reconciled again as soon as they are.
+var errResolutionPending = errors.New("hostname resolution pending")
+
+// resolvConfPath is where the nameservers of the system are read from.
+var resolvConfPath = "/etc/resolv.conf"
+
+// HostnameResolverOptions contains the settings of the HostnameResolver.
+type HostnameResolverOptions struct {
+	// Nameserver is the address -- with an optional port, defaulting to 53
+	// -- of the DNS server to use. If empty, the nameservers and search
+	// domains in /etc/resolv.conf are used.
+	Nameserver string
+	// Interval is the maximum time after which hostnames are resolved
+	// again: they are resolved again earlier if the TTL of their records
+	// expires before.
+	Interval time.Duration
+	// Timeout is the timeout of each resolution.
+	Timeout time.Duration
+	// RegisterHostnames makes hostnames be registered as they are rather
+	// than with their IPs, in which case they are never resolved.
+	RegisterHostnames bool
+}
+
+// HostnameResolver resolves the hostnames of load balancers in background,
+// so that the event handlers are never blocked by DNS queries, and resolves
+// them again whenever their records expire, triggering a reconciliation of
+// the objects that use them whenever their IPs change.
+type HostnameResolver struct {
+	client *dns.Client
+	HostnameResolverOptions
+	log zerolog.Logger
+
+	lock        sync.Mutex
+	hostnames   map[string]*resolvedHostname
+	subscribers map[string]chan event.GenericEvent
+	trigger     chan struct{}
+}
+
+type resolvedHostname struct {
+	ips            []string
+	resolved       bool
+	failures       int
+	nextResolution time.Time
+	owners         map[resolverOwner]bool
+}
+
+// resolverOwner is an object that uses a hostname.
+type resolverOwner struct {
+	kind string
+	name types.NamespacedName
+}
+
+// NewHostnameResolver returns a new HostnameResolver, which must be added to
+// the manager in order to start resolving hostnames.
+func NewHostnameResolver(opts HostnameResolverOptions, log zerolog.Logger) *HostnameResolver {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultResolutionInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultResolutionTimeout
+	}
+
+	return &HostnameResolver{
+		client:                  &dns.Client{},
+		HostnameResolverOptions: opts,
+		log:                     log,
+		hostnames:               map[string]*resolvedHostname{},
+		subscribers:             map[string]chan event.GenericEvent{},
+		trigger:                 make(chan struct{}, 1),
+	}
+}
+
+// Start resolves hostnames until the context is canceled.
+func (h *HostnameResolver) Start(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-h.trigger:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
+		}
+
+		timer.Reset(time.Until(h.resolveDue(ctx)))
+	}
+}
+
+// subscribe returns a channel where events for the objects of the provided
+// kind are sent whenever the IPs of their hostnames change.
+func (h *HostnameResolver) subscribe(kind string) <-chan event.GenericEvent {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, exists := h.subscribers[kind]; !exists {
+		h.subscribers[kind] = make(chan event.GenericEvent, 100)
+	}
+
+	return h.subscribers[kind]
+}
+
+// lookup returns the IPs of the hostname used by the provided owner. If the
+// hostname has not been resolved yet, false is returned and its resolution
+// is scheduled: the owner will be notified when it is done.
+func (h *HostnameResolver) lookup(owner resolverOwner, hostname string) ([]string, bool) {
+	if h == nil {
+		return nil, false
+	}
+
+	if h.RegisterHostnames {
+		return []string{hostname}, true
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	entry, exists := h.hostnames[hostname]
+	if !exists {
+		entry = &resolvedHostname{owners: map[resolverOwner]bool{}}
+		h.hostnames[hostname] = entry
+
+		select {
+		case h.trigger <- struct{}{}:
+		default:
+		}
+	}
+
+	entry.owners[owner] = true
+	return entry.ips, entry.resolved
+}
+
+// lookupFunc returns a function that looks up hostnames for the provided
+// owner.
+func (h *HostnameResolver) lookupFunc(kind string, name types.NamespacedName) func(string) ([]string, bool) {
+	owner := resolverOwner{kind: kind, name: name}
+	return func(hostname string) ([]string, bool) {
+		return h.lookup(owner, hostname)
+	}
+}
+
+// release removes the owner from all hostnames, so that it is not notified
+// anymore. It is called before computing the state of the owner, which looks
+// up again the hostnames it still uses.
+func (h *HostnameResolver) release(kind string, name types.NamespacedName) {
+	if h == nil {
+		return
+	}
+
+	owner := resolverOwner{kind: kind, name: name}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, entry := range h.hostnames {
+		delete(entry.owners, owner)
+	}
+}
+
+// resolveDue resolves all hostnames whose resolution is due, notifies the
+// owners of the ones whose IPs changed and returns when the next resolution
+// is due.
+func (h *HostnameResolver) resolveDue(ctx context.Context) time.Time {
+	now := time.Now()
+	due := []string{}
+
+	h.lock.Lock()
+	for hostname, entry := range h.hostnames {
+		if len(entry.owners) == 0 {
+			delete(h.hostnames, hostname)
+			continue
+		}
+
+		if !entry.nextResolution.After(now) {
+			due = append(due, hostname)
+		}
+	}
+	h.lock.Unlock()
+
+	type result struct {
+		ips []string
+		ttl time.Duration
+		err error
+	}
+	results := make([]result, len(due))
+	var wg sync.WaitGroup
+	for i, hostname := range due {
+		wg.Add(1)
+		go func(i int, hostname string) {
+			defer wg.Done()
+
+			lookupCtx, canc := context.WithTimeout(ctx, h.Timeout)
+			defer canc()
+			ips, ttl, err := h.resolve(lookupCtx, hostname)
+			results[i] = result{ips: ips, ttl: ttl, err: err}
+		}(i, hostname)
+	}
+	wg.Wait()
+
+	changed := map[resolverOwner]bool{}
+	h.lock.Lock()
+	for i, hostname := range due {
+		entry, exists := h.hostnames[hostname]
+		if !exists {
+			continue
+		}
+
+		if err := results[i].err; err != nil {
+			// IPs resolved previously are kept, so that a temporary
+			// failure does not remove the endpoints.
+			dnsResolutionFailuresTotal.Inc()
+			entry.failures++
+			retry := resolutionRetryBaseDelay << (entry.failures - 1)
+			if retry <= 0 || retry > h.Interval {
+				retry = h.Interval
+			}
+			entry.nextResolution = time.Now().Add(retry)
+			h.log.Err(err).Str("hostname", hostname).Int("failures", entry.failures).
+				Msg("cannot resolve hostname")
+			continue
+		}
+
+		if !entry.resolved || !sameElements(entry.ips, results[i].ips) {
+			for owner := range entry.owners {
+				changed[owner] = true
+			}
+		}
+
+		entry.ips, entry.resolved, entry.failures = results[i].ips, true, 0
+		entry.nextResolution = time.Now().Add(h.getResolutionInterval(results[i].ttl))
+	}
+
+	next := time.Now().Add(h.Interval)
+	for _, entry := range h.hostnames {
+		if entry.nextResolution.Before(next) {
+			next = entry.nextResolution
+		}
+	}
+
+	notifications := map[resolverOwner]chan event.GenericEvent{}
+	for owner := range changed {
+		if ch, exists := h.subscribers[owner.kind]; exists {
+			notifications[owner] = ch
+		}
+	}
+	h.lock.Unlock()
+
+	for owner, ch := range notifications {
+		select {
+		case ch <- event.GenericEvent{Object: &metav1.PartialObjectMetadata{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: owner.name.Namespace,
+				Name:      owner.name.Name,
+			},
+		}}:
+		case <-ctx.Done():
+			return next
+		}
+	}
+
+	return next
+}
+
+// getResolutionInterval returns after how long a hostname whose records
+// have the provided TTL must be resolved again.
+func (h *HostnameResolver) getResolutionInterval(ttl time.Duration) time.Duration {
+	switch {
+	case ttl > h.Interval:
+		return h.Interval
+	case ttl < minResolutionInterval:
+		return minResolutionInterval
+	default:
+		return ttl
+	}
+}
+
+// getClientConfig returns the nameservers to query and how to expand
+// hostnames: either the nameserver in the options or the ones of the system,
+// which are read every time so that changes are picked up.
+func (h *HostnameResolver) getClientConfig() (*dns.ClientConfig, error) {
+	if h.Nameserver == "" {
+		return dns.ClientConfigFromFile(resolvConfPath)
+	}
+
+	host, port, err := net.SplitHostPort(h.Nameserver)
+	if err != nil {
+		host, port = h.Nameserver, "53"
+	}
+
+	return &dns.ClientConfig{Servers: []string{host}, Port: port, Ndots: 1}, nil
+}
+
+// resolve returns the sorted IPv4 and IPv6 addresses of the hostname along
+// with the lowest TTL of the records that were found, including the CNAME
+// records leading to them.
+func (h *HostnameResolver) resolve(ctx context.Context, hostname string) ([]string, time.Duration, error) {
+	config, err := h.getClientConfig()
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot get nameservers: %w", err)
+	}
+
+	for _, name := range config.NameList(hostname) {
+		ips, ttl, err := h.resolveName(ctx, config, name)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if len(ips) > 0 {
+			sort.Strings(ips)
+			return ips, ttl, nil
+		}
+	}
+
+	return nil, 0, fmt.Errorf("no such host: %s", hostname)
+}
+
+// resolveName returns the IPv4 and IPv6 addresses of the fully qualified
+// name, if it exists, and the lowest TTL of their records.
+func (h *HostnameResolver) resolveName(ctx context.Context, config *dns.ClientConfig, name string) ([]string, time.Duration, error) {
+	var (
+		ips    = []string{}
+		minTTL uint32
+		found  bool
+	)
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		resp, err := h.exchange(ctx, config, name, qtype)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, rr := range resp.Answer {
+			switch record := rr.(type) {
+			case *dns.A:
+				ips = append(ips, record.A.String())
+			case *dns.AAAA:
+				ips = append(ips, record.AAAA.String())
+			case *dns.CNAME:
+				// The IPs may change as soon as the alias does.
+			default:
+				continue
+			}
+
+			if ttl := rr.Header().Ttl; !found || ttl < minTTL {
+				minTTL, found = ttl, true
+			}
+		}
+	}
+
+	return ips, time.Duration(minTTL) * time.Second, nil
+}
+
+// exchange queries the nameservers in turn until one of them answers, and
+// returns its response unless it is an error other than a non-existent
+// name.
+func (h *HostnameResolver) exchange(ctx context.Context, config *dns.ClientConfig, name string, qtype uint16) (*dns.Msg, error) {
+	msg := &dns.Msg{}
+	msg.SetQuestion(name, qtype)
+
+	var err error
+	for _, server := range config.Servers {
+		address := net.JoinHostPort(server, config.Port)
+
+		var resp *dns.Msg
+		resp, _, err = h.client.ExchangeContext(ctx, msg, address)
+		if err == nil && resp.Truncated {
+			tcpClient := &dns.Client{Net: "tcp"}
+			resp, _, err = tcpClient.ExchangeContext(ctx, msg, address)
+		}
+		if err != nil {
+			continue
+		}
+
+		switch resp.Rcode {
+		case dns.RcodeSuccess, dns.RcodeNameError:
+			return resp, nil
+		default:
+			err = fmt.Errorf("%s answered %s", address, dns.RcodeToString[resp.Rcode])
+		}
+	}
+
+	if err == nil {
+		err = fmt.Errorf("no nameservers to query")
+	}
+
+	return nil, err
+}
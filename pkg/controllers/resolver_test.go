@@ -0,0 +1,282 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeNameserver is an in-process recursive nameserver, which follows CNAME
+// records among the ones it contains.
+type fakeNameserver struct {
+	lock    sync.Mutex
+	records []dns.RR
+}
+
+func (f *fakeNameserver) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	resp := &dns.Msg{}
+	resp.SetReply(r)
+	resp.Rcode = dns.RcodeNameError
+
+	name, qtype := r.Question[0].Name, r.Question[0].Qtype
+	for name != "" {
+		target := ""
+		for _, rr := range f.records {
+			if !strings.EqualFold(rr.Header().Name, name) {
+				continue
+			}
+
+			resp.Rcode = dns.RcodeSuccess
+			switch rr.Header().Rrtype {
+			case dns.TypeCNAME:
+				resp.Answer = append(resp.Answer, rr)
+				target = rr.(*dns.CNAME).Target
+			case qtype:
+				resp.Answer = append(resp.Answer, rr)
+			}
+		}
+		name = target
+	}
+
+	w.WriteMsg(resp)
+}
+
+func (f *fakeNameserver) setRecords(records ...string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.records = []dns.RR{}
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			panic(err)
+		}
+		f.records = append(f.records, rr)
+	}
+}
+
+// startFakeNameserver starts a fake nameserver with the provided records and
+// returns its address.
+func startFakeNameserver(t *testing.T, records ...string) (*fakeNameserver, string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeNameserver{}
+	fake.setRecords(records...)
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        conn,
+		Handler:           fake,
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	<-started
+
+	return fake, conn.LocalAddr().String()
+}
+
+func TestHostnameResolver(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	owner := resolverOwner{kind: serviceOwnerKind, name: types.NamespacedName{Namespace: "ns", Name: "serv"}}
+
+	var nilResolver *HostnameResolver
+	_, resolved := nilResolver.lookup(owner, "lb.example.com")
+	a.False(resolved)
+
+	r := NewHostnameResolver(HostnameResolverOptions{}, zerolog.Nop())
+	a.Equal(defaultResolutionInterval, r.Interval)
+	a.Equal(defaultResolutionTimeout, r.Timeout)
+
+	fake, nameserver := startFakeNameserver(t,
+		"lb.example.com. 30 IN A 10.10.10.10",
+		"lb.example.com. 300 IN AAAA 2001:db8::1")
+	r = NewHostnameResolver(HostnameResolverOptions{Nameserver: nameserver}, zerolog.Nop())
+	events := r.subscribe(serviceOwnerKind)
+
+	_, resolved = r.lookup(owner, "lb.example.com")
+	a.False(resolved)
+
+	// The owner is notified once the hostname is resolved, which is
+	// resolved again as soon as the first of its records expires.
+	next := r.resolveDue(ctx)
+	a.WithinDuration(time.Now().Add(30*time.Second), next, time.Second)
+	select {
+	case ev := <-events:
+		a.Equal(owner.name.Namespace, ev.Object.GetNamespace())
+		a.Equal(owner.name.Name, ev.Object.GetName())
+	default:
+		a.Fail("owner was not notified")
+	}
+
+	ips, resolved := r.lookup(owner, "lb.example.com")
+	a.True(resolved)
+	a.Equal([]string{"10.10.10.10", "2001:db8::1"}, ips)
+
+	// The owner is not notified if the IPs do not change.
+	r.hostnames["lb.example.com"].nextResolution = time.Time{}
+	r.resolveDue(ctx)
+	a.Empty(events)
+
+	// Records with a TTL longer than the interval are resolved again after
+	// the interval, and the TTL of aliases counts as well.
+	fake.setRecords(
+		"lb.example.com. 10 IN CNAME lb-1.example.net.",
+		"lb-1.example.net. 3600 IN A 10.10.10.11")
+	r.hostnames["lb.example.com"].nextResolution = time.Time{}
+	next = r.resolveDue(ctx)
+	a.WithinDuration(time.Now().Add(10*time.Second), next, time.Second)
+	a.Len(events, 1)
+	<-events
+	ips, _ = r.lookup(owner, "lb.example.com")
+	a.Equal([]string{"10.10.10.11"}, ips)
+
+	fake.setRecords("lb.example.com. 3600 IN A 10.10.10.11")
+	r.hostnames["lb.example.com"].nextResolution = time.Time{}
+	next = r.resolveDue(ctx)
+	a.WithinDuration(time.Now().Add(r.Interval), next, time.Second)
+	a.Empty(events)
+	a.Equal(minResolutionInterval, r.getResolutionInterval(0))
+
+	// Hostnames without owners are removed.
+	r.release(owner.kind, owner.name)
+	r.resolveDue(ctx)
+	a.Empty(r.hostnames)
+}
+
+func TestGetClientConfig(t *testing.T) {
+	a := assert.New(t)
+
+	r := NewHostnameResolver(HostnameResolverOptions{Nameserver: "10.0.0.10"}, zerolog.Nop())
+	config, err := r.getClientConfig()
+	if a.NoError(err) {
+		a.Equal([]string{"10.0.0.10"}, config.Servers)
+		a.Equal("53", config.Port)
+		a.Equal([]string{"lb.example.com."}, config.NameList("lb.example.com"))
+	}
+
+	// The nameservers and search domains of the system are used otherwise.
+	prevPath := resolvConfPath
+	defer func() { resolvConfPath = prevPath }()
+	resolvConfPath = filepath.Join(t.TempDir(), "resolv.conf")
+	a.NoError(os.WriteFile(resolvConfPath,
+		[]byte("nameserver 10.96.0.10\nsearch svc.cluster.local\noptions ndots:5\n"), 0644))
+
+	r = NewHostnameResolver(HostnameResolverOptions{}, zerolog.Nop())
+	config, err = r.getClientConfig()
+	if a.NoError(err) {
+		a.Equal([]string{"10.96.0.10"}, config.Servers)
+		a.Equal([]string{"lb.svc.cluster.local.", "lb."}, config.NameList("lb"))
+	}
+}
+
+func TestHostnameResolverFailures(t *testing.T) {
+	a := assert.New(t)
+	owner := resolverOwner{kind: serviceOwnerKind, name: types.NamespacedName{Namespace: "ns", Name: "serv"}}
+
+	// Nothing is listening on this port, so that all resolutions fail.
+	r := NewHostnameResolver(HostnameResolverOptions{
+		Nameserver: "127.0.0.1:1",
+		Timeout:    time.Second,
+	}, zerolog.Nop())
+	r.lookup(owner, "lb.example.com")
+
+	next := r.resolveDue(context.Background())
+	entry := r.hostnames["lb.example.com"]
+	a.False(entry.resolved)
+	a.Equal(1, entry.failures)
+	a.WithinDuration(time.Now().Add(resolutionRetryBaseDelay), next, time.Second)
+
+	// IPs that were resolved previously are kept, including when the
+	// hostname does not exist anymore.
+	_, nameserver := startFakeNameserver(t, "other.example.com. 30 IN A 10.10.10.11")
+	r.Nameserver = nameserver
+	entry.ips, entry.resolved, entry.nextResolution = []string{"10.10.10.10"}, true, time.Time{}
+	r.resolveDue(context.Background())
+	ips, resolved := r.lookup(owner, "lb.example.com")
+	a.True(resolved)
+	a.Equal([]string{"10.10.10.10"}, ips)
+	a.Equal(2, entry.failures)
+}
+
+func TestGetServiceStateWithHostname(t *testing.T) {
+	a := assert.New(t)
+	name := types.NamespacedName{Namespace: "ns", Name: "serv"}
+	cli := fake.NewClientBuilder().WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   name.Namespace,
+			Labels: map[string]string{watchLabel: watchEnabledLabel},
+		}},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name.Name,
+				Namespace:   name.Namespace,
+				Annotations: map[string]string{"version": "v1"},
+			},
+			Spec: corev1.ServiceSpec{
+				Type:  corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{{Port: 80}},
+			},
+			Status: corev1.ServiceStatus{
+				LoadBalancer: corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{{Hostname: "lb.example.com"}},
+				},
+			},
+		}).Build()
+
+	_, nameserver := startFakeNameserver(t, "lb.example.com. 30 IN A 10.10.10.10")
+	opts := &ControllerOptions{
+		ServiceAnnotations: []string{"version"},
+		Resolver:           NewHostnameResolver(HostnameResolverOptions{Nameserver: nameserver}, zerolog.Nop()),
+	}
+	_, err := getServiceState(context.Background(), cli, name, opts)
+	a.ErrorIs(err, errResolutionPending)
+
+	opts.Resolver.resolveDue(context.Background())
+	state, err := getServiceState(context.Background(), cli, name, opts)
+	if a.NoError(err) && a.Len(state.Endpoints, 1) {
+		a.Equal("10.10.10.10", state.Endpoints[0].Address)
+	}
+
+	opts.Resolver = NewHostnameResolver(HostnameResolverOptions{RegisterHostnames: true}, zerolog.Nop())
+	state, err = getServiceState(context.Background(), cli, name, opts)
+	if a.NoError(err) && a.Len(state.Endpoints, 1) {
+		a.Equal("lb.example.com", state.Endpoints[0].Address)
+	}
+}
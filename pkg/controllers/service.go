@@ -19,18 +19,17 @@ package controllers
 
 import (
 	"context"
-	"time"
+	"errors"
 
-	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
-	serego "github.com/CloudNativeSDWAN/serego/api/core/types"
 	"github.com/rs/zerolog"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/types"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
-	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -40,7 +39,7 @@ const (
 	servCtrlName string = "service-event-handler"
 )
 
-type serviceEventHandler struct {
+type serviceReconciler struct {
 	client client.Client
 	log    zerolog.Logger
 	*ControllerOptions
@@ -54,285 +53,80 @@ func NewServiceController(mgr manager.Manager, opts *ControllerOptions, log zero
 		return nil, ErrorInvalidControllerOptions
 	}
 
-	servHandler := &serviceEventHandler{
+	servReconciler := &serviceReconciler{
 		client:            mgr.GetClient(),
 		log:               log,
 		ControllerOptions: opts,
 	}
 	c, err := controller.New(servCtrlName, mgr, controller.Options{
-		Reconciler: reconcile.Func(func(c context.Context, r reconcile.Request) (reconcile.Result, error) {
-			return reconcile.Result{}, nil
-		}),
+		Reconciler:  servReconciler,
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(requeueBaseDelay, requeueMaxDelay),
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = c.Watch(&source.Kind{Type: &corev1.Service{}}, servHandler)
+	err = c.Watch(&source.Kind{Type: &corev1.Service{}}, &handler.EnqueueRequestForObject{})
 	if err != nil {
 		return nil, err
 	}
 
-	return c, nil
-}
-
-// Create handles create events.
-func (s *serviceEventHandler) Create(ce event.CreateEvent, wq workqueue.RateLimitingInterface) {
-	l := s.log.With().Str("name", "create-event-handler").Logger()
-	defer wq.Done(ce.Object)
-
-	service, ok := ce.Object.(*corev1.Service)
-	if !ok {
-		return
-	}
-
-	l = l.With().Str("name", types.NamespacedName{
-		Namespace: service.Namespace,
-		Name:      service.Name,
-	}.String()).Logger()
-
-	watchNs, err := s.checkParentNamespace(service)
-	if !watchNs {
+	if opts.Resolver != nil {
+		// Objects are reconciled again when the IPs of their hostnames
+		// change.
+		err = c.Watch(&source.Channel{Source: opts.Resolver.subscribe(serviceOwnerKind)}, &handler.EnqueueRequestForObject{})
 		if err != nil {
-			l.Err(err).Msg("cannot check parent namespace")
-		}
-		return
-	}
-
-	checkedService := checkService(service, s.ServiceAnnotations)
-	if !checkedService.passed {
-		if checkedService.err != nil {
-			l.Err(checkedService.err).
-				Msg("cannot check service")
+			return nil, err
 		}
-		return
 	}
 
-	// Send an event to create the namespace. NOTE: we do this because we have
-	// no idea whether the namespace controller sent this before us. Se we
-	// disabled the namespace controller from sending Create events, and we let
-	// the service controller do that.
-	s.EventsChan <- &serviceregistry.Event{
-		EventType: serviceregistry.EventCreate,
-		Object: &serego.Namespace{
-			Name: service.Namespace,
-		},
-	}
-
-	s.EventsChan <- &serviceregistry.Event{
-		EventType: serviceregistry.EventCreate,
-		Object: &serego.Service{
-			Name:      service.Name,
-			Namespace: service.Namespace,
-		},
-	}
-
-	for _, ep := range checkedService.endpoints {
-		s.EventsChan <- &serviceregistry.Event{
-			EventType: serviceregistry.EventCreate,
-			Object:    ep,
-		}
-	}
-}
-
-// Update handles update events.
-func (s *serviceEventHandler) Update(ue event.UpdateEvent, wq workqueue.RateLimitingInterface) {
-	l := s.log.With().Str("name", "update-event-handler").Logger()
-	defer wq.Done(ue.ObjectNew)
-	curr, currok := ue.ObjectNew.(*corev1.Service)
-	old, oldok := ue.ObjectOld.(*corev1.Service)
-	if !currok || !oldok {
-
-		return
-	}
-
-	if curr.DeletionTimestamp != nil {
-		if old.DeletionTimestamp != nil {
-			return
-		}
-
-		s.handleDelete(curr)
-		return
-	}
-
-	defer wq.Done(ue.ObjectNew)
-
-	l = l.With().Str("name", types.NamespacedName{
-		Namespace: curr.Namespace,
-		Name:      curr.Name,
-	}.String()).Logger()
-
-	watchNs, err := s.checkParentNamespace(curr)
-	if !watchNs {
-		if err != nil {
-			l.Err(err).Msg("cannot check parent namespace")
-		}
-
-		return
-	}
-
-	currChecked := checkService(curr, s.ServiceAnnotations)
-	oldChecked := checkService(old, s.ServiceAnnotations)
-	if currChecked.err != nil || oldChecked.err != nil {
-		checkErr := currChecked.err
+	if opts.EndpointSlices {
+		// Changes to the endpoint slices are reconciled as changes to the
+		// service they belong to.
+		err = c.Watch(&source.Kind{Type: &discoveryv1.EndpointSlice{}},
+			handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+				serviceName := obj.GetLabels()[discoveryv1.LabelServiceName]
+				if serviceName == "" {
+					return nil
+				}
+
+				return []reconcile.Request{{NamespacedName: types.NamespacedName{
+					Namespace: obj.GetNamespace(),
+					Name:      serviceName,
+				}}}
+			}))
 		if err != nil {
-			checkErr = oldChecked.err
+			return nil, err
 		}
-		l.Err(checkErr).Msg("error occurred while getting ips from service")
 	}
 
-	// Easiest cases
-	switch {
-	case !oldChecked.passed && !currChecked.passed:
-		return
-	case oldChecked.passed && !currChecked.passed:
-		l.Info().Str("reason", currChecked.reason).Msg("sending delete...")
-
-		for _, ep := range oldChecked.endpoints {
-			s.EventsChan <- &serviceregistry.Event{
-				EventType: serviceregistry.EventDelete,
-				Object:    ep,
-			}
-		}
-
-		s.EventsChan <- &serviceregistry.Event{
-			EventType: serviceregistry.EventDelete,
-			Object: &serego.Service{
-				Name:      old.Name,
-				Namespace: old.Namespace,
-			},
-		}
-
-		return
-	case !oldChecked.passed && currChecked.passed:
-		l.Info().Msg("sending create...")
-
-		s.EventsChan <- &serviceregistry.Event{
-			EventType: serviceregistry.EventCreate,
-			Object: &serego.Namespace{
-				Name: curr.Namespace,
-			},
-		}
-
-		s.EventsChan <- &serviceregistry.Event{
-			EventType: serviceregistry.EventCreate,
-			Object: &serego.Service{
-				Name:      curr.Name,
-				Namespace: curr.Namespace,
-			},
-		}
-
-		for _, ep := range currChecked.endpoints {
-			s.EventsChan <- &serviceregistry.Event{
-				EventType: serviceregistry.EventCreate,
-				Object:    ep,
-			}
-		}
-
-		return
-	}
-
-	// Make sure the namespace and service are created.
-	s.EventsChan <- &serviceregistry.Event{
-		EventType: serviceregistry.EventCreate,
-		Object: &serego.Namespace{
-			Name: curr.Namespace,
-		},
-	}
-	s.EventsChan <- &serviceregistry.Event{
-		EventType: serviceregistry.EventCreate,
-		Object: &serego.Service{
-			Namespace: curr.Namespace,
-			Name:      curr.Name,
-		},
-	}
-
-	// Check what is changed
-	oldEndpoints := getEndpointsMapFromSlice(oldChecked.endpoints)
-	currEndpoints := getEndpointsMapFromSlice(currChecked.endpoints)
-
-	// Check what must be removed, updated or created
-	for _, ep := range oldEndpoints {
-		currEp := currEndpoints[ep.Name]
-
-		if currEp == nil {
-			s.EventsChan <- &serviceregistry.Event{
-				EventType: serviceregistry.EventDelete,
-				Object:    ep,
-			}
-		} else {
-			s.EventsChan <- &serviceregistry.Event{
-				EventType: serviceregistry.EventUpdate,
-				Object:    currEp,
-			}
-		}
-	}
-
-	for _, ep := range currEndpoints {
-		if _, exists := currEndpoints[ep.Name]; !exists {
-			s.EventsChan <- &serviceregistry.Event{
-				EventType: serviceregistry.EventCreate,
-				Object:    ep,
-			}
-		}
-	}
-}
-
-// Delete handles delete events.
-func (s *serviceEventHandler) Delete(de event.DeleteEvent, wq workqueue.RateLimitingInterface) {
-	wq.Done(de.Object)
+	return c, nil
 }
 
-func (s *serviceEventHandler) handleDelete(service *corev1.Service) {
-	l := s.log.With().Str("name", types.NamespacedName{
-		Namespace: service.Namespace,
-		Name:      service.Name,
-	}.String()).Logger()
-
-	watchNs, err := s.checkParentNamespace(service)
-	if !watchNs {
-		if err != nil {
-			l.Err(err).Msg("cannot check parent namespace")
-		}
-
-		return
-	}
-
-	checkedService := checkService(service, s.ServiceAnnotations)
+// Reconcile brings the service on the service registry to the state
+// described by the Kubernetes service with the same namespace and name.
+//
+// Errors are returned to the controller, so that the request is requeued
+// with an exponential backoff.
+func (s *serviceReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	l := s.log.With().Str("name", req.NamespacedName.String()).Logger()
 
-	for _, ep := range checkedService.endpoints {
-		s.EventsChan <- &serviceregistry.Event{
-			EventType: serviceregistry.EventDelete,
-			Object:    ep,
-		}
+	state, err := getServiceState(ctx, s.client, req.NamespacedName, s.ControllerOptions)
+	if errors.Is(err, errResolutionPending) {
+		// The resolver triggers a new reconciliation once it is done.
+		l.Debug().Msg("waiting for hostnames to be resolved")
+		return reconcile.Result{}, nil
 	}
-
-	s.EventsChan <- &serviceregistry.Event{
-		EventType: serviceregistry.EventDelete,
-		Object: &serego.Service{
-			Name:      service.Name,
-			Namespace: service.Namespace,
-		},
+	if err != nil {
+		l.Err(err).Msg("cannot get desired state of service: requeueing...")
+		return reconcile.Result{}, err
 	}
-}
-
-func (s *serviceEventHandler) checkParentNamespace(service *corev1.Service) (bool, error) {
-	ctx, canc := context.WithTimeout(context.Background(), 10*time.Second)
-	defer canc()
 
-	var namespace corev1.Namespace
-	if err := s.client.
-		Get(ctx, types.NamespacedName{Name: service.Namespace}, &namespace); err != nil {
-		return false, err
+	if err := syncServiceState(ctx, s.EventsChan, state); err != nil {
+		l.Err(err).Msg("cannot sync service with the service registry: requeueing...")
+		return reconcile.Result{}, err
 	}
 
-	return checkNsLabels(namespace.Labels, s.WatchNamespacesByDefault), nil
-}
-
-// Generic handles generic events.
-func (s *serviceEventHandler) Generic(ge event.GenericEvent, wq workqueue.RateLimitingInterface) {
-	// We don't really know what to do with generic events.
-	// We will just ignore this.
-	wq.Done(ge.Object)
+	return reconcile.Result{}, nil
 }
@@ -0,0 +1,226 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/internal/types"
+	"github.com/CloudNativeSDWAN/cnwan-operator/internal/utils"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	settingsCtrlName string = "settings-event-handler"
+
+	reasonInvalidSettings string = "InvalidSettings"
+	reasonSettingsApplied string = "SettingsApplied"
+	reasonRestartRequired string = "RestartRequired"
+)
+
+type settingsReconciler struct {
+	// reader reads config maps from a cache restricted to the namespace of
+	// the settings, while client is used for all other objects.
+	reader   client.Reader
+	client   client.Client
+	recorder record.EventRecorder
+	log      zerolog.Logger
+	// settings are the ones the operator was started with: changes to them,
+	// except for the ones in ControllerOptions, require a restart.
+	settings *types.Settings
+	// resyncPending is set when the settings changed but services could not
+	// be synced yet: the sync is retried even if settings did not change
+	// again in the meantime.
+	resyncPending bool
+	*ControllerOptions
+}
+
+// NewSettingsController returns a controller that watches the config map
+// with the settings of the operator and applies the changes that can be
+// applied without a restart, i.e. the namespaces and annotations to watch.
+//
+// When these change, all services are synced with the service registry
+// again. Invalid settings are rejected and reported with an event on the
+// config map, while the current ones are kept.
+func NewSettingsController(mgr manager.Manager, opts *ControllerOptions, settings *types.Settings, configMap ktypes.NamespacedName, log zerolog.Logger) (controller.Controller, error) {
+	if mgr == nil {
+		return nil, ErrorInvalidManager
+	}
+	if opts == nil {
+		return nil, ErrorInvalidControllerOptions
+	}
+
+	// Only config maps in the namespace of the operator are watched, so that
+	// no permissions on other namespaces are needed.
+	cmCache, err := cache.New(mgr.GetConfig(), cache.Options{
+		Scheme:    mgr.GetScheme(),
+		Mapper:    mgr.GetRESTMapper(),
+		Namespace: configMap.Namespace,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create cache for config maps: %w", err)
+	}
+
+	if err := mgr.Add(cmCache); err != nil {
+		return nil, fmt.Errorf("cannot add cache for config maps: %w", err)
+	}
+
+	settingsReconciler := &settingsReconciler{
+		reader:            cmCache,
+		client:            mgr.GetClient(),
+		recorder:          mgr.GetEventRecorderFor("cnwan-operator"),
+		log:               log,
+		settings:          settings,
+		ControllerOptions: opts,
+	}
+	c, err := controller.New(settingsCtrlName, mgr, controller.Options{
+		Reconciler:  settingsReconciler,
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(requeueBaseDelay, requeueMaxDelay),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Watch(source.NewKindWithCache(&corev1.ConfigMap{}, cmCache),
+		&handler.EnqueueRequestForObject{},
+		predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetNamespace() == configMap.Namespace &&
+				obj.GetName() == configMap.Name
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reconcile applies the settings contained in the config map.
+func (s *settingsReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	l := s.log.With().Str("config-map", req.NamespacedName.String()).Logger()
+
+	var cm corev1.ConfigMap
+	if err := s.reader.Get(ctx, req.NamespacedName, &cm); err != nil {
+		if k8serrors.IsNotFound(err) {
+			l.Warn().Msg("settings config map not found: keeping current settings")
+			return reconcile.Result{}, nil
+		}
+
+		return reconcile.Result{}, err
+	}
+
+	settings, err := parseSettingsConfigMap(&cm)
+	if err != nil {
+		l.Err(err).Msg("invalid settings provided: keeping current settings")
+		s.recorder.Event(&cm, corev1.EventTypeWarning, reasonInvalidSettings,
+			fmt.Sprintf("settings were rejected and will not be applied: %s", err))
+		return reconcile.Result{}, nil
+	}
+
+	return reconcile.Result{}, s.apply(ctx, &cm, settings, l)
+}
+
+// apply applies the settings that can be changed without a restart and
+// records events about the outcome on the object that contains them.
+func (s *settingsReconciler) apply(ctx context.Context, obj client.Object, settings *types.Settings, l zerolog.Logger) error {
+	if requiresRestart(s.settings, settings) {
+		l.Warn().Msg("some of the new settings will only be applied after a restart")
+		s.recorder.Event(obj, corev1.EventTypeWarning, reasonRestartRequired,
+			"only watchNamespacesByDefault and the settings about annotations and labels are applied without restarting the operator")
+	}
+
+	changed, err := s.UpdateWatchSettings(settings.WatchNamespacesByDefault, settings.Service)
+	if err != nil {
+		return err
+	}
+	if !changed && !s.resyncPending {
+		return nil
+	}
+
+	if !changed {
+		l.Info().Msg("previous sync failed: syncing all services again...")
+		return s.syncServices(ctx, l)
+	}
+
+	l.Info().Bool("watch-namespaces-by-default", settings.WatchNamespacesByDefault).
+		Strs("service-annotations", settings.Service.Annotations).
+		Int("annotation-rules", len(settings.Service.AnnotationRules)).
+		Strs("namespace-annotations", settings.Service.NamespaceAnnotations).
+		Strs("service-labels", settings.Service.Labels).
+		Msg("settings changed: syncing all services...")
+	s.recorder.Event(obj, corev1.EventTypeNormal, reasonSettingsApplied,
+		"new settings applied: syncing all services with the service registry")
+
+	s.resyncPending = true
+	return s.syncServices(ctx, l)
+}
+
+// syncServices syncs all services and clears the pending resync only if it
+// succeeded.
+func (s *settingsReconciler) syncServices(ctx context.Context, l zerolog.Logger) error {
+	if err := syncServices(ctx, s.client, s.ControllerOptions, l); err != nil {
+		return err
+	}
+
+	s.resyncPending = false
+	return nil
+}
+
+func parseSettingsConfigMap(cm *corev1.ConfigMap) (*types.Settings, error) {
+	if len(cm.Data) != 1 {
+		return nil, fmt.Errorf("config map must have exactly one key, found %d", len(cm.Data))
+	}
+
+	var settings *types.Settings
+	for _, data := range cm.Data {
+		if err := yaml.Unmarshal([]byte(data), &settings); err != nil {
+			return nil, fmt.Errorf("cannot unmarshal settings: %w", err)
+		}
+	}
+
+	return utils.ParseAndValidateSettings(settings)
+}
+
+// requiresRestart returns true if the new settings differ from the current
+// ones for fields that cannot be changed while the operator is running.
+func requiresRestart(curr, next *types.Settings) bool {
+	if curr == nil {
+		return false
+	}
+
+	currCopy, nextCopy := *curr, *next
+	currCopy.WatchNamespacesByDefault, nextCopy.WatchNamespacesByDefault = false, false
+	currCopy.Service, nextCopy.Service = types.ServiceSettings{}, types.ServiceSettings{}
+
+	return !reflect.DeepEqual(currCopy, nextCopy)
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestSettingsReconcile(t *testing.T) {
+	a := assert.New(t)
+	cmName := ktypes.NamespacedName{Namespace: "cnwan-operator-system", Name: "cnwan-operator-settings"}
+	newConfigMap := func(settings string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: cmName.Namespace, Name: cmName.Name},
+			Data:       map[string]string{"settings.yaml": settings},
+		}
+	}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "ns",
+		Labels: map[string]string{watchLabel: watchEnabledLabel},
+	}}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "serv",
+			Namespace:   "ns",
+			Annotations: map[string]string{"version": "v1"},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Port: 80}},
+		},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "10.10.10.10"}},
+			},
+		},
+	}
+
+	cases := []struct {
+		id             string
+		settings       string
+		expAnnotations []string
+		expEvents      []string
+		expSynced      int
+	}{
+		{
+			id:             "invalid",
+			settings:       "serviceAnnotations: [version]",
+			expAnnotations: []string{},
+			expEvents:      []string{"Warning " + reasonInvalidSettings},
+		},
+		{
+			id:             "unchanged",
+			settings:       "serviceAnnotations: []\nserviceRegistry:\n  etcd:\n    endpoints:\n    - host: etcd",
+			expAnnotations: []string{},
+		},
+		{
+			id:             "changed",
+			settings:       "serviceAnnotations: [version]\nserviceRegistry:\n  etcd:\n    endpoints:\n    - host: etcd",
+			expAnnotations: []string{"version"},
+			expEvents:      []string{"Normal " + reasonSettingsApplied},
+			expSynced:      1,
+		},
+		{
+			id:             "changed-rules",
+			settings:       "serviceAnnotations: []\nannotationRules:\n- key: version\n  rename: cnwan.io/version\nserviceRegistry:\n  etcd:\n    endpoints:\n    - host: etcd",
+			expAnnotations: []string{},
+			expEvents:      []string{"Normal " + reasonSettingsApplied},
+			expSynced:      1,
+		},
+		{
+			id:             "requires-restart",
+			settings:       "clusterID: other\nserviceAnnotations: []\nserviceRegistry:\n  etcd:\n    endpoints:\n    - host: etcd",
+			expAnnotations: []string{},
+			expEvents:      []string{"Warning " + reasonRestartRequired},
+		},
+	}
+
+	for _, currCase := range cases {
+		initial, err := parseSettingsConfigMap(newConfigMap("serviceAnnotations: []\nserviceRegistry:\n  etcd:\n    endpoints:\n    - host: etcd"))
+		if !a.NoError(err) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+
+		eventsChan := make(chan *serviceregistry.Event, 10)
+		recorder := record.NewFakeRecorder(10)
+		cli := fake.NewClientBuilder().WithObjects(newConfigMap(currCase.settings), namespace, service).Build()
+		r := &settingsReconciler{
+			reader:   cli,
+			client:   cli,
+			recorder: recorder,
+			log:      zerolog.Nop(),
+			settings: initial,
+			ControllerOptions: &ControllerOptions{
+				ServiceAnnotations: []string{},
+				EventsChan:         eventsChan,
+			},
+		}
+
+		synced := 0
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for ev := range eventsChan {
+				synced++
+				ev.Result <- nil
+			}
+		}()
+
+		_, err = r.Reconcile(context.Background(), reconcile.Request{NamespacedName: cmName})
+		close(eventsChan)
+		<-done
+		close(recorder.Events)
+
+		events := []string{}
+		for ev := range recorder.Events {
+			// Only keep the type and reason of the event.
+			events = append(events, strings.Join(strings.Fields(ev)[:2], " "))
+		}
+
+		if !a.NoError(err) ||
+			!a.Equal(currCase.expAnnotations, r.ServiceAnnotations) ||
+			!a.Equal(currCase.expSynced, synced) ||
+			!a.ElementsMatch(currCase.expEvents, events) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
+
+func TestSettingsReconcileFailedSync(t *testing.T) {
+	a := assert.New(t)
+	cmName := ktypes.NamespacedName{Namespace: "cnwan-operator-system", Name: "cnwan-operator-settings"}
+	initial, err := parseSettingsConfigMap(&corev1.ConfigMap{
+		Data: map[string]string{"settings.yaml": "serviceAnnotations: []\nserviceRegistry:\n  etcd:\n    endpoints:\n    - host: etcd"},
+	})
+	if !a.NoError(err) {
+		a.FailNow("cannot parse initial settings")
+	}
+
+	cli := fake.NewClientBuilder().WithObjects(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: cmName.Namespace, Name: cmName.Name},
+			Data:       map[string]string{"settings.yaml": "serviceAnnotations: [version]\nserviceRegistry:\n  etcd:\n    endpoints:\n    - host: etcd"},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "ns",
+			Labels: map[string]string{watchLabel: watchEnabledLabel},
+		}},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "serv",
+				Namespace:   "ns",
+				Annotations: map[string]string{"version": "v1"},
+			},
+			Spec: corev1.ServiceSpec{
+				Type:  corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{{Port: 80}},
+			},
+			Status: corev1.ServiceStatus{
+				LoadBalancer: corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{{IP: "10.10.10.10"}},
+				},
+			},
+		},
+	).Build()
+	eventsChan := make(chan *serviceregistry.Event, 10)
+	r := &settingsReconciler{
+		reader:   cli,
+		client:   cli,
+		recorder: record.NewFakeRecorder(10),
+		log:      zerolog.Nop(),
+		settings: initial,
+		ControllerOptions: &ControllerOptions{
+			ServiceAnnotations: []string{},
+			EventsChan:         eventsChan,
+		},
+	}
+
+	// The first sync fails: the following reconciliations must keep trying
+	// even though the settings are now unchanged, until one succeeds.
+	syncErrs := []error{fmt.Errorf("registry unavailable"), nil, nil}
+	expSynced := []int{1, 1, 0}
+	for i, syncErr := range syncErrs {
+		synced := 0
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for ev := range eventsChan {
+				synced++
+				ev.Result <- syncErr
+			}
+		}()
+
+		_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: cmName})
+		close(eventsChan)
+		<-done
+		eventsChan = make(chan *serviceregistry.Event, 10)
+		r.EventsChan = eventsChan
+
+		if !a.Equal(syncErr != nil, err != nil) || !a.Equal(expSynced[i], synced) {
+			a.FailNow(fmt.Sprintf("reconciliation %d failed", i))
+		}
+	}
+}
@@ -19,15 +19,43 @@
 package controllers
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
 	"strings"
-	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
 	serego "github.com/CloudNativeSDWAN/serego/api/core/types"
+	"github.com/rs/zerolog"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	portNameMetadataKey    string = "cnwan.io/port-name"
+	protocolMetadataKey    string = "cnwan.io/protocol"
+	appProtocolMetadataKey string = "cnwan.io/app-protocol"
+	ipFamilyMetadataKey    string = "cnwan.io/ip-family"
+
+	// maxEndpointNameLength is the maximum length of the names of the
+	// endpoints that is accepted by all service registries.
+	maxEndpointNameLength int = 63
+	// maxListMetadataLength is the maximum length of the values of metadata
+	// containing lists, e.g. the rules of an ingress, so that objects with
+	// long lists do not exceed the size of metadata allowed by service
+	// registries, e.g. 512 characters for all the metadata of an endpoint on
+	// Service Directory.
+	maxListMetadataLength int = 200
 )
 
 // filterAnnotations is used to remove annotations that should be ignored
@@ -72,7 +100,10 @@ func filterAnnotations(currentAnnotations map[string]string, filter []string) ma
 	return filtered
 }
 
-func getIPsFromService(service *corev1.Service, attempts int) ([]string, error) {
+// getIPsFromService returns the external IPs of the service and the ones of
+// its load balancer, looking up its hostnames with the provided function.
+// False is returned if some hostnames have not been resolved yet.
+func getIPsFromService(service *corev1.Service, lookup func(string) ([]string, bool)) ([]string, bool) {
 	ipsMap := map[string]bool{}
 	for _, externalIP := range service.Spec.ExternalIPs {
 		ipsMap[externalIP] = true
@@ -85,13 +116,9 @@ func getIPsFromService(service *corev1.Service, attempts int) ([]string, error)
 		}
 
 		if ing.Hostname != "" {
-			if attempts == 0 {
-				attempts = 1
-			}
-
-			resolvedIPs, err := tryResolveHostnames(ing.Hostname, attempts)
-			if err != nil {
-				return nil, err
+			resolvedIPs, resolved := lookup(ing.Hostname)
+			if !resolved {
+				return nil, false
 			}
 
 			for _, resolvedIP := range resolvedIPs {
@@ -104,22 +131,29 @@ func getIPsFromService(service *corev1.Service, attempts int) ([]string, error)
 	for ip := range ipsMap {
 		ips = append(ips, ip)
 	}
-	return ips, nil
+	sort.Strings(ips)
+	return ips, true
 }
 
-func tryResolveHostnames(hostname string, maxAttempts int) (resolvedIPs []string, err error) {
-	// TODO: get a context to do this so we know when
-	// we have to stop checking
-	for attempts := 0; attempts < maxAttempts; attempts++ {
-		resolvedIPs, err = net.LookupHost(hostname)
-		if err == nil {
-			return resolvedIPs, nil
-		}
+// sameElements returns true if the two slices contain the same elements,
+// regardless of their order.
+func sameElements(first, second []string) bool {
+	if len(first) != len(second) {
+		return false
+	}
 
-		time.Sleep(2 * time.Second)
+	counts := map[string]int{}
+	for _, elem := range first {
+		counts[elem]++
+	}
+	for _, elem := range second {
+		counts[elem]--
+		if counts[elem] < 0 {
+			return false
+		}
 	}
 
-	return nil, fmt.Errorf("too many failed attempts to resolve hostname: %w", err)
+	return true
 }
 
 func checkNsLabels(labels map[string]string, watchAllByDefault bool) bool {
@@ -142,25 +176,39 @@ type checkServiceResult struct {
 	endpoints   []*serego.Endpoint
 }
 
-func checkService(service *corev1.Service, annotationsToKeep []string) (result checkServiceResult) {
-	if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+// checkService checks whether the service can be registered and returns its
+// endpoints.
+//
+// nodeIPs are the addresses used for NodePort services, which are only
+// registered if it is not nil, while lookup is used to resolve the hostnames
+// of load balancers.
+func checkService(service *corev1.Service, annotationsToKeep annotationFilter, nodeIPs []string, lookup func(string) ([]string, bool)) (result checkServiceResult) {
+	isNodePort := service.Spec.Type == corev1.ServiceTypeNodePort && nodeIPs != nil
+	if service.Spec.Type != corev1.ServiceTypeLoadBalancer && !isNodePort {
 		result.reason = "not a LoadBalancer"
+		if nodeIPs != nil {
+			result.reason = "not a LoadBalancer or NodePort"
+		}
 		return
 	}
 
-	annotations := filterAnnotations(service.Annotations, annotationsToKeep)
+	annotations := annotationsToKeep.apply(service)
 	if len(annotations) == 0 {
 		result.reason = "no valid annotations"
 		return
 	}
 
-	ips, err := getIPsFromService(service, 10)
+	ips, resolved := nodeIPs, true
+	if !isNodePort {
+		ips, resolved = getIPsFromService(service, lookup)
+	}
+	if !resolved {
+		result.reason = "hostnames not resolved yet"
+		result.err = errResolutionPending
+		return
+	}
 	if len(ips) == 0 {
 		result.reason = "no valid hostnames/ips found"
-		if err != nil {
-			result.err = err
-		}
-
 		return
 	}
 
@@ -171,32 +219,612 @@ func checkService(service *corev1.Service, annotationsToKeep []string) (result c
 		endpoints:   []*serego.Endpoint{},
 	}
 	for _, port := range service.Spec.Ports {
+		portNumber := port.Port
+		if isNodePort {
+			if port.NodePort == 0 {
+				continue
+			}
+			portNumber = port.NodePort
+		}
+
+		metadata := getPortMetadata(annotations, port.Name, port.Protocol, port.AppProtocol)
 		for _, ip := range ips {
+			result.endpoints = append(result.endpoints,
+				newEndpoint(service.Namespace, service.Name, ip, portNumber, metadata))
+		}
+	}
 
-			// Create an hashed name for this
-			toBeHashed := fmt.Sprintf("%s:%d", ip, port.Port)
-			h := sha256.New()
-			h.Write([]byte(toBeHashed))
-			hash := hex.EncodeToString(h.Sum(nil))
+	return
+}
 
-			result.endpoints = append(result.endpoints, &serego.Endpoint{
-				Namespace: service.Namespace,
-				Service:   service.Name,
-				Name:      fmt.Sprintf("%s-%s", service.Name, hash[:10]),
-				Address:   ip,
-				Port:      port.Port,
-				Metadata:  annotations,
-			})
+// checkServiceEndpointSlices checks whether the ClusterIP service can be
+// registered with the addresses of its pods, as found in the provided
+// endpoint slices, and returns its endpoints.
+func checkServiceEndpointSlices(service *corev1.Service, annotationsToKeep annotationFilter, slices []discoveryv1.EndpointSlice) (result checkServiceResult) {
+	if service.Spec.Type != corev1.ServiceTypeClusterIP {
+		result.reason = "not a ClusterIP"
+		return
+	}
+
+	annotations := annotationsToKeep.apply(service)
+	if len(annotations) == 0 {
+		result.reason = "no valid annotations"
+		return
+	}
+
+	ipsMap := map[string]bool{}
+	endpoints := map[string]*serego.Endpoint{}
+	for _, slice := range slices {
+		if slice.AddressType == discoveryv1.AddressTypeFQDN {
+			continue
 		}
+
+		for _, endp := range slice.Endpoints {
+			if !isEndpointReady(endp.Conditions) {
+				continue
+			}
+
+			for _, ip := range endp.Addresses {
+				for _, port := range slice.Ports {
+					if port.Port == nil {
+						continue
+					}
+
+					var (
+						name     string
+						protocol corev1.Protocol
+					)
+					if port.Name != nil {
+						name = *port.Name
+					}
+					if port.Protocol != nil {
+						protocol = *port.Protocol
+					}
+
+					// The same address may appear in multiple slices while
+					// they are being updated.
+					metadata := getPortMetadata(annotations, name, protocol, port.AppProtocol)
+					endpoint := newEndpoint(service.Namespace, service.Name, ip, *port.Port, metadata)
+					endpoints[endpoint.Name+"/"+name] = endpoint
+					ipsMap[ip] = true
+				}
+			}
+		}
+	}
+
+	if len(endpoints) == 0 {
+		result.reason = "no ready pods found"
+		return
 	}
 
+	result = checkServiceResult{
+		passed:      true,
+		annotations: annotations,
+		ips:         []string{},
+		endpoints:   []*serego.Endpoint{},
+	}
+	for ip := range ipsMap {
+		result.ips = append(result.ips, ip)
+	}
+	sort.Strings(result.ips)
+	for _, endpoint := range endpoints {
+		result.endpoints = append(result.endpoints, endpoint)
+	}
+	renameSharedEndpoints(result.endpoints)
+	sort.Slice(result.endpoints, func(i, j int) bool {
+		return result.endpoints[i].Name < result.endpoints[j].Name
+	})
+
 	return
 }
 
-func getEndpointsMapFromSlice(endpoints []*serego.Endpoint) map[string]*serego.Endpoint {
-	epMap := map[string]*serego.Endpoint{}
-	for _, ep := range endpoints {
-		epMap[ep.Name] = ep
+// joinCapped joins the provided values with commas, leaving out the ones that
+// would make the result longer than maxLength: in that case, the result ends
+// with ",..." -- or is just "..." if not even the first value fits.
+func joinCapped(values []string, maxLength int) string {
+	const ellipsis = "..."
+
+	if joined := strings.Join(values, ","); len(joined) <= maxLength {
+		return joined
+	}
+
+	capped := ""
+	for _, val := range values {
+		next := val
+		if capped != "" {
+			next = capped + "," + val
+		}
+		if len(next)+len(","+ellipsis) > maxLength {
+			break
+		}
+		capped = next
+	}
+
+	if capped == "" {
+		return ellipsis
+	}
+
+	return capped + "," + ellipsis
+}
+
+// isEndpointReady returns true if traffic can be sent to the endpoint, i.e.
+// it is ready and not terminating, so that pods that are draining are not
+// registered.
+func isEndpointReady(conds discoveryv1.EndpointConditions) bool {
+	if conds.Terminating != nil && *conds.Terminating {
+		return false
+	}
+
+	// As per the EndpointSlice API, nil values must be interpreted as
+	// ready/serving.
+	if conds.Ready != nil {
+		return *conds.Ready
+	}
+
+	return conds.Serving == nil || *conds.Serving
+}
+
+// newEndpoint returns an endpoint of the service with the provided address,
+// named after an hash of the address, so that the same address and port
+// always result in the same endpoint.
+func newEndpoint(namespace, service, ip string, port int32, metadata map[string]string) *serego.Endpoint {
+	// Create an hashed name for this. The protocol is only included when it
+	// is not TCP, so that e.g. a TCP and a UDP port with the same number get
+	// two different endpoints and TCP ones keep the name they always had.
+	toBeHashed := fmt.Sprintf("%s:%d", ip, port)
+	if protocol := metadata[protocolMetadataKey]; protocol != "" && protocol != string(corev1.ProtocolTCP) {
+		toBeHashed = fmt.Sprintf("%s/%s", toBeHashed, protocol)
+	}
+
+	return &serego.Endpoint{
+		Namespace: namespace,
+		Service:   service,
+		Name:      hashEndpointName(service, toBeHashed),
+		Address:   ip,
+		Port:      port,
+		Metadata:  metadata,
+	}
+}
+
+func hashEndpointName(service, toBeHashed string) string {
+	h := sha256.New()
+	h.Write([]byte(toBeHashed))
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	return fmt.Sprintf("%s-%s", service, hash[:10])
+}
+
+// renameSharedEndpoints includes the name of the port in the hashed names of
+// the endpoints that share the same address, port and protocol -- e.g. when
+// two ports of a service target the same port of its pods -- so that each of
+// them gets its own endpoint.
+func renameSharedEndpoints(endpoints []*serego.Endpoint) {
+	counts := map[string]int{}
+	for _, endp := range endpoints {
+		counts[endp.Name]++
+	}
+
+	for _, endp := range endpoints {
+		if counts[endp.Name] < 2 {
+			continue
+		}
+
+		toBeHashed := fmt.Sprintf("%s:%d/%s/%s", endp.Address, endp.Port,
+			endp.Metadata[protocolMetadataKey], endp.Metadata[portNameMetadataKey])
+		endp.Name = hashEndpointName(endp.Service, toBeHashed)
+	}
+}
+
+// getPortMetadata returns the metadata of the endpoints of a port, i.e. the
+// annotations of its service along with the name and protocols of the port,
+// so that consumers can tell e.g. HTTPS from a UDP tunnel on the same port.
+func getPortMetadata(annotations map[string]string, name string, protocol corev1.Protocol, appProtocol *string) map[string]string {
+	metadata := map[string]string{}
+	for key, val := range annotations {
+		metadata[key] = val
+	}
+
+	if name != "" {
+		metadata[portNameMetadataKey] = name
+	}
+	if protocol != "" {
+		metadata[protocolMetadataKey] = string(protocol)
+	}
+	if appProtocol != nil && *appProtocol != "" {
+		metadata[appProtocolMetadataKey] = *appProtocol
+	}
+
+	return metadata
+}
+
+// prepareEndpoints drops the endpoints whose address is not a valid IP --
+// i.e. it cannot be parsed, it is unspecified or it is link-local -- or does
+// not belong to the allowed IP families, records the IP family of the others
+// in their metadata and names them as configured.
+//
+// families are the IP families of the object the endpoints belong to, if it
+// has any, and further restrict the ones allowed by the options.
+func (o *ControllerOptions) prepareEndpoints(endpoints []*serego.Endpoint, families []corev1.IPFamily) []*serego.Endpoint {
+	isAllowed := func(family corev1.IPFamily) bool {
+		if len(o.IPFamilies) > 0 && !containsFamily(o.IPFamilies, family) {
+			return false
+		}
+
+		return len(families) == 0 || containsFamily(families, family)
+	}
+	registerHostnames := o.Resolver != nil && o.Resolver.RegisterHostnames
+
+	prepared := []*serego.Endpoint{}
+	for _, endp := range endpoints {
+		ip := net.ParseIP(endp.Address)
+		if ip == nil {
+			// Hostnames are only found here if they must be registered.
+			if registerHostnames && endp.Address != "" {
+				prepared = append(prepared, endp)
+			}
+			continue
+		}
+
+		if ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+			continue
+		}
+
+		family := corev1.IPv6Protocol
+		if ip.To4() != nil {
+			family = corev1.IPv4Protocol
+		}
+		if !isAllowed(family) {
+			continue
+		}
+
+		// Endpoints with different addresses share the same metadata, so
+		// a copy is made.
+		metadata := map[string]string{ipFamilyMetadataKey: string(family)}
+		for key, val := range endp.Metadata {
+			metadata[key] = val
+		}
+		endp.Metadata = metadata
+		prepared = append(prepared, endp)
+	}
+
+	if o.ReadableEndpointNames {
+		setReadableNames(prepared)
+	}
+
+	return prepared
+}
+
+// placeMetadata moves the metadata of the provided object and the one it
+// inherits from its namespace from the endpoints of the state to the service
+// and namespace of the state, if metadata is registered hierarchically.
+//
+// Endpoints keep the metadata that is specific to them, e.g. their ports, or
+// that has a different value from the one of the object.
+func (o *ControllerOptions) placeMetadata(state *serviceregistry.ServiceState, filter annotationFilter, obj metav1.Object) {
+	if !o.HierarchicalMetadata || len(state.Endpoints) == 0 {
+		return
+	}
+
+	// All the allowed annotations of the namespace are registered on it,
+	// including the ones that the object overrides, so that all objects
+	// in the namespace agree on its metadata.
+	metadata, _ := filter.split(obj)
+	inherited := map[string]string{}
+	for key, val := range filter.inherited {
+		inherited[key] = val
+	}
+	isPlaced := func(key, val string) bool {
+		if objVal, exists := metadata[key]; exists {
+			return objVal == val
+		}
+
+		nsVal, exists := inherited[key]
+		return exists && nsVal == val
+	}
+
+	for _, endp := range state.Endpoints {
+		for key, val := range endp.Metadata {
+			if isPlaced(key, val) {
+				delete(endp.Metadata, key)
+			}
+		}
+	}
+
+	state.ServiceMetadata = metadata
+	state.NamespaceMetadata = inherited
+}
+
+func containsFamily(families []corev1.IPFamily, family corev1.IPFamily) bool {
+	for _, f := range families {
+		if f == family {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setReadableNames renames the endpoints after their service, the name of
+// their port -- or the port number, if the port has no name -- and their
+// address, e.g. shop-https-10-10-10-10, instead of an hash.
+//
+// Endpoints whose readable name would be too long keep their hashed name.
+func setReadableNames(endpoints []*serego.Endpoint) {
+	replacer := strings.NewReplacer(".", "-", ":", "-")
+	for _, endp := range endpoints {
+		port := endp.Metadata[portNameMetadataKey]
+		if port == "" {
+			port = strconv.Itoa(int(endp.Port))
+		}
+
+		address := strings.Trim(replacer.Replace(strings.ToLower(endp.Address)), "-")
+		name := fmt.Sprintf("%s-%s-%s", endp.Service, port, address)
+		if len(name) <= maxEndpointNameLength {
+			endp.Name = name
+		}
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Name < endpoints[j].Name
+	})
+}
+
+// isNodeReady returns true if the node is ready and is not being deleted.
+func isNodeReady(node *corev1.Node) bool {
+	if node.DeletionTimestamp != nil {
+		return false
+	}
+
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// getNodeIPs returns the addresses of the provided type of all ready nodes,
+// sorted so that the same endpoints are always computed in the same order.
+func getNodeIPs(nodes []corev1.Node, addressType corev1.NodeAddressType) []string {
+	ips := []string{}
+	for i := range nodes {
+		if !isNodeReady(&nodes[i]) {
+			continue
+		}
+
+		for _, addr := range nodes[i].Status.Addresses {
+			if addr.Type == addressType && addr.Address != "" {
+				ips = append(ips, addr.Address)
+			}
+		}
+	}
+
+	sort.Strings(ips)
+	return ips
+}
+
+// getServiceState returns the state that the service with the provided name
+// should have on the service registry, computed from the current state of
+// the service and its parent namespace in Kubernetes.
+//
+// A state with no endpoints is returned if the service does not exist (or is
+// being deleted), if its namespace is not watched or if the service is not
+// eligible for registration.
+func getServiceState(ctx context.Context, cli client.Client, name types.NamespacedName, opts *ControllerOptions) (*serviceregistry.ServiceState, error) {
+	state := &serviceregistry.ServiceState{
+		Namespace: name.Namespace,
+		Name:      name.Name,
+	}
+
+	// The hostnames still used by the service are looked up again below.
+	opts.Resolver.release(serviceOwnerKind, name)
+
+	var service corev1.Service
+	if err := cli.Get(ctx, name, &service); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return state, nil
+		}
+
+		return nil, err
+	}
+
+	if service.DeletionTimestamp != nil {
+		return state, nil
+	}
+
+	var namespace corev1.Namespace
+	if err := cli.Get(ctx, types.NamespacedName{Name: name.Namespace}, &namespace); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return state, nil
+		}
+
+		return nil, err
+	}
+
+	watchByDefault, annotations := opts.getWatchSettings()
+	if namespace.DeletionTimestamp != nil ||
+		!checkNsLabels(namespace.Labels, watchByDefault) {
+		return state, nil
+	}
+	annotations = annotations.forNamespace(&namespace)
+
+	var checkedService checkServiceResult
+	switch {
+	case opts.EndpointSlices && service.Spec.Type == corev1.ServiceTypeClusterIP:
+		var slices discoveryv1.EndpointSliceList
+		if err := cli.List(ctx, &slices, client.InNamespace(service.Namespace),
+			client.MatchingLabels{discoveryv1.LabelServiceName: service.Name}); err != nil {
+			return nil, err
+		}
+
+		checkedService = checkServiceEndpointSlices(&service, annotations, slices.Items)
+	case opts.NodePortAddressType != "" && service.Spec.Type == corev1.ServiceTypeNodePort:
+		var nodes corev1.NodeList
+		if err := cli.List(ctx, &nodes); err != nil {
+			return nil, err
+		}
+
+		checkedService = checkService(&service, annotations, getNodeIPs(nodes.Items, opts.NodePortAddressType), nil)
+	default:
+		checkedService = checkService(&service, annotations, nil, opts.Resolver.lookupFunc(serviceOwnerKind, name))
+	}
+	if !checkedService.passed {
+		// An error here means that the service may be eligible but we
+		// could not get its addresses yet: return it so that the caller
+		// does not change what is registered.
+		return state, checkedService.err
+	}
+
+	state.Endpoints = opts.prepareEndpoints(checkedService.endpoints, service.Spec.IPFamilies)
+	opts.placeMetadata(state, annotations, &service)
+
+	return state, nil
+}
+
+// syncServices syncs all services that match the provided list options with
+// the service registry.
+func syncServices(ctx context.Context, cli client.Client, opts *ControllerOptions, log zerolog.Logger, listOpts ...client.ListOption) error {
+	services := corev1.ServiceList{}
+	if err := cli.List(ctx, &services, listOpts...); err != nil {
+		log.Err(err).Msg("cannot retrieve list of services")
+		return err
+	}
+
+	errs := []error{syncServiceList(ctx, cli, opts, log, services.Items)}
+	if opts.Ingresses {
+		errs = append(errs, syncIngresses(ctx, cli, opts, log, listOpts...))
+	}
+	if opts.Gateways || opts.HTTPRoutes {
+		errs = append(errs, syncGatewayAPIObjects(ctx, cli, opts, log, listOpts...))
+	}
+
+	return errors.Join(errs...)
+}
+
+// syncIngresses syncs all ingresses that match the provided list options
+// with the service registry.
+func syncIngresses(ctx context.Context, cli client.Client, opts *ControllerOptions, log zerolog.Logger, listOpts ...client.ListOption) error {
+	ingresses := networkingv1.IngressList{}
+	if err := cli.List(ctx, &ingresses, listOpts...); err != nil {
+		log.Err(err).Msg("cannot retrieve list of ingresses")
+		return err
+	}
+
+	errs := []error{}
+	for _, ingress := range ingresses.Items {
+		state, err := getIngressState(ctx, cli, types.NamespacedName{
+			Namespace: ingress.Namespace,
+			Name:      ingress.Name,
+		}, opts)
+		if errors.Is(err, errResolutionPending) {
+			// The object is synced as soon as its hostnames are resolved.
+			continue
+		}
+		if err == nil {
+			err = syncServiceState(ctx, opts.EventsChan, state)
+		}
+
+		if err != nil {
+			log.Err(err).Str("ingress", ingress.Namespace+"/"+ingress.Name).
+				Msg("cannot sync ingress with the service registry")
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// getRegisteredState returns the state that a service registered by the
+// operator for an object of the provided kind should have on the service
+// registry, which is computed from the object it was created for -- e.g. an
+// ingress -- if any, or from the service with its name.
+func getRegisteredState(ctx context.Context, cli client.Client, name types.NamespacedName, kind string, opts *ControllerOptions) (*serviceregistry.ServiceState, error) {
+	if kind == "" {
+		return getServiceState(ctx, cli, name, opts)
+	}
+
+	for _, src := range []struct {
+		kind     string
+		prefix   string
+		enabled  bool
+		getState func(context.Context, client.Client, types.NamespacedName, *ControllerOptions) (*serviceregistry.ServiceState, error)
+	}{
+		{kind: ingressOwnerKind, prefix: ingressServicePrefix, enabled: opts.Ingresses, getState: getIngressState},
+		{kind: gatewayOwnerKind, prefix: gatewayServicePrefix, enabled: opts.Gateways, getState: getGatewayState},
+		{kind: httpRouteOwnerKind, prefix: httpRouteServicePrefix, enabled: opts.HTTPRoutes, getState: getHTTPRouteState},
+	} {
+		if src.kind != kind {
+			continue
+		}
+
+		if !src.enabled {
+			return &serviceregistry.ServiceState{Namespace: name.Namespace, Name: name.Name, Kind: kind}, nil
+		}
+
+		return src.getState(ctx, cli, types.NamespacedName{
+			Namespace: name.Namespace,
+			Name:      strings.TrimPrefix(name.Name, src.prefix),
+		}, opts)
+	}
+
+	return nil, fmt.Errorf("service %s/%s was registered for unknown kind %s", name.Namespace, name.Name, kind)
+}
+
+// syncServiceList syncs the provided services with the service registry.
+func syncServiceList(ctx context.Context, cli client.Client, opts *ControllerOptions, log zerolog.Logger, services []corev1.Service) error {
+	errs := []error{}
+	for _, service := range services {
+		state, err := getServiceState(ctx, cli, types.NamespacedName{
+			Namespace: service.Namespace,
+			Name:      service.Name,
+		}, opts)
+		if errors.Is(err, errResolutionPending) {
+			// The object is synced as soon as its hostnames are resolved.
+			continue
+		}
+		if err == nil {
+			err = syncServiceState(ctx, opts.EventsChan, state)
+		}
+
+		if err != nil {
+			log.Err(err).Str("service", service.Namespace+"/"+service.Name).
+				Msg("cannot sync service with the service registry")
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// syncServiceState sends the state to the service registry events handler
+// and waits for it to be accepted.
+func syncServiceState(ctx context.Context, eventsChan chan *serviceregistry.Event, state *serviceregistry.ServiceState) error {
+	return sendEvent(ctx, eventsChan, &serviceregistry.Event{
+		EventType: serviceregistry.EventSync,
+		Object:    state,
+	})
+}
+
+// sendEvent sends the event to the service registry events handler and waits
+// for it to be accepted by all service registries, which then process it --
+// and retry it if needed -- on their own.
+func sendEvent(mainCtx context.Context, eventsChan chan *serviceregistry.Event, event *serviceregistry.Event) error {
+	ctx, canc := context.WithTimeout(mainCtx, syncTimeout)
+	defer canc()
+
+	event.Result = make(chan error, 1)
+
+	select {
+	case eventsChan <- event:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-event.Result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return epMap
 }
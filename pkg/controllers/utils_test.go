@@ -19,9 +19,20 @@
 package controllers
 
 import (
+	"context"
+	"fmt"
 	"testing"
 
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	serego "github.com/CloudNativeSDWAN/serego/api/core/types"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestFilterAnnotations(t *testing.T) {
@@ -75,3 +86,537 @@ func TestFilterAnnotations(t *testing.T) {
 		a.Equal(currCase.expRes, res)
 	}
 }
+
+func TestGetServiceState(t *testing.T) {
+	name := types.NamespacedName{Namespace: "ns", Name: "serv"}
+	opts := &ControllerOptions{ServiceAnnotations: []string{"version"}}
+	nodePortOpts := &ControllerOptions{
+		ServiceAnnotations:  []string{"version"},
+		NodePortAddressType: corev1.NodeInternalIP,
+	}
+	namespace := func(watch string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   name.Namespace,
+			Labels: map[string]string{watchLabel: watch},
+		}}
+	}
+	service := func(servType corev1.ServiceType) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name.Name,
+				Namespace:   name.Namespace,
+				Annotations: map[string]string{"version": "v1"},
+			},
+			Spec: corev1.ServiceSpec{
+				Type:  servType,
+				Ports: []corev1.ServicePort{{Port: 80, NodePort: 30080}},
+			},
+			Status: corev1.ServiceStatus{
+				LoadBalancer: corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{{IP: "10.10.10.10"}},
+				},
+			},
+		}
+	}
+
+	node := func(name string, ready corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+				Addresses:  []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: name}},
+			},
+		}
+	}
+
+	cases := []struct {
+		id           string
+		opts         *ControllerOptions
+		objects      []client.Object
+		expEndpoints int
+	}{
+		{
+			id:      "service-not-found",
+			objects: []client.Object{namespace(watchEnabledLabel)},
+		},
+		{
+			id: "namespace-not-watched",
+			objects: []client.Object{
+				namespace(watchDisabledLabel),
+				service(corev1.ServiceTypeLoadBalancer),
+			},
+		},
+		{
+			id: "not-load-balancer",
+			objects: []client.Object{
+				namespace(watchEnabledLabel),
+				service(corev1.ServiceTypeClusterIP),
+			},
+		},
+		{
+			id: "success",
+			objects: []client.Object{
+				namespace(watchEnabledLabel),
+				service(corev1.ServiceTypeLoadBalancer),
+			},
+			expEndpoints: 1,
+		},
+		{
+			id: "endpoint-slices",
+			opts: &ControllerOptions{
+				ServiceAnnotations: []string{"version"},
+				EndpointSlices:     true,
+			},
+			objects: []client.Object{
+				namespace(watchEnabledLabel),
+				service(corev1.ServiceTypeClusterIP),
+				&discoveryv1.EndpointSlice{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "serv-abcde",
+						Namespace: name.Namespace,
+						Labels:    map[string]string{discoveryv1.LabelServiceName: name.Name},
+					},
+					AddressType: discoveryv1.AddressTypeIPv4,
+					Endpoints: []discoveryv1.Endpoint{
+						{Addresses: []string{"10.1.0.1"}},
+						{Addresses: []string{"10.1.0.2"}},
+					},
+					Ports: []discoveryv1.EndpointPort{{Port: func() *int32 { p := int32(8080); return &p }()}},
+				},
+			},
+			expEndpoints: 2,
+		},
+		{
+			id: "node-port-disabled",
+			objects: []client.Object{
+				namespace(watchEnabledLabel),
+				service(corev1.ServiceTypeNodePort),
+				node("10.0.0.1", corev1.ConditionTrue),
+			},
+		},
+		{
+			id:   "node-port",
+			opts: nodePortOpts,
+			objects: []client.Object{
+				namespace(watchEnabledLabel),
+				service(corev1.ServiceTypeNodePort),
+				node("10.0.0.1", corev1.ConditionTrue),
+				node("10.0.0.2", corev1.ConditionTrue),
+				node("10.0.0.3", corev1.ConditionFalse),
+			},
+			expEndpoints: 2,
+		},
+		{
+			id:   "node-port-no-ready-nodes",
+			opts: nodePortOpts,
+			objects: []client.Object{
+				namespace(watchEnabledLabel),
+				service(corev1.ServiceTypeNodePort),
+				node("10.0.0.3", corev1.ConditionUnknown),
+			},
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		cli := fake.NewClientBuilder().WithObjects(currCase.objects...).Build()
+		currOpts := opts
+		if currCase.opts != nil {
+			currOpts = currCase.opts
+		}
+		res, err := getServiceState(context.Background(), cli, name, currOpts)
+		if !a.NoError(err, currCase.id) {
+			continue
+		}
+
+		a.Equal(name.Namespace, res.Namespace, currCase.id)
+		a.Equal(name.Name, res.Name, currCase.id)
+		a.Len(res.Endpoints, currCase.expEndpoints, currCase.id)
+	}
+}
+
+func TestGetNodeIPs(t *testing.T) {
+	now := metav1.Now()
+	node := func(ready corev1.ConditionStatus, addresses ...corev1.NodeAddress) corev1.Node {
+		return corev1.Node{
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+				Addresses:  addresses,
+			},
+		}
+	}
+	deleted := node(corev1.ConditionTrue, corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "1.1.1.4"})
+	deleted.DeletionTimestamp = &now
+
+	nodes := []corev1.Node{
+		node(corev1.ConditionTrue,
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+			corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "1.1.1.2"}),
+		node(corev1.ConditionTrue,
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+			corev1.NodeAddress{Type: corev1.NodeHostName, Address: "node-1"}),
+		node(corev1.ConditionFalse,
+			corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "1.1.1.3"}),
+		{Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.5"}}}},
+		deleted,
+	}
+
+	a := assert.New(t)
+	a.Equal([]string{"10.0.0.1", "10.0.0.2"}, getNodeIPs(nodes, corev1.NodeInternalIP))
+	a.Equal([]string{"1.1.1.2"}, getNodeIPs(nodes, corev1.NodeExternalIP))
+	a.Equal([]string{}, getNodeIPs(nil, corev1.NodeExternalIP))
+}
+
+func TestCheckServiceEndpointSlices(t *testing.T) {
+	yes, no := true, false
+	port := func(p int32) *int32 { return &p }
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "serv",
+			Namespace:   "ns",
+			Annotations: map[string]string{"version": "v1"},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			ClusterIP: corev1.ClusterIPNone,
+		},
+	}
+	slice := func(addrType discoveryv1.AddressType, endpoints ...discoveryv1.Endpoint) discoveryv1.EndpointSlice {
+		return discoveryv1.EndpointSlice{
+			AddressType: addrType,
+			Endpoints:   endpoints,
+			Ports:       []discoveryv1.EndpointPort{{Port: port(80)}, {Port: port(443)}, {}},
+		}
+	}
+
+	cases := []struct {
+		id           string
+		annotations  []string
+		slices       []discoveryv1.EndpointSlice
+		expPassed    bool
+		expAddresses []string
+	}{
+		{
+			id:          "no-valid-annotations",
+			annotations: []string{"other"},
+			slices: []discoveryv1.EndpointSlice{
+				slice(discoveryv1.AddressTypeIPv4, discoveryv1.Endpoint{Addresses: []string{"10.1.0.1"}}),
+			},
+		},
+		{
+			id:          "no-ready-pods",
+			annotations: []string{"version"},
+			slices: []discoveryv1.EndpointSlice{
+				slice(discoveryv1.AddressTypeIPv4,
+					discoveryv1.Endpoint{
+						Addresses:  []string{"10.1.0.1"},
+						Conditions: discoveryv1.EndpointConditions{Ready: &no},
+					},
+					discoveryv1.Endpoint{
+						Addresses:  []string{"10.1.0.2"},
+						Conditions: discoveryv1.EndpointConditions{Serving: &yes, Terminating: &yes},
+					}),
+				slice(discoveryv1.AddressTypeFQDN, discoveryv1.Endpoint{Addresses: []string{"pod.example.com"}}),
+			},
+		},
+		{
+			id:          "success",
+			annotations: []string{"version"},
+			slices: []discoveryv1.EndpointSlice{
+				slice(discoveryv1.AddressTypeIPv4,
+					discoveryv1.Endpoint{Addresses: []string{"10.1.0.1"}},
+					discoveryv1.Endpoint{
+						Addresses:  []string{"10.1.0.2"},
+						Conditions: discoveryv1.EndpointConditions{Ready: &yes},
+					},
+					discoveryv1.Endpoint{
+						Addresses:  []string{"10.1.0.3"},
+						Conditions: discoveryv1.EndpointConditions{Ready: &no, Serving: &yes},
+					}),
+				// The same pod may appear in more slices while they are updated.
+				slice(discoveryv1.AddressTypeIPv4,
+					discoveryv1.Endpoint{Addresses: []string{"10.1.0.1"}},
+					discoveryv1.Endpoint{
+						Addresses:  []string{"10.1.0.4"},
+						Conditions: discoveryv1.EndpointConditions{Serving: &yes},
+					}),
+			},
+			expPassed:    true,
+			expAddresses: []string{"10.1.0.1", "10.1.0.2", "10.1.0.4"},
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		res := checkServiceEndpointSlices(service, annotationFilter{allowed: currCase.annotations}, currCase.slices)
+		if !a.Equal(currCase.expPassed, res.passed, currCase.id) || !res.passed {
+			continue
+		}
+
+		a.Equal(currCase.expAddresses, res.ips, currCase.id)
+		a.Len(res.endpoints, len(currCase.expAddresses)*2, currCase.id)
+	}
+}
+
+func TestGetPortMetadata(t *testing.T) {
+	appProtocol, empty := "kubernetes.io/h2c", ""
+	annotations := map[string]string{"version": "v1"}
+	cases := []struct {
+		id          string
+		name        string
+		protocol    corev1.Protocol
+		appProtocol *string
+		expRes      map[string]string
+	}{
+		{
+			id:     "unnamed",
+			expRes: map[string]string{"version": "v1"},
+		},
+		{
+			id:          "empty-app-protocol",
+			name:        "tunnel",
+			protocol:    corev1.ProtocolUDP,
+			appProtocol: &empty,
+			expRes: map[string]string{
+				"version":           "v1",
+				portNameMetadataKey: "tunnel",
+				protocolMetadataKey: "UDP",
+			},
+		},
+		{
+			id:          "all",
+			name:        "grpc",
+			protocol:    corev1.ProtocolTCP,
+			appProtocol: &appProtocol,
+			expRes: map[string]string{
+				"version":              "v1",
+				portNameMetadataKey:    "grpc",
+				protocolMetadataKey:    "TCP",
+				appProtocolMetadataKey: "kubernetes.io/h2c",
+			},
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		res := getPortMetadata(annotations, currCase.name, currCase.protocol, currCase.appProtocol)
+		if !a.Equal(currCase.expRes, res) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+
+	// The annotations must not be modified, as they are shared by all ports.
+	a.Equal(map[string]string{"version": "v1"}, annotations)
+}
+
+func TestNewEndpoint(t *testing.T) {
+	a := assert.New(t)
+	endpoint := func(protocol corev1.Protocol, name string) *serego.Endpoint {
+		return newEndpoint("ns", "dns", "10.10.10.10", 53, getPortMetadata(nil, name, protocol, nil))
+	}
+
+	tcp, udp := endpoint(corev1.ProtocolTCP, ""), endpoint(corev1.ProtocolUDP, "")
+	a.NotEqual(tcp.Name, udp.Name)
+	a.Equal(tcp.Name, endpoint(corev1.ProtocolTCP, "").Name)
+	a.NotEqual(endpoint(corev1.ProtocolTCP, "dns-tcp").Name, endpoint(corev1.ProtocolUDP, "dns-udp").Name)
+
+	// TCP endpoints keep the names they had before protocols were tracked.
+	a.Equal("dns-6cacccaa08", tcp.Name)
+	a.Equal(tcp.Name, endpoint(corev1.ProtocolTCP, "dns").Name)
+	a.Equal(tcp.Name, endpoint("", "").Name)
+}
+
+func TestRenameSharedEndpoints(t *testing.T) {
+	a := assert.New(t)
+	endpoint := func(address string, port int32, name string) *serego.Endpoint {
+		return newEndpoint("ns", "shop", address, port, getPortMetadata(nil, name, corev1.ProtocolTCP, nil))
+	}
+
+	single := endpoint("10.10.10.10", 8443, "admin")
+	singleName := single.Name
+	http, https := endpoint("10.10.10.10", 8080, "http"), endpoint("10.10.10.10", 8080, "https")
+	sharedName := http.Name
+	other := endpoint("10.10.10.11", 8080, "http")
+	otherName := other.Name
+
+	renameSharedEndpoints([]*serego.Endpoint{single, http, https, other})
+	a.Equal(singleName, single.Name)
+	a.Equal(otherName, other.Name)
+	a.NotEqual(sharedName, http.Name)
+	a.NotEqual(sharedName, https.Name)
+	a.NotEqual(http.Name, https.Name)
+}
+
+func TestSetReadableNames(t *testing.T) {
+	endpoints := []*serego.Endpoint{
+		newEndpoint("ns", "shop", "10.10.10.10", 443, map[string]string{portNameMetadataKey: "https"}),
+		newEndpoint("ns", "shop", "10.10.10.10", 8080, nil),
+		newEndpoint("ns", "shop", "2001:DB8::1", 443, map[string]string{portNameMetadataKey: "https"}),
+		newEndpoint("ns", "shop", "2001:db8:1111:2222:3333:4444:5555:6666", 443, map[string]string{portNameMetadataKey: "https"}),
+		newEndpoint("ns", "shop-frontend-canary", "2001:db8:1111:2222:3333:4444:5555:6666", 443, map[string]string{portNameMetadataKey: "https"}),
+	}
+	hashedName := endpoints[4].Name
+
+	setReadableNames(endpoints)
+	names := []string{}
+	for _, endp := range endpoints {
+		names = append(names, endp.Name)
+	}
+
+	assert.ElementsMatch(t, []string{
+		"shop-8080-10-10-10-10",
+		"shop-https-10-10-10-10",
+		"shop-https-2001-db8--1",
+		"shop-https-2001-db8-1111-2222-3333-4444-5555-6666",
+		hashedName,
+	}, names)
+}
+
+func TestPrepareEndpoints(t *testing.T) {
+	newEndpoints := func() []*serego.Endpoint {
+		metadata := map[string]string{"version": "v1"}
+		endpoints := []*serego.Endpoint{}
+		for _, addr := range []string{
+			"10.10.10.10", "2001:db8::1", "lb.example.com", "0.0.0.0",
+			"::", "169.254.0.1", "fe80::1", "ff02::1", "",
+		} {
+			endpoints = append(endpoints, newEndpoint("ns", "serv", addr, 80, metadata))
+		}
+		return endpoints
+	}
+
+	cases := []struct {
+		id          string
+		opts        *ControllerOptions
+		families    []corev1.IPFamily
+		expFamilies map[string]string
+	}{
+		{
+			id:   "all-families",
+			opts: &ControllerOptions{},
+			expFamilies: map[string]string{
+				"10.10.10.10": "IPv4",
+				"2001:db8::1": "IPv6",
+			},
+		},
+		{
+			id:          "ipv6-only",
+			opts:        &ControllerOptions{IPFamilies: []corev1.IPFamily{corev1.IPv6Protocol}},
+			expFamilies: map[string]string{"2001:db8::1": "IPv6"},
+		},
+		{
+			id:          "service-families",
+			opts:        &ControllerOptions{},
+			families:    []corev1.IPFamily{corev1.IPv4Protocol},
+			expFamilies: map[string]string{"10.10.10.10": "IPv4"},
+		},
+		{
+			id:       "no-common-families",
+			opts:     &ControllerOptions{IPFamilies: []corev1.IPFamily{corev1.IPv6Protocol}},
+			families: []corev1.IPFamily{corev1.IPv4Protocol},
+		},
+		{
+			id: "register-hostnames",
+			opts: &ControllerOptions{
+				IPFamilies: []corev1.IPFamily{corev1.IPv4Protocol},
+				Resolver:   NewHostnameResolver(HostnameResolverOptions{RegisterHostnames: true}, zerolog.Nop()),
+			},
+			expFamilies: map[string]string{
+				"10.10.10.10":    "IPv4",
+				"lb.example.com": "",
+			},
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		res := currCase.opts.prepareEndpoints(newEndpoints(), currCase.families)
+
+		families := map[string]string{}
+		for _, endp := range res {
+			families[endp.Address] = endp.Metadata[ipFamilyMetadataKey]
+			if !a.Equal("v1", endp.Metadata["version"]) {
+				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+			}
+		}
+
+		if !a.Len(res, len(currCase.expFamilies)) ||
+			(len(currCase.expFamilies) > 0 && !a.Equal(currCase.expFamilies, families)) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
+
+func TestPlaceMetadata(t *testing.T) {
+	filter := annotationFilter{
+		allowed:              []string{"version", "team"},
+		namespaceAnnotations: []string{"team", "region"},
+	}.forNamespace(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{"team": "payments", "region": "eu"},
+	}})
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{"version": "v1", "team": "shop"},
+	}}
+	newState := func() *serviceregistry.ServiceState {
+		metadata := filter.apply(service)
+		metadata[portNameMetadataKey] = "http"
+		return &serviceregistry.ServiceState{
+			Endpoints: []*serego.Endpoint{newEndpoint("ns", "serv", "10.10.10.10", 80, metadata)},
+		}
+	}
+
+	cases := []struct {
+		id          string
+		opts        *ControllerOptions
+		expEndpMeta map[string]string
+		expServMeta map[string]string
+		expNsMeta   map[string]string
+	}{
+		{
+			id:          "endpoints",
+			opts:        &ControllerOptions{},
+			expEndpMeta: map[string]string{"version": "v1", "team": "shop", "region": "eu", portNameMetadataKey: "http"},
+		},
+		{
+			id:          "hierarchical",
+			opts:        &ControllerOptions{HierarchicalMetadata: true},
+			expEndpMeta: map[string]string{portNameMetadataKey: "http"},
+			expServMeta: map[string]string{"version": "v1", "team": "shop"},
+			expNsMeta:   map[string]string{"team": "payments", "region": "eu"},
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		state := newState()
+		currCase.opts.placeMetadata(state, filter, service)
+
+		if !a.Equal(currCase.expEndpMeta, state.Endpoints[0].Metadata) ||
+			!a.Equal(currCase.expServMeta, state.ServiceMetadata) ||
+			!a.Equal(currCase.expNsMeta, state.NamespaceMetadata) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
+
+func TestJoinCapped(t *testing.T) {
+	cases := []struct {
+		id     string
+		values []string
+		expRes string
+	}{
+		{id: "empty"},
+		{id: "fits", values: []string{"a.com/", "b.com/api"}, expRes: "a.com/,b.com/api"},
+		{id: "exact", values: []string{"a.com/", "b.com/api", "c.com/"}, expRes: "a.com/,b.com/api,c.com/"},
+		{id: "capped", values: []string{"a.com/", "b.com/api", "c.com/", "d.com/"}, expRes: "a.com/,b.com/api,..."},
+		{id: "first-too-long", values: []string{"a-very-long-host.example.com/"}, expRes: "..."},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		res := joinCapped(currCase.values, len("a.com/,b.com/api,c.com/"))
+		if !a.Equal(currCase.expRes, res) || !a.LessOrEqual(len(res), len("a.com/,b.com/api,c.com/")) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
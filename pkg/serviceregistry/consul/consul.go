@@ -0,0 +1,135 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+// Package consul implements a service registry on HashiCorp Consul.
+//
+// Endpoints are registered as instances of Consul catalog services on an
+// external node, i.e. one that is not backed by a Consul agent: the catalog
+// service is named after the namespace and service of the endpoint, and its
+// metadata is registered as the meta and tags of the instance.
+//
+// Consul has no place for namespaces and services outside of the catalog,
+// so they are stored in the Consul KV store, along with their metadata.
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+const (
+	// DefaultNode is the name of the node where endpoints are registered, if
+	// none is provided.
+	DefaultNode string = "cnwan-operator"
+	// DefaultPrefix is the prefix of the keys where namespaces and services
+	// are stored in the KV store, if none is provided.
+	DefaultPrefix string = "cnwan"
+
+	requestTimeout = 30 * time.Second
+)
+
+// Config contains the configuration of a Consul service registry.
+type Config struct {
+	// Address is the address of the Consul HTTP API, i.e. host and port.
+	Address string
+	// Datacenter is the datacenter where objects are registered. If empty,
+	// the one of the Consul agent that receives the requests is used.
+	Datacenter string
+	// Token is the ACL token sent with all requests, if not empty.
+	Token string
+	// TLSConfig, if not nil, makes all requests use HTTPS with this
+	// configuration.
+	TLSConfig *tls.Config
+	// Node is the name of the node where endpoints are registered.
+	Node string
+	// Prefix is the prefix of the keys where namespaces and services are
+	// stored in the KV store.
+	Prefix string
+}
+
+// Registry is a service registry on Consul.
+type Registry struct {
+	client     *api.Client
+	datacenter string
+	node       string
+	prefix     string
+}
+
+var _ serviceregistry.Registry = (*Registry)(nil)
+
+// New returns a new Registry that uses the Consul HTTP API with the provided
+// configuration.
+func New(cfg Config) (*Registry, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("no address provided")
+	}
+
+	transport := cleanhttp.DefaultPooledTransport()
+	apiCfg := &api.Config{
+		Address:    cfg.Address,
+		Scheme:     "http",
+		Datacenter: cfg.Datacenter,
+		Token:      cfg.Token,
+		HttpClient: &http.Client{Transport: transport, Timeout: requestTimeout},
+	}
+	if cfg.TLSConfig != nil {
+		apiCfg.Scheme = "https"
+		transport.TLSClientConfig = cfg.TLSConfig
+	}
+
+	client, err := api.NewClient(apiCfg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create consul client: %w", err)
+	}
+
+	r := &Registry{
+		client:     client,
+		datacenter: cfg.Datacenter,
+		node:       cfg.Node,
+		prefix:     strings.Trim(cfg.Prefix, "/"),
+	}
+	if r.node == "" {
+		r.node = DefaultNode
+	}
+	if r.prefix == "" {
+		r.prefix = DefaultPrefix
+	}
+
+	return r, nil
+}
+
+// Namespace returns an operation on the namespace with the provided name.
+func (r *Registry) Namespace(name string) serviceregistry.NamespaceOperation {
+	return &namespaceOperation{registry: r, name: name}
+}
+
+func (r *Registry) queryOptions(ctx context.Context) *api.QueryOptions {
+	return (&api.QueryOptions{}).WithContext(ctx)
+}
+
+func (r *Registry) writeOptions(ctx context.Context) *api.WriteOptions {
+	return (&api.WriteOptions{}).WithContext(ctx)
+}
@@ -0,0 +1,307 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	serego "github.com/CloudNativeSDWAN/serego/api/core"
+	stypes "github.com/CloudNativeSDWAN/serego/api/core/types"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConsul is an in-process fake of the parts of the Consul HTTP API that
+// are used by the registry.
+type fakeConsul struct {
+	lock      sync.Mutex
+	token     string
+	kv        map[string][]byte
+	instances map[string]*api.CatalogService
+}
+
+func newFakeConsul(token string) *fakeConsul {
+	return &fakeConsul{
+		token:     token,
+		kv:        map[string][]byte{},
+		instances: map[string]*api.CatalogService{},
+	}
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if r.Header.Get("X-Consul-Token") != f.token {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+	if r.URL.Query().Get("dc") != "dc1" {
+		http.Error(w, "No path to datacenter", http.StatusInternalServerError)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+		f.serveKV(w, r, strings.TrimPrefix(r.URL.Path, "/v1/kv/"), body)
+	case r.URL.Path == "/v1/catalog/register":
+		reg := &api.CatalogRegistration{}
+		json.Unmarshal(body, reg)
+		f.instances[reg.Node+"/"+reg.Service.ID] = &api.CatalogService{
+			Node:           reg.Node,
+			ServiceID:      reg.Service.ID,
+			ServiceName:    reg.Service.Service,
+			ServiceAddress: reg.Service.Address,
+			ServicePort:    reg.Service.Port,
+			ServiceTags:    reg.Service.Tags,
+			ServiceMeta:    reg.Service.Meta,
+		}
+		w.Write([]byte("true"))
+	case r.URL.Path == "/v1/catalog/deregister":
+		dereg := &api.CatalogDeregistration{}
+		json.Unmarshal(body, dereg)
+		delete(f.instances, dereg.Node+"/"+dereg.ServiceID)
+		w.Write([]byte("true"))
+	case strings.HasPrefix(r.URL.Path, "/v1/catalog/service/"):
+		name := strings.TrimPrefix(r.URL.Path, "/v1/catalog/service/")
+		instances := []*api.CatalogService{}
+		for _, inst := range f.instances {
+			if inst.ServiceName == name {
+				instances = append(instances, inst)
+			}
+		}
+		json.NewEncoder(w).Encode(instances)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeConsul) serveKV(w http.ResponseWriter, r *http.Request, key string, body []byte) {
+	switch r.Method {
+	case http.MethodPut:
+		f.kv[key] = body
+		w.Write([]byte("true"))
+	case http.MethodDelete:
+		delete(f.kv, key)
+		w.Write([]byte("true"))
+	case http.MethodGet:
+		if !r.URL.Query().Has("keys") {
+			value, exists := f.kv[key]
+			if !exists {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode([]*api.KVPair{{Key: key, Value: value}})
+			return
+		}
+
+		keys := map[string]bool{}
+		for k := range f.kv {
+			if !strings.HasPrefix(k, key) {
+				continue
+			}
+			if i := strings.Index(k[len(key):], "/"); i >= 0 {
+				k = k[:len(key)+i+1]
+			}
+			keys[k] = true
+		}
+		if len(keys) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		list := []string{}
+		for k := range keys {
+			list = append(list, k)
+		}
+		sort.Strings(list)
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	fake := newFakeConsul("secret")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	r, err := New(Config{
+		Address:    strings.TrimPrefix(server.URL, "http://"),
+		Datacenter: "dc1",
+		Token:      "secret",
+	})
+	if !a.NoError(err) {
+		a.FailNow("cannot create registry")
+	}
+
+	nsop := r.Namespace("ns")
+	sop := nsop.Service("serv")
+	epop := sop.Endpoint("serv-80")
+
+	_, err = nsop.Get(ctx)
+	a.True(serrors.IsNotFound(err))
+	a.Error(sop.Register(ctx))
+	a.True(serrors.IsNotFound(epop.Register(ctx)))
+
+	a.NoError(nsop.Register(ctx, register.WithMetadata(map[string]string{"cnwan.io/clusters": "c1"})))
+	a.NoError(sop.Register(ctx, register.WithMetadata(map[string]string{"owner": "cnwan-operator"})))
+	a.NoError(epop.Register(ctx,
+		register.WithAddress("10.10.10.10"),
+		register.WithPort(80),
+		register.WithMetadata(map[string]string{"cnwan.io/cluster-id": "c1", "version_tag": "v1"})))
+
+	ns, err := nsop.Get(ctx)
+	a.NoError(err)
+	a.Equal(&stypes.Namespace{Name: "ns", Metadata: map[string]string{"cnwan.io/clusters": "c1"}}, ns)
+
+	ep, err := epop.Get(ctx)
+	a.NoError(err)
+	a.Equal(&stypes.Endpoint{
+		Name:      "serv-80",
+		Service:   "serv",
+		Namespace: "ns",
+		Address:   "10.10.10.10",
+		Port:      80,
+		Metadata:  map[string]string{"cnwan.io/cluster-id": "c1", "version_tag": "v1"},
+	}, ep)
+
+	inst := fake.instances[DefaultNode+"/ns/serv/serv-80"]
+	if !a.NotNil(inst) {
+		a.FailNow("endpoint not registered on the catalog")
+	}
+	a.Equal("ns-serv", inst.ServiceName)
+	a.Equal([]string{"cnwan.io/cluster-id=c1", "version_tag=v1"}, inst.ServiceTags)
+	a.Equal(map[string]string{
+		"cnwan_2eio_2fcluster-id": "c1",
+		"version_5ftag":           "v1",
+		namespaceMetaKey:          "ns",
+		serviceMetaKey:            "serv",
+		endpointMetaKey:           "serv-80",
+	}, inst.ServiceMeta)
+
+	// Address and port are kept and metadata is replaced.
+	a.NoError(epop.Register(ctx, register.WithReplaceMetadata(),
+		register.WithMetadata(map[string]string{"version": "v2"})))
+	ep, err = epop.Get(ctx)
+	a.NoError(err)
+	a.Equal("10.10.10.10", ep.Address)
+	a.Equal(int32(80), ep.Port)
+	a.Equal(map[string]string{"version": "v2"}, ep.Metadata)
+
+	// Endpoints of other nodes are ignored.
+	fake.instances["other/ns/serv/serv-81"] = &api.CatalogService{
+		Node:        "other",
+		ServiceID:   "ns/serv/serv-81",
+		ServiceName: "ns-serv",
+		ServiceMeta: map[string]string{namespaceMetaKey: "ns", serviceMetaKey: "serv", endpointMetaKey: "serv-81"},
+	}
+
+	names := []string{}
+	nsIterator := r.Namespace(serego.Any).List()
+	for {
+		ns, nsop, err := nsIterator.Next(ctx)
+		if err != nil {
+			a.True(serrors.IsIteratorDone(err))
+			break
+		}
+		names = append(names, ns.Name)
+
+		servIterator := nsop.Service(serego.Any).List()
+		for {
+			serv, sop, err := servIterator.Next(ctx)
+			if err != nil {
+				a.True(serrors.IsIteratorDone(err))
+				break
+			}
+			names = append(names, serv.Name)
+
+			epIterator := sop.Endpoint(serego.Any).List()
+			for {
+				ep, _, err := epIterator.Next(ctx)
+				if err != nil {
+					a.True(serrors.IsIteratorDone(err))
+					break
+				}
+				names = append(names, ep.Name)
+			}
+		}
+	}
+	a.Equal([]string{"ns", "serv", "serv-80"}, names)
+
+	a.NoError(nsop.Deregister(ctx))
+	_, err = sop.Get(ctx)
+	a.True(serrors.IsNotFound(err))
+	_, err = epop.Get(ctx)
+	a.True(serrors.IsNotFound(err))
+	a.NoError(epop.Deregister(ctx))
+	a.Len(fake.instances, 1)
+	a.Empty(fake.kv)
+
+	r, err = New(Config{
+		Address:    strings.TrimPrefix(server.URL, "http://"),
+		Datacenter: "dc1",
+		Token:      "wrong",
+	})
+	a.NoError(err)
+	_, err = r.Namespace("ns").Get(ctx)
+	a.Error(err)
+	a.False(serrors.IsNotFound(err))
+}
+
+func TestMetaKeys(t *testing.T) {
+	a := assert.New(t)
+
+	cases := []struct {
+		id     string
+		key    string
+		expKey string
+	}{
+		{id: "unchanged", key: "Version-1", expKey: "Version-1"},
+		{id: "escaped", key: "cnwan.io/owner", expKey: "cnwan_2eio_2fowner"},
+		{id: "underscore", key: "a_b", expKey: "a_5fb"},
+		{id: "unicode", key: "é", expKey: "_c3_a9"},
+	}
+
+	for _, currCase := range cases {
+		key := escapeMetaKey(currCase.key)
+		unescaped, ok := unescapeMetaKey(key)
+		if !a.Equal(currCase.expKey, key) || !a.True(ok) || !a.Equal(currCase.key, unescaped) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+
+	for _, key := range []string{namespaceMetaKey, serviceMetaKey, endpointMetaKey, "a_", "a_2", "a_2E"} {
+		if _, ok := unescapeMetaKey(key); !a.False(ok) {
+			a.FailNow(fmt.Sprintf("key %s was unescaped", key))
+		}
+	}
+}
@@ -0,0 +1,471 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package consul
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	stypes "github.com/CloudNativeSDWAN/serego/api/core/types"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+	"github.com/hashicorp/consul/api"
+)
+
+// listByName returns a function that lists the objects stored under the
+// provided key, or just the one with the provided name if not empty.
+func (r *Registry) listByName(key, name string) func(ctx context.Context) ([]string, error) {
+	return func(ctx context.Context) ([]string, error) {
+		if name != "" {
+			return []string{name}, nil
+		}
+
+		return r.listKV(ctx, key)
+	}
+}
+
+type namespaceOperation struct {
+	registry *Registry
+	name     string
+}
+
+func (n *namespaceOperation) Get(ctx context.Context) (*stypes.Namespace, error) {
+	if n.name == "" {
+		return nil, serrors.EmptyNamespaceName
+	}
+
+	ns := &stypes.Namespace{}
+	if err := n.registry.getKV(ctx, n.registry.kvKey(n.name), ns); err != nil {
+		if serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", serrors.NamespaceNotFound, n.name)
+		}
+
+		return nil, err
+	}
+
+	ns.Name = n.name
+	if ns.Metadata == nil {
+		ns.Metadata = map[string]string{}
+	}
+
+	return ns, nil
+}
+
+func (n *namespaceOperation) Register(ctx context.Context, opts ...register.Option) error {
+	curr, err := n.Get(ctx)
+	if err != nil && !serrors.IsNotFound(err) {
+		return err
+	}
+
+	var currMeta map[string]string
+	if curr != nil {
+		currMeta = curr.Metadata
+	}
+
+	_, metadata, err := serviceregistry.PrepareRegister(opts, currMeta, curr != nil,
+		serrors.NamespaceNotFound, serrors.NamespaceAlreadyExists)
+	if err != nil {
+		return err
+	}
+
+	return n.registry.putKV(ctx, n.registry.kvKey(n.name),
+		&stypes.Namespace{Name: n.name, Metadata: metadata})
+}
+
+// Deregister removes the namespace, along with all its services and their
+// endpoints.
+func (n *namespaceOperation) Deregister(ctx context.Context) error {
+	if n.name == "" {
+		return serrors.EmptyNamespaceName
+	}
+
+	services, err := n.registry.listKV(ctx, n.registry.kvKey(n.name))
+	if err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		if err := n.Service(service).Deregister(ctx); err != nil {
+			return err
+		}
+	}
+
+	return n.registry.deleteKV(ctx, n.registry.kvKey(n.name))
+}
+
+func (n *namespaceOperation) List() serviceregistry.NamespaceIterator {
+	return &namespaceIterator{
+		registry: n.registry,
+		lister:   serviceregistry.NewLister(n.registry.listByName(n.registry.prefix, n.name)),
+	}
+}
+
+func (n *namespaceOperation) Service(name string) serviceregistry.ServiceOperation {
+	return &serviceOperation{registry: n.registry, namespace: n.name, name: name}
+}
+
+type namespaceIterator struct {
+	registry *Registry
+	lister   *serviceregistry.Lister[string]
+}
+
+func (i *namespaceIterator) Next(ctx context.Context) (*stypes.Namespace, serviceregistry.NamespaceOperation, error) {
+	for {
+		name, err := i.lister.Next(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		nsop := i.registry.Namespace(name)
+		ns, err := nsop.Get(ctx)
+		switch {
+		case serrors.IsNotFound(err):
+			// It was removed in the meantime.
+			continue
+		case err != nil:
+			return nil, nil, err
+		}
+
+		return ns, nsop, nil
+	}
+}
+
+type serviceOperation struct {
+	registry  *Registry
+	namespace string
+	name      string
+}
+
+func (s *serviceOperation) checkNames() error {
+	switch {
+	case s.namespace == "":
+		return serrors.EmptyNamespaceName
+	case s.name == "":
+		return serrors.EmptyServiceName
+	}
+
+	return nil
+}
+
+func (s *serviceOperation) Get(ctx context.Context) (*stypes.Service, error) {
+	if err := s.checkNames(); err != nil {
+		return nil, err
+	}
+
+	serv := &stypes.Service{}
+	if err := s.registry.getKV(ctx, s.registry.kvKey(s.namespace, s.name), serv); err != nil {
+		if serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s/%s", serrors.ServiceNotFound, s.namespace, s.name)
+		}
+
+		return nil, err
+	}
+
+	serv.Name, serv.Namespace = s.name, s.namespace
+	if serv.Metadata == nil {
+		serv.Metadata = map[string]string{}
+	}
+
+	return serv, nil
+}
+
+func (s *serviceOperation) Register(ctx context.Context, opts ...register.Option) error {
+	curr, err := s.Get(ctx)
+	if err != nil && !serrors.IsNotFound(err) {
+		return err
+	}
+
+	var currMeta map[string]string
+	if curr != nil {
+		currMeta = curr.Metadata
+	} else if _, err := s.registry.Namespace(s.namespace).Get(ctx); err != nil {
+		return fmt.Errorf("cannot get namespace %s before registering service: %w", s.namespace, err)
+	}
+
+	_, metadata, err := serviceregistry.PrepareRegister(opts, currMeta, curr != nil,
+		serrors.ServiceNotFound, serrors.ServiceAlreadyExists)
+	if err != nil {
+		return err
+	}
+
+	return s.registry.putKV(ctx, s.registry.kvKey(s.namespace, s.name),
+		&stypes.Service{Name: s.name, Namespace: s.namespace, Metadata: metadata})
+}
+
+// Deregister removes the service, along with all its endpoints.
+func (s *serviceOperation) Deregister(ctx context.Context) error {
+	if err := s.checkNames(); err != nil {
+		return err
+	}
+
+	endpoints, err := s.listEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, ep := range endpoints {
+		if err := s.Endpoint(ep.Name).Deregister(ctx); err != nil {
+			return err
+		}
+	}
+
+	return s.registry.deleteKV(ctx, s.registry.kvKey(s.namespace, s.name))
+}
+
+func (s *serviceOperation) List() serviceregistry.ServiceIterator {
+	return &serviceIterator{
+		namespace: &namespaceOperation{registry: s.registry, name: s.namespace},
+		lister: serviceregistry.NewLister(func(ctx context.Context) ([]string, error) {
+			if s.namespace == "" {
+				return nil, serrors.EmptyNamespaceName
+			}
+
+			return s.registry.listByName(s.registry.kvKey(s.namespace), s.name)(ctx)
+		}),
+	}
+}
+
+func (s *serviceOperation) Endpoint(name string) serviceregistry.EndpointOperation {
+	return &endpointOperation{service: s, name: name}
+}
+
+// catalogName returns the name of the Consul catalog service where the
+// endpoints of this service are registered.
+func (s *serviceOperation) catalogName() string {
+	return s.namespace + "-" + s.name
+}
+
+// listEndpoints returns the endpoints of this service, sorted by name.
+//
+// Only the instances of the catalog service that are registered on the node
+// of the operator for this namespace and service are considered, so that
+// services with the same catalog name are told apart.
+func (s *serviceOperation) listEndpoints(ctx context.Context) ([]*stypes.Endpoint, error) {
+	instances, _, err := s.registry.client.Catalog().Service(s.catalogName(), "",
+		s.registry.queryOptions(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := []*stypes.Endpoint{}
+	for _, inst := range instances {
+		if inst.Node != s.registry.node ||
+			inst.ServiceMeta[namespaceMetaKey] != s.namespace ||
+			inst.ServiceMeta[serviceMetaKey] != s.name {
+			continue
+		}
+
+		endpoints = append(endpoints, &stypes.Endpoint{
+			Name:      inst.ServiceMeta[endpointMetaKey],
+			Service:   s.name,
+			Namespace: s.namespace,
+			Address:   inst.ServiceAddress,
+			Port:      int32(inst.ServicePort),
+			Metadata:  fromConsulMeta(inst.ServiceMeta),
+		})
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Name < endpoints[j].Name
+	})
+
+	return endpoints, nil
+}
+
+type serviceIterator struct {
+	namespace *namespaceOperation
+	lister    *serviceregistry.Lister[string]
+}
+
+func (i *serviceIterator) Next(ctx context.Context) (*stypes.Service, serviceregistry.ServiceOperation, error) {
+	for {
+		name, err := i.lister.Next(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sop := i.namespace.Service(name)
+		serv, err := sop.Get(ctx)
+		switch {
+		case serrors.IsNotFound(err):
+			// It was removed in the meantime.
+			continue
+		case err != nil:
+			return nil, nil, err
+		}
+
+		return serv, sop, nil
+	}
+}
+
+type endpointOperation struct {
+	service *serviceOperation
+	name    string
+}
+
+func (e *endpointOperation) checkNames() error {
+	if err := e.service.checkNames(); err != nil {
+		return err
+	}
+
+	if e.name == "" {
+		return serrors.EmptyEndpointName
+	}
+
+	return nil
+}
+
+// id returns the ID of the catalog service instance of this endpoint.
+func (e *endpointOperation) id() string {
+	return path.Join(e.service.namespace, e.service.name, e.name)
+}
+
+func (e *endpointOperation) Get(ctx context.Context) (*stypes.Endpoint, error) {
+	if err := e.checkNames(); err != nil {
+		return nil, err
+	}
+
+	endpoints, err := e.service.listEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ep := range endpoints {
+		if ep.Name == e.name {
+			return ep, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", serrors.EndpointNotFound, e.id())
+}
+
+func (e *endpointOperation) Register(ctx context.Context, opts ...register.Option) error {
+	curr, err := e.Get(ctx)
+	if err != nil && !serrors.IsNotFound(err) {
+		return err
+	}
+
+	var (
+		currMeta map[string]string
+		address  string
+		port     int32
+	)
+	if curr != nil {
+		currMeta, address, port = curr.Metadata, curr.Address, curr.Port
+	} else if _, err := e.service.Get(ctx); err != nil {
+		return fmt.Errorf("cannot get service %s before registering endpoint: %w", e.service.name, err)
+	}
+
+	regOpts, metadata, err := serviceregistry.PrepareRegister(opts, currMeta, curr != nil,
+		serrors.EndpointNotFound, serrors.EndpointAlreadyExists)
+	if err != nil {
+		return err
+	}
+	if regOpts.Address != nil {
+		address = *regOpts.Address
+	}
+	if regOpts.Port != nil {
+		port = *regOpts.Port
+	}
+
+	meta, tags := toConsulMeta(metadata)
+	meta[namespaceMetaKey] = e.service.namespace
+	meta[serviceMetaKey] = e.service.name
+	meta[endpointMetaKey] = e.name
+
+	registry := e.service.registry
+	_, err = registry.client.Catalog().Register(&api.CatalogRegistration{
+		Datacenter: registry.datacenter,
+		Node:       registry.node,
+		Address:    address,
+		NodeMeta: map[string]string{
+			"external-node":  "true",
+			"external-probe": "false",
+		},
+		// The address above is only used if the node does not exist yet.
+		SkipNodeUpdate: true,
+		Service: &api.AgentService{
+			ID:      e.id(),
+			Service: e.service.catalogName(),
+			Tags:    tags,
+			Address: address,
+			Port:    int(port),
+			Meta:    meta,
+		},
+	}, registry.writeOptions(ctx))
+	return err
+}
+
+func (e *endpointOperation) Deregister(ctx context.Context) error {
+	if _, err := e.Get(ctx); err != nil {
+		if serrors.IsNotFound(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	registry := e.service.registry
+	_, err := registry.client.Catalog().Deregister(&api.CatalogDeregistration{
+		Datacenter: registry.datacenter,
+		Node:       registry.node,
+		ServiceID:  e.id(),
+	}, registry.writeOptions(ctx))
+	return err
+}
+
+func (e *endpointOperation) List() serviceregistry.EndpointIterator {
+	return &endpointIterator{
+		service: e.service,
+		lister: serviceregistry.NewLister(func(ctx context.Context) ([]*stypes.Endpoint, error) {
+			if err := e.service.checkNames(); err != nil {
+				return nil, err
+			}
+
+			endpoints, err := e.service.listEndpoints(ctx)
+			if err != nil || e.name == "" {
+				return endpoints, err
+			}
+
+			for _, ep := range endpoints {
+				if ep.Name == e.name {
+					return []*stypes.Endpoint{ep}, nil
+				}
+			}
+
+			return []*stypes.Endpoint{}, nil
+		}),
+	}
+}
+
+type endpointIterator struct {
+	service *serviceOperation
+	lister  *serviceregistry.Lister[*stypes.Endpoint]
+}
+
+func (i *endpointIterator) Next(ctx context.Context) (*stypes.Endpoint, serviceregistry.EndpointOperation, error) {
+	ep, err := i.lister.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ep, i.service.Endpoint(ep.Name), nil
+}
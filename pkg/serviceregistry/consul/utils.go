@@ -0,0 +1,175 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package consul
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	// The following meta keys are reserved for the names of the endpoint.
+	// They contain an underscore that is not followed by two hexadecimal
+	// digits, so they can never be the escaped form of a metadata key.
+	namespaceMetaKey string = "cnwan_namespace"
+	serviceMetaKey   string = "cnwan_service"
+	endpointMetaKey  string = "cnwan_endpoint"
+)
+
+// escapeMetaKey returns a version of the provided metadata key that can be
+// used as a meta key on Consul, which only accepts letters, digits, dashes
+// and underscores.
+//
+// All other characters -- and underscores -- are replaced with an underscore
+// followed by their hexadecimal value, so that the original key can always
+// be restored.
+func escapeMetaKey(key string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(key) {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9', b == '-':
+			escaped.WriteByte(b)
+		default:
+			escaped.WriteString(fmt.Sprintf("_%02x", b))
+		}
+	}
+
+	return escaped.String()
+}
+
+// unescapeMetaKey restores a metadata key escaped with escapeMetaKey. It
+// returns false if the key was not escaped by it, e.g. if it is reserved.
+func unescapeMetaKey(key string) (string, bool) {
+	var unescaped []byte
+	for i := 0; i < len(key); i++ {
+		if key[i] != '_' {
+			unescaped = append(unescaped, key[i])
+			continue
+		}
+
+		if i+2 >= len(key) {
+			return "", false
+		}
+
+		b, err := hex.DecodeString(key[i+1 : i+3])
+		if err != nil || strings.ToLower(key[i+1:i+3]) != key[i+1:i+3] {
+			return "", false
+		}
+		unescaped = append(unescaped, b...)
+		i += 2
+	}
+
+	return string(unescaped), true
+}
+
+// toConsulMeta returns the meta and tags to register on Consul for the
+// provided metadata. Tags are in the key=value form and sorted.
+func toConsulMeta(metadata map[string]string) (map[string]string, []string) {
+	meta, tags := map[string]string{}, []string{}
+	for k, v := range metadata {
+		meta[escapeMetaKey(k)] = v
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+
+	return meta, tags
+}
+
+// fromConsulMeta returns the metadata contained in the provided Consul meta,
+// ignoring the reserved keys.
+func fromConsulMeta(meta map[string]string) map[string]string {
+	metadata := map[string]string{}
+	for k, v := range meta {
+		if key, ok := unescapeMetaKey(k); ok {
+			metadata[key] = v
+		}
+	}
+
+	return metadata
+}
+
+// kvKey returns the key where the object with the provided names is stored.
+func (r *Registry) kvKey(names ...string) string {
+	return path.Join(append([]string{r.prefix}, names...)...)
+}
+
+// getKV decodes the value stored in the provided key into out. An error
+// that satisfies serego's errors.IsNotFound is returned if it does not exist.
+func (r *Registry) getKV(ctx context.Context, key string, out interface{}) error {
+	pair, _, err := r.client.KV().Get(key, r.queryOptions(ctx))
+	if err != nil {
+		return err
+	}
+
+	if pair == nil {
+		return fmt.Errorf("%s: %w", key, serrors.NotFound)
+	}
+
+	if err := json.Unmarshal(pair.Value, out); err != nil {
+		return fmt.Errorf("cannot decode value of %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (r *Registry) putKV(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cannot encode value of %s: %w", key, err)
+	}
+
+	_, err = r.client.KV().Put(&api.KVPair{Key: key, Value: data}, r.writeOptions(ctx))
+	return err
+}
+
+func (r *Registry) deleteKV(ctx context.Context, key string) error {
+	_, err := r.client.KV().Delete(key, r.writeOptions(ctx))
+	return err
+}
+
+// listKV returns the names of the objects stored directly under the provided
+// key, sorted alphabetically.
+func (r *Registry) listKV(ctx context.Context, key string) ([]string, error) {
+	keys, _, err := r.client.KV().Keys(key+"/", "/", r.queryOptions(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, k := range keys {
+		// Keys ending with a slash are folders, i.e. the ones containing
+		// the children of an object.
+		if strings.HasSuffix(k, "/") {
+			continue
+		}
+
+		names = append(names, path.Base(k))
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
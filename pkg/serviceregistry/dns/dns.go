@@ -0,0 +1,333 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+// Package dns implements a service registry on an authoritative DNS server,
+// which is updated with RFC 2136 dynamic updates and follows the DNS-SD
+// conventions of RFC 6763.
+//
+// Each namespace is a subdomain of the zone, listed as a browsing domain of
+// the zone, and each service is a service type of its namespace, i.e.
+// _<service>._tcp.<namespace>.<zone>, and also _<service>._udp if it has
+// endpoints with other protocols than TCP. Endpoints are instances of their
+// service, with SRV records pointing to their hostname or, if their address
+// is an IP, to its A or AAAA record. Metadata of all objects is published as
+// TXT records.
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	"github.com/miekg/dns"
+)
+
+const (
+	// DefaultTTL is the TTL of the records, in seconds, if none is provided.
+	DefaultTTL uint32 = 60
+	// DefaultTSIGAlgorithm is the algorithm used to sign the updates, if
+	// none is provided.
+	DefaultTSIGAlgorithm string = dns.HmacSHA256
+
+	requestTimeout = 30 * time.Second
+	tsigFudge      = 300
+	// maxTXTLength is the maximum length of a string of a TXT record.
+	maxTXTLength = 255
+	// maxServiceNameLength is the maximum length of the name of a service,
+	// which is published with a leading underscore in a label of at most
+	// 63 octets. RFC 6763, section 7.2, recommends 15 characters at most.
+	maxServiceNameLength = 62
+	// protocolMetadataKey is the metadata key of the transport protocol of
+	// an endpoint, e.g. UDP.
+	protocolMetadataKey = "cnwan.io/protocol"
+	// tcpLabel and udpLabel are the labels of the transport protocols of
+	// services: as per RFC 6763, section 7, _tcp is used for TCP and _udp
+	// for all other protocols.
+	tcpLabel = "_tcp"
+	udpLabel = "_udp"
+)
+
+// protocolLabels are the labels of all transport protocols of services.
+var protocolLabels = []string{tcpLabel, udpLabel}
+
+// Config contains the configuration of a DNS service registry.
+type Config struct {
+	// Server is the address of the authoritative DNS server, i.e. host and
+	// port.
+	Server string
+	// Zone where records are published, e.g. example.com.
+	Zone string
+	// TTL of the records, in seconds.
+	TTL uint32
+	// TSIGKeyName and TSIGSecret, if not empty, are the name and the base64
+	// encoded secret of the key used to sign updates with TSIG.
+	TSIGKeyName string
+	TSIGSecret  string
+	// TSIGAlgorithm is the algorithm used to sign updates, e.g. hmac-sha256.
+	TSIGAlgorithm string
+}
+
+// Registry is a service registry on DNS.
+type Registry struct {
+	server        string
+	zone          string
+	ttl           uint32
+	tsigKeyName   string
+	tsigAlgorithm string
+	client        *dns.Client
+}
+
+var _ serviceregistry.Registry = (*Registry)(nil)
+
+// New returns a new Registry that publishes records on the server and zone
+// of the provided configuration.
+func New(cfg Config) (*Registry, error) {
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("no server provided")
+	}
+
+	if _, ok := dns.IsDomainName(cfg.Zone); !ok || cfg.Zone == "" {
+		return nil, fmt.Errorf("invalid zone provided: %s", cfg.Zone)
+	}
+
+	r := &Registry{
+		server: cfg.Server,
+		zone:   dns.CanonicalName(cfg.Zone),
+		ttl:    cfg.TTL,
+		// Updates can be too large for UDP.
+		client: &dns.Client{Net: "tcp", Timeout: requestTimeout},
+	}
+	if r.ttl == 0 {
+		r.ttl = DefaultTTL
+	}
+
+	if cfg.TSIGKeyName != "" {
+		r.tsigKeyName = dns.CanonicalName(cfg.TSIGKeyName)
+		r.tsigAlgorithm = DefaultTSIGAlgorithm
+		if cfg.TSIGAlgorithm != "" {
+			r.tsigAlgorithm = dns.Fqdn(strings.ToLower(cfg.TSIGAlgorithm))
+		}
+		r.client.TsigSecret = map[string]string{r.tsigKeyName: cfg.TSIGSecret}
+	}
+
+	return r, nil
+}
+
+// Namespace returns an operation on the namespace with the provided name.
+func (r *Registry) Namespace(name string) serviceregistry.NamespaceOperation {
+	return &namespaceOperation{registry: r, name: name}
+}
+
+// browsingDomain is where the namespaces of the zone are listed.
+func (r *Registry) browsingDomain() string {
+	return "b._dns-sd._udp." + r.zone
+}
+
+func (r *Registry) namespaceDomain(namespace string) string {
+	return namespace + "." + r.zone
+}
+
+// serviceTypesDomain is where the services of a namespace are listed.
+func (r *Registry) serviceTypesDomain(namespace string) string {
+	return "_services._dns-sd._udp." + r.namespaceDomain(namespace)
+}
+
+// serviceDomain is where the endpoints of a service with the provided
+// protocol label are listed. The metadata of the service are published on
+// the one of TCP.
+func (r *Registry) serviceDomain(namespace, service, protocol string) string {
+	return "_" + service + "." + protocol + "." + r.namespaceDomain(namespace)
+}
+
+// instanceDomain is where the SRV and TXT records of an endpoint are
+// published.
+func (r *Registry) instanceDomain(namespace, service, protocol, endpoint string) string {
+	return endpoint + "." + r.serviceDomain(namespace, service, protocol)
+}
+
+// protocolLabel returns the protocol label of an endpoint with the provided
+// metadata. Endpoints without a protocol are assumed to use TCP.
+func protocolLabel(metadata map[string]string) string {
+	switch strings.ToUpper(metadata[protocolMetadataKey]) {
+	case "", "TCP":
+		return tcpLabel
+	default:
+		return udpLabel
+	}
+}
+
+// hostDomain is where the A or AAAA record of an endpoint is published.
+func (r *Registry) hostDomain(namespace, service, endpoint string) string {
+	return endpoint + "." + service + "." + r.namespaceDomain(namespace)
+}
+
+func (r *Registry) header(name string, rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: r.ttl}
+}
+
+func (r *Registry) ptr(name, target string) *dns.PTR {
+	return &dns.PTR{Hdr: r.header(name, dns.TypePTR), Ptr: target}
+}
+
+// txt returns the TXT record with the provided metadata, as key=value
+// strings sorted by key.
+func (r *Registry) txt(name string, metadata map[string]string) (*dns.TXT, error) {
+	txt := &dns.TXT{Hdr: r.header(name, dns.TypeTXT), Txt: []string{}}
+	for k, v := range metadata {
+		if len(k)+len(v)+1 > maxTXTLength {
+			return nil, fmt.Errorf("metadata %s is too long for a TXT record", k)
+		}
+
+		txt.Txt = append(txt.Txt, k+"="+v)
+	}
+	sort.Strings(txt.Txt)
+
+	if len(txt.Txt) == 0 {
+		// RFC 6763 requires TXT records to contain at least one string.
+		txt.Txt = []string{""}
+	}
+
+	return txt, nil
+}
+
+// fromTXT returns the metadata contained in the provided TXT records.
+func fromTXT(records []dns.RR) map[string]string {
+	metadata := map[string]string{}
+	for _, rr := range records {
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+
+		for _, s := range txt.Txt {
+			if s == "" {
+				continue
+			}
+
+			k, v, _ := strings.Cut(s, "=")
+			metadata[k] = v
+		}
+	}
+
+	return metadata
+}
+
+// addressRecord returns the A or AAAA record of the provided address, or
+// nil if it is not an IP.
+func (r *Registry) addressRecord(name, address string) dns.RR {
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil:
+		return nil
+	case ip.To4() != nil:
+		return &dns.A{Hdr: r.header(name, dns.TypeA), A: ip.To4()}
+	default:
+		return &dns.AAAA{Hdr: r.header(name, dns.TypeAAAA), AAAA: ip}
+	}
+}
+
+// query returns the records of the provided name and type. No records and
+// no error are returned if the name does not exist.
+func (r *Registry) query(ctx context.Context, name string, rrtype uint16) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, rrtype)
+	m.RecursionDesired = false
+
+	resp, _, err := r.client.ExchangeContext(ctx, m, r.server)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.Rcode {
+	case dns.RcodeSuccess:
+	case dns.RcodeNameError:
+		return []dns.RR{}, nil
+	default:
+		return nil, fmt.Errorf("cannot query %s %s: server responded with %s",
+			name, dns.TypeToString[rrtype], dns.RcodeToString[resp.Rcode])
+	}
+
+	records := []dns.RR{}
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == rrtype {
+			records = append(records, rr)
+		}
+	}
+
+	return records, nil
+}
+
+// queryPTR returns the targets of the PTR records of the provided name, with
+// the provided suffix removed and sorted alphabetically.
+func (r *Registry) queryPTR(ctx context.Context, name, suffix string) ([]string, error) {
+	records, err := r.query(ctx, name, dns.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := []string{}
+	for _, rr := range records {
+		target := dns.CanonicalName(rr.(*dns.PTR).Ptr)
+		if strings.HasSuffix(target, suffix) {
+			targets = append(targets, strings.TrimSuffix(target, suffix))
+		}
+	}
+	sort.Strings(targets)
+
+	return targets, nil
+}
+
+// update sends a dynamic update of the zone, filled by the provided
+// function, signing it with TSIG if a key was provided.
+func (r *Registry) update(ctx context.Context, fill func(m *dns.Msg)) error {
+	m := new(dns.Msg)
+	m.SetUpdate(r.zone)
+	fill(m)
+	if r.tsigKeyName != "" {
+		m.SetTsig(r.tsigKeyName, r.tsigAlgorithm, tsigFudge, time.Now().Unix())
+	}
+
+	resp, _, err := r.client.ExchangeContext(ctx, m, r.server)
+	if err != nil {
+		return err
+	}
+
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("cannot update zone %s: server responded with %s",
+			r.zone, dns.RcodeToString[resp.Rcode])
+	}
+
+	return nil
+}
+
+// checkName returns an error if the provided name cannot be used as a
+// label of a domain name.
+func checkName(name string, errEmpty error) error {
+	switch {
+	case name == "":
+		return errEmpty
+	case len(name) > 63 || strings.ContainsAny(name, ". \t\n"):
+		return fmt.Errorf("invalid name %s: it must be a valid domain name label", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,360 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	serego "github.com/CloudNativeSDWAN/serego/api/core"
+	stypes "github.com/CloudNativeSDWAN/serego/api/core/types"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer is an in-process authoritative DNS server that supports the
+// parts of RFC 2136 that are used by the registry.
+type fakeServer struct {
+	lock    sync.Mutex
+	records []dns.RR
+}
+
+func (f *fakeServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	resp := new(dns.Msg)
+	resp.SetReply(r)
+
+	if r.Opcode == dns.OpcodeUpdate {
+		if r.IsTsig() == nil || w.TsigStatus() != nil {
+			resp.Rcode = dns.RcodeNotAuth
+		} else {
+			f.update(r.Ns)
+			resp.SetTsig(r.IsTsig().Hdr.Name, r.IsTsig().Algorithm, 300, int64(r.IsTsig().TimeSigned))
+		}
+		w.WriteMsg(resp)
+		return
+	}
+
+	q := r.Question[0]
+	exists := false
+	for _, rr := range f.records {
+		if !strings.EqualFold(rr.Header().Name, q.Name) {
+			continue
+		}
+
+		exists = true
+		if rr.Header().Rrtype == q.Qtype {
+			resp.Answer = append(resp.Answer, rr)
+		}
+	}
+	if !exists {
+		resp.Rcode = dns.RcodeNameError
+	}
+
+	w.WriteMsg(resp)
+}
+
+func (f *fakeServer) update(updates []dns.RR) {
+	for _, u := range updates {
+		h := u.Header()
+		switch h.Class {
+		case dns.ClassANY:
+			f.remove(func(rr dns.RR) bool {
+				return strings.EqualFold(rr.Header().Name, h.Name) &&
+					(h.Rrtype == dns.TypeANY || rr.Header().Rrtype == h.Rrtype)
+			})
+		case dns.ClassNONE:
+			target := dns.Copy(u)
+			target.Header().Class, target.Header().Ttl = dns.ClassINET, 0
+			f.remove(func(rr dns.RR) bool {
+				rr = dns.Copy(rr)
+				rr.Header().Ttl = 0
+				return dns.IsDuplicate(rr, target)
+			})
+		default:
+			f.remove(func(rr dns.RR) bool {
+				return dns.IsDuplicate(rr, u)
+			})
+			f.records = append(f.records, u)
+		}
+	}
+}
+
+func (f *fakeServer) remove(match func(rr dns.RR) bool) {
+	records := []dns.RR{}
+	for _, rr := range f.records {
+		if !match(rr) {
+			records = append(records, rr)
+		}
+	}
+	f.records = records
+}
+
+// names returns the names of all records, sorted and without duplicates.
+func (f *fakeServer) names() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	names := map[string]bool{}
+	for _, rr := range f.records {
+		names[rr.Header().Name] = true
+	}
+
+	list := []string{}
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+func TestRegistry(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	secret := "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+	fake := &fakeServer{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !a.NoError(err) {
+		a.FailNow("cannot listen")
+	}
+	started := make(chan struct{})
+	server := &dns.Server{
+		Listener:          listener,
+		Handler:           fake,
+		TsigSecret:        map[string]string{"cnwan.": secret},
+		NotifyStartedFunc: func() { close(started) },
+		// The default function rejects updates.
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+	<-started
+
+	r, err := New(Config{
+		Server:      listener.Addr().String(),
+		Zone:        "Example.com",
+		TSIGKeyName: "cnwan",
+		TSIGSecret:  secret,
+	})
+	if !a.NoError(err) {
+		a.FailNow("cannot create registry")
+	}
+
+	nsop := r.Namespace("ns")
+	sop := nsop.Service("serv")
+	epop := sop.Endpoint("serv-80")
+
+	_, err = nsop.Get(ctx)
+	a.True(serrors.IsNotFound(err))
+	a.True(serrors.IsNotFound(sop.Register(ctx)))
+	a.True(serrors.IsNotFound(epop.Register(ctx)))
+
+	a.NoError(nsop.Register(ctx, register.WithMetadata(map[string]string{"cnwan.io/clusters": "c1"})))
+	a.NoError(sop.Register(ctx))
+	a.NoError(epop.Register(ctx,
+		register.WithAddress("10.10.10.10"),
+		register.WithPort(80),
+		register.WithMetadata(map[string]string{"cnwan.io/cluster-id": "c1", "version": "v1"})))
+	a.NoError(sop.Endpoint("serv-443").Register(ctx,
+		register.WithAddress("2001:db8::1"),
+		register.WithPort(443)))
+	// Endpoints with other protocols than TCP are published under _udp and
+	// hostnames are the targets of the SRV records. register.WithAddress
+	// only accepts IPs.
+	hostname := "dns.example.org"
+	a.NoError(sop.Endpoint("serv-53").Register(ctx,
+		func(opts *register.Options) error { opts.Address = &hostname; return nil },
+		register.WithPort(53),
+		register.WithMetadata(map[string]string{"cnwan.io/protocol": "UDP"})))
+
+	a.Equal([]string{
+		"_serv._tcp.ns.example.com.",
+		"_serv._udp.ns.example.com.",
+		"_services._dns-sd._udp.ns.example.com.",
+		"b._dns-sd._udp.example.com.",
+		"ns.example.com.",
+		"serv-443._serv._tcp.ns.example.com.",
+		"serv-443.serv.ns.example.com.",
+		"serv-53._serv._udp.ns.example.com.",
+		"serv-80._serv._tcp.ns.example.com.",
+		"serv-80.serv.ns.example.com.",
+	}, fake.names())
+
+	ns, err := nsop.Get(ctx)
+	a.NoError(err)
+	a.Equal(&stypes.Namespace{Name: "ns", Metadata: map[string]string{"cnwan.io/clusters": "c1"}}, ns)
+
+	serv, err := sop.Get(ctx)
+	a.NoError(err)
+	a.Equal(&stypes.Service{Name: "serv", Namespace: "ns", Metadata: map[string]string{}}, serv)
+
+	ep, err := epop.Get(ctx)
+	a.NoError(err)
+	a.Equal(&stypes.Endpoint{
+		Name:      "serv-80",
+		Service:   "serv",
+		Namespace: "ns",
+		Address:   "10.10.10.10",
+		Port:      80,
+		Metadata:  map[string]string{"cnwan.io/cluster-id": "c1", "version": "v1"},
+	}, ep)
+
+	// Address and port are kept and metadata is replaced.
+	a.NoError(epop.Register(ctx, register.WithReplaceMetadata(),
+		register.WithMetadata(map[string]string{"version": "v2"})))
+	ep, err = epop.Get(ctx)
+	a.NoError(err)
+	a.Equal("10.10.10.10", ep.Address)
+	a.Equal(int32(80), ep.Port)
+	a.Equal(map[string]string{"version": "v2"}, ep.Metadata)
+
+	ep, err = sop.Endpoint("serv-53").Get(ctx)
+	a.NoError(err)
+	a.Equal("dns.example.org", ep.Address)
+	a.Equal(int32(53), ep.Port)
+	srv, err := r.query(ctx, "serv-53._serv._udp.ns.example.com.", dns.TypeSRV)
+	a.NoError(err)
+	a.Len(srv, 1)
+	a.Equal("dns.example.org.", srv[0].(*dns.SRV).Target)
+
+	names := []string{}
+	nsIterator := r.Namespace(serego.Any).List()
+	for {
+		ns, nsop, err := nsIterator.Next(ctx)
+		if err != nil {
+			a.True(serrors.IsIteratorDone(err))
+			break
+		}
+		names = append(names, ns.Name)
+
+		servIterator := nsop.Service(serego.Any).List()
+		for {
+			serv, sop, err := servIterator.Next(ctx)
+			if err != nil {
+				a.True(serrors.IsIteratorDone(err))
+				break
+			}
+			names = append(names, serv.Name)
+
+			epIterator := sop.Endpoint(serego.Any).List()
+			for {
+				ep, _, err := epIterator.Next(ctx)
+				if err != nil {
+					a.True(serrors.IsIteratorDone(err))
+					break
+				}
+				names = append(names, fmt.Sprintf("%s %s:%d", ep.Name, ep.Address, ep.Port))
+			}
+		}
+	}
+	a.Equal([]string{
+		"ns",
+		"serv",
+		"serv-443 2001:db8::1:443",
+		"serv-53 dns.example.org:53",
+		"serv-80 10.10.10.10:80",
+	}, names)
+
+	// The endpoint moves to _tcp and the service is not listed under _udp
+	// anymore.
+	a.NoError(sop.Endpoint("serv-53").Register(ctx, register.WithReplaceMetadata(),
+		register.WithMetadata(map[string]string{"cnwan.io/protocol": "TCP"})))
+	a.Contains(fake.names(), "serv-53._serv._tcp.ns.example.com.")
+	a.NotContains(fake.names(), "serv-53._serv._udp.ns.example.com.")
+	types, err := r.queryPTR(ctx, r.serviceTypesDomain("ns"), ".ns.example.com.")
+	a.NoError(err)
+	a.Equal([]string{"_serv._tcp"}, types)
+	ep, err = sop.Endpoint("serv-53").Get(ctx)
+	a.NoError(err)
+	a.Equal("dns.example.org", ep.Address)
+
+	a.NoError(nsop.Deregister(ctx))
+	_, err = sop.Get(ctx)
+	a.True(serrors.IsNotFound(err))
+	_, err = epop.Get(ctx)
+	a.True(serrors.IsNotFound(err))
+	a.NoError(epop.Deregister(ctx))
+	a.Empty(fake.names())
+
+	a.Error(r.Namespace("ns.other").Register(ctx))
+
+	r.client.TsigSecret = map[string]string{"cnwan.": "d3Jvbmc="}
+	a.Error(nsop.Register(ctx))
+}
+
+func TestCheckNames(t *testing.T) {
+	cases := []struct {
+		id        string
+		namespace string
+		service   string
+		endpoint  string
+		expErr    bool
+	}{
+		{
+			id:        "longest-names",
+			namespace: strings.Repeat("n", 63),
+			service:   strings.Repeat("s", 62),
+			endpoint:  strings.Repeat("e", 63),
+		},
+		{
+			// The service is published as _<service>, which would be 64
+			// octets long.
+			id:        "service-too-long",
+			namespace: "ns",
+			service:   strings.Repeat("s", 63),
+			endpoint:  "ep",
+			expErr:    true,
+		},
+		{
+			id:        "endpoint-too-long",
+			namespace: "ns",
+			service:   "serv",
+			endpoint:  strings.Repeat("e", 64),
+			expErr:    true,
+		},
+		{
+			id:        "invalid-label",
+			namespace: "ns",
+			service:   "serv.other",
+			endpoint:  "ep",
+			expErr:    true,
+		},
+	}
+
+	a := assert.New(t)
+	r := &Registry{zone: "example.com."}
+	for _, currCase := range cases {
+		epop := r.Namespace(currCase.namespace).Service(currCase.service).Endpoint(currCase.endpoint)
+		err := epop.(*endpointOperation).checkNames()
+		if !a.Equal(currCase.expErr, err != nil) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
@@ -0,0 +1,618 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	stypes "github.com/CloudNativeSDWAN/serego/api/core/types"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+	"github.com/miekg/dns"
+)
+
+type namespaceOperation struct {
+	registry *Registry
+	name     string
+}
+
+func (n *namespaceOperation) Get(ctx context.Context) (*stypes.Namespace, error) {
+	if err := checkName(n.name, serrors.EmptyNamespaceName); err != nil {
+		return nil, err
+	}
+
+	records, err := n.registry.query(ctx, n.registry.namespaceDomain(n.name), dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: %s", serrors.NamespaceNotFound, n.name)
+	}
+
+	return &stypes.Namespace{Name: n.name, Metadata: fromTXT(records)}, nil
+}
+
+func (n *namespaceOperation) Register(ctx context.Context, opts ...register.Option) error {
+	curr, err := n.Get(ctx)
+	if err != nil && !serrors.IsNotFound(err) {
+		return err
+	}
+
+	var currMeta map[string]string
+	if curr != nil {
+		currMeta = curr.Metadata
+	}
+
+	_, metadata, err := serviceregistry.PrepareRegister(opts, currMeta, curr != nil,
+		serrors.NamespaceNotFound, serrors.NamespaceAlreadyExists)
+	if err != nil {
+		return err
+	}
+
+	domain := n.registry.namespaceDomain(n.name)
+	txt, err := n.registry.txt(domain, metadata)
+	if err != nil {
+		return err
+	}
+
+	return n.registry.update(ctx, func(m *dns.Msg) {
+		m.RemoveRRset([]dns.RR{txt})
+		m.Insert([]dns.RR{n.registry.ptr(n.registry.browsingDomain(), domain), txt})
+	})
+}
+
+// Deregister removes the namespace, along with all its services and their
+// endpoints.
+func (n *namespaceOperation) Deregister(ctx context.Context) error {
+	if err := checkName(n.name, serrors.EmptyNamespaceName); err != nil {
+		return err
+	}
+
+	services, err := n.listServices(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		if err := n.Service(service).Deregister(ctx); err != nil {
+			return err
+		}
+	}
+
+	domain := n.registry.namespaceDomain(n.name)
+	return n.registry.update(ctx, func(m *dns.Msg) {
+		m.Remove([]dns.RR{n.registry.ptr(n.registry.browsingDomain(), domain)})
+		m.RemoveRRset([]dns.RR{&dns.TXT{Hdr: n.registry.header(domain, dns.TypeTXT)}})
+	})
+}
+
+// listServices returns the names of the services of the namespace.
+func (n *namespaceOperation) listServices(ctx context.Context) ([]string, error) {
+	// All services are published under TCP, even if they only have
+	// endpoints with other protocols.
+	types, err := n.registry.queryPTR(ctx, n.registry.serviceTypesDomain(n.name),
+		"."+tcpLabel+"."+n.registry.namespaceDomain(n.name))
+	if err != nil {
+		return nil, err
+	}
+
+	services := []string{}
+	for _, t := range types {
+		services = append(services, strings.TrimPrefix(t, "_"))
+	}
+
+	return services, nil
+}
+
+func (n *namespaceOperation) List() serviceregistry.NamespaceIterator {
+	return &namespaceIterator{
+		registry: n.registry,
+		lister: serviceregistry.NewLister(func(ctx context.Context) ([]string, error) {
+			if n.name != "" {
+				return []string{n.name}, nil
+			}
+
+			return n.registry.queryPTR(ctx, n.registry.browsingDomain(), "."+n.registry.zone)
+		}),
+	}
+}
+
+func (n *namespaceOperation) Service(name string) serviceregistry.ServiceOperation {
+	return &serviceOperation{namespace: n, name: name}
+}
+
+type namespaceIterator struct {
+	registry *Registry
+	lister   *serviceregistry.Lister[string]
+}
+
+func (i *namespaceIterator) Next(ctx context.Context) (*stypes.Namespace, serviceregistry.NamespaceOperation, error) {
+	for {
+		name, err := i.lister.Next(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		nsop := i.registry.Namespace(name)
+		ns, err := nsop.Get(ctx)
+		switch {
+		case serrors.IsNotFound(err):
+			// It was removed in the meantime.
+			continue
+		case err != nil:
+			return nil, nil, err
+		}
+
+		return ns, nsop, nil
+	}
+}
+
+type serviceOperation struct {
+	namespace *namespaceOperation
+	name      string
+}
+
+func (s *serviceOperation) checkNames() error {
+	if err := checkName(s.namespace.name, serrors.EmptyNamespaceName); err != nil {
+		return err
+	}
+
+	if err := checkName(s.name, serrors.EmptyServiceName); err != nil {
+		return err
+	}
+
+	if len(s.name) > maxServiceNameLength {
+		return fmt.Errorf("invalid service name %s: it must be at most %d characters long", s.name, maxServiceNameLength)
+	}
+
+	return nil
+}
+
+func (s *serviceOperation) domain() string {
+	return s.protocolDomain(tcpLabel)
+}
+
+func (s *serviceOperation) protocolDomain(protocol string) string {
+	return s.namespace.registry.serviceDomain(s.namespace.name, s.name, protocol)
+}
+
+// typePTR returns the record that lists the service with the provided
+// protocol label among the ones of its namespace.
+func (s *serviceOperation) typePTR(protocol string) *dns.PTR {
+	registry := s.namespace.registry
+	return registry.ptr(registry.serviceTypesDomain(s.namespace.name), s.protocolDomain(protocol))
+}
+
+func (s *serviceOperation) Get(ctx context.Context) (*stypes.Service, error) {
+	if err := s.checkNames(); err != nil {
+		return nil, err
+	}
+
+	records, err := s.namespace.registry.query(ctx, s.domain(), dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: %s/%s", serrors.ServiceNotFound, s.namespace.name, s.name)
+	}
+
+	return &stypes.Service{
+		Name:      s.name,
+		Namespace: s.namespace.name,
+		Metadata:  fromTXT(records),
+	}, nil
+}
+
+func (s *serviceOperation) Register(ctx context.Context, opts ...register.Option) error {
+	curr, err := s.Get(ctx)
+	if err != nil && !serrors.IsNotFound(err) {
+		return err
+	}
+
+	var currMeta map[string]string
+	if curr != nil {
+		currMeta = curr.Metadata
+	} else if _, err := s.namespace.Get(ctx); err != nil {
+		return fmt.Errorf("cannot get namespace %s before registering service: %w", s.namespace.name, err)
+	}
+
+	_, metadata, err := serviceregistry.PrepareRegister(opts, currMeta, curr != nil,
+		serrors.ServiceNotFound, serrors.ServiceAlreadyExists)
+	if err != nil {
+		return err
+	}
+
+	registry := s.namespace.registry
+	txt, err := registry.txt(s.domain(), metadata)
+	if err != nil {
+		return err
+	}
+
+	return registry.update(ctx, func(m *dns.Msg) {
+		m.RemoveRRset([]dns.RR{txt})
+		m.Insert([]dns.RR{s.typePTR(tcpLabel), txt})
+	})
+}
+
+// Deregister removes the service, along with all its endpoints.
+func (s *serviceOperation) Deregister(ctx context.Context) error {
+	if err := s.checkNames(); err != nil {
+		return err
+	}
+
+	endpoints, err := s.listEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range endpoints {
+		if err := s.Endpoint(endpoint).Deregister(ctx); err != nil {
+			return err
+		}
+	}
+
+	registry := s.namespace.registry
+	return registry.update(ctx, func(m *dns.Msg) {
+		for _, protocol := range protocolLabels {
+			m.Remove([]dns.RR{s.typePTR(protocol)})
+			m.RemoveName([]dns.RR{&dns.ANY{Hdr: registry.header(s.protocolDomain(protocol), dns.TypeANY)}})
+		}
+	})
+}
+
+// listEndpoints returns the names of the endpoints of the service, with all
+// protocols.
+func (s *serviceOperation) listEndpoints(ctx context.Context) ([]string, error) {
+	endpoints := []string{}
+	for _, protocol := range protocolLabels {
+		domain := s.protocolDomain(protocol)
+		names, err := s.namespace.registry.queryPTR(ctx, domain, "."+domain)
+		if err != nil {
+			return nil, err
+		}
+
+		endpoints = append(endpoints, names...)
+	}
+	sort.Strings(endpoints)
+
+	return endpoints, nil
+}
+
+// removeEmptyProtocol stops listing the service with the provided protocol
+// label among the ones of its namespace if it has no endpoints with it.
+// The service is always listed with TCP, as its metadata is published there.
+func (s *serviceOperation) removeEmptyProtocol(ctx context.Context, protocol string) error {
+	if protocol == tcpLabel {
+		return nil
+	}
+
+	endpoints, err := s.namespace.registry.query(ctx, s.protocolDomain(protocol), dns.TypePTR)
+	if err != nil || len(endpoints) > 0 {
+		return err
+	}
+
+	return s.namespace.registry.update(ctx, func(m *dns.Msg) {
+		m.Remove([]dns.RR{s.typePTR(protocol)})
+	})
+}
+
+func (s *serviceOperation) List() serviceregistry.ServiceIterator {
+	return &serviceIterator{
+		namespace: s.namespace,
+		lister: serviceregistry.NewLister(func(ctx context.Context) ([]string, error) {
+			if err := checkName(s.namespace.name, serrors.EmptyNamespaceName); err != nil {
+				return nil, err
+			}
+
+			if s.name != "" {
+				return []string{s.name}, nil
+			}
+
+			return s.namespace.listServices(ctx)
+		}),
+	}
+}
+
+func (s *serviceOperation) Endpoint(name string) serviceregistry.EndpointOperation {
+	return &endpointOperation{service: s, name: name}
+}
+
+type serviceIterator struct {
+	namespace *namespaceOperation
+	lister    *serviceregistry.Lister[string]
+}
+
+func (i *serviceIterator) Next(ctx context.Context) (*stypes.Service, serviceregistry.ServiceOperation, error) {
+	for {
+		name, err := i.lister.Next(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sop := i.namespace.Service(name)
+		serv, err := sop.Get(ctx)
+		switch {
+		case serrors.IsNotFound(err):
+			// It was removed in the meantime.
+			continue
+		case err != nil:
+			return nil, nil, err
+		}
+
+		return serv, sop, nil
+	}
+}
+
+type endpointOperation struct {
+	service *serviceOperation
+	name    string
+}
+
+func (e *endpointOperation) checkNames() error {
+	if err := e.service.checkNames(); err != nil {
+		return err
+	}
+
+	return checkName(e.name, serrors.EmptyEndpointName)
+}
+
+func (e *endpointOperation) instanceDomain(protocol string) string {
+	return e.service.namespace.registry.instanceDomain(e.service.namespace.name, e.service.name, protocol, e.name)
+}
+
+func (e *endpointOperation) hostDomain() string {
+	return e.service.namespace.registry.hostDomain(e.service.namespace.name, e.service.name, e.name)
+}
+
+// target returns the target of the SRV record of the endpoint: its address
+// if it is an hostname, or the domain of its A or AAAA record otherwise.
+func (e *endpointOperation) target(address string) (string, error) {
+	if address == "" || net.ParseIP(address) != nil {
+		return e.hostDomain(), nil
+	}
+
+	if _, ok := dns.IsDomainName(address); !ok {
+		return "", fmt.Errorf("invalid address %s: it must be an IP or an hostname", address)
+	}
+
+	return dns.CanonicalName(address), nil
+}
+
+// getSRV returns the SRV record of the endpoint and the label of the
+// protocol it is published with, or nil if it does not exist.
+func (e *endpointOperation) getSRV(ctx context.Context) (*dns.SRV, string, error) {
+	for _, protocol := range protocolLabels {
+		records, err := e.service.namespace.registry.query(ctx, e.instanceDomain(protocol), dns.TypeSRV)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if len(records) > 0 {
+			return records[0].(*dns.SRV), protocol, nil
+		}
+	}
+
+	return nil, "", nil
+}
+
+func (e *endpointOperation) Get(ctx context.Context) (*stypes.Endpoint, error) {
+	ep, _, err := e.get(ctx)
+	return ep, err
+}
+
+// get returns the endpoint and the label of the protocol it is published
+// with.
+func (e *endpointOperation) get(ctx context.Context) (*stypes.Endpoint, string, error) {
+	if err := e.checkNames(); err != nil {
+		return nil, "", err
+	}
+
+	srv, protocol, err := e.getSRV(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if srv == nil {
+		return nil, "", fmt.Errorf("%w: %s/%s/%s", serrors.EndpointNotFound,
+			e.service.namespace.name, e.service.name, e.name)
+	}
+
+	registry := e.service.namespace.registry
+	txt, err := registry.query(ctx, e.instanceDomain(protocol), dns.TypeTXT)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ep := &stypes.Endpoint{
+		Name:      e.name,
+		Service:   e.service.name,
+		Namespace: e.service.namespace.name,
+		Port:      int32(srv.Port),
+		Metadata:  fromTXT(txt),
+	}
+
+	if target := dns.CanonicalName(srv.Target); target != e.hostDomain() {
+		ep.Address = strings.TrimSuffix(target, ".")
+		return ep, protocol, nil
+	}
+
+	for _, rrtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		addresses, err := registry.query(ctx, e.hostDomain(), rrtype)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, rr := range addresses {
+			switch addr := rr.(type) {
+			case *dns.A:
+				ep.Address = addr.A.String()
+			case *dns.AAAA:
+				ep.Address = addr.AAAA.String()
+			}
+		}
+	}
+
+	return ep, protocol, nil
+}
+
+func (e *endpointOperation) Register(ctx context.Context, opts ...register.Option) error {
+	curr, currProtocol, err := e.get(ctx)
+	if err != nil && !serrors.IsNotFound(err) {
+		return err
+	}
+
+	var (
+		currMeta map[string]string
+		address  string
+		port     int32
+	)
+	if curr != nil {
+		currMeta, address, port = curr.Metadata, curr.Address, curr.Port
+	} else if _, err := e.service.Get(ctx); err != nil {
+		return fmt.Errorf("cannot get service %s before registering endpoint: %w", e.service.name, err)
+	}
+
+	regOpts, metadata, err := serviceregistry.PrepareRegister(opts, currMeta, curr != nil,
+		serrors.EndpointNotFound, serrors.EndpointAlreadyExists)
+	if err != nil {
+		return err
+	}
+	if regOpts.Address != nil {
+		address = *regOpts.Address
+	}
+	if regOpts.Port != nil {
+		port = *regOpts.Port
+	}
+
+	target, err := e.target(address)
+	if err != nil {
+		return err
+	}
+
+	registry := e.service.namespace.registry
+	protocol := protocolLabel(metadata)
+	txt, err := registry.txt(e.instanceDomain(protocol), metadata)
+	if err != nil {
+		return err
+	}
+
+	srv := &dns.SRV{
+		Hdr:    registry.header(e.instanceDomain(protocol), dns.TypeSRV),
+		Port:   uint16(port),
+		Target: target,
+	}
+	records := []dns.RR{
+		e.service.typePTR(protocol),
+		registry.ptr(e.service.protocolDomain(protocol), e.instanceDomain(protocol)),
+		srv, txt,
+	}
+	if addr := registry.addressRecord(e.hostDomain(), address); addr != nil {
+		records = append(records, addr)
+	}
+
+	err = registry.update(ctx, func(m *dns.Msg) {
+		if curr != nil && currProtocol != protocol {
+			m.Remove([]dns.RR{registry.ptr(e.service.protocolDomain(currProtocol), e.instanceDomain(currProtocol))})
+			m.RemoveName([]dns.RR{&dns.ANY{Hdr: registry.header(e.instanceDomain(currProtocol), dns.TypeANY)}})
+		}
+		m.RemoveRRset([]dns.RR{srv, txt})
+		m.RemoveName([]dns.RR{&dns.ANY{Hdr: registry.header(e.hostDomain(), dns.TypeANY)}})
+		m.Insert(records)
+	})
+	if err != nil || curr == nil || currProtocol == protocol {
+		return err
+	}
+
+	return e.service.removeEmptyProtocol(ctx, currProtocol)
+}
+
+func (e *endpointOperation) Deregister(ctx context.Context) error {
+	_, protocol, err := e.get(ctx)
+	if err != nil {
+		if serrors.IsNotFound(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	registry := e.service.namespace.registry
+	err = registry.update(ctx, func(m *dns.Msg) {
+		m.Remove([]dns.RR{registry.ptr(e.service.protocolDomain(protocol), e.instanceDomain(protocol))})
+		m.RemoveName([]dns.RR{
+			&dns.ANY{Hdr: registry.header(e.instanceDomain(protocol), dns.TypeANY)},
+			&dns.ANY{Hdr: registry.header(e.hostDomain(), dns.TypeANY)},
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return e.service.removeEmptyProtocol(ctx, protocol)
+}
+
+func (e *endpointOperation) List() serviceregistry.EndpointIterator {
+	return &endpointIterator{
+		service: e.service,
+		lister: serviceregistry.NewLister(func(ctx context.Context) ([]string, error) {
+			if err := e.service.checkNames(); err != nil {
+				return nil, err
+			}
+
+			if e.name != "" {
+				return []string{e.name}, nil
+			}
+
+			return e.service.listEndpoints(ctx)
+		}),
+	}
+}
+
+type endpointIterator struct {
+	service *serviceOperation
+	lister  *serviceregistry.Lister[string]
+}
+
+func (i *endpointIterator) Next(ctx context.Context) (*stypes.Endpoint, serviceregistry.EndpointOperation, error) {
+	for {
+		name, err := i.lister.Next(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		epop := i.service.Endpoint(name)
+		ep, err := epop.Get(ctx)
+		switch {
+		case serrors.IsNotFound(err):
+			// It was removed in the meantime.
+			continue
+		case err != nil:
+			return nil, nil, err
+		}
+
+		return ep, epop, nil
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package serviceregistry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	stypes "github.com/CloudNativeSDWAN/serego/api/core/types"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+	"github.com/rs/zerolog"
+)
+
+// dryRunOutputLock serializes the writes of all dry-run registries, as they
+// may share the same output.
+var dryRunOutputLock sync.Mutex
+
+// dryRunOperation is an operation that a dry-run registry reports instead of
+// performing it.
+type dryRunOperation struct {
+	Time      time.Time         `json:"time"`
+	Registry  string            `json:"registry"`
+	Operation string            `json:"operation"`
+	Kind      string            `json:"kind"`
+	Path      string            `json:"path"`
+	Address   string            `json:"address,omitempty"`
+	Port      int32             `json:"port,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// NewDryRunRegistry returns a Registry that reads objects from the provided
+// one but never registers or deregisters them: it logs the operations that
+// would be performed instead, including the metadata that objects would
+// have after being registered, and writes them to out as JSON lines unless
+// it is nil.
+//
+// The name is included in all operations, so that multiple registries can
+// share the same output.
+func NewDryRunRegistry(registry Registry, name string, out io.Writer, log zerolog.Logger) Registry {
+	return &dryRunRegistry{
+		registry: registry,
+		name:     name,
+		out:      out,
+		log:      log.With().Str("registry", name).Bool("dry-run", true).Logger(),
+	}
+}
+
+type dryRunRegistry struct {
+	registry Registry
+	name     string
+	out      io.Writer
+	log      zerolog.Logger
+}
+
+func (d *dryRunRegistry) Namespace(name string) NamespaceOperation {
+	return &dryRunNamespace{d.registry.Namespace(name), d, name}
+}
+
+func (d *dryRunRegistry) report(op *dryRunOperation) error {
+	op.Time, op.Registry = time.Now(), d.name
+
+	l := d.log.Info().Str("operation", op.Operation).Str("kind", op.Kind).Str("path", op.Path)
+	if op.Kind == kindEndpoint && op.Operation == opRegister {
+		l = l.Str("address", op.Address).Int32("port", op.Port)
+	}
+	if op.Operation == opRegister {
+		l = l.Interface("metadata", op.Metadata)
+	}
+	l.Msg("dry run: operation not performed")
+
+	if d.out == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+
+	dryRunOutputLock.Lock()
+	defer dryRunOutputLock.Unlock()
+	_, err = d.out.Write(append(line, '\n'))
+	return err
+}
+
+type dryRunNamespace struct {
+	NamespaceOperation
+	registry *dryRunRegistry
+	name     string
+}
+
+func (n *dryRunNamespace) Register(ctx context.Context, opts ...register.Option) error {
+	ns, err := n.NamespaceOperation.Get(ctx)
+	if err != nil && !serrors.IsNotFound(err) {
+		return err
+	}
+
+	exists := err == nil
+	var currMeta map[string]string
+	if exists {
+		currMeta = ns.Metadata
+	}
+
+	_, metadata, err := PrepareRegister(opts, currMeta, exists,
+		serrors.NamespaceNotFound, serrors.NamespaceAlreadyExists)
+	if err != nil {
+		return err
+	}
+
+	return n.registry.report(&dryRunOperation{
+		Operation: opRegister,
+		Kind:      kindNamespace,
+		Path:      n.name,
+		Metadata:  metadata,
+	})
+}
+
+func (n *dryRunNamespace) Deregister(_ context.Context) error {
+	return n.registry.report(&dryRunOperation{
+		Operation: opDeregister,
+		Kind:      kindNamespace,
+		Path:      n.name,
+	})
+}
+
+func (n *dryRunNamespace) List() NamespaceIterator {
+	return &dryRunNamespaceIterator{n.NamespaceOperation.List(), n.registry}
+}
+
+func (n *dryRunNamespace) Service(name string) ServiceOperation {
+	return &dryRunService{n.NamespaceOperation.Service(name), n.registry, n.name, name}
+}
+
+type dryRunNamespaceIterator struct {
+	NamespaceIterator
+	registry *dryRunRegistry
+}
+
+func (i *dryRunNamespaceIterator) Next(ctx context.Context) (*stypes.Namespace, NamespaceOperation, error) {
+	ns, nsop, err := i.NamespaceIterator.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ns, &dryRunNamespace{nsop, i.registry, ns.Name}, nil
+}
+
+type dryRunService struct {
+	ServiceOperation
+	registry  *dryRunRegistry
+	namespace string
+	name      string
+}
+
+func (s *dryRunService) Register(ctx context.Context, opts ...register.Option) error {
+	serv, err := s.ServiceOperation.Get(ctx)
+	if err != nil && !serrors.IsNotFound(err) {
+		return err
+	}
+
+	exists := err == nil
+	var currMeta map[string]string
+	if exists {
+		currMeta = serv.Metadata
+	}
+
+	_, metadata, err := PrepareRegister(opts, currMeta, exists,
+		serrors.ServiceNotFound, serrors.ServiceAlreadyExists)
+	if err != nil {
+		return err
+	}
+
+	return s.registry.report(&dryRunOperation{
+		Operation: opRegister,
+		Kind:      kindService,
+		Path:      path.Join(s.namespace, s.name),
+		Metadata:  metadata,
+	})
+}
+
+func (s *dryRunService) Deregister(_ context.Context) error {
+	return s.registry.report(&dryRunOperation{
+		Operation: opDeregister,
+		Kind:      kindService,
+		Path:      path.Join(s.namespace, s.name),
+	})
+}
+
+func (s *dryRunService) List() ServiceIterator {
+	return &dryRunServiceIterator{s.ServiceOperation.List(), s.registry, s.namespace}
+}
+
+func (s *dryRunService) Endpoint(name string) EndpointOperation {
+	return &dryRunEndpoint{s.ServiceOperation.Endpoint(name), s.registry, s.namespace, s.name, name}
+}
+
+type dryRunServiceIterator struct {
+	ServiceIterator
+	registry  *dryRunRegistry
+	namespace string
+}
+
+func (i *dryRunServiceIterator) Next(ctx context.Context) (*stypes.Service, ServiceOperation, error) {
+	serv, sop, err := i.ServiceIterator.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return serv, &dryRunService{sop, i.registry, i.namespace, serv.Name}, nil
+}
+
+type dryRunEndpoint struct {
+	EndpointOperation
+	registry  *dryRunRegistry
+	namespace string
+	service   string
+	name      string
+}
+
+func (e *dryRunEndpoint) Register(ctx context.Context, opts ...register.Option) error {
+	ep, err := e.EndpointOperation.Get(ctx)
+	if err != nil && !serrors.IsNotFound(err) {
+		return err
+	}
+
+	exists := err == nil
+	curr := &stypes.Endpoint{}
+	if exists {
+		curr = ep
+	}
+
+	regOpts, metadata, err := PrepareRegister(opts, curr.Metadata, exists,
+		serrors.EndpointNotFound, serrors.EndpointAlreadyExists)
+	if err != nil {
+		return err
+	}
+
+	op := &dryRunOperation{
+		Operation: opRegister,
+		Kind:      kindEndpoint,
+		Path:      path.Join(e.namespace, e.service, e.name),
+		Address:   curr.Address,
+		Port:      curr.Port,
+		Metadata:  metadata,
+	}
+	if regOpts.Address != nil {
+		op.Address = *regOpts.Address
+	}
+	if regOpts.Port != nil {
+		op.Port = *regOpts.Port
+	}
+
+	return e.registry.report(op)
+}
+
+func (e *dryRunEndpoint) Deregister(_ context.Context) error {
+	return e.registry.report(&dryRunOperation{
+		Operation: opDeregister,
+		Kind:      kindEndpoint,
+		Path:      path.Join(e.namespace, e.service, e.name),
+	})
+}
+
+func (e *dryRunEndpoint) List() EndpointIterator {
+	return &dryRunEndpointIterator{e.EndpointOperation.List(), e.registry, e.namespace, e.service}
+}
+
+type dryRunEndpointIterator struct {
+	EndpointIterator
+	registry  *dryRunRegistry
+	namespace string
+	service   string
+}
+
+func (i *dryRunEndpointIterator) Next(ctx context.Context) (*stypes.Endpoint, EndpointOperation, error) {
+	ep, epop, err := i.EndpointIterator.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ep, &dryRunEndpoint{epop, i.registry, i.namespace, i.service, ep.Name}, nil
+}
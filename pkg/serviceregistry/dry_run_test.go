@@ -0,0 +1,247 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package serviceregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	stypes "github.com/CloudNativeSDWAN/serego/api/core/types"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+var errWritten = errors.New("the registry was written")
+
+// readOnlyRegistry only contains an endpoint, ns/serv/ep, along with its
+// parents, and fails all writes.
+type readOnlyRegistry struct {
+	name, service, endpoint string
+}
+
+func (r *readOnlyRegistry) Namespace(name string) NamespaceOperation {
+	return &readOnlyRegistry{name: name}
+}
+
+func (r *readOnlyRegistry) Get(_ context.Context) (*stypes.Namespace, error) {
+	if r.name != "ns" {
+		return nil, serrors.NamespaceNotFound
+	}
+
+	return &stypes.Namespace{Name: r.name, Metadata: map[string]string{"owner": "cnwan-operator"}}, nil
+}
+
+func (r *readOnlyRegistry) Register(_ context.Context, _ ...register.Option) error {
+	return errWritten
+}
+
+func (r *readOnlyRegistry) Deregister(_ context.Context) error {
+	return errWritten
+}
+
+func (r *readOnlyRegistry) List() NamespaceIterator {
+	return nil
+}
+
+func (r *readOnlyRegistry) Service(name string) ServiceOperation {
+	return &readOnlyService{r.name, name}
+}
+
+type readOnlyService struct {
+	namespace, name string
+}
+
+func (s *readOnlyService) Get(_ context.Context) (*stypes.Service, error) {
+	if s.namespace != "ns" || s.name != "serv" {
+		return nil, serrors.ServiceNotFound
+	}
+
+	return &stypes.Service{Namespace: s.namespace, Name: s.name}, nil
+}
+
+func (s *readOnlyService) Register(_ context.Context, _ ...register.Option) error {
+	return errWritten
+}
+
+func (s *readOnlyService) Deregister(_ context.Context) error {
+	return errWritten
+}
+
+func (s *readOnlyService) List() ServiceIterator {
+	return nil
+}
+
+func (s *readOnlyService) Endpoint(name string) EndpointOperation {
+	return &readOnlyEndpoint{s.namespace, s.name, name}
+}
+
+type readOnlyEndpoint struct {
+	namespace, service, name string
+}
+
+func (e *readOnlyEndpoint) Get(_ context.Context) (*stypes.Endpoint, error) {
+	if e.namespace != "ns" || e.service != "serv" || e.name != "ep" {
+		return nil, serrors.EndpointNotFound
+	}
+
+	return &stypes.Endpoint{
+		Namespace: e.namespace,
+		Service:   e.service,
+		Name:      e.name,
+		Address:   "10.10.10.10",
+		Port:      80,
+		Metadata:  map[string]string{"version": "v1"},
+	}, nil
+}
+
+func (e *readOnlyEndpoint) Register(_ context.Context, _ ...register.Option) error {
+	return errWritten
+}
+
+func (e *readOnlyEndpoint) Deregister(_ context.Context) error {
+	return errWritten
+}
+
+func (e *readOnlyEndpoint) List() EndpointIterator {
+	return nil
+}
+
+func TestDryRunRegistry(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		id     string
+		op     func(Registry) error
+		expOp  *dryRunOperation
+		expErr error
+	}{
+		{
+			id: "register-existing-namespace",
+			op: func(r Registry) error {
+				return r.Namespace("ns").Register(ctx, register.WithMetadataKeyValue("cnwan.io/clusters", "c1"))
+			},
+			expOp: &dryRunOperation{
+				Operation: opRegister,
+				Kind:      kindNamespace,
+				Path:      "ns",
+				Metadata:  map[string]string{"owner": "cnwan-operator", "cnwan.io/clusters": "c1"},
+			},
+		},
+		{
+			id: "create-existing-namespace",
+			op: func(r Registry) error {
+				return r.Namespace("ns").Register(ctx, register.WithCreateMode())
+			},
+			expErr: serrors.NamespaceAlreadyExists,
+		},
+		{
+			id: "register-new-service",
+			op: func(r Registry) error {
+				return r.Namespace("ns").Service("new").Register(ctx, register.WithMetadataKeyValue("owner", "cnwan-operator"))
+			},
+			expOp: &dryRunOperation{
+				Operation: opRegister,
+				Kind:      kindService,
+				Path:      "ns/new",
+				Metadata:  map[string]string{"owner": "cnwan-operator"},
+			},
+		},
+		{
+			id: "update-existing-endpoint",
+			op: func(r Registry) error {
+				return r.Namespace("ns").Service("serv").Endpoint("ep").Register(ctx,
+					register.WithPort(8080), register.WithMetadataKeyValue("cnwan.io/cluster-id", "c1"))
+			},
+			expOp: &dryRunOperation{
+				Operation: opRegister,
+				Kind:      kindEndpoint,
+				Path:      "ns/serv/ep",
+				Address:   "10.10.10.10",
+				Port:      8080,
+				Metadata:  map[string]string{"version": "v1", "cnwan.io/cluster-id": "c1"},
+			},
+		},
+		{
+			id: "replace-new-endpoint",
+			op: func(r Registry) error {
+				return r.Namespace("ns").Service("serv").Endpoint("ep-2").Register(ctx,
+					register.WithAddress("10.10.10.11"), register.WithPort(80), register.WithReplaceMetadata())
+			},
+			expOp: &dryRunOperation{
+				Operation: opRegister,
+				Kind:      kindEndpoint,
+				Path:      "ns/serv/ep-2",
+				Address:   "10.10.10.11",
+				Port:      80,
+			},
+		},
+		{
+			id: "deregister-endpoint",
+			op: func(r Registry) error {
+				return r.Namespace("ns").Service("serv").Endpoint("ep").Deregister(ctx)
+			},
+			expOp: &dryRunOperation{Operation: opDeregister, Kind: kindEndpoint, Path: "ns/serv/ep"},
+		},
+		{
+			id: "deregister-namespace",
+			op: func(r Registry) error {
+				return r.Namespace("ns").Deregister(ctx)
+			},
+			expOp: &dryRunOperation{Operation: opDeregister, Kind: kindNamespace, Path: "ns"},
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		out := &bytes.Buffer{}
+		r := NewDryRunRegistry(&readOnlyRegistry{}, "etcd", out, zerolog.Nop())
+
+		err := currCase.op(r)
+		if !a.ErrorIs(err, currCase.expErr) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+
+		if currCase.expOp == nil {
+			if !a.Empty(out.String()) {
+				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+			}
+			continue
+		}
+
+		if !a.Equal(1, strings.Count(out.String(), "\n")) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+
+		op := &dryRunOperation{}
+		if !a.NoError(json.Unmarshal(out.Bytes(), op)) || !a.False(op.Time.IsZero()) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+
+		currCase.expOp.Registry, currCase.expOp.Time = "etcd", op.Time
+		if !a.Equal(currCase.expOp, op) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
@@ -20,10 +20,13 @@ package serviceregistry
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	serego "github.com/CloudNativeSDWAN/serego/api/core"
+	stypes "github.com/CloudNativeSDWAN/serego/api/core/types"
 	"github.com/rs/zerolog"
 )
 
@@ -33,32 +36,172 @@ const (
 	EventCreate EventType = "create"
 	EventUpdate EventType = "update"
 	EventDelete EventType = "delete"
+	// EventSync asks the namespace worker to bring a service on the service
+	// registry to the state described by a ServiceState object.
+	EventSync EventType = "sync"
 )
 
 const (
 	maximumIdleDuration = 5 * time.Minute
+	// drainTimeout is the maximum time that the event handler is given to
+	// dispatch and process the events that are still queued after being
+	// stopped.
+	drainTimeout = 15 * time.Second
+	// registryQueueLength is the number of events that can be waiting to be
+	// dispatched to the namespace workers of a service registry before new
+	// ones are rejected.
+	registryQueueLength = 100
+	// retryBaseDelay and retryMaxDelay are the delays before an event that
+	// a service registry failed to process is sent to it again, for the
+	// first time and at most, respectively.
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 5 * time.Minute
 )
 
 type Event struct {
 	EventType
 	Object interface{}
+	// Result, if not nil, receives nil once the event has been accepted by
+	// all service registries, or an error if it cannot be processed at all.
+	// It must be buffered, as the event handler will not wait for anyone to
+	// read from it.
+	//
+	// Each service registry retries the events that it fails to process on
+	// its own, so the outcome of the operations is never reported here.
+	Result chan error
+
+	// attempts is the number of times that a service registry failed to
+	// process the event.
+	attempts int
+}
+
+// ServiceState is the desired state of a service on the service registry.
+//
+// An empty list of endpoints means that the service should not be on the
+// service registry at all, and will therefore be removed along with all the
+// endpoints that the operator registered for it.
+type ServiceState struct {
+	Namespace string
+	Name      string
+	Endpoints []*stypes.Endpoint
+	// NamespaceMetadata and ServiceMetadata are the metadata to register on
+	// the namespace and the service, in place of the one previously
+	// registered there by the operator.
+	NamespaceMetadata map[string]string
+	ServiceMetadata   map[string]string
+	// Kind is the kind of the Kubernetes object that the service is
+	// registered for, e.g. Ingress, and is empty for Kubernetes services. A
+	// service registered for an object of a different kind is never synced
+	// with this state, as it belongs to another object with a colliding
+	// name.
+	Kind string
 }
 
 type EventHandler struct {
-	seregoClient   *serego.ServiceRegistry
-	workers        map[string]*namespaceWorkerData
-	waitGroup      sync.WaitGroup
+	registries []*registryHandler
+	eventsChan chan *Event
+	// lock protects eventsChan, which is only modified by the dispatcher but
+	// is read when collecting metrics.
+	lock      sync.RWMutex
+	waitGroup sync.WaitGroup
+
+	// running and heartbeat are used to tell whether the dispatcher is
+	// running and still making progress.
+	running   atomic.Bool
+	heartbeat atomic.Int64
+
+	log zerolog.Logger
+}
+
+// registryHandler dispatches events to the namespace workers of a single
+// service registry, so that a service registry that is slow or cannot be
+// reached does not delay the others.
+type registryHandler struct {
+	name       string
+	registry   Registry
+	workers    map[string]*namespaceWorkerData
+	eventsChan chan *Event
+	// stopping contains the workers that were stopped because idle and may
+	// still be processing their last events, so that a new worker for the
+	// same namespace does not start before they exit.
+	stopping map[string]*namespaceWorkerData
+	// lock protects workers and stopping, which are only modified by the
+	// dispatcher of the registry but are read when collecting metrics.
+	lock      sync.RWMutex
+	waitGroup sync.WaitGroup
+
+	// pending contains the latest event of each object whose events did
+	// not fit in the queue, in the order in which they were first left out.
+	// They are queued again, before any newer event, as soon as there is
+	// room, so that the service registry eventually converges with the
+	// others even if it fell behind.
+	pending     map[string]*Event
+	pendingKeys []string
+	// latest contains the latest event accepted for each object that has
+	// not been processed successfully yet, so that an event that failed is
+	// only sent again if no newer one for the same object was accepted in
+	// the meantime.
+	latest map[string]*Event
+	// absent contains the services that the operator has nothing registered
+	// for, so that syncing them with no endpoints -- e.g. services that are
+	// not eligible for registration -- does not need any operation at all.
+	absent map[string]bool
+	// pendingLock protects pending, pendingKeys, latest and absent.
+	pendingLock sync.Mutex
+
+	registryCheckLock    sync.Mutex
+	lastRegistryCheck    time.Time
+	lastRegistryCheckErr error
+
 	log            zerolog.Logger
+	clusterID      string
 	persistentMeta map[string]string
+	endpointMeta   map[string]string
 }
 
-func NewEventHandler(seregoClient *serego.ServiceRegistry, persistentMeta map[string]string, log zerolog.Logger) *EventHandler {
+// NewEventHandler returns a new EventHandler that registers objects on all
+// the provided service registries, which are identified by their names.
+//
+// The cluster ID is used to tell apart objects registered by operators
+// running in different clusters that share the same service registry, and
+// persistentMeta is registered on all objects.
+func NewEventHandler(registries map[string]Registry, clusterID string, persistentMeta map[string]string, log zerolog.Logger) *EventHandler {
+	endpointMeta := map[string]string{}
+	for k, v := range persistentMeta {
+		endpointMeta[k] = v
+	}
+	if clusterID != "" {
+		endpointMeta[clusterIDKey] = clusterID
+	}
+
+	names := make([]string, 0, len(registries))
+	for name := range registries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	handlers := make([]*registryHandler, 0, len(names))
+	for _, name := range names {
+		handlers = append(handlers, &registryHandler{
+			name:           name,
+			registry:       registries[name],
+			workers:        map[string]*namespaceWorkerData{},
+			stopping:       map[string]*namespaceWorkerData{},
+			eventsChan:     make(chan *Event, registryQueueLength),
+			pending:        map[string]*Event{},
+			latest:         map[string]*Event{},
+			absent:         map[string]bool{},
+			log:            log.With().Str("registry", name).Logger(),
+			clusterID:      clusterID,
+			persistentMeta: persistentMeta,
+			endpointMeta:   endpointMeta,
+		})
+	}
+
 	return &EventHandler{
-		seregoClient:   seregoClient,
-		workers:        map[string]*namespaceWorkerData{},
-		waitGroup:      sync.WaitGroup{},
-		log:            log,
-		persistentMeta: persistentMeta,
+		registries: handlers,
+		waitGroup:  sync.WaitGroup{},
+		log:        log,
 	}
 }
 
@@ -66,70 +209,360 @@ func (e *EventHandler) WatchForEvents(mainCtx context.Context, eventsChannel cha
 	l := e.log.With().Logger()
 	l.Info().Msg("watching for events from the cluster...")
 
-	cleanUpTicker := time.NewTicker(time.Minute)
+	e.lock.Lock()
+	e.eventsChan = eventsChannel
+	e.lock.Unlock()
+
+	e.heartbeat.Store(time.Now().UnixNano())
+	e.running.Store(true)
+	defer e.running.Store(false)
+
+	// The service registries are stopped only after they have received all
+	// the events that were sent before the cancel.
+	stopCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	for _, reg := range e.registries {
+		reg := reg
+		e.waitGroup.Add(1)
+		go func() {
+			defer e.waitGroup.Done()
+			reg.dispatchEvents(mainCtx, stopCtx)
+		}()
+	}
+
+	heartbeatTicker := time.NewTicker(heartbeatInterval)
+	defer heartbeatTicker.Stop()
+
 	for {
+		e.heartbeat.Store(time.Now().UnixNano())
+
 		select {
+		case <-heartbeatTicker.C:
 
 		case <-mainCtx.Done():
 			l := e.log.With().Str("from", "event handler").Logger()
 			l.Info().Msg("cancel requested")
-			if len(e.workers) == 0 {
-				return nil
-			}
-
-			l.Info().Msg("propagating cancel to all namespace workers...")
 
-			for _, nsWorker := range e.workers {
-				nsWorker.canc()
-			}
+			l.Debug().Msg("sending remaining events to all service registries...")
+			e.drainEvents(eventsChannel)
+			stop()
 
-			l.Debug().Msg("waiting for all namespace workers to finish...")
+			l.Debug().Msg("waiting for all service registries to finish...")
 			e.waitGroup.Wait()
 			l.Info().Msg("all namespace workers exited: goodbye!")
 			return nil
 
 		case event := <-eventsChannel:
-			l := e.log.With().Str("from", "event-dispatcher").Logger()
-			namespaceName := getNamespaceNameFromEventObject(event)
+			e.dispatch(event)
+		}
+	}
+}
 
-			if namespaceName == "" {
-				l.Warn().Msg("could not find namespace name: skipping...")
-				continue
-			}
+// drainEvents sends to the service registries all the events that are still
+// waiting to be dispatched.
+func (e *EventHandler) drainEvents(eventsChannel chan *Event) {
+	for {
+		select {
+		case event := <-eventsChannel:
+			e.dispatch(event)
+		default:
+			return
+		}
+	}
+}
 
-			nsWorker := e.getOrCreateNamespaceWorker(mainCtx, namespaceName)
+func (e *EventHandler) dispatch(event *Event) {
+	l := e.log.With().Str("from", "event-dispatcher").Logger()
+	namespaceName := getNamespaceNameFromEventObject(event)
 
-			l.Info().Msg("dispatching event to namespace worker...")
+	if namespaceName == "" {
+		l.Warn().Msg("could not find namespace name: skipping...")
+		if event.Result != nil {
+			event.Result <- fmt.Errorf("could not find namespace name in event")
+		}
+		return
+	}
 
-			nsWorker.worker.eventsChan <- event
-			nsWorker.lastEvent = time.Now()
+	e.fanOut(event)
+}
+
+// fanOut sends a copy of the event to each service registry without waiting
+// for them to process it and, if the event has a Result channel, sends nil
+// there right away.
+//
+// A service registry that has too many pending events receives the event as
+// soon as it catches up, and one that fails to process it tries again later
+// on its own: this way, a service registry that is slow or cannot be reached
+// never holds back the others, nor whoever sent the event.
+func (e *EventHandler) fanOut(event *Event) {
+	for _, reg := range e.registries {
+		regEvent := &Event{EventType: event.EventType, Object: event.Object}
+		if !reg.enqueue(regEvent) {
+			reg.log.Warn().Str("from", "event-dispatcher").
+				Msg("too many pending events: event will be sent again later")
+		}
+	}
+
+	if event.Result != nil {
+		event.Result <- nil
+	}
+}
+
+// enqueue sends the event to the queue of the service registry and returns
+// true, unless the queue is full or older events are still waiting for room:
+// in this case, the event replaces any other one pending for the same object
+// and will be queued later.
+//
+// Syncs with no endpoints of services that are known to be absent from the
+// service registry are accepted but never queued.
+func (r *registryHandler) enqueue(event *Event) bool {
+	r.pendingLock.Lock()
+	defer r.pendingLock.Unlock()
+
+	key := getEventObjectKey(event)
+	if !isEmptySync(event) {
+		delete(r.absent, key)
+	} else if r.absent[key] {
+		return true
+	}
+	r.latest[key] = event
+
+	if r.flushPendingLocked() {
+		select {
+		case r.eventsChan <- event:
+			return true
+		default:
+		}
+	}
+
+	r.addPendingLocked(key, event)
+	return false
+}
+
+// addPendingLocked adds the event to the pending ones, in place of any
+// other one pending for the same object. It must be called with the pending
+// lock held.
+func (r *registryHandler) addPendingLocked(key string, event *Event) {
+	if _, exists := r.pending[key]; !exists {
+		r.pendingKeys = append(r.pendingKeys, key)
+	}
+	r.pending[key] = event
+}
+
+// processed is called once a namespace worker has processed an event: if
+// it failed, the event is sent again after a delay that grows with each
+// attempt, unless a newer event for the same object is accepted in the
+// meantime.
+func (r *registryHandler) processed(mainCtx context.Context, event *Event, err error) {
+	key := getEventObjectKey(event)
+
+	r.pendingLock.Lock()
+	defer r.pendingLock.Unlock()
+
+	if r.latest[key] != event {
+		// The newer event will bring the object to its desired state.
+		return
+	}
+
+	if err == nil {
+		delete(r.latest, key)
+		if isEmptySync(event) {
+			r.absent[key] = true
+		}
+		return
+	}
+
+	delay := getRetryDelay(event.attempts)
+	event.attempts++
+	r.log.Err(err).Str("object", key).Str("retry-in", delay.String()).
+		Msg("could not process event: it will be sent again later")
+
+	time.AfterFunc(delay, func() {
+		if mainCtx.Err() != nil {
+			return
+		}
+
+		r.pendingLock.Lock()
+		defer r.pendingLock.Unlock()
+
+		if r.latest[key] == event {
+			r.addPendingLocked(key, event)
+			r.flushPendingLocked()
+		}
+	})
+}
+
+// getRetryDelay returns how long to wait before sending again an event that
+// failed the provided number of times already.
+func getRetryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 0; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > retryMaxDelay {
+		return retryMaxDelay
+	}
+
+	return delay
+}
+
+// flushPending queues as many pending events as there is room for.
+func (r *registryHandler) flushPending() {
+	r.pendingLock.Lock()
+	defer r.pendingLock.Unlock()
+
+	r.flushPendingLocked()
+}
+
+// flushPendingLocked queues as many pending events as there is room for and
+// returns true if none is left. It must be called with the pending lock
+// held.
+func (r *registryHandler) flushPendingLocked() bool {
+	for len(r.pendingKeys) > 0 {
+		key := r.pendingKeys[0]
+		select {
+		case r.eventsChan <- r.pending[key]:
+			delete(r.pending, key)
+			r.pendingKeys = r.pendingKeys[1:]
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// dispatchEvents sends the events of the service registry to the workers of
+// their namespaces until stopCtx is canceled, and then the ones that are
+// still queued or pending as well, unless it takes more than drainTimeout
+// since mainCtx was canceled.
+func (r *registryHandler) dispatchEvents(mainCtx, stopCtx context.Context) {
+	// Operations are performed with a context that is not canceled as soon
+	// as the workers are stopped, so that the events that are still queued
+	// can be processed, e.g. before another replica of the operator takes
+	// over. If they take too long, they are canceled anyway.
+	opsCtx, opsCanc := context.WithCancel(context.Background())
+	defer opsCanc()
+	go func() {
+		select {
+		case <-mainCtx.Done():
+			time.AfterFunc(drainTimeout, opsCanc)
+		case <-opsCtx.Done():
+		}
+	}()
+
+	cleanUpTicker := time.NewTicker(time.Minute)
+	defer cleanUpTicker.Stop()
+
+	for {
+		select {
+		case <-stopCtx.Done():
+			r.stop(mainCtx, opsCtx)
+			return
+
+		case event := <-r.eventsChan:
+			r.dispatch(mainCtx, opsCtx, event)
+
+			// There is room in the queue again.
+			r.flushPending()
 
 		case <-cleanUpTicker.C:
-			l := e.log.With().Str("from", "worker-manager").Logger()
+			r.removeIdleWorkers()
+		}
+	}
+}
 
-			now := time.Now()
-			toRemove := []string{}
+// dispatch sends the event to the worker of its namespace, and returns false
+// if it could not be sent before opsCtx was canceled.
+func (r *registryHandler) dispatch(mainCtx, opsCtx context.Context, event *Event) bool {
+	l := r.log.With().Str("from", "event-dispatcher").Logger()
+	nsWorker := r.getOrCreateNamespaceWorker(mainCtx, opsCtx, getNamespaceNameFromEventObject(event))
+
+	l.Info().Msg("dispatching event to namespace worker...")
+
+	select {
+	case nsWorker.worker.eventsChan <- event:
+		nsWorker.lastEvent = time.Now()
+		return true
+	case <-opsCtx.Done():
+		return false
+	}
+}
 
-			for name, worker := range e.workers {
-				if now.Sub(worker.lastEvent) > maximumIdleDuration {
-					l.Info().Str("namespace", name).
-						Msg("worker exceeded maximum idle time: signaling stop...")
-					worker.canc()
-					toRemove = append(toRemove, name)
-				}
-			}
+// stop sends the events that are still queued or pending to the namespace
+// workers, and then stops them and waits for them to finish.
+func (r *registryHandler) stop(mainCtx, opsCtx context.Context) {
+	l := r.log.With().Str("from", "event handler").Logger()
 
-			for _, workerToRemove := range toRemove {
-				delete(e.workers, workerToRemove)
-			}
+	l.Info().Msg("dispatching remaining events to namespace workers...")
+	for {
+		r.flushPending()
+
+		var event *Event
+		select {
+		case event = <-r.eventsChan:
+		default:
+		}
+		if event == nil {
+			break
+		}
+
+		if !r.dispatch(mainCtx, opsCtx, event) {
+			l.Warn().Msg("could not dispatch all remaining events in time: discarding them...")
+			break
+		}
+	}
+
+	r.lock.Lock()
+	if len(r.workers) > 0 {
+		l.Info().Msg("propagating cancel to all namespace workers...")
+	}
+	for _, nsWorker := range r.workers {
+		nsWorker.canc()
+	}
+	r.lock.Unlock()
+
+	l.Debug().Msg("waiting for all namespace workers to finish...")
+	r.waitGroup.Wait()
+}
+
+// removeIdleWorkers stops the workers that did not receive any event for too
+// long.
+func (r *registryHandler) removeIdleWorkers() {
+	l := r.log.With().Str("from", "worker-manager").Logger()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for name, worker := range r.stopping {
+		select {
+		case <-worker.done:
+			delete(r.stopping, name)
+		default:
+		}
+	}
+
+	now := time.Now()
+	for name, worker := range r.workers {
+		if now.Sub(worker.lastEvent) > maximumIdleDuration {
+			l.Info().Str("namespace", name).
+				Msg("worker exceeded maximum idle time: signaling stop...")
+			worker.canc()
+			delete(r.workers, name)
+			r.stopping[name] = worker
 		}
 	}
 }
 
-func (e *EventHandler) getOrCreateNamespaceWorker(mainCtx context.Context, name string) *namespaceWorkerData {
-	l := e.log.With().Str("namespace", name).Logger()
+func (r *registryHandler) getOrCreateNamespaceWorker(mainCtx, opsCtx context.Context, name string) *namespaceWorkerData {
+	l := r.log.With().Str("namespace", name).Logger()
 
-	nsWorker, exists := e.workers[name]
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	nsWorker, exists := r.workers[name]
 	if exists {
 		l.Debug().Msg("worker already running")
 		return nsWorker
@@ -138,20 +571,38 @@ func (e *EventHandler) getOrCreateNamespaceWorker(mainCtx context.Context, name
 	l.Debug().Msg("creating namespace worker...")
 	data := &namespaceWorkerData{
 		worker: &namespaceWorker{
-			nsop:           e.seregoClient.Namespace(name),
-			log:            e.log.With().Str("worker", name+"-event-handler").Logger(),
+			nsop:           r.registry.Namespace(name),
+			registry:       r.name,
+			log:            r.log.With().Str("worker", name+"-event-handler").Logger(),
 			eventsChan:     make(chan *Event, 25),
-			persistentMeta: e.persistentMeta,
+			clusterID:      r.clusterID,
+			persistentMeta: r.persistentMeta,
+			endpointMeta:   r.endpointMeta,
+			processed: func(event *Event, err error) {
+				r.processed(mainCtx, event, err)
+			},
 		},
+		done: make(chan struct{}),
 	}
-	data.ctx, data.canc = context.WithCancel(mainCtx)
-	e.workers[name] = data
+	data.ctx, data.canc = context.WithCancel(context.Background())
+
+	// A worker of the same namespace that was stopped may still be
+	// processing its last events: the new one only starts after it exits,
+	// so that a namespace is never handled by two workers at once.
+	previous := r.stopping[name]
+	delete(r.stopping, name)
+	r.workers[name] = data
 
 	// Add it to the wait group so we can successfully wait for it to finish
-	e.waitGroup.Add(1)
+	r.waitGroup.Add(1)
 	go func() {
-		defer e.waitGroup.Done()
-		data.worker.handleNamespacedEvents(data.ctx)
+		defer r.waitGroup.Done()
+		defer close(data.done)
+
+		if previous != nil {
+			<-previous.done
+		}
+		data.worker.handleNamespacedEvents(data.ctx, opsCtx)
 	}()
 
 	return data
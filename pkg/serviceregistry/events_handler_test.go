@@ -0,0 +1,435 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package serviceregistry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	serego "github.com/CloudNativeSDWAN/serego/api/core/types"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanOut(t *testing.T) {
+	cases := []struct {
+		id         string
+		withResult bool
+		full       map[string]bool
+	}{
+		{id: "no-result"},
+		{id: "success", withResult: true},
+		{
+			id:         "one-full",
+			withResult: true,
+			full:       map[string]bool{"etcd": true},
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		e := NewEventHandler(map[string]Registry{"consul": nil, "etcd": nil}, "", nil, zerolog.Nop())
+		for _, reg := range e.registries {
+			if currCase.full[reg.name] {
+				reg.eventsChan = make(chan *Event)
+			}
+		}
+
+		event := &Event{EventType: EventDelete, Object: &serego.Namespace{Name: "ns"}}
+		if currCase.withResult {
+			event.Result = make(chan error, 1)
+		}
+		e.fanOut(event)
+
+		// The event is accepted without waiting for the service
+		// registries to process it, even if their queue is full.
+		if currCase.withResult && !a.NoError(<-event.Result) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+
+		for _, reg := range e.registries {
+			if currCase.full[reg.name] {
+				// It is sent again as soon as there is room.
+				if !a.Equal([]string{"ns"}, reg.pendingKeys) {
+					a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+				}
+				continue
+			}
+
+			regEvent := <-reg.eventsChan
+			if !a.Equal(event.Object, regEvent.Object) || !a.Nil(regEvent.Result) {
+				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+			}
+		}
+	}
+}
+
+func TestProcessed(t *testing.T) {
+	errDown := errors.New("service registry is down")
+	newEvent := func() *Event {
+		return &Event{EventType: EventDelete, Object: &serego.Namespace{Name: "ns"}}
+	}
+	cases := []struct {
+		id         string
+		err        error
+		superseded bool
+		expRetry   bool
+	}{
+		{id: "success"},
+		{id: "failure", err: errDown, expRetry: true},
+		{id: "superseded", err: errDown, superseded: true},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		e := NewEventHandler(map[string]Registry{"etcd": nil}, "", nil, zerolog.Nop())
+		reg := e.registries[0]
+
+		event := newEvent()
+		reg.enqueue(event)
+		<-reg.eventsChan
+		if currCase.superseded {
+			reg.enqueue(newEvent())
+			<-reg.eventsChan
+		}
+
+		reg.processed(context.Background(), event, currCase.err)
+
+		if !currCase.expRetry {
+			select {
+			case <-reg.eventsChan:
+				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+			case <-time.After(2 * retryBaseDelay):
+			}
+
+			if !currCase.superseded && !a.Empty(reg.latest) {
+				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+			}
+			continue
+		}
+
+		select {
+		case retried := <-reg.eventsChan:
+			if !a.Equal(event, retried) || !a.Equal(1, retried.attempts) {
+				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+			}
+		case <-time.After(2 * retryBaseDelay):
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
+
+func TestGetRetryDelay(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(retryBaseDelay, getRetryDelay(0))
+	a.Equal(4*retryBaseDelay, getRetryDelay(2))
+	a.Equal(retryMaxDelay, getRetryDelay(100))
+}
+
+// blockedRegistry blocks the dispatcher of its service registry until it is
+// released.
+type blockedRegistry struct {
+	*memRegistry
+	release chan struct{}
+}
+
+func (b *blockedRegistry) Namespace(name string) NamespaceOperation {
+	<-b.release
+	return b.memRegistry.Namespace(name)
+}
+
+func TestWatchForEventsConvergence(t *testing.T) {
+	a := assert.New(t)
+
+	fast := newMemRegistry()
+	slow := &blockedRegistry{memRegistry: newMemRegistry(), release: make(chan struct{})}
+	e := NewEventHandler(map[string]Registry{"fast": fast, "slow": slow},
+		"c1", map[string]string{ownerKey: ownerValue}, zerolog.Nop())
+
+	ctx, canc := context.WithCancel(context.Background())
+	eventsChan := make(chan *Event)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.WatchForEvents(ctx, eventsChan)
+	}()
+
+	// The queue of the slow service registry is filled well beyond its
+	// capacity.
+	services := 2 * registryQueueLength
+	for i := 0; i < services; i++ {
+		name := fmt.Sprintf("serv-%d", i)
+		eventsChan <- &Event{EventType: EventSync, Object: &ServiceState{
+			Namespace: "ns",
+			Name:      name,
+			Endpoints: []*serego.Endpoint{{
+				Namespace: "ns",
+				Service:   name,
+				Name:      "ep",
+				Address:   "10.10.10.10",
+				Port:      80,
+			}},
+		}}
+	}
+
+	converged := func(r *memRegistry) func() bool {
+		return func() bool {
+			r.lock.Lock()
+			defer r.lock.Unlock()
+
+			for i := 0; i < services; i++ {
+				if _, exists := r.objects[fmt.Sprintf("ns/serv-%d/ep", i)]; !exists {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	a.Eventually(converged(fast), 10*time.Second, 10*time.Millisecond)
+	a.False(converged(slow.memRegistry)())
+
+	close(slow.release)
+	a.Eventually(converged(slow.memRegistry), 10*time.Second, 10*time.Millisecond)
+
+	canc()
+	<-done
+}
+
+// failingRegistry fails to register namespaces as long as it is failing.
+type failingRegistry struct {
+	*memRegistry
+	failing atomic.Bool
+}
+
+func (f *failingRegistry) Namespace(name string) NamespaceOperation {
+	return &failingNamespace{f.memRegistry.Namespace(name), f}
+}
+
+type failingNamespace struct {
+	NamespaceOperation
+	registry *failingRegistry
+}
+
+func (n *failingNamespace) Register(ctx context.Context, opts ...register.Option) error {
+	if n.registry.failing.Load() {
+		return errors.New("service registry is down")
+	}
+
+	return n.NamespaceOperation.Register(ctx, opts...)
+}
+
+func TestWatchForEventsRetry(t *testing.T) {
+	a := assert.New(t)
+
+	healthy := newMemRegistry()
+	down := &failingRegistry{memRegistry: newMemRegistry()}
+	down.failing.Store(true)
+	e := NewEventHandler(map[string]Registry{"healthy": healthy, "down": down},
+		"c1", map[string]string{ownerKey: ownerValue}, zerolog.Nop())
+
+	ctx, canc := context.WithCancel(context.Background())
+	eventsChan := make(chan *Event)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.WatchForEvents(ctx, eventsChan)
+	}()
+
+	event := &Event{EventType: EventSync, Result: make(chan error, 1), Object: &ServiceState{
+		Namespace: "ns",
+		Name:      "serv",
+		Endpoints: []*serego.Endpoint{{
+			Namespace: "ns",
+			Service:   "serv",
+			Name:      "ep",
+			Address:   "10.10.10.10",
+			Port:      80,
+		}},
+	}}
+	eventsChan <- event
+
+	// The failing service registry does not hold back the event.
+	a.NoError(<-event.Result)
+
+	registered := func(r *memRegistry) func() bool {
+		return func() bool {
+			_, err := r.get("ns/serv/ep", serrors.EndpointNotFound)
+			return err == nil
+		}
+	}
+	a.Eventually(registered(healthy), 10*time.Second, 10*time.Millisecond)
+	a.False(registered(down.memRegistry)())
+
+	// It converges on its own once it is back.
+	down.failing.Store(false)
+	a.Eventually(registered(down.memRegistry), 10*time.Second, 10*time.Millisecond)
+
+	canc()
+	<-done
+}
+
+func TestWatchForEventsDrain(t *testing.T) {
+	a := assert.New(t)
+
+	slow := &blockedRegistry{memRegistry: newMemRegistry(), release: make(chan struct{})}
+	e := NewEventHandler(map[string]Registry{"slow": slow},
+		"c1", map[string]string{ownerKey: ownerValue}, zerolog.Nop())
+
+	ctx, canc := context.WithCancel(context.Background())
+	eventsChan := make(chan *Event, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.WatchForEvents(ctx, eventsChan)
+	}()
+
+	// Events are left in the queue of the service registry, among the
+	// pending ones and in the queue of the event handler.
+	services := 2 * registryQueueLength
+	for i := 0; i < services; i++ {
+		name := fmt.Sprintf("serv-%d", i)
+		eventsChan <- &Event{EventType: EventSync, Object: &ServiceState{
+			Namespace: "ns",
+			Name:      name,
+			Endpoints: []*serego.Endpoint{{
+				Namespace: "ns",
+				Service:   name,
+				Name:      "ep",
+				Address:   "10.10.10.10",
+				Port:      80,
+			}},
+		}}
+	}
+
+	canc()
+	close(slow.release)
+	<-done
+
+	for i := 0; i < services; i++ {
+		_, err := slow.get(fmt.Sprintf("ns/serv-%d/ep", i), serrors.EndpointNotFound)
+		a.NoError(err)
+	}
+}
+
+// overlapRegistry blocks all reads of namespaces until it is released, and
+// records whether any of them were performed concurrently.
+type overlapRegistry struct {
+	*memRegistry
+	release    chan struct{}
+	active     atomic.Int32
+	calls      atomic.Int32
+	overlapped atomic.Bool
+}
+
+func (o *overlapRegistry) Namespace(name string) NamespaceOperation {
+	return &overlapNamespace{o.memRegistry.Namespace(name), o}
+}
+
+type overlapNamespace struct {
+	NamespaceOperation
+	registry *overlapRegistry
+}
+
+func (n *overlapNamespace) Get(ctx context.Context) (*serego.Namespace, error) {
+	if n.registry.active.Add(1) > 1 {
+		n.registry.overlapped.Store(true)
+	}
+	defer n.registry.active.Add(-1)
+	n.registry.calls.Add(1)
+
+	<-n.registry.release
+	return n.NamespaceOperation.Get(ctx)
+}
+
+func TestRemoveIdleWorkers(t *testing.T) {
+	a := assert.New(t)
+
+	reg := &overlapRegistry{memRegistry: newMemRegistry(), release: make(chan struct{})}
+	r := NewEventHandler(map[string]Registry{"etcd": reg}, "", nil, zerolog.Nop()).registries[0]
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+	newEvent := func() *Event {
+		return &Event{EventType: EventDelete, Object: &serego.Namespace{Name: "ns"}}
+	}
+
+	old := r.getOrCreateNamespaceWorker(ctx, ctx, "ns")
+	old.worker.eventsChan <- newEvent()
+	a.Eventually(func() bool { return reg.calls.Load() == 1 }, 10*time.Second, 10*time.Millisecond)
+
+	old.lastEvent = time.Time{}
+	r.removeIdleWorkers()
+	a.Empty(r.workers)
+	a.Equal(old, r.stopping["ns"])
+
+	// The new worker waits for the old one to complete its last event.
+	data := r.getOrCreateNamespaceWorker(ctx, ctx, "ns")
+	a.NotEqual(old, data)
+	a.Empty(r.stopping)
+	data.worker.eventsChan <- newEvent()
+	time.Sleep(100 * time.Millisecond)
+	a.Equal(int32(1), reg.calls.Load())
+
+	close(reg.release)
+	a.Eventually(func() bool { return reg.calls.Load() == 2 }, 10*time.Second, 10*time.Millisecond)
+	a.False(reg.overlapped.Load())
+
+	data.canc()
+	<-data.done
+}
+
+func TestEnqueueAbsent(t *testing.T) {
+	a := assert.New(t)
+
+	r := NewEventHandler(map[string]Registry{"etcd": nil}, "", nil, zerolog.Nop()).registries[0]
+	newEvent := func(endpoints ...*serego.Endpoint) *Event {
+		return &Event{EventType: EventSync, Object: &ServiceState{
+			Namespace: "ns",
+			Name:      "serv",
+			Endpoints: endpoints,
+		}}
+	}
+
+	event := newEvent()
+	a.True(r.enqueue(event))
+	a.Equal(event, <-r.eventsChan)
+	r.processed(context.Background(), event, nil)
+	a.True(r.absent["ns/serv"])
+
+	// The service is known not to be registered.
+	a.True(r.enqueue(newEvent()))
+	a.Empty(r.eventsChan)
+	a.Empty(r.latest)
+
+	event = newEvent(&serego.Endpoint{Namespace: "ns", Service: "serv", Name: "ep"})
+	a.True(r.enqueue(event))
+	a.Equal(event, <-r.eventsChan)
+	a.NotContains(r.absent, "ns/serv")
+
+	// The service may be registered at this point.
+	event = newEvent()
+	a.True(r.enqueue(event))
+	a.Equal(event, <-r.eventsChan)
+}
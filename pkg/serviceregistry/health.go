@@ -0,0 +1,117 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package serviceregistry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	serego "github.com/CloudNativeSDWAN/serego/api/core"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+)
+
+const (
+	// heartbeatInterval is how frequently the dispatcher signals that it is
+	// still running, even when there are no events.
+	heartbeatInterval = 10 * time.Second
+	// maximumStallDuration is the maximum time that the dispatcher can be
+	// stuck before it is considered not healthy. Note that it never waits
+	// for a service registry to accept an event.
+	maximumStallDuration = 3 * time.Minute
+	// registryCheckInterval is the minimum time between two consecutive
+	// checks of the service registry, so that it is not flooded by probes.
+	registryCheckInterval = 30 * time.Second
+	registryCheckTimeout  = 10 * time.Second
+)
+
+// CheckDispatcher returns an error if the dispatcher of events is running but
+// has not made any progress for too long. It can be used as a liveness check.
+//
+// No error is returned if the dispatcher is not running, e.g. because this
+// replica is not the leader.
+func (e *EventHandler) CheckDispatcher(_ *http.Request) error {
+	if !e.running.Load() {
+		return nil
+	}
+
+	lastBeat := time.Unix(0, e.heartbeat.Load())
+	if stall := time.Since(lastBeat); stall > maximumStallDuration {
+		return fmt.Errorf("events dispatcher has not made progress in %s", stall.Round(time.Second))
+	}
+
+	return nil
+}
+
+// CheckRegistry returns an error if any of the service registries cannot be
+// reached. It can be used as a readiness check.
+func (e *EventHandler) CheckRegistry(req *http.Request) error {
+	return e.CheckRegistryConnection(req.Context())
+}
+
+// CheckRegistryConnection returns an error if any of the service registries
+// cannot be reached, by performing a cheap read on each of them. The error
+// contains the names of the ones that cannot be reached.
+//
+// The outcome of a check is re-used for a short time, in order to prevent
+// frequent probes from flooding the service registries with requests.
+func (e *EventHandler) CheckRegistryConnection(ctx context.Context) error {
+	errs := make([]error, len(e.registries))
+	wg := sync.WaitGroup{}
+
+	for i, reg := range e.registries {
+		i, reg := i, reg
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = reg.checkConnection(ctx)
+		}()
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (r *registryHandler) checkConnection(ctx context.Context) error {
+	r.registryCheckLock.Lock()
+	defer r.registryCheckLock.Unlock()
+
+	if time.Since(r.lastRegistryCheck) < registryCheckInterval {
+		return r.lastRegistryCheckErr
+	}
+
+	ctx, canc := context.WithTimeout(ctx, registryCheckTimeout)
+	defer canc()
+
+	start := time.Now()
+	_, _, err := r.registry.Namespace(serego.Any).List().Next(ctx)
+	observeRegistryCall(r.name, opList, kindNamespace, start, err)
+	if serrors.IsIteratorDone(err) || serrors.IsNotFound(err) {
+		err = nil
+	}
+	if err != nil {
+		err = fmt.Errorf("cannot reach service registry %s: %w", r.name, err)
+	}
+
+	r.lastRegistryCheck, r.lastRegistryCheckErr = time.Now(), err
+	return err
+}
@@ -0,0 +1,52 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package serviceregistry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDispatcher(t *testing.T) {
+	cases := []struct {
+		id        string
+		running   bool
+		lastBeat  time.Duration
+		expFailed bool
+	}{
+		{id: "not-running", lastBeat: time.Hour},
+		{id: "running", running: true, lastBeat: time.Second},
+		{id: "stalled", running: true, lastBeat: time.Hour, expFailed: true},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		e := &EventHandler{}
+		e.running.Store(currCase.running)
+		e.heartbeat.Store(time.Now().Add(-currCase.lastBeat).UnixNano())
+
+		err := e.CheckDispatcher(nil)
+		if !a.Equal(currCase.expFailed, err != nil) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+// Package kubernetes implements a service registry on Kubernetes, where
+// namespaces, services and endpoints are registered as RegisteredNamespace,
+// RegisteredService and RegisteredEndpoint custom resources.
+//
+// All objects are created in the same namespace of the target cluster, which
+// can be the one where the operator runs or a remote one, e.g. a hub cluster
+// that collects the services of several others. Services and endpoints are
+// labeled with the names of their parents and owned by them.
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/api/v1alpha1"
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultNamespace is the namespace where objects are registered, if
+	// none is provided.
+	DefaultNamespace string = "cnwan-registry"
+)
+
+// Registry is a service registry on Kubernetes custom resources.
+type Registry struct {
+	client    client.Client
+	namespace string
+}
+
+var _ serviceregistry.Registry = (*Registry)(nil)
+
+// New returns a new Registry that registers objects in the provided
+// namespace with the provided client, whose scheme must include the types
+// of the v1alpha1 package.
+func New(cli client.Client, namespace string) *Registry {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	return &Registry{client: cli, namespace: namespace}
+}
+
+// Namespace returns an operation on the namespace with the provided name.
+func (r *Registry) Namespace(name string) serviceregistry.NamespaceOperation {
+	return &namespaceOperation{registry: r, name: name}
+}
+
+// objectName returns the name of the custom resource of the object with the
+// provided names, e.g. <namespace>.<service> for a service.
+func objectName(names ...string) string {
+	return strings.Join(names, ".")
+}
+
+// get retrieves the custom resource with the provided name into obj. The
+// provided notFound error is wrapped and returned if it does not exist.
+func (r *Registry) get(ctx context.Context, name string, obj client.Object, notFound error) error {
+	err := r.client.Get(ctx, client.ObjectKey{Namespace: r.namespace, Name: name}, obj)
+	if k8serrors.IsNotFound(err) {
+		return fmt.Errorf("%w: %s", notFound, name)
+	}
+
+	return err
+}
+
+// save creates the custom resource if it does not exist yet, or updates it
+// otherwise.
+func (r *Registry) save(ctx context.Context, obj client.Object, exists bool) error {
+	if errs := validation.IsDNS1123Subdomain(obj.GetName()); len(errs) > 0 {
+		return fmt.Errorf("invalid object name %s: %s", obj.GetName(), strings.Join(errs, ", "))
+	}
+
+	if exists {
+		return r.client.Update(ctx, obj)
+	}
+
+	obj.SetNamespace(r.namespace)
+	return r.client.Create(ctx, obj)
+}
+
+// delete removes the custom resource with the name of obj, if it exists.
+func (r *Registry) delete(ctx context.Context, obj client.Object) error {
+	obj.SetNamespace(r.namespace)
+	if err := r.client.Delete(ctx, obj); err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// deleteAll removes all custom resources of the same kind as obj that have
+// the provided labels.
+func (r *Registry) deleteAll(ctx context.Context, obj client.Object, labels map[string]string) error {
+	return r.client.DeleteAllOf(ctx, obj,
+		client.InNamespace(r.namespace), client.MatchingLabels(labels))
+}
+
+// list lists the custom resources that have the provided labels into list.
+func (r *Registry) list(ctx context.Context, list client.ObjectList, labels map[string]string) error {
+	return r.client.List(ctx, list,
+		client.InNamespace(r.namespace), client.MatchingLabels(labels))
+}
+
+// ownerReference returns a reference to the provided parent object, so that
+// its children are garbage collected when it is removed.
+func ownerReference(owner client.Object, kind string) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: v1alpha1.GroupVersion.String(),
+		Kind:       kind,
+		Name:       owner.GetName(),
+		UID:        owner.GetUID(),
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package kubernetes
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/api/v1alpha1"
+	serego "github.com/CloudNativeSDWAN/serego/api/core"
+	stypes "github.com/CloudNativeSDWAN/serego/api/core/types"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// newTestClient starts an API server with the custom resource definitions
+// generated in artifacts and returns a client for it, after creating the
+// default namespace of the registry. The test is skipped if the binaries of
+// the API server are not available: make test downloads them.
+func newTestClient(t *testing.T) client.Client {
+	a := assert.New(t)
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set, run make test to use envtest")
+	}
+
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "..", "artifacts", "deploy", "crds")},
+		ErrorIfCRDPathMissing: true,
+	}
+	cfg, err := env.Start()
+	if !a.NoError(err) {
+		a.FailNow("cannot start test environment")
+	}
+	t.Cleanup(func() {
+		a.NoError(env.Stop())
+	})
+
+	scheme := k8sruntime.NewScheme()
+	if !a.NoError(clientgoscheme.AddToScheme(scheme)) || !a.NoError(v1alpha1.AddToScheme(scheme)) {
+		a.FailNow("cannot create scheme")
+	}
+	cli, err := client.New(cfg, client.Options{Scheme: scheme})
+	if !a.NoError(err) {
+		a.FailNow("cannot create client")
+	}
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: DefaultNamespace}}
+	if !a.NoError(cli.Create(context.Background(), ns)) {
+		a.FailNow("cannot create namespace")
+	}
+
+	return cli
+}
+
+func TestRegistry(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	cli := newTestClient(t)
+	r := New(cli, "")
+
+	nsop := r.Namespace("ns")
+	sop := nsop.Service("serv")
+	epop := sop.Endpoint("serv-80")
+
+	_, err := nsop.Get(ctx)
+	a.True(serrors.IsNotFound(err))
+	a.True(serrors.IsNotFound(sop.Register(ctx)))
+	a.True(serrors.IsNotFound(epop.Register(ctx)))
+
+	a.NoError(nsop.Register(ctx, register.WithMetadata(map[string]string{"cnwan.io/clusters": "c1"})))
+	a.Equal(serrors.NamespaceAlreadyExists, nsop.Register(ctx, register.WithCreateMode()))
+	a.NoError(sop.Register(ctx, register.WithMetadata(map[string]string{"owner": "cnwan-operator"})))
+	a.NoError(epop.Register(ctx,
+		register.WithAddress("10.10.10.10"),
+		register.WithPort(80),
+		register.WithMetadata(map[string]string{"cnwan.io/cluster-id": "c1"})))
+
+	ns, err := nsop.Get(ctx)
+	a.NoError(err)
+	a.Equal(&stypes.Namespace{Name: "ns", Metadata: map[string]string{"cnwan.io/clusters": "c1"}}, ns)
+
+	ep, err := epop.Get(ctx)
+	a.NoError(err)
+	a.Equal(&stypes.Endpoint{
+		Name:      "serv-80",
+		Service:   "serv",
+		Namespace: "ns",
+		Address:   "10.10.10.10",
+		Port:      80,
+		Metadata:  map[string]string{"cnwan.io/cluster-id": "c1"},
+	}, ep)
+
+	obj := &v1alpha1.RegisteredEndpoint{}
+	if !a.NoError(cli.Get(ctx, client.ObjectKey{Namespace: DefaultNamespace, Name: "ns.serv.serv-80"}, obj)) {
+		a.FailNow("endpoint not registered as a custom resource")
+	}
+	a.Equal(map[string]string{
+		v1alpha1.RegisteredNamespaceLabel: "ns",
+		v1alpha1.RegisteredServiceLabel:   "serv",
+	}, obj.Labels)
+	a.Len(obj.OwnerReferences, 1)
+	a.Equal("ns.serv", obj.OwnerReferences[0].Name)
+
+	// Address and port are kept and metadata is replaced.
+	a.NoError(epop.Register(ctx, register.WithReplaceMetadata(),
+		register.WithMetadata(map[string]string{"version": "v2"})))
+	ep, err = epop.Get(ctx)
+	a.NoError(err)
+	a.Equal("10.10.10.10", ep.Address)
+	a.Equal(int32(80), ep.Port)
+	a.Equal(map[string]string{"version": "v2"}, ep.Metadata)
+
+	// Objects of other namespaces and services are not listed.
+	a.NoError(r.Namespace("other").Register(ctx))
+	a.NoError(r.Namespace("other").Service("serv").Register(ctx))
+	a.NoError(r.Namespace("other").Service("serv").Endpoint("serv-81").Register(ctx))
+
+	names := []string{}
+	nsIterator := r.Namespace(serego.Any).List()
+	for {
+		ns, nsop, err := nsIterator.Next(ctx)
+		if err != nil {
+			a.True(serrors.IsIteratorDone(err))
+			break
+		}
+		names = append(names, ns.Name)
+
+		servIterator := nsop.Service(serego.Any).List()
+		for {
+			serv, sop, err := servIterator.Next(ctx)
+			if err != nil {
+				a.True(serrors.IsIteratorDone(err))
+				break
+			}
+			names = append(names, serv.Name)
+
+			epIterator := sop.Endpoint(serego.Any).List()
+			for {
+				ep, _, err := epIterator.Next(ctx)
+				if err != nil {
+					a.True(serrors.IsIteratorDone(err))
+					break
+				}
+				names = append(names, ep.Name)
+			}
+		}
+	}
+	a.Equal([]string{"ns", "serv", "serv-80", "other", "serv", "serv-81"}, names)
+
+	a.NoError(nsop.Deregister(ctx))
+	_, err = sop.Get(ctx)
+	a.True(serrors.IsNotFound(err))
+	_, err = epop.Get(ctx)
+	a.True(serrors.IsNotFound(err))
+	a.NoError(epop.Deregister(ctx))
+	a.NoError(nsop.Deregister(ctx))
+
+	_, err = r.Namespace("other").Service("serv").Endpoint("serv-81").Get(ctx)
+	a.NoError(err)
+
+	a.Error(r.Namespace("Invalid_Name").Register(ctx))
+	a.Equal(serrors.EmptyServiceName, nsop.Service(serego.Any).Register(ctx))
+}
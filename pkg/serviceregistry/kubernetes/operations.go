@@ -0,0 +1,478 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/api/v1alpha1"
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	stypes "github.com/CloudNativeSDWAN/serego/api/core/types"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	copied := map[string]string{}
+	for k, v := range metadata {
+		copied[k] = v
+	}
+
+	return copied
+}
+
+type namespaceOperation struct {
+	registry *Registry
+	name     string
+}
+
+// get returns the custom resource of the namespace.
+func (n *namespaceOperation) get(ctx context.Context) (*v1alpha1.RegisteredNamespace, error) {
+	if n.name == "" {
+		return nil, serrors.EmptyNamespaceName
+	}
+
+	obj := &v1alpha1.RegisteredNamespace{}
+	if err := n.registry.get(ctx, objectName(n.name), obj, serrors.NamespaceNotFound); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (n *namespaceOperation) Get(ctx context.Context) (*stypes.Namespace, error) {
+	obj, err := n.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stypes.Namespace{
+		Name:     n.name,
+		Metadata: copyMetadata(obj.Spec.Metadata),
+	}, nil
+}
+
+func (n *namespaceOperation) Register(ctx context.Context, opts ...register.Option) error {
+	obj, err := n.get(ctx)
+	if err != nil && !serrors.IsNotFound(err) {
+		return err
+	}
+
+	exists := obj != nil
+	if !exists {
+		obj = &v1alpha1.RegisteredNamespace{
+			ObjectMeta: metav1.ObjectMeta{Name: objectName(n.name)},
+		}
+	}
+
+	_, metadata, err := serviceregistry.PrepareRegister(opts, obj.Spec.Metadata, exists,
+		serrors.NamespaceNotFound, serrors.NamespaceAlreadyExists)
+	if err != nil {
+		return err
+	}
+
+	obj.Spec = v1alpha1.RegisteredNamespaceSpec{Name: n.name, Metadata: metadata}
+	return n.registry.save(ctx, obj, exists)
+}
+
+// Deregister removes the namespace, along with all its services and their
+// endpoints.
+func (n *namespaceOperation) Deregister(ctx context.Context) error {
+	if n.name == "" {
+		return serrors.EmptyNamespaceName
+	}
+
+	// Children are owned by their parents, but the garbage collector
+	// removes them in background: remove them now so that they are not
+	// listed anymore.
+	labels := map[string]string{v1alpha1.RegisteredNamespaceLabel: n.name}
+	if err := n.registry.deleteAll(ctx, &v1alpha1.RegisteredEndpoint{}, labels); err != nil {
+		return err
+	}
+	if err := n.registry.deleteAll(ctx, &v1alpha1.RegisteredService{}, labels); err != nil {
+		return err
+	}
+
+	return n.registry.delete(ctx, &v1alpha1.RegisteredNamespace{
+		ObjectMeta: metav1.ObjectMeta{Name: objectName(n.name)},
+	})
+}
+
+func (n *namespaceOperation) List() serviceregistry.NamespaceIterator {
+	return &namespaceIterator{
+		registry: n.registry,
+		lister: serviceregistry.NewLister(func(ctx context.Context) ([]*stypes.Namespace, error) {
+			list := &v1alpha1.RegisteredNamespaceList{}
+			if err := n.registry.list(ctx, list, nil); err != nil {
+				return nil, err
+			}
+
+			namespaces := []*stypes.Namespace{}
+			for _, item := range list.Items {
+				if n.name != "" && item.Spec.Name != n.name {
+					continue
+				}
+
+				namespaces = append(namespaces, &stypes.Namespace{
+					Name:     item.Spec.Name,
+					Metadata: copyMetadata(item.Spec.Metadata),
+				})
+			}
+			sort.Slice(namespaces, func(i, j int) bool {
+				return namespaces[i].Name < namespaces[j].Name
+			})
+
+			return namespaces, nil
+		}),
+	}
+}
+
+func (n *namespaceOperation) Service(name string) serviceregistry.ServiceOperation {
+	return &serviceOperation{namespace: n, name: name}
+}
+
+type namespaceIterator struct {
+	registry *Registry
+	lister   *serviceregistry.Lister[*stypes.Namespace]
+}
+
+func (i *namespaceIterator) Next(ctx context.Context) (*stypes.Namespace, serviceregistry.NamespaceOperation, error) {
+	ns, err := i.lister.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ns, i.registry.Namespace(ns.Name), nil
+}
+
+type serviceOperation struct {
+	namespace *namespaceOperation
+	name      string
+}
+
+func (s *serviceOperation) labels() map[string]string {
+	return map[string]string{
+		v1alpha1.RegisteredNamespaceLabel: s.namespace.name,
+		v1alpha1.RegisteredServiceLabel:   s.name,
+	}
+}
+
+// get returns the custom resource of the service.
+func (s *serviceOperation) get(ctx context.Context) (*v1alpha1.RegisteredService, error) {
+	switch {
+	case s.namespace.name == "":
+		return nil, serrors.EmptyNamespaceName
+	case s.name == "":
+		return nil, serrors.EmptyServiceName
+	}
+
+	obj := &v1alpha1.RegisteredService{}
+	if err := s.namespace.registry.get(ctx, objectName(s.namespace.name, s.name),
+		obj, serrors.ServiceNotFound); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (s *serviceOperation) Get(ctx context.Context) (*stypes.Service, error) {
+	obj, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stypes.Service{
+		Name:      s.name,
+		Namespace: s.namespace.name,
+		Metadata:  copyMetadata(obj.Spec.Metadata),
+	}, nil
+}
+
+func (s *serviceOperation) Register(ctx context.Context, opts ...register.Option) error {
+	obj, err := s.get(ctx)
+	if err != nil && !serrors.IsNotFound(err) {
+		return err
+	}
+
+	exists := obj != nil
+	var currMeta map[string]string
+	if exists {
+		currMeta = obj.Spec.Metadata
+	}
+
+	_, metadata, err := serviceregistry.PrepareRegister(opts, currMeta, exists,
+		serrors.ServiceNotFound, serrors.ServiceAlreadyExists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		ns, err := s.namespace.get(ctx)
+		if err != nil {
+			return fmt.Errorf("cannot get namespace %s before registering service: %w", s.namespace.name, err)
+		}
+
+		obj = &v1alpha1.RegisteredService{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            objectName(s.namespace.name, s.name),
+				Labels:          map[string]string{v1alpha1.RegisteredNamespaceLabel: s.namespace.name},
+				OwnerReferences: []metav1.OwnerReference{ownerReference(ns, "RegisteredNamespace")},
+			},
+		}
+	}
+
+	obj.Spec = v1alpha1.RegisteredServiceSpec{
+		Namespace: s.namespace.name,
+		Name:      s.name,
+		Metadata:  metadata,
+	}
+	return s.namespace.registry.save(ctx, obj, exists)
+}
+
+// Deregister removes the service, along with all its endpoints.
+func (s *serviceOperation) Deregister(ctx context.Context) error {
+	switch {
+	case s.namespace.name == "":
+		return serrors.EmptyNamespaceName
+	case s.name == "":
+		return serrors.EmptyServiceName
+	}
+
+	if err := s.namespace.registry.deleteAll(ctx, &v1alpha1.RegisteredEndpoint{}, s.labels()); err != nil {
+		return err
+	}
+
+	return s.namespace.registry.delete(ctx, &v1alpha1.RegisteredService{
+		ObjectMeta: metav1.ObjectMeta{Name: objectName(s.namespace.name, s.name)},
+	})
+}
+
+func (s *serviceOperation) List() serviceregistry.ServiceIterator {
+	return &serviceIterator{
+		namespace: s.namespace,
+		lister: serviceregistry.NewLister(func(ctx context.Context) ([]*stypes.Service, error) {
+			if s.namespace.name == "" {
+				return nil, serrors.EmptyNamespaceName
+			}
+
+			list := &v1alpha1.RegisteredServiceList{}
+			if err := s.namespace.registry.list(ctx, list, map[string]string{
+				v1alpha1.RegisteredNamespaceLabel: s.namespace.name,
+			}); err != nil {
+				return nil, err
+			}
+
+			services := []*stypes.Service{}
+			for _, item := range list.Items {
+				if s.name != "" && item.Spec.Name != s.name {
+					continue
+				}
+
+				services = append(services, &stypes.Service{
+					Name:      item.Spec.Name,
+					Namespace: s.namespace.name,
+					Metadata:  copyMetadata(item.Spec.Metadata),
+				})
+			}
+			sort.Slice(services, func(i, j int) bool {
+				return services[i].Name < services[j].Name
+			})
+
+			return services, nil
+		}),
+	}
+}
+
+func (s *serviceOperation) Endpoint(name string) serviceregistry.EndpointOperation {
+	return &endpointOperation{service: s, name: name}
+}
+
+type serviceIterator struct {
+	namespace *namespaceOperation
+	lister    *serviceregistry.Lister[*stypes.Service]
+}
+
+func (i *serviceIterator) Next(ctx context.Context) (*stypes.Service, serviceregistry.ServiceOperation, error) {
+	serv, err := i.lister.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return serv, i.namespace.Service(serv.Name), nil
+}
+
+type endpointOperation struct {
+	service *serviceOperation
+	name    string
+}
+
+func (e *endpointOperation) objectName() string {
+	return objectName(e.service.namespace.name, e.service.name, e.name)
+}
+
+// get returns the custom resource of the endpoint.
+func (e *endpointOperation) get(ctx context.Context) (*v1alpha1.RegisteredEndpoint, error) {
+	switch {
+	case e.service.namespace.name == "":
+		return nil, serrors.EmptyNamespaceName
+	case e.service.name == "":
+		return nil, serrors.EmptyServiceName
+	case e.name == "":
+		return nil, serrors.EmptyEndpointName
+	}
+
+	obj := &v1alpha1.RegisteredEndpoint{}
+	if err := e.service.namespace.registry.get(ctx, e.objectName(),
+		obj, serrors.EndpointNotFound); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func toEndpoint(spec *v1alpha1.RegisteredEndpointSpec) *stypes.Endpoint {
+	return &stypes.Endpoint{
+		Name:      spec.Name,
+		Service:   spec.Service,
+		Namespace: spec.Namespace,
+		Address:   spec.Address,
+		Port:      spec.Port,
+		Metadata:  copyMetadata(spec.Metadata),
+	}
+}
+
+func (e *endpointOperation) Get(ctx context.Context) (*stypes.Endpoint, error) {
+	obj, err := e.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return toEndpoint(&obj.Spec), nil
+}
+
+func (e *endpointOperation) Register(ctx context.Context, opts ...register.Option) error {
+	obj, err := e.get(ctx)
+	if err != nil && !serrors.IsNotFound(err) {
+		return err
+	}
+
+	exists := obj != nil
+	var currMeta map[string]string
+	if exists {
+		currMeta = obj.Spec.Metadata
+	}
+
+	regOpts, metadata, err := serviceregistry.PrepareRegister(opts, currMeta, exists,
+		serrors.EndpointNotFound, serrors.EndpointAlreadyExists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		serv, err := e.service.get(ctx)
+		if err != nil {
+			return fmt.Errorf("cannot get service %s before registering endpoint: %w", e.service.name, err)
+		}
+
+		obj = &v1alpha1.RegisteredEndpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            e.objectName(),
+				Labels:          e.service.labels(),
+				OwnerReferences: []metav1.OwnerReference{ownerReference(serv, "RegisteredService")},
+			},
+		}
+	}
+
+	obj.Spec.Namespace = e.service.namespace.name
+	obj.Spec.Service = e.service.name
+	obj.Spec.Name = e.name
+	obj.Spec.Metadata = metadata
+	if regOpts.Address != nil {
+		obj.Spec.Address = *regOpts.Address
+	}
+	if regOpts.Port != nil {
+		obj.Spec.Port = *regOpts.Port
+	}
+
+	return e.service.namespace.registry.save(ctx, obj, exists)
+}
+
+func (e *endpointOperation) Deregister(ctx context.Context) error {
+	if _, err := e.get(ctx); err != nil {
+		if serrors.IsNotFound(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	return e.service.namespace.registry.delete(ctx, &v1alpha1.RegisteredEndpoint{
+		ObjectMeta: metav1.ObjectMeta{Name: e.objectName()},
+	})
+}
+
+func (e *endpointOperation) List() serviceregistry.EndpointIterator {
+	return &endpointIterator{
+		service: e.service,
+		lister: serviceregistry.NewLister(func(ctx context.Context) ([]*stypes.Endpoint, error) {
+			switch {
+			case e.service.namespace.name == "":
+				return nil, serrors.EmptyNamespaceName
+			case e.service.name == "":
+				return nil, serrors.EmptyServiceName
+			}
+
+			list := &v1alpha1.RegisteredEndpointList{}
+			if err := e.service.namespace.registry.list(ctx, list, e.service.labels()); err != nil {
+				return nil, err
+			}
+
+			endpoints := []*stypes.Endpoint{}
+			for _, item := range list.Items {
+				if e.name != "" && item.Spec.Name != e.name {
+					continue
+				}
+
+				endpoints = append(endpoints, toEndpoint(&item.Spec))
+			}
+			sort.Slice(endpoints, func(i, j int) bool {
+				return endpoints[i].Name < endpoints[j].Name
+			})
+
+			return endpoints, nil
+		}),
+	}
+}
+
+type endpointIterator struct {
+	service *serviceOperation
+	lister  *serviceregistry.Lister[*stypes.Endpoint]
+}
+
+func (i *endpointIterator) Next(ctx context.Context) (*stypes.Endpoint, serviceregistry.EndpointOperation, error) {
+	ep, err := i.lister.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ep, i.service.Endpoint(ep.Name), nil
+}
@@ -0,0 +1,152 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package serviceregistry
+
+import (
+	"time"
+
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	metricsNamespace string = "cnwan_operator"
+
+	opGet        string = "get"
+	opList       string = "list"
+	opRegister   string = "register"
+	opDeregister string = "deregister"
+
+	kindNamespace string = "namespace"
+	kindService   string = "service"
+	kindEndpoint  string = "endpoint"
+
+	resultSuccess  string = "success"
+	resultNotFound string = "not_found"
+	resultError    string = "error"
+)
+
+var (
+	registryOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "registry_operations_total",
+		Help:      "Total number of operations performed on the service registry.",
+	}, []string{"registry", "operation", "kind", "result"})
+
+	registryOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "registry_operation_duration_seconds",
+		Help:      "Duration of operations performed on the service registry.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"registry", "operation", "kind"})
+
+	eventsQueueLengthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "events_queue_length"),
+		"Number of events waiting to be dispatched to service registries.",
+		nil, nil)
+
+	registryQueueLengthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "registry_queue_length"),
+		"Number of events waiting to be dispatched to the namespace workers of a service registry, including the ones that did not fit in its queue.",
+		[]string{"registry"}, nil)
+
+	registryRetriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "registry_retries"),
+		"Number of objects whose latest event a service registry failed to process and that are waiting to be sent to it again.",
+		[]string{"registry"}, nil)
+
+	namespaceWorkerQueueLengthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "namespace_worker_queue_length"),
+		"Number of events waiting to be processed by a namespace worker.",
+		[]string{"registry", "namespace"}, nil)
+
+	namespaceWorkersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "namespace_workers"),
+		"Number of namespace workers currently running.",
+		[]string{"registry"}, nil)
+)
+
+func init() {
+	metrics.Registry.MustRegister(registryOperationsTotal, registryOperationDuration)
+}
+
+// observeRegistryCall records the outcome and duration of an operation
+// performed on the service registry and started at the provided time.
+func observeRegistryCall(registry, operation, kind string, start time.Time, err error) {
+	result := resultSuccess
+	switch {
+	case err == nil, serrors.IsIteratorDone(err):
+	case serrors.IsNotFound(err):
+		result = resultNotFound
+	default:
+		result = resultError
+	}
+
+	registryOperationsTotal.WithLabelValues(registry, operation, kind, result).Inc()
+	registryOperationDuration.WithLabelValues(registry, operation, kind).
+		Observe(time.Since(start).Seconds())
+}
+
+// Describe implements prometheus.Collector, so that the event handler can
+// report the length of its queues and the number of its workers.
+func (e *EventHandler) Describe(ch chan<- *prometheus.Desc) {
+	ch <- eventsQueueLengthDesc
+	ch <- registryQueueLengthDesc
+	ch <- registryRetriesDesc
+	ch <- namespaceWorkerQueueLengthDesc
+	ch <- namespaceWorkersDesc
+}
+
+func (e *EventHandler) Collect(ch chan<- prometheus.Metric) {
+	e.lock.RLock()
+	ch <- prometheus.MustNewConstMetric(eventsQueueLengthDesc,
+		prometheus.GaugeValue, float64(len(e.eventsChan)))
+	e.lock.RUnlock()
+
+	for _, reg := range e.registries {
+		reg.collect(ch)
+	}
+}
+
+func (r *registryHandler) collect(ch chan<- prometheus.Metric) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	r.pendingLock.Lock()
+	pending, retries := len(r.pendingKeys), 0
+	for _, event := range r.latest {
+		if event.attempts > 0 {
+			retries++
+		}
+	}
+	r.pendingLock.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(registryQueueLengthDesc,
+		prometheus.GaugeValue, float64(len(r.eventsChan)+pending), r.name)
+	ch <- prometheus.MustNewConstMetric(registryRetriesDesc,
+		prometheus.GaugeValue, float64(retries), r.name)
+	ch <- prometheus.MustNewConstMetric(namespaceWorkersDesc,
+		prometheus.GaugeValue, float64(len(r.workers)), r.name)
+
+	for name, data := range r.workers {
+		ch <- prometheus.MustNewConstMetric(namespaceWorkerQueueLengthDesc,
+			prometheus.GaugeValue, float64(len(data.worker.eventsChan)), r.name, name)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package serviceregistry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveRegistryCall(t *testing.T) {
+	cases := []struct {
+		id        string
+		err       error
+		expResult string
+	}{
+		{id: "success", expResult: resultSuccess},
+		{id: "iterator-done", err: serrors.IteratorDone, expResult: resultSuccess},
+		{id: "not-found", err: serrors.EndpointNotFound, expResult: resultNotFound},
+		{id: "error", err: fmt.Errorf("whatever"), expResult: resultError},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		counter := registryOperationsTotal.WithLabelValues("etcd", opGet, kindEndpoint, currCase.expResult)
+		before := testutil.ToFloat64(counter)
+
+		observeRegistryCall("etcd", opGet, kindEndpoint, time.Now(), currCase.err)
+
+		if !a.Equal(before+1, testutil.ToFloat64(counter)) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
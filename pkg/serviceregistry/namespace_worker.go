@@ -20,6 +20,8 @@ package serviceregistry
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	serego "github.com/CloudNativeSDWAN/serego/api/core"
@@ -29,94 +31,380 @@ import (
 	"github.com/rs/zerolog"
 )
 
+// errKindConflict is returned when syncing a service that is registered for
+// a Kubernetes object of a different kind.
+var errKindConflict = errors.New("service belongs to another kind of object")
+
 type namespaceWorkerData struct {
 	worker    *namespaceWorker
 	ctx       context.Context
 	canc      context.CancelFunc
 	lastEvent time.Time
+	// done is closed once the worker has exited.
+	done chan struct{}
 }
 
 type namespaceWorker struct {
-	nsop           *serego.NamespaceOperation
+	nsop           NamespaceOperation
+	registry       string
 	log            zerolog.Logger
 	eventsChan     chan *Event
+	clusterID      string
 	persistentMeta map[string]string
+	endpointMeta   map[string]string
+	// processed, if not nil, is called with the outcome of each event.
+	processed func(event *Event, err error)
 }
 
-func (n *namespaceWorker) handleNamespacedEvents(ctx context.Context) error {
+// handleNamespacedEvents processes the events of the namespace until ctx is
+// canceled, and then the ones that are still queued as well. Operations are
+// performed with opsCtx, so that the ones in progress are not canceled as
+// soon as the worker is stopped.
+func (n *namespaceWorker) handleNamespacedEvents(ctx, opsCtx context.Context) error {
 	l := n.log.With().Logger()
 	l.Info().Msg("worker waiting for events for this namespace...")
 
 	for {
 		select {
 		case <-ctx.Done():
-			l.Info().Msg("received stop from manager: exiting...")
-			return nil
-		case event := <-n.eventsChan:
-
-			switch event.EventType {
-			case EventCreate, EventUpdate:
-				n.handleCreateUpdate(ctx, event)
-			case EventDelete:
-				switch obj := event.Object.(type) {
-				case *stypes.Namespace:
-					n.handleDeleteNamespace(ctx, obj)
-				case *stypes.Service:
-					n.handleDeleteService(ctx, obj)
-				case *stypes.Endpoint:
-					n.handleDeleteEndpoint(ctx, obj)
+			l.Info().Msg("received stop from manager: processing pending events before exiting...")
+			for {
+				select {
+				case event := <-n.eventsChan:
+					n.handleEvent(opsCtx, event)
+				default:
+					l.Info().Msg("exiting...")
+					return nil
 				}
 			}
+		case event := <-n.eventsChan:
+			n.handleEvent(opsCtx, event)
 		}
 	}
 }
 
-func (n *namespaceWorker) handleCreateUpdate(mainCtx context.Context, event *Event) {
-	ctx, canc := context.WithTimeout(mainCtx, time.Minute)
-	defer canc()
+func (n *namespaceWorker) handleEvent(ctx context.Context, event *Event) {
+	var err error
+
+	switch event.EventType {
+	case EventCreate, EventUpdate:
+		err = n.handleCreateUpdate(ctx, event)
+	case EventDelete:
+		switch obj := event.Object.(type) {
+		case *stypes.Namespace:
+			err = n.handleDeleteNamespace(ctx, obj)
+		case *stypes.Service:
+			err = n.handleDeleteService(ctx, obj)
+		case *stypes.Endpoint:
+			err = n.handleDeleteEndpoint(ctx, obj)
+		}
+	case EventSync:
+		state, ok := event.Object.(*ServiceState)
+		if !ok {
+			err = fmt.Errorf("unexpected object for %s event", event.EventType)
+			break
+		}
 
-	switch obj := event.Object.(type) {
+		err = n.handleSync(ctx, state)
+	}
 
+	if event.Result != nil {
+		event.Result <- err
+	}
+	if n.processed != nil {
+		n.processed(event, err)
+	}
+}
+
+func (n *namespaceWorker) handleCreateUpdate(ctx context.Context, event *Event) error {
+	switch obj := event.Object.(type) {
 	case *stypes.Namespace:
-		l := n.log.With().Logger()
-		l.Info().Msg("registering namespace...")
-		if err := n.nsop.
-			Register(ctx, register.WithMetadata(n.persistentMeta)); err != nil {
-			l.Err(err).Msg("could not registrer namespace")
-		} else {
-			l.Info().Msg("namespace correctly registered")
+		return n.registerNamespace(ctx, nil)
+	case *stypes.Service:
+		return n.registerService(ctx, obj.Name, nil)
+	case *stypes.Endpoint:
+		return n.registerEndpoint(ctx, obj)
+	}
+
+	return nil
+}
+
+// handleSync brings the service described by the provided state to its
+// desired condition on the service registry.
+//
+// Only the endpoints that are missing or have changed are registered, and
+// only the endpoints owned by the operator that are not desired anymore are
+// deregistered. If the state has no endpoints at all, the service -- and its
+// namespace, if empty -- are removed as well.
+//
+// Desired endpoints are registered before the old ones are deregistered, and
+// the old ones are kept if any registration fails: this way, endpoints that
+// are renamed -- e.g. when changing how endpoints are named -- are never
+// missing from the service registry.
+//
+// The namespace and service are only updated if their metadata changed, and
+// the metadata that the operator registered there before is replaced with
+// the one in the state.
+//
+// Nothing is done if the service is not registered and the state has no
+// endpoints, or if the service is registered for another kind of object, as
+// trying again would not change the outcome.
+func (n *namespaceWorker) handleSync(mainCtx context.Context, state *ServiceState) error {
+	l := n.log.With().Str("service", state.Name).Logger()
+
+	exists, err := n.checkServiceKind(mainCtx, state)
+	switch {
+	case errors.Is(err, errKindConflict):
+		l.Warn().Err(err).Msg("cannot sync service: skipping...")
+		return nil
+	case err != nil:
+		l.Err(err).Msg("cannot sync service")
+		return err
+	case !exists && len(state.Endpoints) == 0:
+		l.Debug().Msg("service is not registered: nothing to do")
+		return nil
+	}
+
+	registered, err := n.listEndpoints(mainCtx, state.Name)
+	if err != nil {
+		l.Err(err).Msg("cannot get endpoints currently registered")
+		return err
+	}
+
+	desired := getEndpointsMap(state.Endpoints)
+	if len(desired) > 0 {
+		nsMeta, servMeta := state.NamespaceMetadata, state.ServiceMetadata
+		if nsMeta == nil {
+			nsMeta = map[string]string{}
+		}
+		if state.Kind != "" {
+			servMeta = map[string]string{kindKey: state.Kind}
+			for k, v := range state.ServiceMetadata {
+				servMeta[k] = v
+			}
+		}
+		if servMeta == nil {
+			servMeta = map[string]string{}
 		}
 
-	case *stypes.Service:
-		l := n.log.With().Str("service-name", obj.Name).Logger()
-		l.Info().Msg("registering service...")
-		if err := n.nsop.Service(obj.Name).
-			Register(ctx, register.WithMetadata(n.persistentMeta)); err != nil {
-			l.Err(err).Msg("could not registrer service")
-		} else {
-			l.Info().Msg("service correctly registered")
+		if err := n.registerNamespace(mainCtx, nsMeta); err != nil {
+			return err
 		}
 
-	case *stypes.Endpoint:
-		l := n.log.With().
-			Str("service-name", obj.Service).
-			Str("endpoint-name", obj.Name).
-			Logger()
-		l.Info().Msg("registering endpoint...")
-		if err := n.nsop.Service(obj.Service).Endpoint(obj.Name).Register(ctx,
-			register.WithAddress(obj.Address),
-			register.WithPort(obj.Port),
-			register.WithMetadata(obj.Metadata),
-			register.WithMetadata(n.persistentMeta)); err != nil {
-			l.Err(err).Msg("could not registrer endpoint")
-		} else {
-			l.Info().Msg("endpoint correctly registered")
+		if err := n.registerService(mainCtx, state.Name, servMeta); err != nil {
+			return err
+		}
+	}
+
+	errs := []error{}
+	registeredMap := getEndpointsMap(registered)
+	for _, ep := range desired {
+		if !isEndpointChanged(registeredMap[ep.Name], ep, n.endpointMeta) {
+			continue
+		}
+
+		errs = append(errs, n.registerEndpoint(mainCtx, ep))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	for _, ep := range registered {
+		if _, exists := desired[ep.Name]; exists {
+			continue
+		}
+
+		if !isOwnedByCluster(ep.Metadata, n.clusterID) {
+			l.Info().Str("endpoint", ep.Name).
+				Str("reason", "not managed by CNWAN-Operator").
+				Msg("skipping endpoint deletion")
+			continue
+		}
+
+		errs = append(errs, n.deregisterEndpoint(mainCtx, ep))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	if len(desired) > 0 {
+		return nil
+	}
+
+	if err := n.handleDeleteService(mainCtx, &stypes.Service{
+		Namespace: state.Namespace,
+		Name:      state.Name,
+	}); err != nil {
+		return err
+	}
+
+	return n.handleDeleteNamespace(mainCtx, &stypes.Namespace{Name: state.Namespace})
+}
+
+// checkServiceKind returns true if the service of the provided state is
+// registered, and an error if it is registered for a Kubernetes object of a
+// different kind, e.g. if the state is for ingress foo and the service was
+// registered for the Kubernetes service ingress-foo.
+func (n *namespaceWorker) checkServiceKind(mainCtx context.Context, state *ServiceState) (bool, error) {
+	ctx, canc := context.WithTimeout(mainCtx, time.Minute)
+	defer canc()
+
+	start := time.Now()
+	serv, err := n.nsop.Service(state.Name).Get(ctx)
+	observeRegistryCall(n.registry, opGet, kindService, start, err)
+	switch {
+	case serrors.IsNotFound(err):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	if kind := serv.Metadata[kindKey]; kind != state.Kind {
+		return true, fmt.Errorf("%w: service %s is registered for a %s, not for a %s",
+			errKindConflict, state.Name, getKindName(kind), getKindName(state.Kind))
+	}
+
+	return true, nil
+}
+
+func (n *namespaceWorker) listEndpoints(mainCtx context.Context, serviceName string) ([]*stypes.Endpoint, error) {
+	ctx, canc := context.WithTimeout(mainCtx, time.Minute)
+	defer canc()
+
+	endpoints := []*stypes.Endpoint{}
+	iterator := n.nsop.Service(serviceName).Endpoint(serego.Any).List()
+	for {
+		start := time.Now()
+		ep, _, err := iterator.Next(ctx)
+		observeRegistryCall(n.registry, opList, kindEndpoint, start, err)
+		switch {
+		case serrors.IsIteratorDone(err), serrors.IsNotFound(err):
+			return endpoints, nil
+		case err != nil:
+			return nil, err
 		}
 
+		endpoints = append(endpoints, ep)
+	}
+}
+
+// registerNamespace registers the namespace, if it does not exist or its
+// metadata changed. If not nil, metadata replaces the one that the operator
+// registered on the namespace before.
+func (n *namespaceWorker) registerNamespace(mainCtx context.Context, metadata map[string]string) error {
+	ctx, canc := context.WithTimeout(mainCtx, time.Minute)
+	defer canc()
+
+	l := n.log.With().Logger()
+
+	currMeta := map[string]string{}
+	start := time.Now()
+	ns, err := n.nsop.Get(ctx)
+	observeRegistryCall(n.registry, opGet, kindNamespace, start, err)
+	switch {
+	case err == nil:
+		currMeta = ns.Metadata
+	case !serrors.IsNotFound(err):
+		l.Err(err).Msg("cannot check if namespace exists")
+		return err
+	}
+
+	nextMeta := n.getObjectMetadata(currMeta, metadata)
+	if err == nil && !isMetadataChanged(currMeta, nextMeta) {
+		l.Debug().Msg("namespace is up to date")
+		return nil
+	}
+
+	l.Info().Msg("registering namespace...")
+	start = time.Now()
+	err = n.nsop.Register(ctx,
+		register.WithReplaceMetadata(),
+		register.WithMetadata(nextMeta))
+	observeRegistryCall(n.registry, opRegister, kindNamespace, start, err)
+	if err != nil {
+		l.Err(err).Msg("could not registrer namespace")
+		return err
+	}
+
+	l.Info().Msg("namespace correctly registered")
+	return nil
+}
+
+// registerService registers the service, if it does not exist or its
+// metadata changed. If not nil, metadata replaces the one that the operator
+// registered on the service before.
+func (n *namespaceWorker) registerService(mainCtx context.Context, name string, metadata map[string]string) error {
+	ctx, canc := context.WithTimeout(mainCtx, time.Minute)
+	defer canc()
+
+	l := n.log.With().Str("service-name", name).Logger()
+
+	currMeta := map[string]string{}
+	sop := n.nsop.Service(name)
+	start := time.Now()
+	serv, err := sop.Get(ctx)
+	observeRegistryCall(n.registry, opGet, kindService, start, err)
+	switch {
+	case err == nil:
+		currMeta = serv.Metadata
+	case !serrors.IsNotFound(err):
+		l.Err(err).Msg("cannot check if service exists")
+		return err
+	}
+
+	nextMeta := n.getObjectMetadata(currMeta, metadata)
+	if err == nil && !isMetadataChanged(currMeta, nextMeta) {
+		l.Debug().Msg("service is up to date")
+		return nil
+	}
+
+	l.Info().Msg("registering service...")
+	start = time.Now()
+	err = sop.Register(ctx,
+		register.WithReplaceMetadata(),
+		register.WithMetadata(nextMeta))
+	observeRegistryCall(n.registry, opRegister, kindService, start, err)
+	if err != nil {
+		l.Err(err).Msg("could not registrer service")
+		return err
 	}
+
+	l.Info().Msg("service correctly registered")
+	return nil
 }
 
-func (n *namespaceWorker) handleDeleteEndpoint(mainCtx context.Context, endpoint *stypes.Endpoint) {
+func (n *namespaceWorker) registerEndpoint(mainCtx context.Context, endpoint *stypes.Endpoint) error {
+	ctx, canc := context.WithTimeout(mainCtx, time.Minute)
+	defer canc()
+
+	l := n.log.With().
+		Str("service-name", endpoint.Service).
+		Str("endpoint-name", endpoint.Name).
+		Logger()
+	l.Info().Msg("registering endpoint...")
+
+	// Metadata is replaced, so that annotations removed from the service
+	// are removed from the endpoint as well.
+	start := time.Now()
+	err := n.nsop.Service(endpoint.Service).Endpoint(endpoint.Name).Register(ctx,
+		withAddress(endpoint.Address),
+		register.WithPort(endpoint.Port),
+		register.WithReplaceMetadata(),
+		register.WithMetadata(endpoint.Metadata),
+		register.WithMetadata(n.endpointMeta))
+	observeRegistryCall(n.registry, opRegister, kindEndpoint, start, err)
+	if err != nil {
+		l.Err(err).Msg("could not registrer endpoint")
+		return err
+	}
+
+	l.Info().Msg("endpoint correctly registered")
+	return nil
+}
+
+func (n *namespaceWorker) handleDeleteEndpoint(mainCtx context.Context, endpoint *stypes.Endpoint) error {
 	ctx, canc := context.WithTimeout(mainCtx, time.Minute)
 	defer canc()
 
@@ -125,32 +413,51 @@ func (n *namespaceWorker) handleDeleteEndpoint(mainCtx context.Context, endpoint
 		Str("endpoint", endpoint.Name).
 		Logger()
 
-	eop := n.nsop.Service(endpoint.Service).Endpoint(endpoint.Name)
-
-	ep, err := eop.Get(ctx)
+	start := time.Now()
+	ep, err := n.nsop.Service(endpoint.Service).Endpoint(endpoint.Name).Get(ctx)
+	observeRegistryCall(n.registry, opGet, kindEndpoint, start, err)
 	if err != nil {
-		l.Warn().AnErr("error", err).Msg("cannot check if endpoint exists: it " +
-			"might be already deleted")
-		return
+		if serrors.IsNotFound(err) {
+			l.Debug().Msg("endpoint does not exist: nothing to delete")
+			return nil
+		}
+
+		l.Err(err).Msg("cannot check if endpoint exists")
+		return err
 	}
 
-	if !isOwnedByOperator(ep.Metadata) {
-		l.Info().Str("reason", "not managed by CNWAN-Operator").
+	if !isOwnedByCluster(ep.Metadata, n.clusterID) {
+		l.Info().Str("reason", "not managed by CNWAN-Operator in this cluster").
 			Msg("skipping endpoint deletion")
-		return
+		return nil
 	}
 
+	return n.deregisterEndpoint(ctx, ep)
+}
+
+func (n *namespaceWorker) deregisterEndpoint(mainCtx context.Context, endpoint *stypes.Endpoint) error {
+	ctx, canc := context.WithTimeout(mainCtx, time.Minute)
+	defer canc()
+
+	l := n.log.With().
+		Str("service", endpoint.Service).
+		Str("endpoint", endpoint.Name).
+		Logger()
+
 	l.Info().Msg("deleting endpoint...")
-	err = eop.Deregister(ctx)
+	start := time.Now()
+	err := n.nsop.Service(endpoint.Service).Endpoint(endpoint.Name).Deregister(ctx)
+	observeRegistryCall(n.registry, opDeregister, kindEndpoint, start, err)
 	if err != nil {
 		l.Err(err).Msg("cannot delete endpoint")
-		return
+		return err
 	}
 
 	l.Info().Msg("endpoint successfully deleted")
+	return nil
 }
 
-func (n *namespaceWorker) handleDeleteService(mainCtx context.Context, service *stypes.Service) {
+func (n *namespaceWorker) handleDeleteService(mainCtx context.Context, service *stypes.Service) error {
 	ctx, canc := context.WithTimeout(mainCtx, time.Minute)
 	defer canc()
 
@@ -158,75 +465,168 @@ func (n *namespaceWorker) handleDeleteService(mainCtx context.Context, service *
 
 	sop := n.nsop.Service(service.Name)
 
+	start := time.Now()
 	srv, err := sop.Get(ctx)
+	observeRegistryCall(n.registry, opGet, kindService, start, err)
 	if err != nil {
-		l.Warn().AnErr("error", err).Msg("cannot check if service exists: it " +
-			"might be already deleted")
-		return
+		if serrors.IsNotFound(err) {
+			l.Debug().Msg("service does not exist: nothing to delete")
+			return nil
+		}
+
+		l.Err(err).Msg("cannot check if service exists")
+		return err
+	}
+
+	if !isReferencedByCluster(srv.Metadata, n.clusterID) {
+		l.Info().Str("reason", "not managed by CNWAN-Operator in this cluster").
+			Msg("skipping service deletion")
+		return nil
 	}
 
-	if !isOwnedByOperator(srv.Metadata) {
-		l.Info().Str("reason", "not managed by CNWAN-Operator").
+	if clusters := removeClusterReference(srv.Metadata, n.clusterID); clusters != "" {
+		l.Info().Str("reason", "used by other clusters").
 			Msg("skipping service deletion")
-		return
+		start = time.Now()
+		err = sop.Register(ctx, register.WithMetadataKeyValue(clustersKey, clusters))
+		observeRegistryCall(n.registry, opRegister, kindService, start, err)
+		return err
 	}
 
+	start = time.Now()
 	_, _, err = sop.Endpoint(serego.Any).List().Next(ctx)
+	observeRegistryCall(n.registry, opList, kindEndpoint, start, err)
 	switch {
 	case err != nil && !serrors.IsIteratorDone(err):
 		l.Err(err).Msg("cannot check if service is empty")
-		return
+		return err
 	case err == nil:
 		l.Info().Str("reason", "not empty").
 			Msg("skipping service deletion")
-		return
+		return nil
 	}
 
 	l.Info().Msg("deleting service...")
+	start = time.Now()
 	err = sop.Deregister(ctx)
+	observeRegistryCall(n.registry, opDeregister, kindService, start, err)
 	if err != nil {
 		l.Err(err).Msg("cannot delete service")
-		return
+		return err
 	}
 
 	l.Info().Msg("service successfully deleted")
+	return nil
 }
 
-func (n *namespaceWorker) handleDeleteNamespace(mainCtx context.Context, namespace *stypes.Namespace) {
+func (n *namespaceWorker) handleDeleteNamespace(mainCtx context.Context, namespace *stypes.Namespace) error {
 	ctx, canc := context.WithTimeout(mainCtx, time.Minute)
 	defer canc()
 
 	l := n.log.With().Str("namespace", namespace.Name).Logger()
 
+	start := time.Now()
 	ns, err := n.nsop.Get(ctx)
+	observeRegistryCall(n.registry, opGet, kindNamespace, start, err)
 	if err != nil {
+		if serrors.IsNotFound(err) {
+			l.Debug().Msg("namespace does not exist: nothing to delete")
+			return nil
+		}
+
 		l.Err(err).Msg("cannot check if namespace exists: won't be deleted")
-		return
+		return err
 	}
 
-	if !isOwnedByOperator(ns.Metadata) {
-		l.Info().Str("reason", "not managed by CNWAN-Operator").
-			Msg("skipping service deletion")
-		return
+	if !isReferencedByCluster(ns.Metadata, n.clusterID) {
+		l.Info().Str("reason", "not managed by CNWAN-Operator in this cluster").
+			Msg("skipping namespace deletion")
+		return nil
 	}
 
-	_, _, err = n.nsop.Service(serego.Any).List().Next(ctx)
-	switch {
-	case err != nil && !serrors.IsIteratorDone(err):
-		l.Err(err).Msg("cannot check if namespace is empty")
-		return
-	case err == nil:
+	// The reference to this cluster must be kept as long as any of the
+	// services inside the namespace is still used by this cluster, or the
+	// garbage collector would not find them anymore.
+	empty := true
+	servIterator := n.nsop.Service(serego.Any).List()
+	for {
+		start = time.Now()
+		serv, _, err := servIterator.Next(ctx)
+		observeRegistryCall(n.registry, opList, kindService, start, err)
+		if err != nil {
+			if serrors.IsIteratorDone(err) {
+				break
+			}
+
+			l.Err(err).Msg("cannot check if namespace is empty")
+			return err
+		}
+
+		if isReferencedByCluster(serv.Metadata, n.clusterID) {
+			l.Info().Str("reason", "used by other services of this cluster").
+				Msg("skipping namespace deletion")
+			return nil
+		}
+		empty = false
+	}
+
+	if clusters := removeClusterReference(ns.Metadata, n.clusterID); clusters != "" {
+		l.Info().Str("reason", "used by other clusters").
+			Msg("skipping namespace deletion")
+		start = time.Now()
+		err = n.nsop.Register(ctx, register.WithMetadataKeyValue(clustersKey, clusters))
+		observeRegistryCall(n.registry, opRegister, kindNamespace, start, err)
+		return err
+	}
+
+	if !empty {
 		l.Info().Str("reason", "not empty").
 			Msg("skipping namespace deletion")
-		return
+		return nil
 	}
 
 	l.Info().Msg("deleting namespace...")
+	start = time.Now()
 	err = n.nsop.Deregister(ctx)
+	observeRegistryCall(n.registry, opDeregister, kindNamespace, start, err)
 	if err != nil {
 		l.Err(err).Msg("cannot delete namespace")
-		return
+		return err
 	}
 
 	l.Info().Msg("namespace successfully deleted")
+	return nil
+}
+
+// getObjectMetadata returns the metadata that a namespace or service that
+// currently has the provided metadata must have: the persistent one, the
+// reference to this cluster and, unless nil, the provided metadata in place
+// of the one that the operator registered before.
+func (n *namespaceWorker) getObjectMetadata(currMeta, metadata map[string]string) map[string]string {
+	next := map[string]string{}
+	for k, v := range currMeta {
+		next[k] = v
+	}
+	if metadata != nil {
+		next = replaceManagedMetadata(next, metadata)
+	}
+	for k, v := range n.persistentMeta {
+		next[k] = v
+	}
+	for k, v := range n.getClusterReferenceMeta(currMeta) {
+		next[k] = v
+	}
+
+	return next
+}
+
+// getClusterReferenceMeta returns the metadata that must be registered on a
+// namespace or service that currently has the provided metadata, so that
+// this cluster is listed among the ones using it.
+func (n *namespaceWorker) getClusterReferenceMeta(currMeta map[string]string) map[string]string {
+	if n.clusterID == "" {
+		return map[string]string{}
+	}
+
+	return map[string]string{clustersKey: addClusterReference(currMeta, n.clusterID)}
 }
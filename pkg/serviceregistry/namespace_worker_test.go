@@ -0,0 +1,591 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package serviceregistry
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	stypes "github.com/CloudNativeSDWAN/serego/api/core/types"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type memObject struct {
+	metadata map[string]string
+	address  string
+	port     int32
+}
+
+// memRegistry is an in-memory Registry, where objects are stored by their
+// path, e.g. ns/serv/ep.
+type memRegistry struct {
+	lock    sync.Mutex
+	objects map[string]*memObject
+}
+
+func newMemRegistry() *memRegistry {
+	return &memRegistry{objects: map[string]*memObject{}}
+}
+
+func (m *memRegistry) get(objPath string, errNotFound error) (*memObject, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	obj, exists := m.objects[objPath]
+	if !exists {
+		return nil, errNotFound
+	}
+
+	return obj, nil
+}
+
+func (m *memRegistry) register(objPath string, opts []register.Option, errNotFound, errAlreadyExists error) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if parent := path.Dir(objPath); parent != "." {
+		if _, exists := m.objects[parent]; !exists {
+			return fmt.Errorf("parent %s does not exist", parent)
+		}
+	}
+
+	obj, exists := m.objects[objPath]
+	var currMeta map[string]string
+	if exists {
+		currMeta = obj.metadata
+	}
+
+	regOpts, metadata, err := PrepareRegister(opts, currMeta, exists, errNotFound, errAlreadyExists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		obj = &memObject{}
+		m.objects[objPath] = obj
+	}
+	obj.metadata = metadata
+	if regOpts.Address != nil {
+		obj.address = *regOpts.Address
+	}
+	if regOpts.Port != nil {
+		obj.port = *regOpts.Port
+	}
+
+	return nil
+}
+
+func (m *memRegistry) deregister(objPath string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for p := range m.objects {
+		if p == objPath || strings.HasPrefix(p, objPath+"/") {
+			delete(m.objects, p)
+		}
+	}
+
+	return nil
+}
+
+// children returns the names of the objects directly under parent, which is
+// empty for namespaces.
+func (m *memRegistry) children(parent string) func(context.Context) ([]string, error) {
+	return func(context.Context) ([]string, error) {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		names := []string{}
+		for p := range m.objects {
+			if path.Dir(p) == parent || (parent == "" && path.Dir(p) == ".") {
+				names = append(names, path.Base(p))
+			}
+		}
+		sort.Strings(names)
+
+		return names, nil
+	}
+}
+
+func (m *memRegistry) Namespace(name string) NamespaceOperation {
+	return &memNamespace{m, name}
+}
+
+type memNamespace struct {
+	registry *memRegistry
+	name     string
+}
+
+func (n *memNamespace) Get(_ context.Context) (*stypes.Namespace, error) {
+	obj, err := n.registry.get(n.name, serrors.NamespaceNotFound)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stypes.Namespace{Name: n.name, Metadata: obj.metadata}, nil
+}
+
+func (n *memNamespace) Register(_ context.Context, opts ...register.Option) error {
+	return n.registry.register(n.name, opts, serrors.NamespaceNotFound, serrors.NamespaceAlreadyExists)
+}
+
+func (n *memNamespace) Deregister(_ context.Context) error {
+	return n.registry.deregister(n.name)
+}
+
+func (n *memNamespace) List() NamespaceIterator {
+	return &memNamespaceIterator{NewLister(n.registry.children("")), n.registry}
+}
+
+func (n *memNamespace) Service(name string) ServiceOperation {
+	return &memService{n.registry, n.name, name}
+}
+
+type memNamespaceIterator struct {
+	*Lister[string]
+	registry *memRegistry
+}
+
+func (i *memNamespaceIterator) Next(ctx context.Context) (*stypes.Namespace, NamespaceOperation, error) {
+	name, err := i.Lister.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nsop := i.registry.Namespace(name)
+	ns, err := nsop.Get(ctx)
+	return ns, nsop, err
+}
+
+type memService struct {
+	registry  *memRegistry
+	namespace string
+	name      string
+}
+
+func (s *memService) path() string {
+	return path.Join(s.namespace, s.name)
+}
+
+func (s *memService) Get(_ context.Context) (*stypes.Service, error) {
+	obj, err := s.registry.get(s.path(), serrors.ServiceNotFound)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stypes.Service{Namespace: s.namespace, Name: s.name, Metadata: obj.metadata}, nil
+}
+
+func (s *memService) Register(_ context.Context, opts ...register.Option) error {
+	return s.registry.register(s.path(), opts, serrors.ServiceNotFound, serrors.ServiceAlreadyExists)
+}
+
+func (s *memService) Deregister(_ context.Context) error {
+	return s.registry.deregister(s.path())
+}
+
+func (s *memService) List() ServiceIterator {
+	return &memServiceIterator{NewLister(s.registry.children(s.namespace)), s.registry, s.namespace}
+}
+
+func (s *memService) Endpoint(name string) EndpointOperation {
+	return &memEndpoint{s.registry, s.namespace, s.name, name}
+}
+
+type memServiceIterator struct {
+	*Lister[string]
+	registry  *memRegistry
+	namespace string
+}
+
+func (i *memServiceIterator) Next(ctx context.Context) (*stypes.Service, ServiceOperation, error) {
+	name, err := i.Lister.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sop := &memService{i.registry, i.namespace, name}
+	serv, err := sop.Get(ctx)
+	return serv, sop, err
+}
+
+type memEndpoint struct {
+	registry  *memRegistry
+	namespace string
+	service   string
+	name      string
+}
+
+func (e *memEndpoint) path() string {
+	return path.Join(e.namespace, e.service, e.name)
+}
+
+func (e *memEndpoint) Get(_ context.Context) (*stypes.Endpoint, error) {
+	obj, err := e.registry.get(e.path(), serrors.EndpointNotFound)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stypes.Endpoint{
+		Namespace: e.namespace,
+		Service:   e.service,
+		Name:      e.name,
+		Address:   obj.address,
+		Port:      obj.port,
+		Metadata:  obj.metadata,
+	}, nil
+}
+
+func (e *memEndpoint) Register(_ context.Context, opts ...register.Option) error {
+	return e.registry.register(e.path(), opts, serrors.EndpointNotFound, serrors.EndpointAlreadyExists)
+}
+
+func (e *memEndpoint) Deregister(_ context.Context) error {
+	return e.registry.deregister(e.path())
+}
+
+func (e *memEndpoint) List() EndpointIterator {
+	return &memEndpointIterator{NewLister(e.registry.children(path.Join(e.namespace, e.service))), e.registry, e.namespace, e.service}
+}
+
+type memEndpointIterator struct {
+	*Lister[string]
+	registry  *memRegistry
+	namespace string
+	service   string
+}
+
+func (i *memEndpointIterator) Next(ctx context.Context) (*stypes.Endpoint, EndpointOperation, error) {
+	name, err := i.Lister.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	epop := &memEndpoint{i.registry, i.namespace, i.service, name}
+	ep, err := epop.Get(ctx)
+	return ep, epop, err
+}
+
+func TestHandleSyncSharedNamespace(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	r := newMemRegistry()
+	r.objects["ns"] = &memObject{metadata: map[string]string{ownerKey: "cnwan-operator", clustersKey: "c1 c2"}}
+	r.objects["ns/other"] = &memObject{metadata: map[string]string{ownerKey: "cnwan-operator", clustersKey: "c2"}}
+	for _, serv := range []string{"serv-1", "serv-2"} {
+		r.objects["ns/"+serv] = &memObject{metadata: map[string]string{ownerKey: "cnwan-operator", clustersKey: "c1"}}
+		r.objects["ns/"+serv+"/ep"] = &memObject{
+			address:  "10.10.10.10",
+			port:     80,
+			metadata: map[string]string{ownerKey: "cnwan-operator", clusterIDKey: "c1"},
+		}
+	}
+
+	n := &namespaceWorker{
+		nsop:           r.Namespace("ns"),
+		registry:       "test",
+		log:            zerolog.Nop(),
+		clusterID:      "c1",
+		persistentMeta: map[string]string{ownerKey: "cnwan-operator"},
+		endpointMeta:   map[string]string{ownerKey: "cnwan-operator", clusterIDKey: "c1"},
+	}
+
+	// serv-2 is still used by this cluster, so the namespace must still
+	// reference it.
+	a.NoError(n.handleSync(ctx, &ServiceState{Namespace: "ns", Name: "serv-1"}))
+	a.NotContains(r.objects, "ns/serv-1")
+	a.Equal("c1 c2", r.objects["ns"].metadata[clustersKey])
+
+	e := &EventHandler{registries: []*registryHandler{{name: "test", registry: r, clusterID: "c1"}}}
+	owned, err := e.ListOwnedNamespaces(ctx)
+	a.NoError(err)
+	a.Equal([]*OwnedNamespace{{Name: "ns", Services: []*ServiceState{{
+		Namespace: "ns",
+		Name:      "serv-2",
+		Endpoints: []*stypes.Endpoint{{
+			Namespace: "ns",
+			Service:   "serv-2",
+			Name:      "ep",
+			Address:   "10.10.10.10",
+			Port:      80,
+			Metadata:  map[string]string{ownerKey: "cnwan-operator", clusterIDKey: "c1"},
+		}},
+	}}}}, owned)
+
+	a.NoError(n.handleSync(ctx, &ServiceState{Namespace: "ns", Name: "serv-2"}))
+	a.NotContains(r.objects, "ns/serv-2")
+	a.Equal("c2", r.objects["ns"].metadata[clustersKey])
+	a.Contains(r.objects, "ns/other")
+}
+
+func TestHandleSyncKindConflict(t *testing.T) {
+	cases := []struct {
+		id             string
+		name           string
+		registeredKind string
+		kind           string
+		desired        bool
+		expConflict    bool
+	}{
+		{
+			id:          "ingress-over-service",
+			name:        "ingress-foo",
+			kind:        "Ingress",
+			desired:     true,
+			expConflict: true,
+		},
+		{
+			id:             "service-over-ingress",
+			name:           "ingress-foo",
+			registeredKind: "Ingress",
+			expConflict:    true,
+		},
+		{
+			id:          "gateway-over-service",
+			name:        "gateway-foo",
+			kind:        "Gateway",
+			desired:     true,
+			expConflict: true,
+		},
+		{
+			id:             "service-over-gateway",
+			name:           "gateway-foo",
+			registeredKind: "Gateway",
+			expConflict:    true,
+		},
+		{
+			id:          "httproute-over-service",
+			name:        "httproute-foo",
+			kind:        "HTTPRoute",
+			desired:     true,
+			expConflict: true,
+		},
+		{
+			id:             "service-over-httproute",
+			name:           "httproute-foo",
+			registeredKind: "HTTPRoute",
+			expConflict:    true,
+		},
+		{
+			id:             "same-kind",
+			name:           "ingress-foo",
+			registeredKind: "Ingress",
+			kind:           "Ingress",
+			desired:        true,
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		servMeta := map[string]string{ownerKey: "cnwan-operator", clustersKey: "c1"}
+		if currCase.registeredKind != "" {
+			servMeta[kindKey] = currCase.registeredKind
+			servMeta[metadataKeysKey] = kindKey
+		}
+
+		r := newMemRegistry()
+		r.objects["ns"] = &memObject{metadata: map[string]string{ownerKey: "cnwan-operator", clustersKey: "c1"}}
+		r.objects["ns/"+currCase.name] = &memObject{metadata: servMeta}
+		r.objects["ns/"+currCase.name+"/registered"] = &memObject{
+			address:  "10.10.10.10",
+			port:     80,
+			metadata: map[string]string{ownerKey: "cnwan-operator", clusterIDKey: "c1"},
+		}
+
+		n := &namespaceWorker{
+			nsop:           r.Namespace("ns"),
+			registry:       "test",
+			log:            zerolog.Nop(),
+			clusterID:      "c1",
+			persistentMeta: map[string]string{ownerKey: "cnwan-operator"},
+			endpointMeta:   map[string]string{ownerKey: "cnwan-operator", clusterIDKey: "c1"},
+		}
+
+		state := &ServiceState{Namespace: "ns", Name: currCase.name, Kind: currCase.kind}
+		if currCase.desired {
+			state.Endpoints = []*stypes.Endpoint{{
+				Namespace: "ns",
+				Service:   currCase.name,
+				Name:      "desired",
+				Address:   "10.10.10.11",
+				Port:      80,
+			}}
+		}
+
+		// A conflict is not an error, as trying again would not help.
+		err := n.handleSync(context.Background(), state)
+		if currCase.expConflict {
+			// Nothing of what the other object registered can be touched.
+			if !a.NoError(err) ||
+				!a.Contains(r.objects, "ns/"+currCase.name+"/registered") ||
+				!a.NotContains(r.objects, "ns/"+currCase.name+"/desired") ||
+				!a.Equal(servMeta, r.objects["ns/"+currCase.name].metadata) {
+				a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+			}
+			continue
+		}
+
+		if !a.NoError(err) ||
+			!a.NotContains(r.objects, "ns/"+currCase.name+"/registered") ||
+			!a.Contains(r.objects, "ns/"+currCase.name+"/desired") ||
+			!a.Equal(currCase.kind, r.objects["ns/"+currCase.name].metadata[kindKey]) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}
+
+func TestHandleSyncNotRegistered(t *testing.T) {
+	a := assert.New(t)
+
+	n := &namespaceWorker{
+		nsop:           newMemRegistry().Namespace("ns"),
+		registry:       "not-registered",
+		log:            zerolog.Nop(),
+		clusterID:      "c1",
+		persistentMeta: map[string]string{ownerKey: "cnwan-operator"},
+		endpointMeta:   map[string]string{ownerKey: "cnwan-operator", clusterIDKey: "c1"},
+	}
+	calls := func(operation, kind string) float64 {
+		return testutil.ToFloat64(registryOperationsTotal.WithLabelValues("not-registered", operation, kind, resultSuccess)) +
+			testutil.ToFloat64(registryOperationsTotal.WithLabelValues("not-registered", operation, kind, resultNotFound))
+	}
+
+	// Only the service is looked up.
+	a.NoError(n.handleSync(context.Background(), &ServiceState{Namespace: "ns", Name: "serv"}))
+	a.Equal(float64(1), calls(opGet, kindService))
+	a.Zero(calls(opList, kindEndpoint))
+	a.Zero(calls(opGet, kindNamespace))
+}
+
+// awsTagValue matches the values that AWS accepts for tags, which is how
+// Cloud Map stores the metadata of namespaces and services.
+var awsTagValue = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]*$`)
+
+// cloudMapRegistry is an in-memory Registry that, like Cloud Map, rejects
+// metadata of namespaces and services that is not valid for AWS tags.
+type cloudMapRegistry struct {
+	*memRegistry
+}
+
+func (c *cloudMapRegistry) Namespace(name string) NamespaceOperation {
+	return &cloudMapNamespace{c.memRegistry.Namespace(name)}
+}
+
+type cloudMapNamespace struct {
+	NamespaceOperation
+}
+
+func (n *cloudMapNamespace) Register(ctx context.Context, opts ...register.Option) error {
+	if err := checkTagValues(opts); err != nil {
+		return err
+	}
+
+	return n.NamespaceOperation.Register(ctx, opts...)
+}
+
+func (n *cloudMapNamespace) Service(name string) ServiceOperation {
+	return &cloudMapService{n.NamespaceOperation.Service(name)}
+}
+
+type cloudMapService struct {
+	ServiceOperation
+}
+
+func (s *cloudMapService) Register(ctx context.Context, opts ...register.Option) error {
+	if err := checkTagValues(opts); err != nil {
+		return err
+	}
+
+	return s.ServiceOperation.Register(ctx, opts...)
+}
+
+func checkTagValues(opts []register.Option) error {
+	regOpts := &register.Options{}
+	for _, opt := range opts {
+		if err := opt(regOpts); err != nil {
+			return err
+		}
+	}
+
+	for key, val := range regOpts.Metadata {
+		if !awsTagValue.MatchString(val) {
+			return fmt.Errorf("invalid value for tag %s: %s", key, val)
+		}
+	}
+
+	return nil
+}
+
+func TestHandleSyncCloudMap(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	r := &cloudMapRegistry{newMemRegistry()}
+	newWorker := func(clusterID string) *namespaceWorker {
+		return &namespaceWorker{
+			nsop:           r.Namespace("ns"),
+			registry:       "cloud-map",
+			log:            zerolog.Nop(),
+			clusterID:      clusterID,
+			persistentMeta: map[string]string{ownerKey: "cnwan-operator"},
+			endpointMeta:   map[string]string{ownerKey: "cnwan-operator", clusterIDKey: clusterID},
+		}
+	}
+	newState := func(address string) *ServiceState {
+		return &ServiceState{
+			Namespace:         "ns",
+			Name:              "serv",
+			NamespaceMetadata: map[string]string{"team": "shop", "env": "prod"},
+			ServiceMetadata:   map[string]string{"version": "v1", "traffic-profile": "standard"},
+			Endpoints: []*stypes.Endpoint{{
+				Namespace: "ns",
+				Service:   "serv",
+				Name:      "ep-" + address,
+				Address:   address,
+				Port:      80,
+			}},
+		}
+	}
+
+	// Both clusters reference the shared namespace and service.
+	c1, c2 := newWorker("c1"), newWorker("c2")
+	a.NoError(c1.handleSync(ctx, newState("10.10.10.10")))
+	a.NoError(c2.handleSync(ctx, newState("10.10.10.11")))
+	a.Equal([]string{"c1", "c2"}, getClusterReferences(r.objects["ns"].metadata))
+	a.Equal([]string{"c1", "c2"}, getClusterReferences(r.objects["ns/serv"].metadata))
+	a.Equal([]string{"env", "team"}, splitList(r.objects["ns"].metadata[metadataKeysKey]))
+	a.Equal([]string{"traffic-profile", "version"}, splitList(r.objects["ns/serv"].metadata[metadataKeysKey]))
+
+	a.NoError(c1.handleSync(ctx, &ServiceState{Namespace: "ns", Name: "serv"}))
+	a.NotContains(r.objects, "ns/serv/ep-10.10.10.10")
+	a.Contains(r.objects, "ns/serv/ep-10.10.10.11")
+	a.Equal([]string{"c2"}, getClusterReferences(r.objects["ns"].metadata))
+	a.Equal([]string{"c2"}, getClusterReferences(r.objects["ns/serv"].metadata))
+}
@@ -0,0 +1,177 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package serviceregistry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	serego "github.com/CloudNativeSDWAN/serego/api/core"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+)
+
+// OwnedNamespace is a namespace registered by the operator on the service
+// registry, along with the services inside it that are owned by the operator.
+//
+// Namespaces and services are included if they are used by the cluster where
+// the operator is running, even if other clusters are using them as well.
+type OwnedNamespace struct {
+	Name string
+	// Services contains the services owned by the operator, each one with
+	// the endpoints owned by the operator that are currently registered.
+	Services []*ServiceState
+}
+
+// ListOwnedNamespaces returns all namespaces, services and endpoints that
+// are currently registered on the service registries and are owned by the
+// operator running in this cluster. An object is included if it is
+// registered on at least one of them.
+//
+// Service registries that cannot be listed are skipped, so that they do not
+// prevent orphans from being removed from the other ones, and an error is
+// only returned if none of them could be listed.
+func (e *EventHandler) ListOwnedNamespaces(mainCtx context.Context) ([]*OwnedNamespace, error) {
+	ctx, canc := context.WithTimeout(mainCtx, 5*time.Minute)
+	defer canc()
+
+	lists := [][]*OwnedNamespace{}
+	errs := []error{}
+	for _, reg := range e.registries {
+		namespaces, err := reg.listOwnedNamespaces(ctx)
+		if err != nil {
+			reg.log.Err(err).Msg("cannot list objects owned by the operator: skipping...")
+			errs = append(errs, fmt.Errorf("%s: %w", reg.name, err))
+			continue
+		}
+
+		lists = append(lists, namespaces)
+	}
+
+	if len(lists) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return mergeOwnedNamespaces(lists...), nil
+}
+
+func (r *registryHandler) listOwnedNamespaces(ctx context.Context) ([]*OwnedNamespace, error) {
+	namespaces := []*OwnedNamespace{}
+	nsIterator := r.registry.Namespace(serego.Any).List()
+	for {
+		start := time.Now()
+		ns, nsop, err := nsIterator.Next(ctx)
+		observeRegistryCall(r.name, opList, kindNamespace, start, err)
+		if err != nil {
+			if serrors.IsIteratorDone(err) {
+				return namespaces, nil
+			}
+
+			return nil, err
+		}
+
+		if !isReferencedByCluster(ns.Metadata, r.clusterID) {
+			continue
+		}
+
+		ownedNs := &OwnedNamespace{Name: ns.Name, Services: []*ServiceState{}}
+		servIterator := nsop.Service(serego.Any).List()
+		for {
+			start := time.Now()
+			serv, sop, err := servIterator.Next(ctx)
+			observeRegistryCall(r.name, opList, kindService, start, err)
+			if err != nil {
+				if serrors.IsIteratorDone(err) {
+					break
+				}
+
+				return nil, err
+			}
+
+			if !isReferencedByCluster(serv.Metadata, r.clusterID) {
+				continue
+			}
+
+			state := &ServiceState{Namespace: ns.Name, Name: serv.Name, Kind: serv.Metadata[kindKey]}
+			epIterator := sop.Endpoint(serego.Any).List()
+			for {
+				start := time.Now()
+				ep, _, err := epIterator.Next(ctx)
+				observeRegistryCall(r.name, opList, kindEndpoint, start, err)
+				if err != nil {
+					if serrors.IsIteratorDone(err) {
+						break
+					}
+
+					return nil, err
+				}
+
+				if isOwnedByCluster(ep.Metadata, r.clusterID) {
+					state.Endpoints = append(state.Endpoints, ep)
+				}
+			}
+
+			ownedNs.Services = append(ownedNs.Services, state)
+		}
+
+		namespaces = append(namespaces, ownedNs)
+	}
+}
+
+// mergeOwnedNamespaces returns the union of the provided lists, in the order
+// in which namespaces, services and endpoints first appear.
+func mergeOwnedNamespaces(lists ...[]*OwnedNamespace) []*OwnedNamespace {
+	merged := []*OwnedNamespace{}
+	namespaces := map[string]*OwnedNamespace{}
+	services := map[string]*ServiceState{}
+	endpoints := map[string]bool{}
+
+	for _, list := range lists {
+		for _, ns := range list {
+			mergedNs, exists := namespaces[ns.Name]
+			if !exists {
+				mergedNs = &OwnedNamespace{Name: ns.Name, Services: []*ServiceState{}}
+				namespaces[ns.Name] = mergedNs
+				merged = append(merged, mergedNs)
+			}
+
+			for _, serv := range ns.Services {
+				servPath := path.Join(serv.Namespace, serv.Name)
+				mergedServ, exists := services[servPath]
+				if !exists {
+					mergedServ = &ServiceState{Namespace: serv.Namespace, Name: serv.Name, Kind: serv.Kind}
+					services[servPath] = mergedServ
+					mergedNs.Services = append(mergedNs.Services, mergedServ)
+				}
+
+				for _, ep := range serv.Endpoints {
+					epPath := path.Join(servPath, ep.Name)
+					if !endpoints[epPath] {
+						endpoints[epPath] = true
+						mergedServ.Endpoints = append(mergedServ.Endpoints, ep)
+					}
+				}
+			}
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,55 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package serviceregistry
+
+import (
+	"testing"
+
+	serego "github.com/CloudNativeSDWAN/serego/api/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeOwnedNamespaces(t *testing.T) {
+	a := assert.New(t)
+	ep := func(serv, name string) *serego.Endpoint {
+		return &serego.Endpoint{Namespace: "ns", Service: serv, Name: name}
+	}
+
+	etcd := []*OwnedNamespace{
+		{Name: "ns", Services: []*ServiceState{
+			{Namespace: "ns", Name: "serv-1", Endpoints: []*serego.Endpoint{ep("serv-1", "ep-1")}},
+		}},
+	}
+	cloudMap := []*OwnedNamespace{
+		{Name: "empty", Services: []*ServiceState{}},
+		{Name: "ns", Services: []*ServiceState{
+			{Namespace: "ns", Name: "serv-1", Endpoints: []*serego.Endpoint{ep("serv-1", "ep-1"), ep("serv-1", "ep-2")}},
+			{Namespace: "ns", Name: "serv-2"},
+		}},
+	}
+
+	a.Equal([]*OwnedNamespace{
+		{Name: "ns", Services: []*ServiceState{
+			{Namespace: "ns", Name: "serv-1", Endpoints: []*serego.Endpoint{ep("serv-1", "ep-1"), ep("serv-1", "ep-2")}},
+			{Namespace: "ns", Name: "serv-2"},
+		}},
+		{Name: "empty", Services: []*ServiceState{}},
+	}, mergeOwnedNamespaces(etcd, cloudMap))
+	a.Empty(mergeOwnedNamespaces())
+}
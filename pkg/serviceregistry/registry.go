@@ -0,0 +1,260 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package serviceregistry
+
+import (
+	"context"
+
+	serego "github.com/CloudNativeSDWAN/serego/api/core"
+	stypes "github.com/CloudNativeSDWAN/serego/api/core/types"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+)
+
+// Registry is a service registry where namespaces, services and endpoints
+// are registered.
+//
+// Implementations must behave like serego does: Get returns an error that
+// satisfies serego's errors.IsNotFound if the object does not exist,
+// Register creates or updates the object according to the register options,
+// Deregister does not fail if the object does not exist and iterators return
+// an error that satisfies serego's errors.IsIteratorDone when there are no
+// more objects. An empty name, i.e. serego's core.Any, is only used to list
+// objects.
+type Registry interface {
+	Namespace(name string) NamespaceOperation
+}
+
+// NamespaceOperation performs operations on a namespace of a Registry.
+type NamespaceOperation interface {
+	Get(ctx context.Context) (*stypes.Namespace, error)
+	Register(ctx context.Context, opts ...register.Option) error
+	Deregister(ctx context.Context) error
+	List() NamespaceIterator
+	Service(name string) ServiceOperation
+}
+
+// NamespaceIterator iterates over the namespaces of a Registry.
+type NamespaceIterator interface {
+	Next(ctx context.Context) (*stypes.Namespace, NamespaceOperation, error)
+}
+
+// ServiceOperation performs operations on a service of a Registry.
+type ServiceOperation interface {
+	Get(ctx context.Context) (*stypes.Service, error)
+	Register(ctx context.Context, opts ...register.Option) error
+	Deregister(ctx context.Context) error
+	List() ServiceIterator
+	Endpoint(name string) EndpointOperation
+}
+
+// ServiceIterator iterates over the services of a namespace.
+type ServiceIterator interface {
+	Next(ctx context.Context) (*stypes.Service, ServiceOperation, error)
+}
+
+// EndpointOperation performs operations on an endpoint of a Registry.
+type EndpointOperation interface {
+	Get(ctx context.Context) (*stypes.Endpoint, error)
+	Register(ctx context.Context, opts ...register.Option) error
+	Deregister(ctx context.Context) error
+	List() EndpointIterator
+}
+
+// EndpointIterator iterates over the endpoints of a service.
+type EndpointIterator interface {
+	Next(ctx context.Context) (*stypes.Endpoint, EndpointOperation, error)
+}
+
+// NewSeregoRegistry returns a Registry that performs all operations with the
+// provided serego client, i.e. on etcd, Service Directory or Cloud Map.
+func NewSeregoRegistry(client *serego.ServiceRegistry) Registry {
+	return &seregoRegistry{client: client}
+}
+
+type seregoRegistry struct {
+	client *serego.ServiceRegistry
+}
+
+func (s *seregoRegistry) Namespace(name string) NamespaceOperation {
+	return &seregoNamespace{s.client.Namespace(name)}
+}
+
+type seregoNamespace struct {
+	*serego.NamespaceOperation
+}
+
+func (s *seregoNamespace) Get(ctx context.Context) (*stypes.Namespace, error) {
+	return s.NamespaceOperation.Get(ctx)
+}
+
+func (s *seregoNamespace) Deregister(ctx context.Context) error {
+	return s.NamespaceOperation.Deregister(ctx)
+}
+
+func (s *seregoNamespace) List() NamespaceIterator {
+	return &seregoNamespaceIterator{s.NamespaceOperation.List()}
+}
+
+func (s *seregoNamespace) Service(name string) ServiceOperation {
+	return &seregoService{s.NamespaceOperation.Service(name)}
+}
+
+type seregoNamespaceIterator struct {
+	*serego.NamespacesIterator
+}
+
+func (s *seregoNamespaceIterator) Next(ctx context.Context) (*stypes.Namespace, NamespaceOperation, error) {
+	ns, nsop, err := s.NamespacesIterator.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ns, &seregoNamespace{nsop}, nil
+}
+
+type seregoService struct {
+	*serego.ServiceOperation
+}
+
+func (s *seregoService) Get(ctx context.Context) (*stypes.Service, error) {
+	return s.ServiceOperation.Get(ctx)
+}
+
+func (s *seregoService) Deregister(ctx context.Context) error {
+	return s.ServiceOperation.Deregister(ctx)
+}
+
+func (s *seregoService) List() ServiceIterator {
+	return &seregoServiceIterator{s.ServiceOperation.List()}
+}
+
+func (s *seregoService) Endpoint(name string) EndpointOperation {
+	return &seregoEndpoint{s.ServiceOperation.Endpoint(name)}
+}
+
+type seregoServiceIterator struct {
+	*serego.ServicesIterator
+}
+
+func (s *seregoServiceIterator) Next(ctx context.Context) (*stypes.Service, ServiceOperation, error) {
+	serv, sop, err := s.ServicesIterator.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return serv, &seregoService{sop}, nil
+}
+
+type seregoEndpoint struct {
+	*serego.EndpointOperation
+}
+
+func (s *seregoEndpoint) Get(ctx context.Context) (*stypes.Endpoint, error) {
+	return s.EndpointOperation.Get(ctx)
+}
+
+func (s *seregoEndpoint) Deregister(ctx context.Context) error {
+	return s.EndpointOperation.Deregister(ctx)
+}
+
+func (s *seregoEndpoint) List() EndpointIterator {
+	return &seregoEndpointIterator{s.EndpointOperation.List()}
+}
+
+type seregoEndpointIterator struct {
+	*serego.EndpointsIterator
+}
+
+func (s *seregoEndpointIterator) Next(ctx context.Context) (*stypes.Endpoint, EndpointOperation, error) {
+	ep, epop, err := s.EndpointsIterator.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ep, &seregoEndpoint{epop}, nil
+}
+
+// PrepareRegister applies the provided options and returns them, along with
+// the metadata that an object that currently has currMeta must have. It is
+// meant for implementations of Registry that need to handle the register
+// options on their own.
+//
+// errNotFound and errAlreadyExists are returned when the object does not
+// exist in update mode and when it exists in create mode, respectively.
+func PrepareRegister(opts []register.Option, currMeta map[string]string, exists bool, errNotFound, errAlreadyExists error) (*register.Options, map[string]string, error) {
+	regOpts := &register.Options{}
+	for _, opt := range opts {
+		if err := opt(regOpts); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	switch {
+	case regOpts.RegisterMode == register.CreateMode && exists:
+		return nil, nil, errAlreadyExists
+	case regOpts.RegisterMode == register.UpdateMode && !exists:
+		return nil, nil, errNotFound
+	}
+
+	metadata := map[string]string{}
+	if !regOpts.ReplaceMetadata {
+		for k, v := range currMeta {
+			metadata[k] = v
+		}
+	}
+	for k, v := range regOpts.Metadata {
+		metadata[k] = v
+	}
+
+	return regOpts, metadata, nil
+}
+
+// Lister lists objects the first time that Next is called, and then returns
+// them one at a time. It is meant for implementing the iterators of a
+// Registry.
+type Lister[T any] struct {
+	list   func(ctx context.Context) ([]T, error)
+	items  []T
+	listed bool
+}
+
+// NewLister returns a Lister that lists objects with the provided function.
+func NewLister[T any](list func(ctx context.Context) ([]T, error)) *Lister[T] {
+	return &Lister[T]{list: list}
+}
+
+// Next returns the next object, or an error that satisfies serego's
+// errors.IsIteratorDone if there are no more objects.
+func (l *Lister[T]) Next(ctx context.Context) (item T, err error) {
+	if !l.listed {
+		items, err := l.list(ctx)
+		if err != nil {
+			return item, err
+		}
+		l.items, l.listed = items, true
+	}
+
+	if len(l.items) == 0 {
+		return item, serrors.IteratorDone
+	}
+
+	item, l.items = l.items[0], l.items[1:]
+	return item, nil
+}
@@ -19,7 +19,40 @@
 package serviceregistry
 
 import (
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
 	serego "github.com/CloudNativeSDWAN/serego/api/core/types"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+)
+
+const (
+	ownerKey   string = "owner"
+	ownerValue string = "cnwan-operator"
+	// clusterIDKey is the metadata key containing the ID of the cluster that
+	// registered an endpoint.
+	clusterIDKey string = "cnwan.io/cluster-id"
+	// clustersKey is the metadata key containing the space-separated IDs of
+	// all the clusters that are using a namespace or a service, which can be
+	// shared among clusters.
+	clustersKey string = "cnwan.io/clusters"
+	// metadataKeysKey is the metadata key containing the space-separated
+	// keys of the metadata that the operator registered on a namespace or a
+	// service, so that they can be removed when they are not desired
+	// anymore.
+	metadataKeysKey string = "cnwan.io/metadata-keys"
+	// kindKey is the metadata key containing the kind of the Kubernetes
+	// object that a service was registered for, if it is not a Kubernetes
+	// service.
+	kindKey string = "cnwan.io/kind"
+	// listSeparator separates the values of metadata containing lists. It
+	// is a space rather than a comma, as commas are not allowed in the
+	// values of AWS tags -- and therefore of the metadata of namespaces and
+	// services on Cloud Map.
+	listSeparator string = " "
 )
 
 func getNamespaceNameFromEventObject(event *Event) string {
@@ -30,12 +63,215 @@ func getNamespaceNameFromEventObject(event *Event) string {
 		return parsedObject.Namespace
 	case *serego.Endpoint:
 		return parsedObject.Namespace
+	case *ServiceState:
+		return parsedObject.Namespace
+	default:
+		return ""
+	}
+}
+
+// getEventObjectKey returns the path of the object of the event, e.g.
+// ns/serv for a service, so that events about the same object have the same
+// key.
+func getEventObjectKey(event *Event) string {
+	switch parsedObject := event.Object.(type) {
+	case *serego.Namespace:
+		return parsedObject.Name
+	case *serego.Service:
+		return parsedObject.Namespace + "/" + parsedObject.Name
+	case *serego.Endpoint:
+		return parsedObject.Namespace + "/" + parsedObject.Service + "/" + parsedObject.Name
+	case *ServiceState:
+		return parsedObject.Namespace + "/" + parsedObject.Name
 	default:
 		return ""
 	}
 }
 
+// isEmptySync returns true if the event syncs a service that must not be on
+// the service registry at all.
+func isEmptySync(event *Event) bool {
+	state, ok := event.Object.(*ServiceState)
+	return ok && event.EventType == EventSync && len(state.Endpoints) == 0
+}
+
 func isOwnedByOperator(metadata map[string]string) bool {
-	owned, exists := metadata["owner"]
-	return exists && owned == "cnwan-operator"
+	owned, exists := metadata[ownerKey]
+	return exists && owned == ownerValue
+}
+
+// isOwnedByCluster returns true if the endpoint with the provided metadata
+// was registered by the operator running in the provided cluster.
+//
+// Endpoints registered by older versions of the operator do not have any
+// cluster ID and are considered as owned by any cluster.
+func isOwnedByCluster(metadata map[string]string, clusterID string) bool {
+	if !isOwnedByOperator(metadata) {
+		return false
+	}
+
+	owner, exists := metadata[clusterIDKey]
+	return !exists || clusterID == "" || owner == clusterID
+}
+
+// isReferencedByCluster returns true if the namespace or service with the
+// provided metadata is used by the operator running in the provided cluster.
+//
+// Objects registered by older versions of the operator do not have any
+// cluster reference and are considered as used by any cluster.
+func isReferencedByCluster(metadata map[string]string, clusterID string) bool {
+	if !isOwnedByOperator(metadata) {
+		return false
+	}
+
+	if _, exists := metadata[clustersKey]; !exists || clusterID == "" {
+		return true
+	}
+
+	for _, cluster := range getClusterReferences(metadata) {
+		if cluster == clusterID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getClusterReferences(metadata map[string]string) []string {
+	return splitList(metadata[clustersKey])
+}
+
+// addClusterReference returns the value for the clusters key with the
+// provided cluster ID added to the ones in metadata.
+func addClusterReference(metadata map[string]string, clusterID string) string {
+	clusters := map[string]bool{}
+	if clusterID != "" {
+		clusters[clusterID] = true
+	}
+	for _, cluster := range getClusterReferences(metadata) {
+		clusters[cluster] = true
+	}
+
+	return joinClusterReferences(clusters)
+}
+
+// removeClusterReference returns the value for the clusters key with the
+// provided cluster ID removed from the ones in metadata.
+func removeClusterReference(metadata map[string]string, clusterID string) string {
+	clusters := map[string]bool{}
+	for _, cluster := range getClusterReferences(metadata) {
+		if cluster != clusterID {
+			clusters[cluster] = true
+		}
+	}
+
+	return joinClusterReferences(clusters)
+}
+
+func joinClusterReferences(clusters map[string]bool) string {
+	list := []string{}
+	for cluster := range clusters {
+		list = append(list, cluster)
+	}
+
+	sort.Strings(list)
+	return strings.Join(list, listSeparator)
+}
+
+// splitList returns the non-empty values of a metadata containing a list.
+// Values separated by commas, as registered by previous versions of the
+// operator, are split as well.
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// replaceManagedMetadata returns a copy of the provided metadata of a
+// namespace or service, where the metadata that the operator previously
+// registered is replaced with the provided one.
+func replaceManagedMetadata(currMeta, metadata map[string]string) map[string]string {
+	next := map[string]string{}
+	for k, v := range currMeta {
+		next[k] = v
+	}
+	for _, key := range splitList(currMeta[metadataKeysKey]) {
+		delete(next, key)
+	}
+	delete(next, metadataKeysKey)
+
+	keys := []string{}
+	for k, v := range metadata {
+		next[k] = v
+		keys = append(keys, k)
+	}
+	if len(keys) > 0 {
+		sort.Strings(keys)
+		next[metadataKeysKey] = strings.Join(keys, listSeparator)
+	}
+
+	return next
+}
+
+// isMetadataChanged returns true if the two metadata are different, treating
+// nil and empty metadata as equal.
+func isMetadataChanged(registered, desired map[string]string) bool {
+	if len(registered) == 0 && len(desired) == 0 {
+		return false
+	}
+
+	return !reflect.DeepEqual(registered, desired)
+}
+
+// getKindName returns the name of the provided kind of Kubernetes objects,
+// as it appears in the kind metadata of a service.
+func getKindName(kind string) string {
+	if kind == "" {
+		return "Service"
+	}
+
+	return kind
+}
+
+func getEndpointsMap(endpoints []*serego.Endpoint) map[string]*serego.Endpoint {
+	epMap := map[string]*serego.Endpoint{}
+	for _, ep := range endpoints {
+		epMap[ep.Name] = ep
+	}
+	return epMap
+}
+
+// isEndpointChanged returns true if the endpoint currently registered on
+// the service registry differs from the desired one, i.e. if it does not
+// exist, or if its address, port or metadata -- including the ones that are
+// registered on all endpoints -- are different.
+func isEndpointChanged(registered, desired *serego.Endpoint, endpointMeta map[string]string) bool {
+	if registered == nil {
+		return true
+	}
+
+	desiredMeta := map[string]string{}
+	for k, v := range desired.Metadata {
+		desiredMeta[k] = v
+	}
+	for k, v := range endpointMeta {
+		desiredMeta[k] = v
+	}
+
+	return registered.Address != desired.Address ||
+		registered.Port != desired.Port ||
+		!reflect.DeepEqual(registered.Metadata, desiredMeta)
+}
+
+// withAddress is like register.WithAddress, which only accepts IPs, but also
+// accepts hostnames, as they are registered as they are if so configured.
+func withAddress(address string) register.Option {
+	if address == "" || net.ParseIP(address) != nil {
+		return register.WithAddress(address)
+	}
+
+	return func(opts *register.Options) error {
+		opts.Address = &address
+		return nil
+	}
 }
@@ -0,0 +1,218 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package serviceregistry
+
+import (
+	"testing"
+
+	serego "github.com/CloudNativeSDWAN/serego/api/core/types"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsEndpointChanged(t *testing.T) {
+	persistentMeta := map[string]string{"owner": "cnwan-operator"}
+	desired := &serego.Endpoint{
+		Name:     "ep",
+		Address:  "10.10.10.10",
+		Port:     80,
+		Metadata: map[string]string{"version": "v1"},
+	}
+
+	cases := []struct {
+		id         string
+		registered *serego.Endpoint
+		expRes     bool
+	}{
+		{
+			id:     "not-registered",
+			expRes: true,
+		},
+		{
+			id: "different-address",
+			registered: &serego.Endpoint{
+				Name:     "ep",
+				Address:  "10.10.10.11",
+				Port:     80,
+				Metadata: map[string]string{"version": "v1", "owner": "cnwan-operator"},
+			},
+			expRes: true,
+		},
+		{
+			id: "stale-metadata",
+			registered: &serego.Endpoint{
+				Name:     "ep",
+				Address:  "10.10.10.10",
+				Port:     80,
+				Metadata: map[string]string{"version": "v1", "stale": "yes", "owner": "cnwan-operator"},
+			},
+			expRes: true,
+		},
+		{
+			id: "unchanged",
+			registered: &serego.Endpoint{
+				Name:     "ep",
+				Address:  "10.10.10.10",
+				Port:     80,
+				Metadata: map[string]string{"version": "v1", "owner": "cnwan-operator"},
+			},
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		a.Equal(currCase.expRes, isEndpointChanged(currCase.registered, desired, persistentMeta), currCase.id)
+	}
+}
+
+func TestIsReferencedByCluster(t *testing.T) {
+	cases := []struct {
+		id       string
+		metadata map[string]string
+		expRes   bool
+	}{
+		{
+			id:       "not-owned",
+			metadata: map[string]string{clustersKey: "one"},
+		},
+		{
+			id:       "legacy",
+			metadata: map[string]string{ownerKey: ownerValue},
+			expRes:   true,
+		},
+		{
+			id:       "other-clusters",
+			metadata: map[string]string{ownerKey: ownerValue, clustersKey: "two three"},
+		},
+		{
+			id:       "referenced",
+			metadata: map[string]string{ownerKey: ownerValue, clustersKey: "one two"},
+			expRes:   true,
+		},
+		{
+			id:       "referenced-legacy-list",
+			metadata: map[string]string{ownerKey: ownerValue, clustersKey: "one,two"},
+			expRes:   true,
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		a.Equal(currCase.expRes, isReferencedByCluster(currCase.metadata, "one"), currCase.id)
+	}
+}
+
+func TestIsOwnedByCluster(t *testing.T) {
+	cases := []struct {
+		id       string
+		metadata map[string]string
+		expRes   bool
+	}{
+		{
+			id:       "not-owned",
+			metadata: map[string]string{clusterIDKey: "one"},
+		},
+		{
+			id:       "legacy",
+			metadata: map[string]string{ownerKey: ownerValue},
+			expRes:   true,
+		},
+		{
+			id:       "other-cluster",
+			metadata: map[string]string{ownerKey: ownerValue, clusterIDKey: "two"},
+		},
+		{
+			id:       "owned",
+			metadata: map[string]string{ownerKey: ownerValue, clusterIDKey: "one"},
+			expRes:   true,
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		a.Equal(currCase.expRes, isOwnedByCluster(currCase.metadata, "one"), currCase.id)
+	}
+}
+
+func TestClusterReferences(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("one", addClusterReference(map[string]string{}, "one"))
+	a.Equal("one two", addClusterReference(map[string]string{clustersKey: "two"}, "one"))
+	a.Equal("one two", addClusterReference(map[string]string{clustersKey: "one two"}, "one"))
+	a.Equal("", removeClusterReference(map[string]string{clustersKey: "one"}, "one"))
+	a.Equal("three two", removeClusterReference(map[string]string{clustersKey: "two one three"}, "one"))
+
+	// Lists registered by previous versions are separated by commas.
+	a.Equal("one three two", addClusterReference(map[string]string{clustersKey: "two,three"}, "one"))
+	a.Equal("three two", removeClusterReference(map[string]string{clustersKey: "two,one,three"}, "one"))
+}
+
+func TestReplaceManagedMetadata(t *testing.T) {
+	cases := []struct {
+		id       string
+		currMeta map[string]string
+		metadata map[string]string
+		expRes   map[string]string
+	}{
+		{
+			id:       "not-registered",
+			metadata: map[string]string{"version": "v1", "team": "shop"},
+			expRes:   map[string]string{"version": "v1", "team": "shop", metadataKeysKey: "team version"},
+		},
+		{
+			id:       "replace-managed",
+			currMeta: map[string]string{"owner": "cnwan-operator", "version": "v1", "stale": "yes", "other": "tool", metadataKeysKey: "stale version"},
+			metadata: map[string]string{"version": "v2"},
+			expRes:   map[string]string{"owner": "cnwan-operator", "version": "v2", "other": "tool", metadataKeysKey: "version"},
+		},
+		{
+			id:       "remove-managed",
+			currMeta: map[string]string{"owner": "cnwan-operator", "version": "v1", metadataKeysKey: "version"},
+			metadata: map[string]string{},
+			expRes:   map[string]string{"owner": "cnwan-operator"},
+		},
+		{
+			id:       "legacy-list",
+			currMeta: map[string]string{"owner": "cnwan-operator", "version": "v1", "stale": "yes", metadataKeysKey: "stale,version"},
+			metadata: map[string]string{"version": "v2"},
+			expRes:   map[string]string{"owner": "cnwan-operator", "version": "v2", metadataKeysKey: "version"},
+		},
+		{
+			id:       "empty-list",
+			currMeta: map[string]string{"owner": "cnwan-operator", "": "empty", metadataKeysKey: ""},
+			metadata: map[string]string{"version": "v1"},
+			expRes:   map[string]string{"owner": "cnwan-operator", "": "empty", "version": "v1", metadataKeysKey: "version"},
+		},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		a.Equal(currCase.expRes, replaceManagedMetadata(currCase.currMeta, currCase.metadata), currCase.id)
+	}
+}
+
+func TestWithAddress(t *testing.T) {
+	a := assert.New(t)
+	for _, address := range []string{"", "10.10.10.10", "2001:db8::1", "lb.example.com"} {
+		opts := &register.Options{}
+		a.NoError(withAddress(address)(opts))
+		a.Equal(address, *opts.Address)
+	}
+}
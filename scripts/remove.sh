@@ -34,5 +34,6 @@ kubectl delete clusterrole cnwan-operator-cluster-role
 kubectl delete serviceaccount cnwan-operator-service-account -n cnwan-operator-system
 kubectl delete configmap cnwan-operator-settings -n cnwan-operator-system
 kubectl delete namespace cnwan-operator-system
+kubectl delete -f $DEPLOY_DIR/crds || true
 
 print_success
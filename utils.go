@@ -21,17 +21,29 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
 
 	sd "cloud.google.com/go/servicedirectory/apiv1"
+	"github.com/CloudNativeSDWAN/cnwan-operator/api/v1alpha1"
 	"github.com/CloudNativeSDWAN/cnwan-operator/internal/types"
 	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/cluster"
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry/consul"
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry/dns"
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry/kubernetes"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/servicediscovery"
+	"github.com/rs/zerolog"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	etcdns "go.etcd.io/etcd/client/v3/namespace"
 	"google.golang.org/api/option"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func getNetworkCfg(network, subnetwork *string) (netCfg *cluster.NetworkConfiguration, err error) {
@@ -76,6 +88,37 @@ func getNetworkCfg(network, subnetwork *string) (netCfg *cluster.NetworkConfigur
 	return
 }
 
+// getClusterID returns the cluster ID provided in settings or, if empty or
+// "auto", attempts to detect it from the managed platform. If this is not
+// possible, the UID of the kube-system namespace is used instead.
+func getClusterID(ctx context.Context, clusterID string) (string, error) {
+	if clusterID != "" && strings.ToLower(clusterID) != "auto" {
+		return clusterID, nil
+	}
+
+	var (
+		detectedID string
+		err        error
+	)
+	switch cluster.WhereAmIRunning() {
+	case cluster.GKECluster:
+		detectedID, err = cluster.GetClusterIDFromGKE(ctx)
+	case cluster.EKSCluster:
+		detectedID, err = cluster.GetClusterIDFromEKS(ctx)
+	}
+
+	if err == nil && detectedID != "" {
+		return detectedID, nil
+	}
+
+	if err != nil {
+		log.Err(err).Msg("could not get cluster ID from managed cluster: " +
+			"falling back to kube-system namespace UID")
+	}
+
+	return cluster.GetClusterUID(ctx)
+}
+
 func getGSDClient(ctx context.Context) (*sd.RegistrationClient, error) {
 	// TODO: next versions will have a flag parsing system. Therefore this will
 	// need a change in case service account is provided somewhere else.
@@ -184,7 +227,7 @@ func parseAndResetGSDSettings(gcSettings *types.ServiceDirectorySettings) (*type
 	return newSettings, nil
 }
 
-func getEtcdClient(settings *types.EtcdSettings) (*clientv3.Client, error) {
+func getEtcdClient(mainCtx context.Context, settings *types.EtcdSettings) (*clientv3.Client, error) {
 	endps := []string{}
 
 	for _, endp := range settings.Endpoints {
@@ -195,13 +238,14 @@ func getEtcdClient(settings *types.EtcdSettings) (*clientv3.Client, error) {
 	}
 
 	if settings.Authentication == types.EtcdAuthWithNothing {
-		return clientv3.New(cfg)
+		return newEtcdClientWithPrefix(cfg, settings.Prefix)
 	}
 
-	ctx, canc := context.WithTimeout(context.Background(), time.Duration(15)*time.Second)
+	ctx, canc := context.WithTimeout(mainCtx, time.Duration(15)*time.Second)
 	defer canc()
 
-	if settings.Authentication == types.EtcdAuthWithUsernamePassw {
+	switch settings.Authentication {
+	case types.EtcdAuthWithUsernamePassw, types.EtcdAuthWithTLSAndUsernamePassw:
 		user, pass, err := cluster.GetEtcdCredentialsSecret(ctx)
 		if err != nil {
 			return nil, err
@@ -213,12 +257,180 @@ func getEtcdClient(settings *types.EtcdSettings) (*clientv3.Client, error) {
 		if len(pass) > 0 {
 			cfg.Password = string(pass)
 		}
+	}
+
+	switch settings.Authentication {
+	case types.EtcdAuthWithTLS, types.EtcdAuthWithTLSAndUsernamePassw:
+		tlsCfg, err := cluster.NewEtcdTLSConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load etcd TLS certificates: %w", err)
+		}
 
-		cfg.Endpoints = endps
-		return clientv3.New(cfg)
+		cfg.TLS = tlsCfg.TLSConfig()
+		go reloadEtcdTLSCertificates(mainCtx, tlsCfg)
 	}
 
-	// TODO: support for TLS: if authentication is through TLS if Username and Password are both nil, then look
-	// for the secrets containing the client's certificate and and key.
-	return nil, fmt.Errorf("unsupported etcd authentication method")
+	return newEtcdClientWithPrefix(cfg, settings.Prefix)
+}
+
+// getConsulRegistry returns a service registry on Consul, reading the ACL
+// token and the TLS certificates from their secrets if needed.
+func getConsulRegistry(mainCtx context.Context, settings *types.ConsulSettings) (*consul.Registry, error) {
+	ctx, canc := context.WithTimeout(mainCtx, time.Duration(15)*time.Second)
+	defer canc()
+
+	cfg := consul.Config{
+		Address:    settings.Address,
+		Datacenter: settings.Datacenter,
+		Node:       settings.Node,
+		Prefix:     settings.Prefix,
+	}
+
+	if settings.Authentication == types.ConsulAuthWithACLToken {
+		token, err := cluster.GetConsulACLTokenSecret(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Token = token
+	}
+
+	if settings.TLS {
+		tlsCfg, err := cluster.NewConsulTLSConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load consul TLS certificates: %w", err)
+		}
+		cfg.TLSConfig = tlsCfg
+	}
+
+	return consul.New(cfg)
+}
+
+// getDNSRegistry returns a service registry on a DNS server, reading the
+// TSIG key from its secret if needed.
+func getDNSRegistry(mainCtx context.Context, settings *types.DNSSettings) (*dns.Registry, error) {
+	cfg := dns.Config{
+		Server:        settings.Server,
+		Zone:          settings.Zone,
+		TTL:           settings.TTL,
+		TSIGAlgorithm: settings.TSIGAlgorithm,
+	}
+
+	if settings.Authentication == types.DNSAuthWithTSIG {
+		ctx, canc := context.WithTimeout(mainCtx, time.Duration(15)*time.Second)
+		defer canc()
+
+		name, secret, err := cluster.GetDNSTSIGSecret(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cfg.TSIGKeyName, cfg.TSIGSecret = name, secret
+	}
+
+	return dns.New(cfg)
+}
+
+// newLogger returns the logger of the operator, writing to out.
+func newLogger(out io.Writer) zerolog.Logger {
+	return zerolog.New(zerolog.ConsoleWriter{Out: out}).With().Timestamp().Logger()
+}
+
+// openDryRunOutput returns where the registries in dry run write the
+// operations they do not perform, if anywhere, and a function to close it.
+//
+// If the output is stdout, the logger is moved to stderr, so that stdout
+// only contains the operations.
+func openDryRunOutput(output string) (io.Writer, func() error, error) {
+	switch output {
+	case "":
+		return nil, func() error { return nil }, nil
+	case types.DryRunOutputStdout:
+		log = newLogger(os.Stderr)
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	file, err := os.OpenFile(output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, file.Close, nil
+}
+
+// getKubernetesRegistry returns a service registry on Kubernetes custom
+// resources, either on the cluster where the operator runs or on the one
+// whose kubeconfig is in the provided secret.
+func getKubernetesRegistry(mainCtx context.Context, settings *types.KubernetesSettings) (*kubernetes.Registry, error) {
+	var (
+		k8sconf *rest.Config
+		err     error
+	)
+
+	if settings.KubeconfigSecret == "" {
+		k8sconf, err = ctrl.GetConfig()
+	} else {
+		ctx, canc := context.WithTimeout(mainCtx, time.Duration(15)*time.Second)
+		defer canc()
+
+		kubeconfig, kerr := cluster.GetKubeconfigSecret(ctx, settings.KubeconfigSecret)
+		if kerr != nil {
+			return nil, kerr
+		}
+		k8sconf, err = clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load kubernetes configuration: %w", err)
+	}
+
+	scheme := k8sruntime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	cli, err := client.New(k8sconf, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.New(cli, settings.Namespace), nil
+}
+
+// newEtcdClientWithPrefix returns a new etcd client that prepends the
+// provided prefix to all the keys it reads and writes. No prefix is used if
+// it is nil or just a slash, so that installations that did not set any
+// prefix keep using the same keys as previous versions.
+func newEtcdClientWithPrefix(cfg clientv3.Config, prefix *string) (*clientv3.Client, error) {
+	cli, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix == nil || *prefix == "/" {
+		return cli, nil
+	}
+
+	cli.KV = etcdns.NewKV(cli.KV, *prefix)
+	cli.Watcher = etcdns.NewWatcher(cli.Watcher, *prefix)
+	cli.Lease = etcdns.NewLease(cli.Lease, *prefix)
+	return cli, nil
+}
+
+// reloadEtcdTLSCertificates periodically loads the etcd TLS certificates
+// from their secret, so that rotated certificates are used without having
+// to restart the operator.
+func reloadEtcdTLSCertificates(ctx context.Context, tlsCfg *cluster.EtcdTLSConfig) {
+	ticker := time.NewTicker(etcdTLSReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloadCtx, canc := context.WithTimeout(ctx, 15*time.Second)
+			if err := tlsCfg.Reload(reloadCtx); err != nil {
+				log.Err(err).Msg("cannot reload etcd TLS certificates, keeping the current ones...")
+			}
+			canc()
+		}
+	}
 }
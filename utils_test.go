@@ -0,0 +1,135 @@
+// Copyright © 2023 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-operator/internal/types"
+	"github.com/CloudNativeSDWAN/cnwan-operator/pkg/serviceregistry"
+	stypes "github.com/CloudNativeSDWAN/serego/api/core/types"
+	serrors "github.com/CloudNativeSDWAN/serego/api/errors"
+	"github.com/CloudNativeSDWAN/serego/api/options/register"
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// emptyRegistry is a registry without any namespace.
+type emptyRegistry struct {
+	serviceregistry.NamespaceOperation
+}
+
+func (e *emptyRegistry) Namespace(_ string) serviceregistry.NamespaceOperation {
+	return e
+}
+
+func (e *emptyRegistry) Get(_ context.Context) (*stypes.Namespace, error) {
+	return nil, serrors.NamespaceNotFound
+}
+
+func TestOpenDryRunOutputStdout(t *testing.T) {
+	a := assert.New(t)
+
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if !a.NoError(err) {
+		a.FailNow("cannot create pipe")
+	}
+	stderrReader, stderrWriter, err := os.Pipe()
+	if !a.NoError(err) {
+		a.FailNow("cannot create pipe")
+	}
+
+	prevStdout, prevStderr, prevLog := os.Stdout, os.Stderr, log
+	defer func() {
+		os.Stdout, os.Stderr, log = prevStdout, prevStderr, prevLog
+	}()
+	os.Stdout, os.Stderr = stdoutWriter, stderrWriter
+	log = newLogger(os.Stdout)
+
+	stdout, stderr := make(chan []string), make(chan []string)
+	readLines := func(r io.Reader, lines chan<- []string) {
+		read := []string{}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			read = append(read, scanner.Text())
+		}
+		lines <- read
+	}
+	go readLines(stdoutReader, stdout)
+	go readLines(stderrReader, stderr)
+
+	out, closeOut, err := openDryRunOutput(types.DryRunOutputStdout)
+	if !a.NoError(err) {
+		a.FailNow("cannot open dry run output")
+	}
+
+	ctx := context.Background()
+	reg := serviceregistry.NewDryRunRegistry(&emptyRegistry{}, "etcd", out, log)
+	a.NoError(reg.Namespace("ns").Register(ctx, register.WithMetadata(map[string]string{"owner": "cnwan-operator"})))
+	a.NoError(reg.Namespace("ns").Deregister(ctx))
+	log.Info().Msg("done")
+
+	a.NoError(closeOut())
+	stdoutWriter.Close()
+	stderrWriter.Close()
+
+	outLines, errLines := <-stdout, <-stderr
+	a.Len(outLines, 2)
+	for _, line := range outLines {
+		a.True(json.Valid([]byte(line)), line)
+	}
+	a.Len(errLines, 3)
+	a.True(strings.HasSuffix(errLines[2], "done"))
+}
+
+func TestNewEtcdClientWithPrefix(t *testing.T) {
+	prefix, root := "/service-registry", "/"
+	cases := []struct {
+		id        string
+		prefix    *string
+		expPrefix bool
+	}{
+		{id: "no-prefix"},
+		{id: "root", prefix: &root},
+		{id: "prefix", prefix: &prefix, expPrefix: true},
+	}
+
+	a := assert.New(t)
+	for _, currCase := range cases {
+		cli, err := newEtcdClientWithPrefix(clientv3.Config{Endpoints: []string{"localhost:2379"}}, currCase.prefix)
+		if !a.NoError(err) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+
+		// Keys are only prefixed if the KV is wrapped.
+		isPrefixed := reflect.TypeOf(cli.KV) != reflect.TypeOf(clientv3.NewKV(cli))
+		cli.Close()
+		if !a.Equal(currCase.expPrefix, isPrefixed) {
+			a.FailNow(fmt.Sprintf("case %s failed", currCase.id))
+		}
+	}
+}